@@ -54,7 +54,7 @@ func (s *metricFamilyProcessorScenario) test(t *testing.T, set int) {
 		sort.Sort(expected)
 
 		if !expected.Equal(s.actual[i]) {
-			t.Errorf("%d.%d. expected %s, got %s", set, i, expected, s.actual[i])
+			t.Errorf("%d.%d. expected %v, got %v", set, i, expected, s.actual[i])
 		}
 	}
 }
@@ -60,7 +60,7 @@ func (s *testProcessor001ProcessScenario) test(t testing.TB, set int) {
 		sort.Sort(expected)
 
 		if !expected.Equal(s.actual[i]) {
-			t.Errorf("%d.%d. expected %s, got %s", set, i, expected, s.actual[i])
+			t.Errorf("%d.%d. expected %v, got %v", set, i, expected, s.actual[i])
 		}
 	}
 }
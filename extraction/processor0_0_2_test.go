@@ -63,7 +63,7 @@ func (s *testProcessor002ProcessScenario) test(t testing.TB, set int) {
 		sort.Sort(expected)
 
 		if !expected.Equal(s.actual[i]) {
-			t.Fatalf("%d.%d. expected %s, got %s", set, i, expected, s.actual[i])
+			t.Fatalf("%d.%d. expected %v, got %v", set, i, expected, s.actual[i])
 		}
 	}
 }
@@ -94,7 +94,7 @@ func TestTextProcessor(t *testing.T) {
 		sort.Sort(expected)
 		sort.Sort(r)
 		if !expected.Equal(r) {
-			t.Errorf("expected %s, got %s", expected, r)
+			t.Errorf("expected %v, got %v", expected, r)
 		}
 	}
 }
@@ -0,0 +1,230 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationScheme determines how metric and label names are validated.
+type ValidationScheme int
+
+const (
+	// LegacyValidation only allows metric names matching
+	// [a-zA-Z_:][a-zA-Z0-9_:]* and label names matching
+	// [a-zA-Z_][a-zA-Z0-9_]*.
+	LegacyValidation ValidationScheme = iota
+	// UTF8Validation allows any non-empty, valid UTF-8 string as metric
+	// or label name. Names that would not pass LegacyValidation are
+	// quoted in the text-based exposition formats and have to be escaped
+	// for clients that do not support them, see EscapingScheme.
+	UTF8Validation
+)
+
+// NameValidationScheme is the ValidationScheme used by IsValidMetricName and
+// IsValidLabelName. It defaults to LegacyValidation. Set it to UTF8Validation
+// during initialization of the program to allow UTF-8 names. It must not be
+// changed concurrently with anything that validates names.
+var NameValidationScheme = LegacyValidation
+
+// IsValidMetricName returns whether name is a valid metric name according to
+// NameValidationScheme.
+func IsValidMetricName(name string) bool {
+	if NameValidationScheme == UTF8Validation {
+		return name != "" && utf8.ValidString(name)
+	}
+	return IsValidLegacyMetricName(name)
+}
+
+// IsValidLabelName returns whether name is a valid label name according to
+// NameValidationScheme. Note that label names starting with
+// ReservedLabelPrefix are valid label names but must not be used by clients.
+func IsValidLabelName(name string) bool {
+	if NameValidationScheme == UTF8Validation {
+		return name != "" && utf8.ValidString(name)
+	}
+	return IsValidLegacyLabelName(name)
+}
+
+// IsValidLegacyMetricName returns whether name is a valid metric name according
+// to LegacyValidation, independent of NameValidationScheme.
+func IsValidLegacyMetricName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !isValidLegacyRune(r, i, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsValidLegacyLabelName returns whether name is a valid label name according
+// to LegacyValidation, independent of NameValidationScheme.
+func IsValidLegacyLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if !isValidLegacyRune(r, i, false) {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidLegacyRune returns whether r is allowed at position i of a legacy
+// metric name (if allowColon is true) or label name (otherwise).
+func isValidLegacyRune(r rune, i int, allowColon bool) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' ||
+		(r >= '0' && r <= '9' && i > 0) || (r == ':' && allowColon)
+}
+
+// EscapingScheme determines how metric and label names that are not valid
+// according to LegacyValidation are escaped for clients that do not support
+// UTF-8 names.
+type EscapingScheme int
+
+const (
+	// NoEscaping leaves names unchanged. Only clients that support UTF-8
+	// names can consume them.
+	NoEscaping EscapingScheme = iota
+	// UnderscoreEscaping replaces each invalid character with an
+	// underscore. Different names might result in the same escaped name.
+	UnderscoreEscaping
+	// DotsEscaping replaces each dot with "_dot_", each underscore with
+	// "__", and each other invalid character with "__".
+	DotsEscaping
+	// ValueEncodingEscaping prefixes the name with "U__", replaces each
+	// underscore with "__", and replaces each other invalid character with
+	// its Unicode code point in hexadecimal enclosed in underscores, e.g.
+	// "_2e_" for a dot. It is reversible. Names that are valid according
+	// to LegacyValidation are not escaped at all.
+	ValueEncodingEscaping
+)
+
+// EscapingKey is the name of the parameter of the "Accept" and "Content-Type"
+// headers that states the EscapingScheme.
+const EscapingKey = "escaping"
+
+// The values of the EscapingKey parameter for the respective EscapingSchemes.
+const (
+	AllowUTF8         = "allow-utf-8"
+	EscapeUnderscores = "underscores"
+	EscapeDots        = "dots"
+	EscapeValues      = "values"
+)
+
+// NameEscapingScheme is the EscapingScheme applied to the names served to
+// clients that do not request an EscapingScheme explicitly. It defaults to
+// UnderscoreEscaping, as those clients cannot be expected to support UTF-8
+// names.
+var NameEscapingScheme = UnderscoreEscaping
+
+// String returns the value of the EscapingKey parameter for the scheme.
+func (s EscapingScheme) String() string {
+	switch s {
+	case NoEscaping:
+		return AllowUTF8
+	case UnderscoreEscaping:
+		return EscapeUnderscores
+	case DotsEscaping:
+		return EscapeDots
+	case ValueEncodingEscaping:
+		return EscapeValues
+	default:
+		return fmt.Sprintf("EscapingScheme(%d)", int(s))
+	}
+}
+
+// ToEscapingScheme returns the EscapingScheme for the provided value of the
+// EscapingKey parameter.
+func ToEscapingScheme(s string) (EscapingScheme, error) {
+	switch s {
+	case AllowUTF8:
+		return NoEscaping, nil
+	case EscapeUnderscores:
+		return UnderscoreEscaping, nil
+	case EscapeDots:
+		return DotsEscaping, nil
+	case EscapeValues:
+		return ValueEncodingEscaping, nil
+	default:
+		return NoEscaping, fmt.Errorf("unknown escaping scheme %q", s)
+	}
+}
+
+// EscapeMetricName escapes the provided metric name according to scheme. Names
+// that are valid according to LegacyValidation are returned unchanged.
+func EscapeMetricName(name string, scheme EscapingScheme) string {
+	return escapeName(name, scheme, true)
+}
+
+// EscapeLabelName escapes the provided label name according to scheme. Names
+// that are valid according to LegacyValidation are returned unchanged.
+func EscapeLabelName(name string, scheme EscapingScheme) string {
+	return escapeName(name, scheme, false)
+}
+
+func escapeName(name string, scheme EscapingScheme, allowColon bool) string {
+	if name == "" || scheme == NoEscaping {
+		return name
+	}
+	if allowColon && IsValidLegacyMetricName(name) ||
+		!allowColon && IsValidLegacyLabelName(name) {
+		return name
+	}
+	var escaped strings.Builder
+	switch scheme {
+	case UnderscoreEscaping:
+		for i, r := range name {
+			if isValidLegacyRune(r, i, allowColon) {
+				escaped.WriteRune(r)
+			} else {
+				escaped.WriteByte('_')
+			}
+		}
+	case DotsEscaping:
+		for i, r := range name {
+			switch {
+			case r == '_':
+				escaped.WriteString("__")
+			case r == '.':
+				escaped.WriteString("_dot_")
+			case isValidLegacyRune(r, i, allowColon):
+				escaped.WriteRune(r)
+			default:
+				escaped.WriteString("__")
+			}
+		}
+	case ValueEncodingEscaping:
+		escaped.WriteString("U__")
+		for i, r := range name {
+			switch {
+			case r == '_':
+				escaped.WriteString("__")
+			case isValidLegacyRune(r, i, allowColon):
+				escaped.WriteRune(r)
+			default:
+				fmt.Fprintf(&escaped, "_%x_", r)
+			}
+		}
+	default:
+		panic(fmt.Sprintf("invalid escaping scheme %d", scheme))
+	}
+	return escaped.String()
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "testing"
+
+func TestNameValidation(t *testing.T) {
+	defer func(s ValidationScheme) { NameValidationScheme = s }(NameValidationScheme)
+
+	var scenarios = []struct {
+		name                      string
+		legacyMetric, legacyLabel bool
+		utf8                      bool
+	}{
+		{"", false, false, false},
+		{"name", true, true, true},
+		{"_name_0", true, true, true},
+		{"name:sub", true, false, true},
+		{":name", true, false, true},
+		{"0name", false, false, true},
+		{"name.with.dots", false, false, true},
+		{"näme", false, false, true},
+		{"invalid\xff", false, false, false},
+	}
+
+	for i, s := range scenarios {
+		NameValidationScheme = LegacyValidation
+		if got := IsValidMetricName(s.name); got != s.legacyMetric {
+			t.Errorf("%d. legacy metric name %q: got %t, want %t", i, s.name, got, s.legacyMetric)
+		}
+		if got := IsValidLabelName(s.name); got != s.legacyLabel {
+			t.Errorf("%d. legacy label name %q: got %t, want %t", i, s.name, got, s.legacyLabel)
+		}
+		NameValidationScheme = UTF8Validation
+		if got := IsValidMetricName(s.name); got != s.utf8 {
+			t.Errorf("%d. UTF-8 metric name %q: got %t, want %t", i, s.name, got, s.utf8)
+		}
+		if got := IsValidLabelName(s.name); got != s.utf8 {
+			t.Errorf("%d. UTF-8 label name %q: got %t, want %t", i, s.name, got, s.utf8)
+		}
+		if got := IsValidLegacyMetricName(s.name); got != s.legacyMetric {
+			t.Errorf("%d. IsValidLegacyMetricName(%q): got %t, want %t", i, s.name, got, s.legacyMetric)
+		}
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	var scenarios = []struct {
+		name                      string
+		isLabel                   bool
+		underscores, dots, values string
+	}{
+		{"", false, "", "", ""},
+		{"no_escaping:needed", false, "no_escaping:needed", "no_escaping:needed", "no_escaping:needed"},
+		{"label:name", true, "label_name", "label__name", "U__label_3a_name"},
+		{"my.metric_name", false, "my_metric_name", "my_dot_metric__name", "U__my_2e_metric__name"},
+		{"0metric", false, "_metric", "__metric", "U___30_metric"},
+		{"mëtric", false, "m_tric", "m__tric", "U__m_eb_tric"},
+		{"a☃b", true, "a_b", "a__b", "U__a_2603_b"},
+	}
+
+	for i, s := range scenarios {
+		escape := EscapeMetricName
+		if s.isLabel {
+			escape = EscapeLabelName
+		}
+		if got := escape(s.name, NoEscaping); got != s.name {
+			t.Errorf("%d. %q with %s: got %q", i, s.name, NoEscaping, got)
+		}
+		for _, want := range []struct {
+			scheme  EscapingScheme
+			escaped string
+		}{
+			{UnderscoreEscaping, s.underscores},
+			{DotsEscaping, s.dots},
+			{ValueEncodingEscaping, s.values},
+		} {
+			if got := escape(s.name, want.scheme); got != want.escaped {
+				t.Errorf("%d. %q with %s: got %q, want %q", i, s.name, want.scheme, got, want.escaped)
+			}
+		}
+	}
+}
+
+func TestToEscapingScheme(t *testing.T) {
+	for _, scheme := range []EscapingScheme{
+		NoEscaping, UnderscoreEscaping, DotsEscaping, ValueEncodingEscaping,
+	} {
+		got, err := ToEscapingScheme(scheme.String())
+		if err != nil {
+			t.Errorf("%s: %s", scheme, err)
+		}
+		if got != scheme {
+			t.Errorf("got %s, want %s", got, scheme)
+		}
+	}
+	if _, err := ToEscapingScheme("unknown"); err == nil {
+		t.Error("expected error for unknown escaping scheme")
+	}
+}
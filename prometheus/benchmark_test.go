@@ -14,6 +14,7 @@
 package prometheus
 
 import (
+	"sync"
 	"testing"
 )
 
@@ -75,6 +76,70 @@ func BenchmarkCounterNoLabels(b *testing.B) {
 	}
 }
 
+// benchmarkConcurrently runs f b.N times, spread over the given number of
+// goroutines.
+func benchmarkConcurrently(b *testing.B, goroutines int, f func()) {
+	var wg sync.WaitGroup
+	b.ReportAllocs()
+	b.ResetTimer()
+	for g := 0; g < goroutines; g++ {
+		n := b.N / goroutines
+		if g < b.N%goroutines {
+			n++
+		}
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				f()
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+func BenchmarkCounterNoLabelsConcurrent(b *testing.B) {
+	m := NewCounter(CounterOpts{
+		Name: "benchmark_counter",
+		Help: "A counter to benchmark it.",
+	})
+	benchmarkConcurrently(b, 32, m.Inc)
+}
+
+func BenchmarkCounterAddFloatConcurrent(b *testing.B) {
+	m := NewCounter(CounterOpts{
+		Name: "benchmark_counter",
+		Help: "A counter to benchmark it.",
+	})
+	benchmarkConcurrently(b, 32, func() { m.Add(0.5) })
+}
+
+func BenchmarkGaugeNoLabelsConcurrent(b *testing.B) {
+	m := NewGauge(GaugeOpts{
+		Name: "benchmark_gauge",
+		Help: "A gauge to benchmark it.",
+	})
+	benchmarkConcurrently(b, 32, func() { m.Add(3.1415) })
+}
+
+// mutexValue is a mutex-protected float64 as a reference point for the
+// lock-free implementation of value.
+type mutexValue struct {
+	mtx sync.Mutex
+	val float64
+}
+
+func (v *mutexValue) Add(val float64) {
+	v.mtx.Lock()
+	v.val += val
+	v.mtx.Unlock()
+}
+
+func BenchmarkMutexValueConcurrent(b *testing.B) {
+	v := &mutexValue{}
+	benchmarkConcurrently(b, 32, func() { v.Add(3.1415) })
+}
+
 func BenchmarkGaugeWithLabelValues(b *testing.B) {
 	m := NewGaugeVec(
 		GaugeOpts{
@@ -129,3 +194,31 @@ func BenchmarkSummaryNoLabels(b *testing.B) {
 		m.Observe(3.1415)
 	}
 }
+
+func BenchmarkHistogramWithLabelValues(b *testing.B) {
+	m := NewHistogramVec(
+		HistogramOpts{
+			Name: "benchmark_histogram",
+			Help: "A histogram to benchmark it.",
+		},
+		[]string{"one", "two", "three"},
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.WithLabelValues("eins", "zwei", "drei").Observe(3.1415)
+	}
+}
+
+func BenchmarkHistogramNoLabels(b *testing.B) {
+	m := NewHistogram(HistogramOpts{
+		Name: "benchmark_histogram",
+		Help: "A histogram to benchmark it.",
+	},
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Observe(3.1415)
+	}
+}
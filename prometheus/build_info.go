@@ -0,0 +1,69 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// NewBuildInfoCollector returns a collector which exports the metric
+// go_build_info, a constant '1' labeled by the "path", "version", and
+// "checksum" of the main module of the running binary, as reported by
+// debug.ReadBuildInfo. If the build information is not available, e.g. because
+// the binary was not built with module support, the label values are
+// "(unknown)".
+func NewBuildInfoCollector() Collector {
+	path, version, sum := readBuildInfo()
+	return NewInfo(InfoOpts{
+		Name: "go_build_info",
+		Help: "Build information about the main Go module.",
+	}, Labels{"path": path, "version": version, "checksum": sum})
+}
+
+// VersionInfo describes the version of an application, usually injected at
+// build time via -ldflags. See NewVersionCollector.
+type VersionInfo struct {
+	Version  string
+	Revision string
+	Branch   string
+}
+
+// NewVersionCollector returns a collector which exports the metric
+// <program>_build_info, a constant '1' labeled by the "version", "revision",
+// and "branch" from the given VersionInfo and by the "goversion" the binary was
+// built with. Empty fields of the VersionInfo result in empty label values.
+func NewVersionCollector(program string, info VersionInfo) Collector {
+	return NewInfo(InfoOpts{
+		Namespace: program,
+		Name:      "build_info",
+		Help:      "A metric with a constant '1' value labeled by version, revision, branch, and goversion from which " + program + " was built.",
+	}, Labels{
+		"version":   info.Version,
+		"revision":  info.Revision,
+		"branch":    info.Branch,
+		"goversion": runtime.Version(),
+	})
+}
+
+// readBuildInfo returns the path, version, and checksum of the main module.
+func readBuildInfo() (path, version, sum string) {
+	path, version, sum = "(unknown)", "(unknown)", "(unknown)"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		path = bi.Main.Path
+		version = bi.Main.Version
+		sum = bi.Main.Sum
+	}
+	return
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestBuildInfoCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(NewBuildInfoCollector()); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "go_build_info" {
+		t.Fatalf("got %v, want a single go_build_info metric family", mfs)
+	}
+	m := mfs[0].GetMetric()[0]
+	var names []string
+	for _, lp := range m.GetLabel() {
+		names = append(names, lp.GetName())
+	}
+	if got, want := len(names), 3; got != want {
+		t.Errorf("got labels %v, want checksum, path, and version", names)
+	}
+	if got := m.GetGauge().GetValue(); got != 1 {
+		t.Errorf("got value %v, want 1", got)
+	}
+}
+
+func TestVersionCollector(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(NewVersionCollector("myapp", VersionInfo{
+		Version:  "1.2.3",
+		Revision: "abcdef",
+		Branch:   "main",
+	})); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "myapp_build_info" {
+		t.Fatalf("got %v, want a single myapp_build_info metric family", mfs)
+	}
+	want := map[string]string{
+		"branch":    "main",
+		"goversion": runtime.Version(),
+		"revision":  "abcdef",
+		"version":   "1.2.3",
+	}
+	labels := mfs[0].GetMetric()[0].GetLabel()
+	if len(labels) != len(want) {
+		t.Fatalf("got labels %v, want %v", labels, want)
+	}
+	for _, lp := range labels {
+		if got, want := lp.GetValue(), want[lp.GetName()]; got != want {
+			t.Errorf("got %q for label %q, want %q", got, lp.GetName(), want)
+		}
+	}
+}
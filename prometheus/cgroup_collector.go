@@ -0,0 +1,254 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultCgroupRoot is the usual mount point of the cgroup file system.
+const defaultCgroupRoot = "/sys/fs/cgroup"
+
+// CgroupCollectorOpts bundles the options for creating a cgroup collector with
+// NewCgroupCollector. All fields are optional and can safely be left at their
+// zero value.
+type CgroupCollectorOpts struct {
+	// Namespace is prepended to the names of all metrics.
+	Namespace string
+	// Root is the directory of the cgroup to export metrics for. For
+	// cgroup v1, it is the directory the controller hierarchies are mounted
+	// in, e.g. Root/memory and Root/cpu. If Root is empty, the cgroup of the
+	// current process below /sys/fs/cgroup is used.
+	Root string
+}
+
+type cgroupCollector struct {
+	root string
+
+	memoryLimit, memoryUsage *Desc
+	cpuQuota, cpuPeriod      *Desc
+	cpuUsage                 *Desc
+	periods, throttled       *Desc
+	throttledTime            *Desc
+}
+
+// NewCgroupCollector returns a collector which exports the resource limits and
+// usage of a cgroup, as enforced for containers, e.g. in Kubernetes: the memory
+// limit and usage, the CFS quota and period of the CPU controller, and how
+// often and how long the cgroup has been throttled. Both cgroup v1 and v2 are
+// supported. Values that cannot be read, or that are unlimited, are
+// omitted. The process metrics exported by NewProcessCollector do not take the
+// limits of a cgroup into account.
+func NewCgroupCollector(opts CgroupCollectorOpts) Collector {
+	root := opts.Root
+	if root == "" {
+		root = selfCgroupRoot()
+	}
+	fqName := func(name string) string {
+		return BuildFQName(opts.Namespace, "cgroup", name)
+	}
+	return &cgroupCollector{
+		root: root,
+		memoryLimit: NewDesc(
+			fqName("memory_limit_bytes"),
+			"Memory limit of the cgroup in bytes.",
+			nil, nil,
+		),
+		memoryUsage: NewDesc(
+			fqName("memory_usage_bytes"),
+			"Current memory usage of the cgroup in bytes.",
+			nil, nil,
+		),
+		cpuQuota: NewDesc(
+			fqName("cpu_cfs_quota_seconds"),
+			"CPU time the cgroup may use per CFS period in seconds.",
+			nil, nil,
+		),
+		cpuPeriod: NewDesc(
+			fqName("cpu_cfs_period_seconds"),
+			"Length of a CFS period of the cgroup in seconds.",
+			nil, nil,
+		),
+		cpuUsage: NewDesc(
+			fqName("cpu_usage_seconds_total"),
+			"Total CPU time consumed by the cgroup in seconds.",
+			nil, nil,
+		),
+		periods: NewDesc(
+			fqName("cpu_cfs_periods_total"),
+			"Total number of elapsed CFS periods in which the cgroup was runnable.",
+			nil, nil,
+		),
+		throttled: NewDesc(
+			fqName("cpu_cfs_throttled_periods_total"),
+			"Total number of CFS periods in which the cgroup was throttled.",
+			nil, nil,
+		),
+		throttledTime: NewDesc(
+			fqName("cpu_cfs_throttled_seconds_total"),
+			"Total time the cgroup was throttled in seconds.",
+			nil, nil,
+		),
+	}
+}
+
+// selfCgroupRoot returns the cgroup v2 directory of the current process if it
+// can be determined and the default cgroup root otherwise.
+func selfCgroupRoot() string {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return defaultCgroupRoot
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// The cgroup v2 entry has the form "0::/path".
+		if path := strings.TrimPrefix(scanner.Text(), "0::"); path != scanner.Text() {
+			dir := filepath.Join(defaultCgroupRoot, path)
+			if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+				return dir
+			}
+		}
+	}
+	return defaultCgroupRoot
+}
+
+// Describe implements Collector.
+func (c *cgroupCollector) Describe(ch chan<- *Desc) {
+	ch <- c.memoryLimit
+	ch <- c.memoryUsage
+	ch <- c.cpuQuota
+	ch <- c.cpuPeriod
+	ch <- c.cpuUsage
+	ch <- c.periods
+	ch <- c.throttled
+	ch <- c.throttledTime
+}
+
+// Collect implements Collector.
+func (c *cgroupCollector) Collect(ch chan<- Metric) {
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err == nil {
+		c.collectV2(ch)
+	} else {
+		c.collectV1(ch)
+	}
+}
+
+func (c *cgroupCollector) collectV2(ch chan<- Metric) {
+	if v, ok := readCgroupValue(c.root, "memory.max"); ok {
+		ch <- MustNewConstMetric(c.memoryLimit, GaugeValue, v)
+	}
+	if v, ok := readCgroupValue(c.root, "memory.current"); ok {
+		ch <- MustNewConstMetric(c.memoryUsage, GaugeValue, v)
+	}
+	// cpu.max contains the quota and the period in microseconds, e.g.
+	// "50000 100000" or "max 100000".
+	if fields := readCgroupFields(c.root, "cpu.max"); len(fields) == 2 {
+		if quota, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			ch <- MustNewConstMetric(c.cpuQuota, GaugeValue, quota/1e6)
+		}
+		if period, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			ch <- MustNewConstMetric(c.cpuPeriod, GaugeValue, period/1e6)
+		}
+	}
+	stat := readCgroupStat(c.root, "cpu.stat")
+	if v, ok := stat["usage_usec"]; ok {
+		ch <- MustNewConstMetric(c.cpuUsage, CounterValue, v/1e6)
+	}
+	c.collectThrottling(ch, stat, "throttled_usec", 1e6)
+}
+
+func (c *cgroupCollector) collectV1(ch chan<- Metric) {
+	if v, ok := readCgroupValue(c.root, "memory", "memory.limit_in_bytes"); ok && v < 1<<62 {
+		// Without a limit, the kernel reports a value close to the
+		// maximum int64, rounded down to the page size.
+		ch <- MustNewConstMetric(c.memoryLimit, GaugeValue, v)
+	}
+	if v, ok := readCgroupValue(c.root, "memory", "memory.usage_in_bytes"); ok {
+		ch <- MustNewConstMetric(c.memoryUsage, GaugeValue, v)
+	}
+	// A quota of -1 means that the cgroup is not limited.
+	if v, ok := readCgroupValue(c.root, "cpu", "cpu.cfs_quota_us"); ok && v >= 0 {
+		ch <- MustNewConstMetric(c.cpuQuota, GaugeValue, v/1e6)
+	}
+	if v, ok := readCgroupValue(c.root, "cpu", "cpu.cfs_period_us"); ok {
+		ch <- MustNewConstMetric(c.cpuPeriod, GaugeValue, v/1e6)
+	}
+	if v, ok := readCgroupValue(c.root, "cpuacct", "cpuacct.usage"); ok {
+		ch <- MustNewConstMetric(c.cpuUsage, CounterValue, v/1e9)
+	}
+	c.collectThrottling(ch, readCgroupStat(c.root, "cpu", "cpu.stat"), "throttled_time", 1e9)
+}
+
+// collectThrottling sends the throttling metrics found in the given cpu.stat
+// values. The throttled time is read from timeKey and divided by timeUnit to
+// convert it into seconds.
+func (c *cgroupCollector) collectThrottling(ch chan<- Metric, stat map[string]float64, timeKey string, timeUnit float64) {
+	if v, ok := stat["nr_periods"]; ok {
+		ch <- MustNewConstMetric(c.periods, CounterValue, v)
+	}
+	if v, ok := stat["nr_throttled"]; ok {
+		ch <- MustNewConstMetric(c.throttled, CounterValue, v)
+	}
+	if v, ok := stat[timeKey]; ok {
+		ch <- MustNewConstMetric(c.throttledTime, CounterValue, v/timeUnit)
+	}
+}
+
+// readCgroupFields returns the whitespace separated fields of the file at the
+// given path elements, or nil if the file cannot be read.
+func readCgroupFields(elem ...string) []string {
+	content, err := ioutil.ReadFile(filepath.Join(elem...))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(content))
+}
+
+// readCgroupValue reads a file at the given path elements that contains a
+// single number. It returns false if the file cannot be read or contains
+// anything else, e.g. "max".
+func readCgroupValue(elem ...string) (float64, bool) {
+	fields := readCgroupFields(elem...)
+	if len(fields) != 1 {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	return v, err == nil
+}
+
+// readCgroupStat reads a file at the given path elements with lines of the
+// form "key value", like cpu.stat.
+func readCgroupStat(elem ...string) map[string]float64 {
+	stat := map[string]float64{}
+	content, err := ioutil.ReadFile(filepath.Join(elem...))
+	if err != nil {
+		return stat
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			stat[fields[0]] = v
+		}
+	}
+	return stat
+}
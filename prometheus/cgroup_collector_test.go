@@ -0,0 +1,135 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCgroupCollector(t *testing.T) {
+	scenarios := []struct {
+		files map[string]string
+		want  map[string]float64
+	}{
+		{ // cgroup v2 with limits.
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory\n",
+				"memory.max":         "536870912\n",
+				"memory.current":     "104857600\n",
+				"cpu.max":            "50000 100000\n",
+				"cpu.stat":           "usage_usec 2500000\nuser_usec 2000000\nnr_periods 42\nnr_throttled 7\nthrottled_usec 350000\n",
+			},
+			want: map[string]float64{
+				"cgroup_memory_limit_bytes":              536870912,
+				"cgroup_memory_usage_bytes":              104857600,
+				"cgroup_cpu_cfs_quota_seconds":           0.05,
+				"cgroup_cpu_cfs_period_seconds":          0.1,
+				"cgroup_cpu_usage_seconds_total":         2.5,
+				"cgroup_cpu_cfs_periods_total":           42,
+				"cgroup_cpu_cfs_throttled_periods_total": 7,
+				"cgroup_cpu_cfs_throttled_seconds_total": 0.35,
+			},
+		},
+		{ // cgroup v2 without limits.
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory\n",
+				"memory.max":         "max\n",
+				"memory.current":     "4096\n",
+				"cpu.max":            "max 100000\n",
+			},
+			want: map[string]float64{
+				"cgroup_memory_usage_bytes":     4096,
+				"cgroup_cpu_cfs_period_seconds": 0.1,
+			},
+		},
+		{ // cgroup v1 with limits.
+			files: map[string]string{
+				"memory/memory.limit_in_bytes": "268435456\n",
+				"memory/memory.usage_in_bytes": "1048576\n",
+				"cpu/cpu.cfs_quota_us":         "200000\n",
+				"cpu/cpu.cfs_period_us":        "100000\n",
+				"cpu/cpu.stat":                 "nr_periods 10\nnr_throttled 2\nthrottled_time 1500000000\n",
+				"cpuacct/cpuacct.usage":        "3000000000\n",
+			},
+			want: map[string]float64{
+				"cgroup_memory_limit_bytes":              268435456,
+				"cgroup_memory_usage_bytes":              1048576,
+				"cgroup_cpu_cfs_quota_seconds":           0.2,
+				"cgroup_cpu_cfs_period_seconds":          0.1,
+				"cgroup_cpu_usage_seconds_total":         3,
+				"cgroup_cpu_cfs_periods_total":           10,
+				"cgroup_cpu_cfs_throttled_periods_total": 2,
+				"cgroup_cpu_cfs_throttled_seconds_total": 1.5,
+			},
+		},
+		{ // cgroup v1 without limits.
+			files: map[string]string{
+				"memory/memory.limit_in_bytes": "9223372036854771712\n",
+				"cpu/cpu.cfs_quota_us":         "-1\n",
+			},
+			want: map[string]float64{},
+		},
+	}
+
+	for i, s := range scenarios {
+		root, err := ioutil.TempDir("", "test_cgroup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		writeCgroupFiles(t, root, s.files)
+
+		r := NewRegistry()
+		if err := r.Register(NewCgroupCollector(CgroupCollectorOpts{Root: root})); err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		got := map[string]float64{}
+		for _, mf := range mfs {
+			m := mf.GetMetric()[0]
+			if m.GetCounter() != nil {
+				got[mf.GetName()] = m.GetCounter().GetValue()
+			} else {
+				got[mf.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+		if len(got) != len(s.want) {
+			t.Errorf("%d. got metrics %v, want %v", i, got, s.want)
+			continue
+		}
+		for name, want := range s.want {
+			if got[name] != want {
+				t.Errorf("%d. got %v for %s, want %v", i, got[name], name, want)
+			}
+		}
+	}
+}
@@ -35,7 +35,13 @@ type Collector interface {
 	// method idempotently sends the same descriptors throughout the
 	// lifetime of the Collector. If a Collector encounters an error while
 	// executing this method, it must send an invalid descriptor (created
-	// with NewInvalidDesc) to signal the error to the registry.
+	// with NewInvalidDesc) to signal the error to the registry. The registry
+	// consumes the descriptors while they are being sent, so a Collector
+	// proxying a large number of upstream metrics may create its
+	// descriptors one at a time rather than holding all of them at once.
+	// A Collector that cannot know its descriptors ahead of time may send
+	// none at all, in which case it is registered as an unchecked Collector
+	// (see Register).
 	Describe(chan<- *Desc)
 	// Collect is called by Prometheus when collecting metrics. The
 	// implementation sends each collected metric via the provided channel
@@ -16,6 +16,15 @@ package prometheus
 import (
 	"errors"
 	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	dto "github.com/prometheus/client_model/go"
 )
 
 // Counter is a Metric that represents a single numerical value that only ever
@@ -26,6 +35,12 @@ import (
 // A Counter is typically used to count requests served, tasks completed, errors
 // occurred, etc.
 //
+// Counters created by this package also report the time of their creation
+// (the created timestamp), which allows the Prometheus server to detect counter
+// resets and to calculate rates correctly for short-lived series. Currently,
+// only the protocol buffer exposition format is able to transport created
+// timestamps.
+//
 // To create Counter instances, use NewCounter.
 type Counter interface {
 	Metric
@@ -35,42 +50,141 @@ type Counter interface {
 	// if you have to transfer a value from an external counter into this
 	// Prometheus metrics. Do not use it for regular handling of a
 	// Prometheus counter (as it can be used to break the contract of
-	// monotonically increasing values).
+	// monotonically increasing values). Setting a value lower than the
+	// current one counts as a reset and refreshes the created timestamp.
 	Set(float64)
 	// Inc increments the counter by 1.
 	Inc()
 	// Add adds the given value to the counter. It panics if the value is <
-	// 0.
+	// 0 or NaN.
 	Add(float64)
 }
 
+// ExemplarAdder is implemented by Counters that offer the option of adding a
+// value to the Counter together with an exemplar. Its AddWithExemplar method
+// works like the Add method of the Counter interface but also replaces the
+// currently saved exemplar (if any) with a new one, created from the provided
+// value, the current time as timestamp, and the provided labels. Empty Labels
+// will lead to a valid (label-less) exemplar. But if Labels is nil, the current
+// exemplar is left in place. AddWithExemplar panics if the value is < 0 or NaN,
+// if any of the provided labels are invalid, or if the provided labels contain
+// more than ExemplarMaxRunes runes in total.
+//
+// Exemplars are a way to link a metric to out-of-band data like the trace ID
+// of a request, e.g.
+//     c.(prometheus.ExemplarAdder).AddWithExemplar(1, prometheus.Labels{"trace_id": traceID})
+// Currently, only the protocol buffer exposition format is able to transport
+// exemplars. The text format ignores them.
+type ExemplarAdder interface {
+	AddWithExemplar(value float64, exemplar Labels)
+}
+
 // CounterOpts is an alias for Opts. See there for doc comments.
 type CounterOpts Opts
 
 // NewCounter creates a new Counter based on the provided CounterOpts.
 func NewCounter(opts CounterOpts) Counter {
-	desc := NewDesc(
+	desc := NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		nil,
 		opts.ConstLabels,
 	)
-	result := &counter{value: value{desc: desc, valType: CounterValue, labelPairs: desc.constLabelPairs}}
+	result := &counter{
+		value:     value{desc: desc, valType: CounterValue, labelPairs: desc.constLabelPairs},
+		createdTs: ptypes.TimestampNow(),
+	}
 	result.Init(result) // Init self-collection.
 	return result
 }
 
 type counter struct {
+	// valInt holds the integral part of the counter value that was added
+	// via Inc or Add with a whole number. Those additions are a simple
+	// atomic add instead of the CAS loop required to add to the float64
+	// in value. Both parts are merged upon Write. valInt has to go first
+	// in the struct to guarantee alignment for atomic operations.
+	// http://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	valInt uint64
+
 	value
+
+	exemplar atomic.Value // Containing nil or a *dto.Exemplar.
+
+	createdMtx sync.RWMutex // Protects createdTs.
+	createdTs  *timestamp.Timestamp
+}
+
+var errCounterDecrease = errors.New("counter cannot decrease in value")
+
+func (c *counter) Set(v float64) {
+	c.createdMtx.Lock()
+	defer c.createdMtx.Unlock()
+
+	if v < c.get() {
+		c.createdTs = ptypes.TimestampNow()
+	}
+	atomic.StoreUint64(&c.valInt, 0)
+	c.value.Set(v)
+}
+
+func (c *counter) Inc() {
+	atomic.AddUint64(&c.valInt, 1)
 }
 
 func (c *counter) Add(v float64) {
 	if v < 0 {
-		panic(errors.New("counter cannot decrease in value"))
+		panic(errCounterDecrease)
+	}
+	// Note that NaN fails the range check and will be rejected by the
+	// float64 path.
+	if v < 1<<63 {
+		if ival := uint64(v); float64(ival) == v {
+			atomic.AddUint64(&c.valInt, ival)
+			return
+		}
 	}
 	c.value.Add(v)
 }
 
+// get returns the current value of the counter, i.e. the sum of the float64
+// and the integer part.
+func (c *counter) get() float64 {
+	fval := math.Float64frombits(atomic.LoadUint64(&c.valBits))
+	ival := atomic.LoadUint64(&c.valInt)
+	return fval + float64(ival)
+}
+
+func (c *counter) AddWithExemplar(v float64, e Labels) {
+	c.Add(v)
+	c.updateExemplar(v, e)
+}
+
+func (c *counter) Write(out *dto.Metric) error {
+	if err := populateMetric(CounterValue, c.get(), c.labelPairs, out); err != nil {
+		return err
+	}
+	if e, ok := c.exemplar.Load().(*dto.Exemplar); ok && e != nil {
+		out.Counter.Exemplar = e
+	}
+	c.createdMtx.RLock()
+	out.Counter.CreatedTimestamp = c.createdTs
+	c.createdMtx.RUnlock()
+	return nil
+}
+
+func (c *counter) updateExemplar(v float64, l Labels) {
+	if l == nil {
+		return
+	}
+	e, err := newExemplar(v, time.Now(), l)
+	if err != nil {
+		panic(err)
+	}
+	c.exemplar.Store(e)
+}
+
 // CounterVec is a Collector that bundles a set of Counters that all share the
 // same Desc, but have different values for their variable labels. This is used
 // if you want to count the same thing partitioned by various dimensions
@@ -87,9 +201,10 @@ type CounterVec struct {
 // partitioned by the given label names. At least one label name must be
 // provided.
 func NewCounterVec(opts CounterOpts, labelNames []string) *CounterVec {
-	desc := NewDesc(
+	desc := NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		labelNames,
 		opts.ConstLabels,
 	)
@@ -99,11 +214,14 @@ func NewCounterVec(opts CounterOpts, labelNames []string) *CounterVec {
 			desc:     desc,
 			hash:     fnv.New64a(),
 			newMetric: func(lvs ...string) Metric {
-				result := &counter{value: value{
-					desc:       desc,
-					valType:    CounterValue,
-					labelPairs: makeLabelPairs(desc, lvs),
-				}}
+				result := &counter{
+					value: value{
+						desc:       desc,
+						valType:    CounterValue,
+						labelPairs: makeLabelPairs(desc, lvs),
+					},
+					createdTs: ptypes.TimestampNow(),
+				}
 				result.Init(result) // Init self-collection.
 				return result
 			},
@@ -148,6 +266,27 @@ func (m *CounterVec) With(labels Labels) Counter {
 	return m.MetricVec.With(labels).(Counter)
 }
 
+// CurryWith returns a vector curried with the provided labels. See the
+// CurryWith method of MetricVec for details. The difference is that this method
+// returns a CounterVec and not a MetricVec.
+func (m *CounterVec) CurryWith(labels Labels) (*CounterVec, error) {
+	curried := &CounterVec{}
+	if err := m.MetricVec.curryInto(&curried.MetricVec, labels); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *CounterVec) MustCurryWith(labels Labels) *CounterVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
 // CounterFunc is a Counter whose value is determined at collect time by calling a
 // provided function.
 //
@@ -166,9 +305,10 @@ type CounterFunc interface {
 // the contract for a Counter (values only go up, not down), but compliance will
 // not be checked.
 func NewCounterFunc(opts CounterOpts, function func() float64) CounterFunc {
-	return newValueFunc(NewDesc(
+	return newValueFunc(NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		nil,
 		opts.ConstLabels,
 	), CounterValue, function)
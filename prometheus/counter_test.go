@@ -15,7 +15,12 @@ package prometheus
 
 import (
 	"math"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -27,23 +32,40 @@ func TestCounterAdd(t *testing.T) {
 		ConstLabels: Labels{"a": "1", "b": "2"},
 	}).(*counter)
 	counter.Inc()
-	if expected, got := 1., math.Float64frombits(counter.valBits); expected != got {
+	if expected, got := 1., counter.get(); expected != got {
 		t.Errorf("Expected %f, got %f.", expected, got)
 	}
 	counter.Add(42)
-	if expected, got := 43., math.Float64frombits(counter.valBits); expected != got {
+	if expected, got := 43., counter.get(); expected != got {
 		t.Errorf("Expected %f, got %f.", expected, got)
 	}
 
 	if expected, got := "counter cannot decrease in value", decreaseCounter(counter).Error(); expected != got {
 		t.Errorf("Expected error %q, got %q.", expected, got)
 	}
+	if expected, got := "NaN cannot be added to a metric value", addNaNToCounter(counter).Error(); expected != got {
+		t.Errorf("Expected error %q, got %q.", expected, got)
+	}
+	if expected, got := 43., counter.get(); expected != got {
+		t.Errorf("Expected %f after rejected additions, got %f.", expected, got)
+	}
 
 	m := &dto.Metric{}
 	counter.Write(m)
 
-	if expected, got := `label:<name:"a" value:"1" > label:<name:"b" value:"2" > counter:<value:43 > `, m.String(); expected != got {
-		t.Errorf("expected %q, got %q", expected, got)
+	if m.Counter.CreatedTimestamp == nil {
+		t.Error("expected created timestamp, got none")
+	}
+	m.Counter.CreatedTimestamp = nil // Varies between runs, see TestCounterCreatedTimestamp.
+	expected := &dto.Metric{
+		Label: []*dto.LabelPair{
+			{Name: proto.String("a"), Value: proto.String("1")},
+			{Name: proto.String("b"), Value: proto.String("2")},
+		},
+		Counter: &dto.Counter{Value: proto.Float64(43)},
+	}
+	if !proto.Equal(expected, m) {
+		t.Errorf("expected %s, got %s", proto.CompactTextString(expected), proto.CompactTextString(m))
 	}
 }
 
@@ -56,3 +78,198 @@ func decreaseCounter(c *counter) (err error) {
 	c.Add(-1)
 	return nil
 }
+
+func addNaNToCounter(c *counter) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = e.(error)
+		}
+	}()
+	c.Add(math.NaN())
+	return nil
+}
+
+func TestCounterFunc(t *testing.T) {
+	var calls int
+	cf := NewCounterFunc(
+		CounterOpts{
+			Name:        "test_name",
+			Help:        "test help",
+			ConstLabels: Labels{"a": "1", "b": "2"},
+		},
+		func() float64 {
+			calls++
+			return 42
+		},
+	)
+
+	if expected, got := `Desc{fqName: "test_name", help: "test help", constLabels: {a="1",b="2"}, variableLabels: []}`, cf.Desc().String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if calls != 0 {
+		t.Errorf("function called %d times before collection, expected none", calls)
+	}
+
+	m := &dto.Metric{}
+	cf.Write(m)
+
+	if expected, got := `a="1",b="2"`, labelPairsString(m.GetLabel()); expected != got {
+		t.Errorf("expected labels %s, got %s", expected, got)
+	}
+	if expected, got := 42., m.GetCounter().GetValue(); expected != got {
+		t.Errorf("expected value %f, got %f", expected, got)
+	}
+	if calls != 1 {
+		t.Errorf("function called %d times, expected once per Write", calls)
+	}
+}
+
+func TestCounterAddWithExemplar(t *testing.T) {
+	counter := NewCounter(CounterOpts{
+		Name: "test",
+		Help: "test help",
+	})
+	adder := counter.(ExemplarAdder)
+
+	adder.AddWithExemplar(42, Labels{"trace_id": "2cba"})
+	adder.AddWithExemplar(1, nil) // Keeps the old exemplar.
+
+	m := &dto.Metric{}
+	counter.Write(m)
+	if expected, got := 43., m.GetCounter().GetValue(); expected != got {
+		t.Errorf("expected value %f, got %f", expected, got)
+	}
+	e := m.GetCounter().GetExemplar()
+	if e == nil {
+		t.Fatal("expected exemplar, got none")
+	}
+	if expected, got := 42., e.GetValue(); expected != got {
+		t.Errorf("expected exemplar value %f, got %f", expected, got)
+	}
+	if got := e.GetLabel(); len(got) != 1 || got[0].GetName() != "trace_id" || got[0].GetValue() != "2cba" {
+		t.Errorf("expected exemplar label trace_id=\"2cba\", got %v", got)
+	}
+	if e.GetTimestamp() == nil {
+		t.Error("expected exemplar timestamp, got none")
+	}
+
+	scenarios := []Labels{
+		{"in-valid": "x"},
+		{"trace_id": strings.Repeat("x", ExemplarMaxRunes)},
+		{"trace_id": "\xff"},
+	}
+	for i, l := range scenarios {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("%d. expected panic for exemplar labels %v", i, l)
+				}
+			}()
+			adder.AddWithExemplar(1, l)
+		}()
+	}
+}
+
+func TestCounterCreatedTimestamp(t *testing.T) {
+	before := time.Now()
+	vec := NewCounterVec(CounterOpts{
+		Name: "test",
+		Help: "test help",
+	}, []string{"a"})
+	counter := vec.WithLabelValues("1")
+	after := time.Now()
+
+	m := &dto.Metric{}
+	counter.Write(m)
+	created, err := ptypes.Timestamp(m.GetCounter().GetCreatedTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Before(before) || created.After(after) {
+		t.Errorf("expected created timestamp between %v and %v, got %v", before, after, created)
+	}
+
+	// Resetting the vector drops the child, and the next one is created
+	// with a new timestamp.
+	vec.Reset()
+	time.Sleep(time.Millisecond)
+	m.Reset()
+	vec.WithLabelValues("1").Write(m)
+	recreated, err := ptypes.Timestamp(m.GetCounter().GetCreatedTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !recreated.After(created) {
+		t.Errorf("expected created timestamp after %v, got %v", created, recreated)
+	}
+}
+
+func TestCounterSetCreatedTimestamp(t *testing.T) {
+	counter := NewCounter(CounterOpts{
+		Name: "test",
+		Help: "test help",
+	})
+	counter.Add(42)
+
+	m := &dto.Metric{}
+	counter.Write(m)
+	created := m.GetCounter().GetCreatedTimestamp()
+
+	// Setting a higher value is not a reset.
+	counter.Set(50)
+	m.Reset()
+	counter.Write(m)
+	if got := m.GetCounter().GetCreatedTimestamp(); got != created {
+		t.Errorf("expected created timestamp %v after raising the value, got %v", created, got)
+	}
+
+	// Setting a lower value is.
+	time.Sleep(time.Millisecond)
+	counter.Set(1)
+	m.Reset()
+	counter.Write(m)
+	before, err := ptypes.Timestamp(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := ptypes.Timestamp(m.GetCounter().GetCreatedTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.After(before) {
+		t.Errorf("expected created timestamp after %v, got %v", before, after)
+	}
+}
+
+func TestCounterAddMixed(t *testing.T) {
+	counter := NewCounter(CounterOpts{
+		Name: "test",
+		Help: "test help",
+	}).(*counter)
+
+	counter.Inc()
+	counter.Add(3)
+	counter.Add(0.5)
+	counter.Add(1 << 62)
+	if expected, got := uint64(1<<62+4), counter.valInt; expected != got {
+		t.Errorf("expected integer part %d, got %d", expected, got)
+	}
+	if expected, got := 0.5, math.Float64frombits(counter.valBits); expected != got {
+		t.Errorf("expected float part %f, got %f", expected, got)
+	}
+
+	// Values that cannot be represented as uint64 take the float path.
+	counter.Add(1 << 64)
+	counter.Add(math.Inf(1))
+	if expected, got := math.Inf(1), counter.get(); expected != got {
+		t.Errorf("expected %f, got %f", expected, got)
+	}
+
+	counter.Set(42)
+	counter.Inc()
+	m := &dto.Metric{}
+	counter.Write(m)
+	if expected, got := 43., m.GetCounter().GetValue(); expected != got {
+		t.Errorf("expected %f after Set and Inc, got %f", expected, got)
+	}
+}
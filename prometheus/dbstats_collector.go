@@ -0,0 +1,121 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "database/sql"
+
+type dbStatsCollector struct {
+	db *sql.DB
+
+	maxOpenConnections *Desc
+
+	openConnections  *Desc
+	inUseConnections *Desc
+	idleConnections  *Desc
+
+	waitCount         *Desc
+	waitDuration      *Desc
+	maxIdleClosed     *Desc
+	maxIdleTimeClosed *Desc
+	maxLifetimeClosed *Desc
+}
+
+// NewDBStatsCollector returns a collector that exports the connection pool
+// statistics of the given *sql.DB, as reported by its Stats method, e.g. the
+// number of open, in-use, and idle connections and how often and how long
+// callers had to wait for a connection. All metrics carry a "db_name" label
+// set to the given dbName, so that several databases used by the same process
+// can be told apart. Register one collector per *sql.DB with a distinct
+// dbName.
+func NewDBStatsCollector(db *sql.DB, dbName string) Collector {
+	fqName := func(name string) string {
+		return "go_sql_" + name
+	}
+	constLabels := Labels{"db_name": dbName}
+	return &dbStatsCollector{
+		db: db,
+		maxOpenConnections: NewDesc(
+			fqName("max_open_connections"),
+			"Maximum number of open connections to the database.",
+			nil, constLabels,
+		),
+		openConnections: NewDesc(
+			fqName("open_connections"),
+			"The number of established connections both in use and idle.",
+			nil, constLabels,
+		),
+		inUseConnections: NewDesc(
+			fqName("in_use_connections"),
+			"The number of connections currently in use.",
+			nil, constLabels,
+		),
+		idleConnections: NewDesc(
+			fqName("idle_connections"),
+			"The number of idle connections.",
+			nil, constLabels,
+		),
+		waitCount: NewDesc(
+			fqName("wait_count_total"),
+			"The total number of connections waited for.",
+			nil, constLabels,
+		),
+		waitDuration: NewDesc(
+			fqName("wait_duration_seconds_total"),
+			"The total time blocked waiting for a new connection.",
+			nil, constLabels,
+		),
+		maxIdleClosed: NewDesc(
+			fqName("max_idle_closed_total"),
+			"The total number of connections closed due to SetMaxIdleConns.",
+			nil, constLabels,
+		),
+		maxIdleTimeClosed: NewDesc(
+			fqName("max_idle_time_closed_total"),
+			"The total number of connections closed due to SetConnMaxIdleTime.",
+			nil, constLabels,
+		),
+		maxLifetimeClosed: NewDesc(
+			fqName("max_lifetime_closed_total"),
+			"The total number of connections closed due to SetConnMaxLifetime.",
+			nil, constLabels,
+		),
+	}
+}
+
+// Describe implements Collector.
+func (c *dbStatsCollector) Describe(ch chan<- *Desc) {
+	ch <- c.maxOpenConnections
+	ch <- c.openConnections
+	ch <- c.inUseConnections
+	ch <- c.idleConnections
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxIdleTimeClosed
+	ch <- c.maxLifetimeClosed
+}
+
+// Collect implements Collector.
+func (c *dbStatsCollector) Collect(ch chan<- Metric) {
+	stats := c.db.Stats()
+	ch <- MustNewConstMetric(c.maxOpenConnections, GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- MustNewConstMetric(c.openConnections, GaugeValue, float64(stats.OpenConnections))
+	ch <- MustNewConstMetric(c.inUseConnections, GaugeValue, float64(stats.InUse))
+	ch <- MustNewConstMetric(c.idleConnections, GaugeValue, float64(stats.Idle))
+	ch <- MustNewConstMetric(c.waitCount, CounterValue, float64(stats.WaitCount))
+	ch <- MustNewConstMetric(c.waitDuration, CounterValue, stats.WaitDuration.Seconds())
+	ch <- MustNewConstMetric(c.maxIdleClosed, CounterValue, float64(stats.MaxIdleClosed))
+	ch <- MustNewConstMetric(c.maxIdleTimeClosed, CounterValue, float64(stats.MaxIdleTimeClosed))
+	ch <- MustNewConstMetric(c.maxLifetimeClosed, CounterValue, float64(stats.MaxLifetimeClosed))
+}
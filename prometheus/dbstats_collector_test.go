@@ -0,0 +1,87 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+// nopDriver is a database/sql driver that never connects. It is sufficient to
+// create a *sql.DB, whose Stats method does not require a connection.
+type nopDriver struct{}
+
+func (nopDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func init() {
+	sql.Register("prometheus-nop", nopDriver{})
+}
+
+func TestDBStatsCollector(t *testing.T) {
+	reg := NewRegistry()
+	for _, name := range []string{"db_A", "db_B"} {
+		db, err := sql.Open("prometheus-nop", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(42)
+		if err := reg.Register(NewDBStatsCollector(db, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{
+		"go_sql_idle_connections",
+		"go_sql_in_use_connections",
+		"go_sql_max_idle_closed_total",
+		"go_sql_max_idle_time_closed_total",
+		"go_sql_max_lifetime_closed_total",
+		"go_sql_max_open_connections",
+		"go_sql_open_connections",
+		"go_sql_wait_count_total",
+		"go_sql_wait_duration_seconds_total",
+	}
+	if got, want := len(mfs), len(names); got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	for i, mf := range mfs {
+		if got, want := mf.GetName(), names[i]; got != want {
+			t.Errorf("%d. got metric family %q, want %q", i, got, want)
+		}
+		if got, want := len(mf.GetMetric()), 2; got != want {
+			t.Errorf("%d. got %d metrics for %s, want %d", i, got, mf.GetName(), want)
+			continue
+		}
+		for j, m := range mf.GetMetric() {
+			if got, want := m.GetLabel()[0].GetValue(), []string{"db_A", "db_B"}[j]; got != want {
+				t.Errorf("%d. got db_name %q, want %q", i, got, want)
+			}
+		}
+		if mf.GetName() == "go_sql_max_open_connections" {
+			if got, want := mf.GetMetric()[0].GetGauge().GetValue(), 42.; got != want {
+				t.Errorf("got %v max open connections, want %v", got, want)
+			}
+		}
+	}
+}
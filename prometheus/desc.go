@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"hash/fnv"
-	"regexp"
 	"sort"
 	"strings"
 
@@ -13,12 +12,7 @@ import (
 
 	dto "github.com/prometheus/client_model/go"
 
-	"code.google.com/p/goprotobuf/proto"
-)
-
-var (
-	metricNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_:]*$`)
-	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	"github.com/golang/protobuf/proto"
 )
 
 // Labels represents a collection of label name -> value mappings. This type is
@@ -51,6 +45,9 @@ type Desc struct {
 	fqName string
 	// help provides some helpful information about this metric.
 	help string
+	// unit is the unit of the metric's values. It is empty if no unit
+	// has been set.
+	unit string
 	// constLabelPairs contains precalculated DTO label pairs based on
 	// the constant labels.
 	constLabelPairs []*dto.LabelPair
@@ -74,6 +71,10 @@ type Desc struct {
 // and will be reported on registration time. variableLabels and constLabels can
 // be nil if no such labels should be set. fqName and help must not be empty.
 //
+// The metric and label names are validated according to
+// model.NameValidationScheme. To use UTF-8 names, set it to
+// model.UTF8Validation before creating any Desc.
+//
 // variableLabels only contain the label names. Their label values are variable
 // and therefore not part of the Desc. (They are managed within the Metric.)
 //
@@ -81,16 +82,28 @@ type Desc struct {
 // specified in the Desc. See the Opts documentation for the implications of
 // constant labels.
 func NewDesc(fqName, help string, variableLabels []string, constLabels Labels) *Desc {
+	return NewDescWithUnit(fqName, help, "", variableLabels, constLabels)
+}
+
+// NewDescWithUnit works like NewDesc but additionally sets the unit of the
+// metric's values, which may be empty. See the Opts documentation for the
+// requirements of a valid unit.
+func NewDescWithUnit(fqName, help, unit string, variableLabels []string, constLabels Labels) *Desc {
 	d := &Desc{
 		fqName:         fqName,
 		help:           help,
+		unit:           unit,
 		variableLabels: variableLabels,
 	}
 	if help == "" {
 		d.err = errors.New("empty help string")
 		return d
 	}
-	if !metricNameRE.MatchString(fqName) {
+	if unit != "" && !checkUnit(unit) {
+		d.err = fmt.Errorf("%q is not a valid unit", unit)
+		return d
+	}
+	if !model.IsValidMetricName(fqName) {
 		d.err = fmt.Errorf("%q is not a valid metric name", fqName)
 		return d
 	}
@@ -184,16 +197,49 @@ func (d *Desc) String() string {
 			fmt.Sprintf("%s=%q", lp.GetName(), lp.GetValue()),
 		)
 	}
+	var unit string
+	if d.unit != "" {
+		unit = fmt.Sprintf(", unit: %q", d.unit)
+	}
 	return fmt.Sprintf(
-		"Desc{fqName: %q, help: %q, constLabels: {%s}, variableLabels: %v}",
+		"Desc{fqName: %q, help: %q%s, constLabels: {%s}, variableLabels: %v}",
 		d.fqName,
 		d.help,
+		unit,
 		strings.Join(lpStrings, ","),
 		d.variableLabels,
 	)
 }
 
+// hasUnitSuffix returns whether the fully-qualified name ends with the unit
+// (separated by an underscore), optionally followed by "_total" as required
+// for counters. A Desc without a unit always has the unit suffix.
+func (d *Desc) hasUnitSuffix() bool {
+	if d.unit == "" {
+		return true
+	}
+	name := strings.TrimSuffix(d.fqName, "_total")
+	return strings.HasSuffix(name, "_"+d.unit)
+}
+
+// checkUnit returns whether u starts with a lowercase letter, consists of
+// lowercase letters, digits, and underscores only, and does not end with an
+// underscore.
+func checkUnit(u string) bool {
+	for i, r := range u {
+		switch {
+		case r >= 'a' && r <= 'z':
+		case (r >= '0' && r <= '9' || r == '_') && i > 0:
+		default:
+			return false
+		}
+	}
+	return u != "" && u[len(u)-1] != '_'
+}
+
+// checkLabelName returns whether l is a valid label name according to
+// model.NameValidationScheme that does not start with the reserved prefix.
 func checkLabelName(l string) bool {
-	return labelNameRE.MatchString(l) &&
+	return model.IsValidLabelName(l) &&
 		!strings.HasPrefix(l, model.ReservedLabelPrefix)
 }
@@ -44,8 +44,7 @@
 //    )
 //
 //    func init() {
-//    	prometheus.MustRegister(cpuTemp)
-//    	prometheus.MustRegister(hdFailures)
+//    	prometheus.MustRegister(cpuTemp, hdFailures)
 //    }
 //
 //    func main() {
@@ -61,12 +60,13 @@
 // It also exports some stats about the HTTP usage of the /metrics
 // endpoint. (See the Handler function for more detail.)
 //
-// A more advanced metric type is the Summary.
+// Two more advanced metric types are the Summary and Histogram.
 //
-// In addition to the fundamental metric types Gauge, Counter, and Summary, a
-// very important part of the Prometheus data model is the partitioning of
-// samples along dimensions called labels, which results in metric vectors. The
-// fundamental types are GaugeVec, CounterVec, and SummaryVec.
+// In addition to the fundamental metric types Gauge, Counter, Summary, and
+// Histogram, a very important part of the Prometheus data model is the
+// partitioning of samples along dimensions called labels, which results in
+// metric vectors. The fundamental types are GaugeVec, CounterVec, SummaryVec,
+// and HistogramVec.
 //
 // Those are all the parts needed for basic usage. Detailed documentation and
 // examples are provided below.
@@ -81,9 +81,32 @@
 // The Untyped metric behaves like a Gauge, but signals the Prometheus server
 // not to assume anything about its type.
 //
+// GaugeFunc, CounterFunc, and UntypedFunc are metrics whose value is
+// determined at collect time by calling a provided function. They are handy to
+// expose values that are maintained elsewhere anyway (like the length of a
+// queue or the size of a cache) without having to copy them into a Gauge or
+// Counter all the time. UntypedFunc is the right choice if values are mirrored
+// from an external system that does not guarantee Gauge or Counter semantics.
+//
+// An Info metric exposes metadata like the version of a binary as labels of a
+// gauge with a constant value of 1. An Enum tracks which one out of a fixed set
+// of states is the current one. A GaugeHistogram tracks a distribution that can
+// shrink again, like the sizes of the requests currently in flight.
+//
 // Functions to fine-tune how the metric registry works: EnableCollectChecks,
 // PanicOnCollectError, Register, Unregister, SetMetricFamilyInjectionHook.
 //
+// All of the above operate on the global Prometheus registry. NewRegistry
+// creates a separate Registry, e.g. for a library or a test that wants to keep
+// its metrics apart from the global state. NewPedanticRegistry creates a
+// Registry with strict checks, which is helpful to test custom Collectors.
+//
+// A Registry is a Gatherer, i.e. it gathers the collected metrics into
+// MetricFamily protobufs. HandlerFor exposes any Gatherer via HTTP. A Registry
+// is also a Registerer. WrapRegistererWith wraps a Registerer so that all
+// Collectors registered with it get additional constant labels,
+// WrapRegistererWithPrefix so that their metric names get a prefix.
+//
 // For custom metric collection, there are two entry points: Custom Metric
 // implementations and custom Collector implementations. A Metric is the
 // fundamental unit in the Prometheus data model: a sample at a point in time
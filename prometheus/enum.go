@@ -0,0 +1,153 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// An Enum tracks which one out of a fixed set of states something is currently
+// in, e.g. whether a service is starting, running, or stopping. It is
+// exposed as one gauge per state, distinguished by the "state" label. The gauge
+// of the current state has the value 1, all others have the value 0:
+//     service_state{state="starting"} 0
+//     service_state{state="running"} 1
+//     service_state{state="stopping"} 0
+//
+// Exactly one state is current at any time. Setting a new state implicitly
+// clears the previous one.
+//
+// An Enum is a Collector but not a Metric, as it collects one Metric per
+// state. To create Enum instances, use NewEnum.
+type Enum interface {
+	Collector
+
+	// SetState sets the current state. It panics if the state is not one
+	// of the states the Enum was created with.
+	SetState(string)
+	// State returns the current state.
+	State() string
+}
+
+// enumStateLabel is the name of the label that holds the states of an Enum.
+const enumStateLabel = "state"
+
+var errNoEnumStates = errors.New("an enum must have at least one state")
+
+// EnumOpts bundles the options for creating an Enum metric. It is mandatory to
+// set Name, Help, and States. All other fields are optional and can safely be
+// left at their zero value.
+type EnumOpts struct {
+	// Namespace, Subsystem, and Name are components of the fully-qualified
+	// name of the Enum (created by joining these components with
+	// "_"). Only Name is mandatory, the others merely help structuring the
+	// name. Note that the fully-qualified name of the Enum must be a valid
+	// Prometheus metric name.
+	Namespace string
+	Subsystem string
+	Name      string
+
+	// Help provides information about this Enum. Mandatory!
+	//
+	// Metrics with the same fully-qualified name must have the same Help
+	// string.
+	Help string
+
+	// ConstLabels are used to attach fixed labels to this
+	// Enum. ConstLabels must not contain a "state" label. See the Opts
+	// documentation for the implications of constant labels.
+	ConstLabels Labels
+
+	// States is the set of possible states. Mandatory! The states must be
+	// unique. The first state is the current state of a newly created Enum.
+	States []string
+}
+
+// NewEnum creates a new Enum based on the provided EnumOpts. It panics if no
+// states are provided or if a state is provided more than once.
+func NewEnum(opts EnumOpts) Enum {
+	if len(opts.States) == 0 {
+		panic(errNoEnumStates)
+	}
+	desc := NewDesc(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		[]string{enumStateLabel},
+		opts.ConstLabels,
+	)
+	e := &enum{
+		desc:       desc,
+		states:     make([]string, len(opts.States)),
+		stateIdx:   make(map[string]uint32, len(opts.States)),
+		labelPairs: make([][]*dto.LabelPair, len(opts.States)),
+	}
+	for i, state := range opts.States {
+		if _, ok := e.stateIdx[state]; ok {
+			panic(fmt.Errorf("duplicate state %q in enum", state))
+		}
+		e.states[i] = state
+		e.stateIdx[state] = uint32(i)
+		e.labelPairs[i] = makeLabelPairs(desc, []string{state})
+	}
+	return e
+}
+
+type enum struct {
+	// current is the index of the current state in states. It goes first
+	// in the struct to guarantee alignment for atomic operations.
+	current uint32
+
+	desc       *Desc
+	states     []string
+	stateIdx   map[string]uint32
+	labelPairs [][]*dto.LabelPair // One set of label pairs per state.
+}
+
+func (e *enum) SetState(state string) {
+	i, ok := e.stateIdx[state]
+	if !ok {
+		panic(fmt.Errorf("unknown state %q for enum %s", state, e.desc.fqName))
+	}
+	atomic.StoreUint32(&e.current, i)
+}
+
+func (e *enum) State() string {
+	return e.states[atomic.LoadUint32(&e.current)]
+}
+
+// Describe implements Collector.
+func (e *enum) Describe(ch chan<- *Desc) {
+	ch <- e.desc
+}
+
+// Collect implements Collector.
+func (e *enum) Collect(ch chan<- Metric) {
+	current := atomic.LoadUint32(&e.current)
+	for i := range e.states {
+		var v float64
+		if uint32(i) == current {
+			v = 1
+		}
+		ch <- &constMetric{
+			desc:       e.desc,
+			valType:    GaugeValue,
+			val:        v,
+			labelPairs: e.labelPairs[i],
+		}
+	}
+}
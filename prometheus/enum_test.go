@@ -0,0 +1,110 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/text"
+)
+
+func TestEnum(t *testing.T) {
+	e := NewEnum(EnumOpts{
+		Name:   "service_state",
+		Help:   "The current state of the service.",
+		States: []string{"starting", "running", "stopping"},
+	})
+
+	r := NewRegistry()
+	r.collectChecksEnabled = true
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		state, out string
+	}{
+		{
+			state: "", // Initial state.
+			out: `# HELP service_state The current state of the service.
+# TYPE service_state gauge
+service_state{state="running"} 0
+service_state{state="starting"} 1
+service_state{state="stopping"} 0
+`,
+		},
+		{
+			state: "running",
+			out: `# HELP service_state The current state of the service.
+# TYPE service_state gauge
+service_state{state="running"} 1
+service_state{state="starting"} 0
+service_state{state="stopping"} 0
+`,
+		},
+		{
+			state: "stopping",
+			out: `# HELP service_state The current state of the service.
+# TYPE service_state gauge
+service_state{state="running"} 0
+service_state{state="starting"} 0
+service_state{state="stopping"} 1
+`,
+		},
+	}
+
+	for i, s := range scenarios {
+		if s.state != "" {
+			e.SetState(s.state)
+			if expected, got := s.state, e.State(); expected != got {
+				t.Errorf("%d. expected state %q, got %q", i, expected, got)
+			}
+		}
+		var buf bytes.Buffer
+		if _, err := writeGathered(&buf, r, text.MetricFamilyToText); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); s.out != got {
+			t.Errorf("%d. expected %q, got %q", i, s.out, got)
+		}
+	}
+}
+
+func TestEnumPanics(t *testing.T) {
+	scenarios := []struct {
+		name string
+		f    func()
+	}{
+		{"no states", func() {
+			NewEnum(EnumOpts{Name: "test", Help: "help"})
+		}},
+		{"duplicate states", func() {
+			NewEnum(EnumOpts{Name: "test", Help: "help", States: []string{"a", "b", "a"}})
+		}},
+		{"unknown state", func() {
+			NewEnum(EnumOpts{Name: "test", Help: "help", States: []string{"a", "b"}}).SetState("c")
+		}},
+	}
+	for _, s := range scenarios {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("%s: expected panic", s.name)
+				}
+			}()
+			s.f()
+		}()
+	}
+}
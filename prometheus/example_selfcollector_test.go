@@ -16,7 +16,7 @@ package prometheus_test
 import (
 	"runtime"
 
-	"code.google.com/p/goprotobuf/proto"
+	"github.com/golang/protobuf/proto"
 
 	dto "github.com/prometheus/client_model/go"
 
@@ -20,14 +20,29 @@ import (
 	"net/http"
 	"runtime"
 	"sort"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
 
-	"code.google.com/p/goprotobuf/proto"
+	"github.com/golang/protobuf/proto"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// hideCreatedTimestamp removes the created timestamp from the provided metric,
+// which would otherwise make the output of the examples below vary between
+// runs.
+func hideCreatedTimestamp(m *dto.Metric) {
+	switch {
+	case m.Counter != nil:
+		m.Counter.CreatedTimestamp = nil
+	case m.Summary != nil:
+		m.Summary.CreatedTimestamp = nil
+	case m.Histogram != nil:
+		m.Histogram.CreatedTimestamp = nil
+	}
+}
+
 func ExampleGauge() {
 	opsQueued := prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: "our_company",
@@ -181,9 +196,12 @@ func ExampleLabelPairSorter() {
 
 	sort.Sort(prometheus.LabelPairSorter(labelPairs))
 
-	fmt.Println(labelPairs)
+	for _, lp := range labelPairs {
+		fmt.Println(lp.GetName(), lp.GetValue())
+	}
 	// Output:
-	// [name:"method" value:"get"  name:"status" value:"404" ]
+	// method get
+	// status 404
 }
 
 func ExampleRegister() {
@@ -328,9 +346,9 @@ func ExampleRegister() {
 
 	// Output:
 	// taskCounter registered.
-	// taskCounterVec not registered: a previously registered descriptor with the same fully-qualified name as Desc{fqName: "worker_pool_completed_tasks_total", help: "Total number of tasks completed.", constLabels: {}, variableLabels: [worker_id]} has different label names or a different help string
+	// taskCounterVec not registered: a previously registered descriptor with the same fully-qualified name as Desc{fqName: "worker_pool_completed_tasks_total", help: "Total number of tasks completed.", constLabels: {}, variableLabels: [worker_id]} has different label names or a different help string, previously registered descriptor is Desc{fqName: "worker_pool_completed_tasks_total", help: "Total number of tasks completed.", constLabels: {}, variableLabels: []}
 	// taskCounter unregistered.
-	// taskCounterVec not registered: a previously registered descriptor with the same fully-qualified name as Desc{fqName: "worker_pool_completed_tasks_total", help: "Total number of tasks completed.", constLabels: {}, variableLabels: [worker_id]} has different label names or a different help string
+	// taskCounterVec not registered: a previously registered descriptor with the same fully-qualified name as Desc{fqName: "worker_pool_completed_tasks_total", help: "Total number of tasks completed.", constLabels: {}, variableLabels: [worker_id]} has different label names or a different help string, previously registered descriptor is Desc{fqName: "worker_pool_completed_tasks_total", help: "Total number of tasks completed.", constLabels: {}, variableLabels: []}
 	// taskCounterVec registered.
 	// Worker initialization failed: inconsistent label cardinality
 	// notMyCounter is nil.
@@ -338,6 +356,24 @@ func ExampleRegister() {
 	// taskCounterForWorker2001 registered.
 }
 
+func ExampleAlreadyRegisteredError() {
+	reqCounter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "example_requests_total",
+		Help: "The total number of requests served.",
+	})
+	if err := prometheus.Register(reqCounter); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			// A counter for that metric has been registered before.
+			// Use the old counter from now on.
+			reqCounter = are.ExistingCollector.(prometheus.Counter)
+		} else {
+			// Something else went wrong!
+			panic(err)
+		}
+	}
+	reqCounter.Inc()
+}
+
 func ExampleSummary() {
 	temps := prometheus.NewSummary(prometheus.SummaryOpts{
 		Name: "pond_temperature_celsius",
@@ -354,6 +390,7 @@ func ExampleSummary() {
 	// internally).
 	metric := &dto.Metric{}
 	temps.Write(metric)
+	hideCreatedTimestamp(metric)
 	fmt.Println(proto.MarshalTextString(metric))
 
 	// Output:
@@ -404,6 +441,7 @@ func ExampleSummaryVec() {
 	for metric := range metricChan {
 		dtoMetric := &dto.Metric{}
 		metric.Write(dtoMetric)
+		hideCreatedTimestamp(dtoMetric)
 		metricStrings = append(metricStrings, proto.MarshalTextString(dtoMetric))
 	}
 	sort.Strings(metricStrings) // For reproducible print order.
@@ -452,3 +490,83 @@ func ExampleSummaryVec() {
 	// >
 	// ]
 }
+
+func ExampleHistogram() {
+	temps := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pond_temperature_celsius",
+		Help:    "The temperature of the frog pond.", // Sorry, we can't measure how badly it smells.
+		Buckets: prometheus.LinearBuckets(20, 5, 5),  // 5 buckets, each 5 centigrade wide.
+	})
+
+	// Simulate some observations.
+	for i := 0; i < 1000; i++ {
+		temps.Observe(30 + math.Floor(120*math.Sin(float64(i)*0.1))/10)
+	}
+
+	// Just for demonstration, let's check the state of the histogram by
+	// (ab)using its Write method (which is usually only used by Prometheus
+	// internally).
+	metric := &dto.Metric{}
+	temps.Write(metric)
+	hideCreatedTimestamp(metric)
+	fmt.Println(proto.MarshalTextString(metric))
+
+	// Output:
+	// histogram: <
+	//   sample_count: 1000
+	//   sample_sum: 29969.50000000001
+	//   bucket: <
+	//     cumulative_count: 192
+	//     upper_bound: 20
+	//   >
+	//   bucket: <
+	//     cumulative_count: 366
+	//     upper_bound: 25
+	//   >
+	//   bucket: <
+	//     cumulative_count: 501
+	//     upper_bound: 30
+	//   >
+	//   bucket: <
+	//     cumulative_count: 638
+	//     upper_bound: 35
+	//   >
+	//   bucket: <
+	//     cumulative_count: 816
+	//     upper_bound: 40
+	//   >
+	// >
+}
+
+func ExampleNewMetricWithTimestamp() {
+	desc := prometheus.NewDesc(
+		"temperature_kelvin",
+		"Current temperature in Kelvin.",
+		nil, nil,
+	)
+
+	// Create a constant gauge from values we got from an external
+	// temperature reporting system. Those values are reported with a slight
+	// delay, so we want to add the timestamp of the actual measurement.
+	temperatureReportedByExternalSystem := 298.15
+	timeReportedByExternalSystem := time.Date(2009, time.November, 10, 23, 0, 0, 12345678, time.UTC)
+	s := prometheus.NewMetricWithTimestamp(
+		timeReportedByExternalSystem,
+		prometheus.MustNewConstMetric(
+			desc, prometheus.GaugeValue, temperatureReportedByExternalSystem,
+		),
+	)
+
+	// Just for demonstration, let's check the state of the gauge by
+	// (ab)using its Write method (which is usually only used by Prometheus
+	// internally).
+	metric := &dto.Metric{}
+	s.Write(metric)
+	fmt.Println(proto.MarshalTextString(metric))
+
+	// Output:
+	// gauge: <
+	//   value: 298.15
+	// >
+	// timestamp_ms: 1257894000012
+}
@@ -19,6 +19,8 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/golang/protobuf/proto"
+
 	dto "github.com/prometheus/client_model/go"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -81,7 +83,7 @@ func ExampleExpvarCollector() {
 		if strings.Index(m.Desc().String(), "expvar_memstats") == -1 {
 			metric.Reset()
 			m.Write(&metric)
-			metricStrings = append(metricStrings, metric.String())
+			metricStrings = append(metricStrings, proto.CompactTextString(&metric))
 		}
 	}
 	sort.Strings(metricStrings)
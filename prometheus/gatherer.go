@@ -0,0 +1,148 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// CachingGatherer is a Gatherer that memoizes the result of another Gatherer for
+// a fixed duration. It is useful if the wrapped Gatherer is expensive to call,
+// e.g. because its Collectors query a remote API, and the metrics are scraped
+// by several Prometheus servers in short succession. Create instances with
+// NewCachingGatherer.
+//
+// Concurrent calls of Gather while the cached result is outdated result in a
+// single call of the wrapped Gatherer. The error returned by the wrapped
+// Gatherer is cached along with the MetricFamilies.
+type CachingGatherer struct {
+	gatherer Gatherer
+	ttl      time.Duration
+
+	mtx        sync.Mutex
+	lastGather time.Time
+	mfs        []*dto.MetricFamily
+	err        error
+}
+
+// NewCachingGatherer returns a CachingGatherer that caches the result of the
+// provided Gatherer for the duration ttl.
+func NewCachingGatherer(g Gatherer, ttl time.Duration) *CachingGatherer {
+	return &CachingGatherer{
+		gatherer: g,
+		ttl:      ttl,
+	}
+}
+
+// Gather implements Gatherer. It calls the wrapped Gatherer only if the cached
+// result is older than the ttl. The returned MetricFamilies are copies of the
+// cached ones, so that they can still be modified freely by the caller.
+func (g *CachingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if t := now.Now(); g.lastGather.IsZero() || t.Sub(g.lastGather) >= g.ttl {
+		g.mfs, g.err = g.gatherer.Gather()
+		g.lastGather = t
+	}
+
+	mfs := make([]*dto.MetricFamily, 0, len(g.mfs))
+	for _, mf := range g.mfs {
+		mfs = append(mfs, proto.Clone(mf).(*dto.MetricFamily))
+	}
+	return mfs, g.err
+}
+
+// Invalidate discards the cached result so that the next call of Gather calls
+// the wrapped Gatherer.
+func (g *CachingGatherer) Invalidate() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.lastGather = time.Time{}
+}
+
+// MetricNameFilter decides by the name of a MetricFamily whether it is kept
+// (true) or dropped (false) by a filtering Gatherer created with
+// FilterGatherer.
+type MetricNameFilter func(name string) bool
+
+// AllowMetricNames returns a MetricNameFilter that keeps only the
+// MetricFamilies with one of the provided names.
+func AllowMetricNames(names ...string) MetricNameFilter {
+	allowed := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		allowed[name] = struct{}{}
+	}
+	return func(name string) bool {
+		_, ok := allowed[name]
+		return ok
+	}
+}
+
+// DenyMetricNames returns a MetricNameFilter that drops the MetricFamilies
+// with one of the provided names.
+func DenyMetricNames(names ...string) MetricNameFilter {
+	allow := AllowMetricNames(names...)
+	return func(name string) bool { return !allow(name) }
+}
+
+// AllowMetricNamePrefixes returns a MetricNameFilter that keeps only the
+// MetricFamilies whose name starts with one of the provided prefixes.
+func AllowMetricNamePrefixes(prefixes ...string) MetricNameFilter {
+	return func(name string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DenyMetricNamePrefixes returns a MetricNameFilter that drops the
+// MetricFamilies whose name starts with one of the provided prefixes.
+func DenyMetricNamePrefixes(prefixes ...string) MetricNameFilter {
+	allow := AllowMetricNamePrefixes(prefixes...)
+	return func(name string) bool { return !allow(name) }
+}
+
+// FilterGatherer returns a Gatherer that calls the provided Gatherer and
+// returns only the MetricFamilies kept by the provided MetricNameFilter. Errors
+// of the wrapped Gatherer are passed on. Note that the wrapped Gatherer still
+// collects all of its metrics, so filtering saves encoding and transfer but not
+// the cost of collection.
+func FilterGatherer(g Gatherer, filter MetricNameFilter) Gatherer {
+	return GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		return filterMetricFamilies(mfs, filter), err
+	})
+}
+
+// filterMetricFamilies removes the MetricFamilies not kept by the provided
+// MetricNameFilter from mfs in place and returns the shortened slice.
+func filterMetricFamilies(mfs []*dto.MetricFamily, filter MetricNameFilter) []*dto.MetricFamily {
+	kept := mfs[:0]
+	for _, mf := range mfs {
+		if filter(mf.GetName()) {
+			kept = append(kept, mf)
+		}
+	}
+	return kept
+}
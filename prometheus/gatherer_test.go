@@ -0,0 +1,235 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// countingGatherer returns a single gauge family whose value is the number of
+// times Gather has been called.
+type countingGatherer struct {
+	calls int
+	err   error
+}
+
+func (g *countingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	g.calls++
+	r := NewRegistry()
+	gauge := NewGauge(GaugeOpts{Name: "test_calls", Help: "help"})
+	gauge.Set(float64(g.calls))
+	r.MustRegister(gauge)
+	mfs, err := r.Gather()
+	if err != nil {
+		return nil, err
+	}
+	return mfs, g.err
+}
+
+func TestCachingGatherer(t *testing.T) {
+	defer func(n nower) {
+		now = n
+	}(now)
+	start := time.Now()
+	var current time.Time
+	now = nowFunc(func() time.Time { return current })
+
+	wrapped := &countingGatherer{}
+	g := NewCachingGatherer(wrapped, time.Minute)
+
+	scenarios := []struct {
+		at         time.Duration
+		want       float64
+		invalidate bool
+	}{
+		{at: 0, want: 1},
+		{at: 30 * time.Second, want: 1},
+		{at: 59 * time.Second, want: 1},
+		{at: time.Minute, want: 2},
+		{at: 90 * time.Second, want: 2},
+		{at: 90 * time.Second, want: 3, invalidate: true},
+	}
+	for i, s := range scenarios {
+		current = start.Add(s.at)
+		if s.invalidate {
+			g.Invalidate()
+		}
+		mfs, err := g.Gather()
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if got := mfs[0].Metric[0].GetGauge().GetValue(); got != s.want {
+			t.Errorf("%d. got value %v, want %v", i, got, s.want)
+		}
+		// Modifying the result must not affect the cache.
+		mfs[0].Metric[0].Gauge.Value = nil
+	}
+
+	// Errors are cached, too.
+	wrapped.err = errors.New("gather failed")
+	g.Invalidate()
+	if _, err := g.Gather(); err != wrapped.err {
+		t.Fatalf("got error %v, want %v", err, wrapped.err)
+	}
+	wrapped.err = nil
+	if _, err := g.Gather(); err == nil {
+		t.Error("expected cached error, got none")
+	}
+}
+
+func TestFilterGatherer(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"a_one", "a_two", "b_one", "c_one"} {
+		r.MustRegister(NewGauge(GaugeOpts{Name: name, Help: "help"}))
+	}
+
+	scenarios := []struct {
+		filter MetricNameFilter
+		want   []string
+	}{
+		{AllowMetricNames("a_two", "c_one", "missing"), []string{"a_two", "c_one"}},
+		{DenyMetricNames("a_two", "c_one"), []string{"a_one", "b_one"}},
+		{AllowMetricNamePrefixes("a_", "c"), []string{"a_one", "a_two", "c_one"}},
+		{DenyMetricNamePrefixes("a_"), []string{"b_one", "c_one"}},
+		{AllowMetricNames(), []string{}},
+	}
+	for i, s := range scenarios {
+		mfs, err := FilterGatherer(r, s.filter).Gather()
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		got := make([]string, 0, len(mfs))
+		for _, mf := range mfs {
+			got = append(got, mf.GetName())
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%d. got %v, want %v", i, got, s.want)
+		}
+	}
+}
+
+func TestHandlerForNameParams(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewGauge(GaugeOpts{Name: "a_gauge", Help: "help"}))
+	r.MustRegister(NewGauge(GaugeOpts{Name: "b_gauge", Help: "help"}))
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/metrics?name[]=b_gauge", nil)
+	HandlerFor(r).ServeHTTP(writer, request)
+	want := "# HELP b_gauge help\n# TYPE b_gauge gauge\nb_gauge 0\n"
+	if got := writer.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRegistryTransactional(t *testing.T) {
+	r := NewRegistry()
+	vec := NewGaugeVec(GaugeOpts{Name: "test_gauge", Help: "help"}, []string{"l"})
+	vec.WithLabelValues("a").Set(1)
+	vec.WithLabelValues("b").Set(2)
+	r.MustRegister(vec)
+	injected := &dto.MetricFamily{
+		Name: proto.String("test_injected"),
+		Help: proto.String("help"),
+		Type: dto.MetricType_UNTYPED.Enum(),
+		Metric: []*dto.Metric{
+			{Untyped: &dto.Untyped{Value: proto.Float64(3)}},
+		},
+	}
+	r.SetMetricFamilyInjectionHook(func() []*dto.MetricFamily {
+		return []*dto.MetricFamily{injected}
+	})
+
+	want, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tg := r.Transactional()
+	mfs, done, err := tg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !metricFamiliesEqual(mfs, want) {
+		t.Errorf("got %v, want %v", mfs, want)
+	}
+	reused := mfs[0]
+	done()
+
+	// The injected MetricFamily is owned by the hook and left alone.
+	if got := injected.GetName(); got != "test_injected" {
+		t.Errorf("injected metric family was modified, name is now %q", got)
+	}
+
+	mfs, done, err = tg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer done()
+	if mfs[0] != reused {
+		t.Error("expected metric family to be reused after done")
+	}
+	if !metricFamiliesEqual(mfs, want) {
+		t.Errorf("got %v after reuse, want %v", mfs, want)
+	}
+}
+
+// metricFamiliesEqual reports whether a and b hold equal MetricFamilies in the
+// same order.
+func metricFamiliesEqual(a, b []*dto.MetricFamily) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !proto.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestHandlerForTransactional(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewGauge(GaugeOpts{Name: "test_gauge", Help: "help"}))
+	var doneCalls int
+	tg := transactionalGathererFunc(func() ([]*dto.MetricFamily, func(), error) {
+		mfs, err := r.Gather()
+		return mfs, func() { doneCalls++ }, err
+	})
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	HandlerForTransactional(tg).ServeHTTP(writer, request)
+	if got, want := writer.Body.String(), "# HELP test_gauge help\n# TYPE test_gauge gauge\ntest_gauge 0\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if doneCalls != 1 {
+		t.Errorf("done called %d times, want 1", doneCalls)
+	}
+}
+
+type transactionalGathererFunc func() ([]*dto.MetricFamily, func(), error)
+
+func (f transactionalGathererFunc) Gather() ([]*dto.MetricFamily, func(), error) {
+	return f()
+}
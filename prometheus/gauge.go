@@ -34,11 +34,16 @@ type Gauge interface {
 	// Dec decrements the Gauge by 1.
 	Dec()
 	// Add adds the given value to the Gauge. (The value can be
-	// negative, resulting in a decrease of the Gauge.)
+	// negative, resulting in a decrease of the Gauge.) It panics if the
+	// value is NaN, as that would irrecoverably turn the Gauge into NaN.
 	Add(float64)
 	// Sub subtracts the given value from the Gauge. (The value can be
-	// negative, resulting in an increase of the Gauge.)
+	// negative, resulting in an increase of the Gauge.) It panics if the
+	// value is NaN.
 	Sub(float64)
+
+	// SetToCurrentTime sets the Gauge to the current Unix time in seconds.
+	SetToCurrentTime()
 }
 
 // GaugeOpts is an alias for Opts. See there for doc comments.
@@ -46,9 +51,10 @@ type GaugeOpts Opts
 
 // NewGauge creates a new Gauge based on the provided GaugeOpts.
 func NewGauge(opts GaugeOpts) Gauge {
-	return newValue(NewDesc(
+	return newValue(NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		nil,
 		opts.ConstLabels,
 	), GaugeValue, 0)
@@ -67,9 +73,10 @@ type GaugeVec struct {
 // partitioned by the given label names. At least one label name must be
 // provided.
 func NewGaugeVec(opts GaugeOpts, labelNames []string) *GaugeVec {
-	desc := NewDesc(
+	desc := NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		labelNames,
 		opts.ConstLabels,
 	)
@@ -122,6 +129,27 @@ func (m *GaugeVec) With(labels Labels) Gauge {
 	return m.MetricVec.With(labels).(Gauge)
 }
 
+// CurryWith returns a vector curried with the provided labels. See the
+// CurryWith method of MetricVec for details. The difference is that this method
+// returns a GaugeVec and not a MetricVec.
+func (m *GaugeVec) CurryWith(labels Labels) (*GaugeVec, error) {
+	curried := &GaugeVec{}
+	if err := m.MetricVec.curryInto(&curried.MetricVec, labels); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *GaugeVec) MustCurryWith(labels Labels) *GaugeVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
 // GaugeFunc is a Gauge whose value is determined at collect time by calling a
 // provided function.
 //
@@ -138,9 +166,10 @@ type GaugeFunc interface {
 // where a GaugeFunc is directly registered with Prometheus, the provided
 // function must be concurrency-safe.
 func NewGaugeFunc(opts GaugeOpts, function func() float64) GaugeFunc {
-	return newValueFunc(NewDesc(
+	return newValueFunc(NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		nil,
 		opts.ConstLabels,
 	), GaugeValue, function)
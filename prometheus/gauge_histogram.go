@@ -0,0 +1,359 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// A GaugeHistogram is the Gauge among the histograms: It tracks the current
+// distribution of a set of items that can come and go, e.g. the sizes of the
+// requests currently in flight, or the age of the jobs currently waiting in a
+// queue. Items are added with Observe and removed again with Remove, so that
+// the bucket counts, the total count, and the sum can go up and down.
+//
+// In contrast, the counts of a regular Histogram only ever go up, which allows
+// the Prometheus server to calculate rates from them. Do not use a Histogram
+// for a distribution that can shrink, and do not calculate rates from a
+// GaugeHistogram.
+//
+// In the protocol buffer exposition format, a GaugeHistogram has its own metric
+// type. The text format has no equivalent, so GaugeHistograms are exposed as
+// regular histograms there.
+//
+// To create GaugeHistogram instances, use NewGaugeHistogram.
+type GaugeHistogram interface {
+	Metric
+	Collector
+
+	// Observe adds an item with the given value to the gauge histogram.
+	Observe(float64)
+	// Remove removes an item with the given value that was previously
+	// added with Observe. Removing an item that has never been observed
+	// leads to invalid bucket counts.
+	Remove(float64)
+}
+
+// GaugeHistogramOpts bundles the options for creating a GaugeHistogram
+// metric. It is mandatory to set Name and Help to a non-empty string. All other
+// fields are optional and can safely be left at their zero value.
+type GaugeHistogramOpts struct {
+	// Namespace, Subsystem, and Name are components of the fully-qualified
+	// name of the GaugeHistogram (created by joining these components with
+	// "_"). Only Name is mandatory, the others merely help structuring the
+	// name. Note that the fully-qualified name of the GaugeHistogram must
+	// be a valid Prometheus metric name.
+	Namespace string
+	Subsystem string
+	Name      string
+
+	// Help provides information about this GaugeHistogram. Mandatory!
+	//
+	// Metrics with the same fully-qualified name must have the same Help
+	// string.
+	Help string
+
+	// Unit is the unit of the observed values, e.g. "seconds". See the
+	// Opts documentation for details.
+	Unit string
+
+	// ConstLabels are used to attach fixed labels to this
+	// GaugeHistogram. See the HistogramOpts documentation for the
+	// implications of constant labels.
+	ConstLabels Labels
+
+	// Buckets defines the buckets into which items are counted. The rules
+	// are the same as for the Buckets of a Histogram. If Buckets is left
+	// empty, the default value is DefBuckets.
+	Buckets []float64
+}
+
+// NewGaugeHistogram creates a new GaugeHistogram based on the provided
+// GaugeHistogramOpts. It panics if the buckets in GaugeHistogramOpts are not in
+// strictly increasing order.
+func NewGaugeHistogram(opts GaugeHistogramOpts) GaugeHistogram {
+	return newGaugeHistogram(
+		NewDescWithUnit(
+			BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			opts.Unit,
+			nil,
+			opts.ConstLabels,
+		),
+		opts,
+	)
+}
+
+func newGaugeHistogram(desc *Desc, opts GaugeHistogramOpts, labelValues ...string) GaugeHistogram {
+	if len(desc.variableLabels) != len(labelValues) {
+		panic(errInconsistentCardinality)
+	}
+	checkBucketLabel(desc)
+
+	if len(opts.Buckets) == 0 {
+		opts.Buckets = DefBuckets
+	}
+
+	h := &gaugeHistogram{
+		desc:        desc,
+		upperBounds: checkBuckets(opts.Buckets),
+		labelPairs:  makeLabelPairs(desc, labelValues),
+	}
+	// The counts include one for the implicit +Inf bucket, as it cannot be
+	// derived from a total count that goes up and down concurrently.
+	h.counts = make([]uint64, len(h.upperBounds)+1)
+
+	h.Init(h) // Init self-collection.
+	return h
+}
+
+type gaugeHistogram struct {
+	// sumBits contains the bits of the float64 representing the sum of all
+	// current items. It has to go first in the struct to guarantee
+	// alignment for atomic operations.
+	// http://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	sumBits uint64
+
+	SelfCollector
+
+	desc *Desc
+
+	upperBounds []float64
+	counts      []uint64 // Non-cumulative, the last one is the +Inf bucket.
+
+	labelPairs []*dto.LabelPair
+}
+
+func (h *gaugeHistogram) Desc() *Desc {
+	return h.desc
+}
+
+func (h *gaugeHistogram) Observe(v float64) {
+	h.update(v, 1, v)
+}
+
+func (h *gaugeHistogram) Remove(v float64) {
+	// Adding ^uint64(0) decrements the count by one.
+	h.update(v, ^uint64(0), -v)
+}
+
+// update adds delta to the count of the bucket v falls into and sumDelta to
+// the sum.
+func (h *gaugeHistogram) update(v float64, delta uint64, sumDelta float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	atomic.AddUint64(&h.counts[i], delta)
+	for {
+		oldBits := atomic.LoadUint64(&h.sumBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + sumDelta)
+		if atomic.CompareAndSwapUint64(&h.sumBits, oldBits, newBits) {
+			break
+		}
+	}
+}
+
+func (h *gaugeHistogram) Write(out *dto.Metric) error {
+	his := &dto.Histogram{}
+	buckets := make([]*dto.Bucket, len(h.upperBounds))
+
+	his.SampleSum = proto.Float64(math.Float64frombits(atomic.LoadUint64(&h.sumBits)))
+	var count uint64
+	for i, upperBound := range h.upperBounds {
+		count += atomic.LoadUint64(&h.counts[i])
+		buckets[i] = &dto.Bucket{
+			CumulativeCount: proto.Uint64(count),
+			UpperBound:      proto.Float64(upperBound),
+		}
+	}
+	count += atomic.LoadUint64(&h.counts[len(h.upperBounds)])
+	his.SampleCount = proto.Uint64(count)
+	his.Bucket = buckets
+	out.Histogram = his
+	out.Label = h.labelPairs
+	return nil
+}
+
+func (h *gaugeHistogram) isGaugeHistogram() {}
+
+// gaugeHistogramMetric is implemented by Metrics that represent a gauge
+// histogram. As gauge histograms are written into the same field of a
+// dto.Metric as regular histograms, the registry needs this to tell them
+// apart.
+type gaugeHistogramMetric interface {
+	Metric
+	isGaugeHistogram()
+}
+
+// isGaugeHistogramMetric returns whether the provided Metric represents a gauge
+// histogram. Unlike a plain type assertion on gaugeHistogramMetric, it looks
+// through the Metrics wrapping another Metric, i.e. those created by
+// NewMetricWithTimestamp and by the wrapping Registerers.
+func isGaugeHistogramMetric(m Metric) bool {
+	for {
+		switch w := m.(type) {
+		case gaugeHistogramMetric:
+			return true
+		case *wrappingMetric:
+			m = w.wrappedMetric
+		case timestampedMetric:
+			m = w.Metric
+		case uncheckedMetric:
+			m = w.Metric
+		default:
+			return false
+		}
+	}
+}
+
+// GaugeHistogramVec is a Collector that bundles a set of GaugeHistograms that
+// all share the same Desc, but have different values for their variable
+// labels. Create instances with NewGaugeHistogramVec.
+//
+// GaugeHistogramVec embeds MetricVec. See there for a full list of methods
+// with detailed documentation.
+type GaugeHistogramVec struct {
+	MetricVec
+}
+
+// NewGaugeHistogramVec creates a new GaugeHistogramVec based on the provided
+// GaugeHistogramOpts and partitioned by the given label names. At least one
+// label name must be provided.
+func NewGaugeHistogramVec(opts GaugeHistogramOpts, labelNames []string) *GaugeHistogramVec {
+	desc := NewDescWithUnit(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		opts.Unit,
+		labelNames,
+		opts.ConstLabels,
+	)
+	return &GaugeHistogramVec{
+		MetricVec: MetricVec{
+			children: map[uint64]Metric{},
+			desc:     desc,
+			hash:     fnv.New64a(),
+			newMetric: func(lvs ...string) Metric {
+				return newGaugeHistogram(desc, opts, lvs...)
+			},
+		},
+	}
+}
+
+// GetMetricWithLabelValues replaces the method of the same name in
+// MetricVec. The difference is that this method returns a GaugeHistogram and
+// not a Metric so that no type conversion is required.
+func (m *GaugeHistogramVec) GetMetricWithLabelValues(lvs ...string) (GaugeHistogram, error) {
+	metric, err := m.MetricVec.GetMetricWithLabelValues(lvs...)
+	if metric != nil {
+		return metric.(GaugeHistogram), err
+	}
+	return nil, err
+}
+
+// GetMetricWith replaces the method of the same name in MetricVec. The
+// difference is that this method returns a GaugeHistogram and not a Metric so
+// that no type conversion is required.
+func (m *GaugeHistogramVec) GetMetricWith(labels Labels) (GaugeHistogram, error) {
+	metric, err := m.MetricVec.GetMetricWith(labels)
+	if metric != nil {
+		return metric.(GaugeHistogram), err
+	}
+	return nil, err
+}
+
+// WithLabelValues works as GetMetricWithLabelValues, but panics where
+// GetMetricWithLabelValues would have returned an error. By not returning an
+// error, WithLabelValues allows shortcuts like
+//     myVec.WithLabelValues("404", "GET").Observe(42.21)
+func (m *GaugeHistogramVec) WithLabelValues(lvs ...string) GaugeHistogram {
+	return m.MetricVec.WithLabelValues(lvs...).(GaugeHistogram)
+}
+
+// With works as GetMetricWith, but panics where GetMetricWithLabels would have
+// returned an error. By not returning an error, With allows shortcuts like
+//     myVec.With(Labels{"code": "404", "method": "GET"}).Observe(42.21)
+func (m *GaugeHistogramVec) With(labels Labels) GaugeHistogram {
+	return m.MetricVec.With(labels).(GaugeHistogram)
+}
+
+// CurryWith returns a vector curried with the provided labels. See the
+// CurryWith method of MetricVec for details. The difference is that this method
+// returns a GaugeHistogramVec and not a MetricVec.
+func (m *GaugeHistogramVec) CurryWith(labels Labels) (*GaugeHistogramVec, error) {
+	curried := &GaugeHistogramVec{}
+	if err := m.MetricVec.curryInto(&curried.MetricVec, labels); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *GaugeHistogramVec) MustCurryWith(labels Labels) *GaugeHistogramVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
+type constGaugeHistogram struct {
+	constHistogram
+}
+
+func (h *constGaugeHistogram) isGaugeHistogram() {}
+
+// NewConstGaugeHistogram works like NewConstHistogram but returns a metric
+// representing a gauge histogram. It is useful for custom Collectors that
+// mirror a distribution maintained elsewhere, e.g. the sizes of the jobs
+// currently waiting in an external queue.
+func NewConstGaugeHistogram(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	buckets map[float64]uint64,
+	labelValues ...string,
+) (Metric, error) {
+	if len(desc.variableLabels) != len(labelValues) {
+		return nil, errInconsistentCardinality
+	}
+	return &constGaugeHistogram{constHistogram{
+		desc:       desc,
+		count:      count,
+		sum:        sum,
+		buckets:    buckets,
+		labelPairs: makeLabelPairs(desc, labelValues),
+	}}, nil
+}
+
+// MustNewConstGaugeHistogram is a version of NewConstGaugeHistogram that panics
+// where NewConstGaugeHistogram would have returned an error.
+func MustNewConstGaugeHistogram(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	buckets map[float64]uint64,
+	labelValues ...string,
+) Metric {
+	m, err := NewConstGaugeHistogram(desc, count, sum, buckets, labelValues...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
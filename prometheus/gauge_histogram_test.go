@@ -0,0 +1,172 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestGaugeHistogram(t *testing.T) {
+	his := NewGaugeHistogram(GaugeHistogramOpts{
+		Name:    "test",
+		Help:    "test help",
+		Buckets: []float64{1, 5, 10},
+	})
+
+	for _, v := range []float64{0.5, 3, 3, 7, 42} {
+		his.Observe(v)
+	}
+	his.Remove(3)
+	his.Remove(42)
+
+	m := &dto.Metric{}
+	his.Write(m)
+	expected := &dto.Metric{
+		Histogram: &dto.Histogram{
+			SampleCount: proto.Uint64(3),
+			SampleSum:   proto.Float64(10.5),
+			Bucket: []*dto.Bucket{
+				{CumulativeCount: proto.Uint64(1), UpperBound: proto.Float64(1)},
+				{CumulativeCount: proto.Uint64(2), UpperBound: proto.Float64(5)},
+				{CumulativeCount: proto.Uint64(3), UpperBound: proto.Float64(10)},
+			},
+		},
+	}
+	if !proto.Equal(expected, m) {
+		t.Errorf("expected %s, got %s", proto.CompactTextString(expected), proto.CompactTextString(m))
+	}
+}
+
+func TestGaugeHistogramConcurrency(t *testing.T) {
+	his := NewGaugeHistogram(GaugeHistogramOpts{
+		Name:    "test",
+		Help:    "test help",
+		Buckets: []float64{1, 2, 3},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(v float64) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				his.Observe(v)
+				his.Remove(v)
+			}
+		}(float64(i) / 2)
+	}
+	wg.Wait()
+
+	m := &dto.Metric{}
+	his.Write(m)
+	expected := &dto.Metric{
+		Histogram: &dto.Histogram{
+			SampleCount: proto.Uint64(0),
+			SampleSum:   proto.Float64(0),
+			Bucket: []*dto.Bucket{
+				{CumulativeCount: proto.Uint64(0), UpperBound: proto.Float64(1)},
+				{CumulativeCount: proto.Uint64(0), UpperBound: proto.Float64(2)},
+				{CumulativeCount: proto.Uint64(0), UpperBound: proto.Float64(3)},
+			},
+		},
+	}
+	if !proto.Equal(expected, m) {
+		t.Errorf("expected %s, got %s", proto.CompactTextString(expected), proto.CompactTextString(m))
+	}
+}
+
+func TestGaugeHistogramExposition(t *testing.T) {
+	vec := NewGaugeHistogramVec(GaugeHistogramOpts{
+		Name:    "queued_job_size_bytes",
+		Help:    "The size of the jobs currently queued.",
+		Buckets: []float64{256},
+	}, []string{"queue"})
+	vec.WithLabelValues("a").Observe(100)
+
+	r := NewRegistry()
+	r.collectChecksEnabled = true
+	if err := r.Register(vec); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &dto.MetricFamily{
+		Name: proto.String("queued_job_size_bytes"),
+		Help: proto.String("The size of the jobs currently queued."),
+		Type: dto.MetricType_GAUGE_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Label: []*dto.LabelPair{
+				{Name: proto.String("queue"), Value: proto.String("a")},
+			},
+			Histogram: &dto.Histogram{
+				SampleCount: proto.Uint64(1),
+				SampleSum:   proto.Float64(100),
+				Bucket: []*dto.Bucket{
+					{CumulativeCount: proto.Uint64(1), UpperBound: proto.Float64(256)},
+				},
+			},
+		}},
+	}
+	if len(mfs) != 1 || !proto.Equal(expected, mfs[0]) {
+		t.Errorf("expected %s, got %v", proto.CompactTextString(expected), mfs)
+	}
+
+	desc := NewDesc("queued_job_size_external_bytes", "The size of the jobs queued elsewhere.", nil, nil)
+	if _, ok := MustNewConstGaugeHistogram(desc, 2, 300, map[float64]uint64{256: 1}).(gaugeHistogramMetric); !ok {
+		t.Error("expected const gauge histogram to be recognized as gauge histogram")
+	}
+	if _, ok := MustNewConstHistogram(desc, 2, 300, map[float64]uint64{256: 1}).(gaugeHistogramMetric); ok {
+		t.Error("expected const histogram not to be recognized as gauge histogram")
+	}
+}
+
+func TestGaugeHistogramWrapped(t *testing.T) {
+	desc := NewDesc("timestamped_job_size_bytes", "The size of the jobs queued elsewhere.", nil, nil)
+	timestamped := NewMetricWithTimestamp(
+		time.Unix(1, 0),
+		MustNewConstGaugeHistogram(desc, 2, 300, map[float64]uint64{256: 1}),
+	)
+
+	r := NewRegistry()
+	WrapRegistererWithPrefix("wrapped_", r).MustRegister(NewGaugeHistogram(GaugeHistogramOpts{
+		Name: "job_size_bytes",
+		Help: "The size of the jobs currently queued.",
+	}))
+	r.MustRegister(&staticCollector{descs: []*Desc{desc}, metrics: []Metric{timestamped}})
+	WrapRegistererWithPrefix("wrapped_", r).MustRegister(&staticCollector{
+		descs:   []*Desc{desc},
+		metrics: []Metric{timestamped},
+	})
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 3; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	for _, mf := range mfs {
+		if got, want := mf.GetType(), dto.MetricType_GAUGE_HISTOGRAM; got != want {
+			t.Errorf("%s: got type %s, want %s", mf.GetName(), got, want)
+		}
+	}
+}
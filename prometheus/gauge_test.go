@@ -16,9 +16,13 @@ package prometheus
 import (
 	"math"
 	"math/rand"
+	"strconv"
 	"sync"
 	"testing"
 	"testing/quick"
+	"time"
+
+	"github.com/golang/protobuf/proto"
 
 	dto "github.com/prometheus/client_model/go"
 )
@@ -138,7 +142,7 @@ func TestGaugeVecConcurrency(t *testing.T) {
 				start.Wait()
 				for i, v := range vals {
 					sStreams[pick[i]] <- v
-					gge.WithLabelValues(string('A' + pick[i])).Add(v)
+					gge.WithLabelValues(strconv.Itoa(pick[i])).Add(v)
 				}
 				end.Done()
 			}(vals)
@@ -146,7 +150,7 @@ func TestGaugeVecConcurrency(t *testing.T) {
 		start.Done()
 
 		for i := range sStreams {
-			if expected, got := <-results[i], math.Float64frombits(gge.WithLabelValues(string('A'+i)).(*value).valBits); math.Abs(expected-got) > 0.000001 {
+			if expected, got := <-results[i], math.Float64frombits(gge.WithLabelValues(strconv.Itoa(i)).(*value).valBits); math.Abs(expected-got) > 0.000001 {
 				t.Fatalf("expected approx. %f, got %f", expected, got)
 				return false
 			}
@@ -176,7 +180,69 @@ func TestGaugeFunc(t *testing.T) {
 	m := &dto.Metric{}
 	gf.Write(m)
 
-	if expected, got := `label:<name:"a" value:"1" > label:<name:"b" value:"2" > gauge:<value:3.1415 > `, m.String(); expected != got {
-		t.Errorf("expected %q, got %q", expected, got)
+	expected := &dto.Metric{
+		Label: []*dto.LabelPair{
+			{Name: proto.String("a"), Value: proto.String("1")},
+			{Name: proto.String("b"), Value: proto.String("2")},
+		},
+		Gauge: &dto.Gauge{Value: proto.Float64(3.1415)},
+	}
+	if !proto.Equal(expected, m) {
+		t.Errorf("expected %s, got %s", proto.CompactTextString(expected), proto.CompactTextString(m))
+	}
+}
+
+func TestGaugeSetCurrentTime(t *testing.T) {
+	g := NewGauge(GaugeOpts{
+		Name: "test_name",
+		Help: "test help",
+	})
+	g.SetToCurrentTime()
+	unixTime := float64(time.Now().Unix())
+
+	m := &dto.Metric{}
+	g.Write(m)
+
+	delta := unixTime - m.GetGauge().GetValue()
+	// This is just a smoke test to make sure SetToCurrentTime is not
+	// totally off. Tests with current time involved are hard...
+	if math.Abs(delta) > 5 {
+		t.Errorf("Gauge set to current time deviates from current time by more than 5s, delta is %f seconds", delta)
+	}
+}
+
+func TestGaugeAddNaN(t *testing.T) {
+	g := NewGauge(GaugeOpts{
+		Name: "test_name",
+		Help: "test help",
+	})
+	g.Set(42)
+
+	for name, f := range map[string]func(){
+		"Add": func() { g.Add(math.NaN()) },
+		"Sub": func() { g.Sub(math.NaN()) },
+	} {
+		func() {
+			defer func() {
+				if e := recover(); e != errAddNaN {
+					t.Errorf("%s: expected panic with %q, got %v", name, errAddNaN, e)
+				}
+			}()
+			f()
+		}()
+	}
+
+	m := &dto.Metric{}
+	g.Write(m)
+	if expected, got := 42., m.GetGauge().GetValue(); expected != got {
+		t.Errorf("expected %f, got %f", expected, got)
+	}
+
+	// Setting a Gauge to NaN is still allowed.
+	g.Set(math.NaN())
+	m.Reset()
+	g.Write(m)
+	if got := m.GetGauge().GetValue(); !math.IsNaN(got) {
+		t.Errorf("expected NaN, got %f", got)
 	}
 }
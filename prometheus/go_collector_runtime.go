@@ -0,0 +1,197 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"math"
+	"regexp"
+	"runtime/metrics"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/model"
+)
+
+// GoRuntimeMetricsRule selects metrics of the runtime/metrics package to be
+// exported by a collector created with NewGoRuntimeMetricsCollector. The
+// Matcher is matched against the runtime/metrics name of a metric, e.g.
+// "/sched/latencies:seconds".
+type GoRuntimeMetricsRule struct {
+	Matcher *regexp.Regexp
+}
+
+// Predefined GoRuntimeMetricsRules for commonly used subsets of the
+// runtime/metrics.
+var (
+	// GoRuntimeMetricsAll selects all supported runtime/metrics.
+	GoRuntimeMetricsAll = GoRuntimeMetricsRule{regexp.MustCompile(`^/.*`)}
+	// GoRuntimeMetricsGC selects the metrics about the garbage collector,
+	// including its pacer.
+	GoRuntimeMetricsGC = GoRuntimeMetricsRule{regexp.MustCompile(`^/gc/.*`)}
+	// GoRuntimeMetricsMemory selects the metrics about the memory classes
+	// of the Go runtime.
+	GoRuntimeMetricsMemory = GoRuntimeMetricsRule{regexp.MustCompile(`^/memory/classes/.*`)}
+	// GoRuntimeMetricsScheduler selects the metrics about the scheduler,
+	// e.g. the histogram of the time goroutines spent runnable before
+	// running.
+	GoRuntimeMetricsScheduler = GoRuntimeMetricsRule{regexp.MustCompile(`^/sched/.*`)}
+)
+
+type goRuntimeMetricsCollector struct {
+	mtx     sync.Mutex // Protects samples.
+	samples []metrics.Sample
+	descs   []*Desc // One per sample.
+	types   []ValueType
+}
+
+// NewGoRuntimeMetricsCollector returns a collector which exports the metrics
+// of the runtime/metrics package selected by the given rules. A metric is
+// exported if it matches any of the rules. If no rules are given, all
+// supported metrics are exported, see GoRuntimeMetricsAll.
+//
+// The names of the runtime/metrics are translated into Prometheus metric
+// names, e.g. "/sched/latencies:seconds" becomes go_sched_latencies_seconds
+// and "/gc/cycles/total:gc-cycles" becomes go_gc_cycles_total_gc_cycles_total.
+// Cumulative metrics are exported as counters, all other scalar metrics as
+// gauges. Histogram metrics are exported as histograms whose buckets are the
+// buckets of the runtime histogram. As the runtime does not track their sums,
+// the sums are estimated from the bucket boundaries.
+//
+// The metrics overlap with those of the collector returned by NewGoCollector,
+// but the names differ, so that both can be registered at the same time.
+func NewGoRuntimeMetricsCollector(rules ...GoRuntimeMetricsRule) Collector {
+	if len(rules) == 0 {
+		rules = []GoRuntimeMetricsRule{GoRuntimeMetricsAll}
+	}
+	c := &goRuntimeMetricsCollector{}
+	names := map[string]struct{}{}
+	for _, d := range metrics.All() {
+		if !matchesAnyRule(d.Name, rules) {
+			continue
+		}
+		var valType ValueType
+		switch d.Kind {
+		case metrics.KindUint64, metrics.KindFloat64:
+			valType = GaugeValue
+			if d.Cumulative {
+				valType = CounterValue
+			}
+		case metrics.KindFloat64Histogram:
+			valType = UntypedValue // Not used for histograms.
+		default:
+			continue // Unsupported kind.
+		}
+		name, ok := runtimeMetricToPromName(d.Name, valType == CounterValue)
+		if !ok {
+			continue
+		}
+		if _, exists := names[name]; exists {
+			continue
+		}
+		names[name] = struct{}{}
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+		c.descs = append(c.descs, NewDesc(name, d.Description, nil, nil))
+		c.types = append(c.types, valType)
+	}
+	return c
+}
+
+func matchesAnyRule(name string, rules []GoRuntimeMetricsRule) bool {
+	for _, r := range rules {
+		if r.Matcher.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+var invalidMetricNameRunes = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// runtimeMetricToPromName translates the name of a runtime/metrics metric,
+// of the form "/path/to/metric:unit", into a Prometheus metric name. The
+// second return value is false if no valid name could be derived.
+func runtimeMetricToPromName(name string, counter bool) (string, bool) {
+	i := strings.LastIndex(name, ":")
+	if i < 0 {
+		return "", false
+	}
+	key, unit := strings.Trim(name[:i], "/"), name[i+1:]
+	promName := "go_" + invalidMetricNameRunes.ReplaceAllString(key, "_")
+	if unit != "" {
+		promName += "_" + invalidMetricNameRunes.ReplaceAllString(unit, "_")
+	}
+	if counter && !strings.HasSuffix(promName, "_total") {
+		promName += "_total"
+	}
+	return promName, model.IsValidMetricName(promName)
+}
+
+// Describe implements Collector.
+func (c *goRuntimeMetricsCollector) Describe(ch chan<- *Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+// Collect implements Collector.
+func (c *goRuntimeMetricsCollector) Collect(ch chan<- Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	metrics.Read(c.samples)
+	for i, s := range c.samples {
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			ch <- MustNewConstMetric(c.descs[i], c.types[i], float64(s.Value.Uint64()))
+		case metrics.KindFloat64:
+			ch <- MustNewConstMetric(c.descs[i], c.types[i], s.Value.Float64())
+		case metrics.KindFloat64Histogram:
+			count, sum, buckets := runtimeHistogramToProm(s.Value.Float64Histogram())
+			ch <- MustNewConstHistogram(c.descs[i], count, sum, buckets)
+		}
+	}
+}
+
+// runtimeHistogramToProm converts a runtime histogram into the count, the
+// estimated sum, and the cumulative buckets of a Prometheus histogram. The
+// bucket with an infinite upper bound is implied by the count and therefore
+// omitted. Each observation contributes the midpoint of its bucket to the sum,
+// or the finite boundary if the bucket is unbounded on one side.
+func runtimeHistogramToProm(h *metrics.Float64Histogram) (uint64, float64, map[float64]uint64) {
+	var (
+		count   uint64
+		sum     float64
+		buckets = make(map[float64]uint64, len(h.Counts))
+	)
+	for i, n := range h.Counts {
+		lower, upper := h.Buckets[i], h.Buckets[i+1]
+		count += n
+		if n > 0 {
+			switch {
+			case math.IsInf(lower, -1) && math.IsInf(upper, +1):
+				// No finite boundary, nothing to add.
+			case math.IsInf(lower, -1):
+				sum += float64(n) * upper
+			case math.IsInf(upper, +1):
+				sum += float64(n) * lower
+			default:
+				sum += float64(n) * (lower + upper) / 2
+			}
+		}
+		if !math.IsInf(upper, +1) {
+			buckets[upper] = count
+		}
+	}
+	return count, sum, buckets
+}
@@ -0,0 +1,129 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"testing"
+)
+
+func TestRuntimeMetricToPromName(t *testing.T) {
+	scenarios := []struct {
+		name    string
+		counter bool
+		want    string
+		ok      bool
+	}{
+		{"/sched/latencies:seconds", false, "go_sched_latencies_seconds", true},
+		{"/gc/heap/allocs:bytes", true, "go_gc_heap_allocs_bytes_total", true},
+		{"/gc/cycles/total:gc-cycles", true, "go_gc_cycles_total_gc_cycles_total", true},
+		{"/memory/classes/heap/free:bytes", false, "go_memory_classes_heap_free_bytes", true},
+		{"/no/unit", false, "", false},
+	}
+	for i, s := range scenarios {
+		got, ok := runtimeMetricToPromName(s.name, s.counter)
+		if ok != s.ok || got != s.want {
+			t.Errorf("%d. got (%q, %t), want (%q, %t)", i, got, ok, s.want, s.ok)
+		}
+	}
+}
+
+func TestRuntimeHistogramToProm(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{1, 2, 0, 3},
+		Buckets: []float64{math.Inf(-1), 1, 2, 4, math.Inf(+1)},
+	}
+	count, sum, buckets := runtimeHistogramToProm(h)
+	if count != 6 {
+		t.Errorf("got count %d, want 6", count)
+	}
+	if want := 1*1. + 2*1.5 + 3*4.; sum != want {
+		t.Errorf("got sum %v, want %v", sum, want)
+	}
+	want := map[float64]uint64{1: 1, 2: 3, 4: 3}
+	if len(buckets) != len(want) {
+		t.Fatalf("got buckets %v, want %v", buckets, want)
+	}
+	for upperBound, n := range want {
+		if buckets[upperBound] != n {
+			t.Errorf("got %d for bucket %v, want %d", buckets[upperBound], upperBound, n)
+		}
+	}
+}
+
+func TestGoRuntimeMetricsCollector(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.Register(NewGoRuntimeMetricsCollector(GoRuntimeMetricsScheduler)); err != nil {
+		t.Fatal(err)
+	}
+	// Both Go collectors can be registered at the same time.
+	if err := registry.Register(NewGoCollector()); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var foundLatencies bool
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if strings.HasPrefix(name, "go_gc_") && name != "go_gc_duration_seconds" {
+			t.Errorf("got metric %s not selected by the rules", name)
+		}
+		if name == "go_sched_latencies_seconds" {
+			foundLatencies = true
+			h := mf.GetMetric()[0].GetHistogram()
+			if h == nil {
+				t.Fatal("go_sched_latencies_seconds is not a histogram")
+			}
+			if len(h.GetBucket()) == 0 {
+				t.Error("go_sched_latencies_seconds has no buckets")
+			}
+		}
+	}
+	if !foundLatencies {
+		t.Error("go_sched_latencies_seconds not collected")
+	}
+}
+
+func TestGoRuntimeMetricsCollectorAll(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.Register(NewGoRuntimeMetricsCollector()); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register(NewGoCollector()); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, mf := range mfs {
+		names[mf.GetName()] = true
+	}
+	for _, name := range []string{
+		"go_memory_classes_heap_free_bytes",
+		"go_gc_heap_allocs_bytes_total",
+		"go_sched_latencies_seconds",
+		"go_goroutines",
+	} {
+		if !names[name] {
+			t.Errorf("metric %s not collected", name)
+		}
+	}
+}
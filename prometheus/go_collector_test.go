@@ -1,7 +1,7 @@
 package prometheus
 
 import (
-	"reflect"
+	"runtime"
 	"testing"
 	"time"
 
@@ -25,34 +25,130 @@ func TestGoCollector(t *testing.T) {
 		}(closec)
 		<-waitc
 		c.Collect(ch)
+		close(ch)
 	}()
 
 	for {
 		select {
 		case metric := <-ch:
-			switch m := metric.(type) {
-			// Attention, this also catches Counter...
-			case Gauge:
-				pb := &dto.Metric{}
-				m.Write(pb)
-
-				if old == -1 {
-					old = int(pb.GetGauge().GetValue())
-					close(waitc)
-					continue
-				}
+			if metric.Desc() != c.goroutinesDesc {
+				continue
+			}
+			pb := &dto.Metric{}
+			metric.Write(pb)
+			if pb.GetGauge() == nil {
+				continue
+			}
 
-				if diff := int(pb.GetGauge().GetValue()) - old; diff != 1 {
-					// TODO: This is flaky in highly concurrent situations.
-					t.Errorf("want 1 new goroutine, got %d", diff)
-				}
+			if old == -1 {
+				old = int(pb.GetGauge().GetValue())
+				close(waitc)
+				continue
+			}
+
+			if diff := int(pb.GetGauge().GetValue()) - old; diff != 1 {
+				// TODO: This is flaky in highly concurrent situations.
+				t.Errorf("want 1 new goroutine, got %d", diff)
+			}
+
+			// Drain the remaining metrics so that the collecting
+			// goroutine can terminate.
+			for range ch {
+			}
+			return
+		case <-time.After(1 * time.Second):
+			t.Fatalf("expected collect timed out")
+		}
+	}
+}
+
+func TestGCCollector(t *testing.T) {
+	var (
+		c        = NewGoCollector()
+		ch       = make(chan Metric)
+		waitc    = make(chan struct{})
+		closec   = make(chan struct{})
+		oldGC    uint64
+		oldPause float64
+	)
+	defer close(closec)
+
+	go func() {
+		c.Collect(ch)
+		// force GC
+		runtime.GC()
+		<-waitc
+		c.Collect(ch)
+		close(ch)
+	}()
 
-				return
-			default:
-				t.Errorf("want type Gauge, got %s", reflect.TypeOf(metric))
+	first := true
+	for {
+		select {
+		case metric := <-ch:
+			if metric.Desc() != c.gcDesc {
+				continue
+			}
+			pb := &dto.Metric{}
+			metric.Write(pb)
+			if pb.GetSummary() == nil {
+				continue
+			}
+			if len(pb.GetSummary().Quantile) != 5 {
+				t.Errorf("expected 5 quantiles, got %d", len(pb.GetSummary().Quantile))
+			}
+			for idx, want := range []float64{0.0, 0.25, 0.5, 0.75, 1.0} {
+				if *pb.GetSummary().Quantile[idx].Quantile != want {
+					t.Errorf("bucket #%d is off, got %f, want %f", idx, *pb.GetSummary().Quantile[idx].Quantile, want)
+				}
+			}
+			if first {
+				first = false
+				oldGC = *pb.GetSummary().SampleCount
+				oldPause = *pb.GetSummary().SampleSum
+				close(waitc)
+				continue
 			}
+			if diff := *pb.GetSummary().SampleCount - oldGC; diff < 1 {
+				t.Errorf("want at least 1 new garbage collection run, got %d", diff)
+			}
+			if diff := *pb.GetSummary().SampleSum - oldPause; diff <= 0 {
+				t.Errorf("want an increase in pause time, got a change of %f", diff)
+			}
+			for range ch {
+			}
+			return
 		case <-time.After(1 * time.Second):
 			t.Fatalf("expected collect timed out")
 		}
 	}
 }
+
+func TestGoCollectorMemStats(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.Register(NewGoCollector()); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, mf := range mfs {
+		got[mf.GetName()] = true
+	}
+	for _, name := range []string{
+		"go_goroutines",
+		"go_threads",
+		"go_gc_duration_seconds",
+		"go_memstats_alloc_bytes",
+		"go_memstats_alloc_bytes_total",
+		"go_memstats_heap_objects",
+		"go_memstats_last_gc_time_seconds",
+		"go_memstats_gc_cpu_fraction",
+	} {
+		if !got[name] {
+			t.Errorf("metric %s not collected", name)
+		}
+	}
+}
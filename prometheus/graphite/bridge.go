@@ -0,0 +1,220 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package graphite provides a bridge to push the metrics of a Prometheus
+// Gatherer to a Graphite (Carbon) server in the plaintext protocol. It is
+// meant for setups migrating from Graphite, where the existing dashboards and
+// alerts still expect the metrics in Graphite while a Prometheus server is
+// being set up.
+//
+// Each sample is written as one line of the form
+//     <prefix>.<name>.<label name>.<label value>... <value> <timestamp>
+// Summaries and histograms are expanded into their quantiles or buckets, their
+// sum, and their count, in the same way as in the text format. Label pairs
+// are sorted by label name. Characters not allowed in a Graphite path
+// component are replaced by "_".
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/internal"
+)
+
+const millisecondsPerSecond = 1000
+
+// ErrorHandling defines how a Bridge handles errors while gathering.
+type ErrorHandling = internal.ErrorHandling
+
+// These constants cause a Bridge to behave as described if errors are
+// encountered while gathering.
+const (
+	// Push as many metrics as possible. The error is still returned by
+	// Push and logged by Run.
+	ContinueOnError = internal.ContinueOnError
+	// Return the error without pushing anything.
+	AbortOnError = internal.AbortOnError
+)
+
+// Logger is the minimal interface a Bridge needs for logging. Note that
+// log.Logger from the standard library implements this interface.
+type Logger = internal.Logger
+
+// Config defines the Graphite bridge config. It is mandatory to set URL. All
+// other fields are optional and can safely be left at their zero value.
+type Config struct {
+	// URL is the address of the Carbon plaintext receiver in the form
+	// "host:port", e.g. "graphite.example.org:2003". Mandatory!
+	URL string
+
+	// Prefix is prepended to the path of all metrics, separated by a
+	// ".". If empty, no prefix is used.
+	Prefix string
+
+	// Interval is the time between two pushes of Run. If 0, it defaults
+	// to 15s.
+	Interval time.Duration
+
+	// Timeout is the timeout for connecting to Carbon and for writing the
+	// metrics. If 0, it defaults to the Interval.
+	Timeout time.Duration
+
+	// Gatherer is the source of the metrics. If nil,
+	// prometheus.DefaultGatherer is used.
+	Gatherer prometheus.Gatherer
+
+	// Logger is used by Run to log the errors of the periodic pushes. If
+	// nil, errors are not logged at all.
+	Logger Logger
+
+	// ErrorHandling defines how errors while gathering are handled.
+	ErrorHandling ErrorHandling
+}
+
+// Bridge pushes metrics to a Graphite server. Create instances with NewBridge.
+type Bridge struct {
+	url      string
+	prefix   string
+	interval time.Duration
+	timeout  time.Duration
+
+	errorHandling ErrorHandling
+	logger        Logger
+
+	g prometheus.Gatherer
+}
+
+// NewBridge returns a pointer to a new Bridge struct based on the provided
+// Config. It returns an error if the URL is missing or if the ErrorHandling is
+// unknown.
+func NewBridge(c *Config) (*Bridge, error) {
+	if c.URL == "" {
+		return nil, errors.New("graphite: missing URL")
+	}
+	if err := c.ErrorHandling.Check(); err != nil {
+		return nil, fmt.Errorf("graphite: %s", err)
+	}
+
+	b := &Bridge{
+		url:           c.URL,
+		prefix:        c.Prefix,
+		interval:      c.Interval,
+		timeout:       c.Timeout,
+		errorHandling: c.ErrorHandling,
+		logger:        c.Logger,
+		g:             c.Gatherer,
+	}
+	if b.interval == 0 {
+		b.interval = internal.DefaultBridgeInterval
+	}
+	if b.timeout == 0 {
+		b.timeout = b.interval
+	}
+	if b.g == nil {
+		b.g = prometheus.DefaultGatherer
+	}
+	return b, nil
+}
+
+// Run starts the event loop that pushes metrics every Interval of the Config
+// until the provided context is done. Errors are logged to the Logger of the
+// Config, if any. Run blocks, so it is usually called in its own goroutine.
+func (b *Bridge) Run(ctx context.Context) {
+	internal.RunBridge(ctx, b.interval, func(context.Context) error { return b.Push() }, b.logger, "error pushing to Graphite:")
+}
+
+// Push gathers the metrics and pushes them to Graphite once. With
+// ContinueOnError, the metrics gathered successfully are pushed even if
+// gathering returned an error, and that error is returned after the push.
+func (b *Bridge) Push() error {
+	mfs, gatherErr := internal.GatherForBridge(b.g, b.errorHandling)
+	if len(mfs) == 0 {
+		return gatherErr
+	}
+
+	conn, err := net.DialTimeout("tcp", b.url, b.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(b.timeout)); err != nil {
+		return err
+	}
+
+	if err := writeMetrics(conn, mfs, b.prefix, time.Now()); err != nil {
+		return err
+	}
+	return gatherErr
+}
+
+// writeMetrics writes the samples of the provided metric families to w in the
+// Graphite plaintext protocol. Samples without a timestamp get the provided
+// now. Samples with a NaN or infinite value are skipped, as Carbon would
+// reject the whole line.
+func writeMetrics(w io.Writer, mfs []*dto.MetricFamily, prefix string, now time.Time) error {
+	buf := bufio.NewWriter(w)
+	for _, s := range internal.FlattenMetricFamilies(mfs) {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+		if prefix != "" {
+			if _, err := buf.WriteString(prefix + "."); err != nil {
+				return err
+			}
+		}
+		if _, err := buf.WriteString(sanitize(s.Name)); err != nil {
+			return err
+		}
+		for _, lp := range s.Labels {
+			if _, err := fmt.Fprintf(buf, ".%s.%s", sanitize(lp.Name), sanitize(lp.Value)); err != nil {
+				return err
+			}
+		}
+		ts := now.Unix()
+		if s.TimestampMs != 0 {
+			ts = s.TimestampMs / millisecondsPerSecond
+		}
+		if _, err := fmt.Fprintf(
+			buf, " %s %d\n", strconv.FormatFloat(s.Value, 'g', -1, 64), ts,
+		); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// sanitize replaces all characters that are not allowed in a Graphite path
+// component by "_". In particular, "." would otherwise introduce an
+// additional level in the path.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
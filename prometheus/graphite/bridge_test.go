@@ -0,0 +1,157 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSanitize(t *testing.T) {
+	scenarios := []struct {
+		in, out string
+	}{
+		{in: "abc_DEF-123:x", out: "abc_DEF-123:x"},
+		{in: "a.b c/d", out: "a_b_c_d"},
+		{in: "+Inf", out: "_Inf"},
+		{in: "0.25", out: "0_25"},
+		{in: "", out: ""},
+	}
+	for i, s := range scenarios {
+		if got := sanitize(s.in); got != s.out {
+			t.Errorf("%d. want %q, got %q", i, s.out, got)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cv := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "requests_total", Help: "Requests."},
+		[]string{"method", "code"},
+	)
+	cv.WithLabelValues("get", "200").Add(3)
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature", Help: "Temperature."})
+	g.Set(21.5)
+	nan := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nan", Help: "Not a number."})
+	nan.Set(math.NaN())
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "latency_seconds",
+		Help:    "Latency.",
+		Buckets: []float64{0.5},
+	})
+	h.Observe(0.25)
+	h.Observe(2)
+	reg.MustRegister(cv, g, nan, h)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, mfs, "prefix", time.Unix(1500000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `prefix.latency_seconds_bucket.le.0_5 1 1500000000
+prefix.latency_seconds_bucket.le._Inf 2 1500000000
+prefix.latency_seconds_sum 2.25 1500000000
+prefix.latency_seconds_count 2 1500000000
+prefix.requests_total.code.200.method.get 3 1500000000
+prefix.temperature 21.5 1500000000
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestWriteMetricsTimestamp(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	desc := prometheus.NewDesc("mirrored", "Mirrored from elsewhere.", nil, nil)
+	reg.MustRegister(&constCollector{prometheus.NewMetricWithTimestamp(
+		time.Unix(1500000000, 123456789),
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1),
+	)})
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeMetrics(&buf, mfs, "", time.Unix(1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	// Timestamps are written in seconds.
+	if got, want := buf.String(), "mirrored 1 1500000000\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+type constCollector struct {
+	m prometheus.Metric
+}
+
+func (c *constCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.m.Desc() }
+func (c *constCollector) Collect(ch chan<- prometheus.Metric) { ch <- c.m }
+
+func TestPush(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		body, _ := ioutil.ReadAll(conn)
+		received <- string(body)
+	}()
+
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "pushes_total", Help: "Pushes."})
+	c.Inc()
+	reg.MustRegister(c)
+
+	b, err := NewBridge(&Config{
+		URL:      ln.Addr().String(),
+		Prefix:   "app",
+		Gatherer: reg,
+		Timeout:  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Push(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-received:
+		if !strings.HasPrefix(got, "app.pushes_total 1 ") {
+			t.Errorf("unexpected line %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for metrics")
+	}
+}
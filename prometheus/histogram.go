@@ -0,0 +1,1015 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// A Histogram counts individual observations from an event or sample stream in
+// configurable buckets. Similar to a summary, it also provides a sum of
+// observations and an observation count.
+//
+// On the Prometheus server, quantiles can be calculated from a Histogram using
+// the histogram_quantile function in the query language.
+//
+// Note that Histograms, in contrast to Summaries, can be aggregated with the
+// Prometheus query language (see the documentation for detailed
+// procedures). However, Histograms require the user to pre-define suitable
+// buckets, and they are in general less accurate. The Observe method of a
+// Histogram has a very low performance overhead in comparison with the Observe
+// method of a Summary.
+//
+// Like Counters, Histograms report the time of their creation as a created
+// timestamp in the protocol buffer exposition format.
+//
+// To create Histogram instances, use NewHistogram.
+type Histogram interface {
+	Metric
+	Collector
+
+	// Observe adds a single observation to the histogram.
+	Observe(float64)
+
+	// SetBuckets atomically replaces the regular buckets of the histogram
+	// with the provided ones. The same rules as for the Buckets field of
+	// HistogramOpts apply, and SetBuckets panics if they are violated. The
+	// observations counted so far are carried over: The count of each old
+	// bucket is moved to the first new bucket whose upper bound is greater
+	// than or equal to the upper bound of the old bucket. Thus, the new
+	// buckets are only precise where their upper bounds coincide with upper
+	// bounds of the old buckets. The sum and count of observations, as
+	// well as a native histogram (if configured), are not affected.
+	SetBuckets([]float64)
+	// ResetBuckets works like SetBuckets but resets the histogram instead
+	// of carrying over the observations counted so far. All counts, the
+	// sum, exemplars, and a native histogram (if configured) are reset, and
+	// the created timestamp is set to the current time so that the reset
+	// is visible to the Prometheus server.
+	ResetBuckets([]float64)
+}
+
+// bucketLabel is used for the label that defines the upper bound of a
+// bucket of a histogram ("le" -> "less or equal").
+const bucketLabel = "le"
+
+var (
+	// DefBuckets are the default Histogram buckets. The default buckets are
+	// tailored to broadly measure response time in seconds. Most likely,
+	// however, you will be required to define buckets customized to your
+	// use case.
+	DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	errBucketLabelNotAllowed = fmt.Errorf(
+		"%q is not allowed as label name in histograms", bucketLabel,
+	)
+)
+
+// Constants relevant to native histograms.
+const (
+	// DefNativeHistogramZeroThreshold is the default value for
+	// NativeHistogramZeroThreshold in the HistogramOpts. It is 2^-128 (or
+	// 0.5*2^-127 in the actual IEEE 754 representation), which is a bucket
+	// boundary at all possible resolutions.
+	DefNativeHistogramZeroThreshold = 2.938735877055719e-39
+	// NativeHistogramZeroThresholdZero can be used as NativeHistogramZeroThreshold
+	// in the HistogramOpts to create a zero bucket of width zero, i.e. a zero
+	// bucket that only receives observations of precisely zero.
+	NativeHistogramZeroThresholdZero = -1
+
+	// nativeHistogramSchemaMinimum and nativeHistogramSchemaMaximum are the
+	// lowest and highest schema that can be used for native histograms.
+	nativeHistogramSchemaMinimum = -4
+	nativeHistogramSchemaMaximum = 8
+)
+
+// nativeHistogramBounds contains, for each of the positive schemas, the upper
+// bounds of the buckets within one power of two, normalized to the interval
+// [0.5, 1) as returned by math.Frexp. Entry 0 is unused as schemas <= 0 don't
+// need a lookup table.
+var nativeHistogramBounds [nativeHistogramSchemaMaximum + 1][]float64
+
+func init() {
+	for schema := 1; schema <= nativeHistogramSchemaMaximum; schema++ {
+		n := 1 << uint(schema)
+		bounds := make([]float64, n)
+		for i := range bounds {
+			bounds[i] = math.Exp2(float64(i)/float64(n)) / 2
+		}
+		nativeHistogramBounds[schema] = bounds
+	}
+}
+
+// LinearBuckets creates 'count' buckets, each 'width' wide, where the lowest
+// bucket has an upper bound of 'start'. The final +Inf bucket is not counted
+// and not included in the returned slice. The returned slice is meant to be
+// used for the Buckets field of HistogramOpts.
+//
+// The function panics if 'count' is zero or negative.
+func LinearBuckets(start, width float64, count int) []float64 {
+	if count < 1 {
+		panic("LinearBuckets needs a positive count")
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start += width
+	}
+	return buckets
+}
+
+// ExponentialBuckets creates 'count' buckets, where the lowest bucket has an
+// upper bound of 'start' and each following bucket's upper bound is 'factor'
+// times the previous bucket's upper bound. The final +Inf bucket is not counted
+// and not included in the returned slice. The returned slice is meant to be
+// used for the Buckets field of HistogramOpts.
+//
+// The function panics if 'count' is 0 or negative, if 'start' is 0 or negative,
+// or if 'factor' is less than or equal 1.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 {
+		panic("ExponentialBuckets needs a positive count")
+	}
+	if start <= 0 {
+		panic("ExponentialBuckets needs a positive start value")
+	}
+	if factor <= 1 {
+		panic("ExponentialBuckets needs a factor greater than 1")
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// ExponentialBucketsRange creates 'count' buckets, where the lowest bucket has
+// an upper bound of 'min' and the highest bucket has an upper bound of
+// 'max'. The factor between the upper bounds of adjacent buckets is calculated
+// accordingly. The final +Inf bucket is not counted and not included in the
+// returned slice. The returned slice is meant to be used for the Buckets field
+// of HistogramOpts.
+//
+// The function panics if 'count' is less than 2, if 'min' is 0 or negative, or
+// if 'max' is not greater than 'min'.
+func ExponentialBucketsRange(min, max float64, count int) []float64 {
+	if count < 2 {
+		panic("ExponentialBucketsRange needs a count of at least 2")
+	}
+	if min <= 0 {
+		panic("ExponentialBucketsRange needs a positive min value")
+	}
+	if max <= min {
+		panic("ExponentialBucketsRange needs a max value greater than min")
+	}
+	// The factor f fulfills min * f^(count-1) = max.
+	factor := math.Pow(max/min, 1/float64(count-1))
+	buckets := ExponentialBuckets(min, factor, count)
+	// Avoid rounding errors in the highest upper bound.
+	buckets[count-1] = max
+	return buckets
+}
+
+// HistogramOpts bundles the options for creating a Histogram metric. It is
+// mandatory to set Name and Help to a non-empty string. All other fields are
+// optional and can safely be left at their zero value.
+type HistogramOpts struct {
+	// Namespace, Subsystem, and Name are components of the fully-qualified
+	// name of the Histogram (created by joining these components with
+	// "_"). Only Name is mandatory, the others merely help structuring the
+	// name. Note that the fully-qualified name of the Histogram must be a
+	// valid Prometheus metric name.
+	Namespace string
+	Subsystem string
+	Name      string
+
+	// Help provides information about this Histogram. Mandatory!
+	//
+	// Metrics with the same fully-qualified name must have the same Help
+	// string.
+	Help string
+
+	// Unit is the unit of the observed values, e.g. "seconds". See the
+	// Opts documentation for details.
+	Unit string
+
+	// ConstLabels are used to attach fixed labels to this
+	// Histogram. Histograms with the same fully-qualified name must have the
+	// same label names in their ConstLabels.
+	//
+	// Note that in most cases, labels have a value that varies during the
+	// lifetime of a process. Those labels are usually managed with a
+	// HistogramVec. ConstLabels serve only special purposes. One is for the
+	// special case where the value of a label does not change during the
+	// lifetime of a process, e.g. if the revision of the running binary is
+	// put into a label. Another, more advanced purpose is if more than one
+	// Collector needs to collect Histograms with the same fully-qualified
+	// name. In that case, those Histograms must differ in the values of
+	// their ConstLabels. See the Collector examples.
+	//
+	// If the value of a label never changes (not even between binaries),
+	// that label most likely should not be a label at all (but part of the
+	// metric name).
+	ConstLabels Labels
+
+	// Buckets defines the buckets into which observations are counted. Each
+	// element in the slice is the upper inclusive bound of a bucket. The
+	// values must be sorted in strictly increasing order. There is no need
+	// to add a highest bucket with +Inf bound, it will be added
+	// implicitly. If Buckets is left empty, the default value is DefBuckets,
+	// unless a native histogram is configured (see below), in which case no
+	// regular buckets are used at all. See LinearBuckets,
+	// ExponentialBuckets, and ExponentialBucketsRange for helpers to create
+	// common bucket layouts.
+	Buckets []float64
+
+	// If NativeHistogramBucketFactor is greater than one, a native histogram
+	// (also known as sparse histogram) with exponential bucket boundaries is
+	// maintained in addition to the regular buckets (if any). Native
+	// histograms are only exposed via the protobuf exposition format. The
+	// buckets are created on demand, so there is no need to pre-define
+	// them.
+	//
+	// NativeHistogramBucketFactor is the maximum ratio between the upper
+	// bounds of consecutive buckets. The actual factor used is picked from
+	// the series 2^(2^-n), i.e. it is equal to or smaller than the requested
+	// factor, resulting in a resolution of 2^n buckets per power of two,
+	// with n ranging from -4 to 8 (corresponding to factors of 65536 and
+	// about 1.0027, respectively). With a factor of 1.1, for example, the
+	// picked factor is about 1.09, resulting in 8 buckets per power of two.
+	NativeHistogramBucketFactor float64
+	// All observations with an absolute value of less or equal
+	// NativeHistogramZeroThreshold are accumulated into a "zero" bucket. For
+	// best results, this should be close to a bucket boundary. This is
+	// usually the case if picking a power of two. If
+	// NativeHistogramZeroThreshold is left at zero,
+	// DefNativeHistogramZeroThreshold is used as the threshold. To configure
+	// a zero bucket with an actual threshold of zero (i.e. only observations
+	// of precisely zero will go into the zero bucket), set
+	// NativeHistogramZeroThreshold to the NativeHistogramZeroThresholdZero
+	// constant (or any negative float value).
+	NativeHistogramZeroThreshold float64
+
+	// The buckets of a native histogram are created on demand. To prevent a
+	// wide spread of observed values from using up an unbounded amount of
+	// memory, NativeHistogramMaxBucketNumber limits the number of buckets
+	// (not counting the zero bucket). If it is left at zero, the number of
+	// buckets is not limited. Otherwise, once the limit is exceeded, the
+	// number of buckets is reduced with one of the following strategies:
+	//
+	// If NativeHistogramMinResetDuration is positive and at least that
+	// much time has passed since the histogram was created or last reset,
+	// the whole histogram (including its regular buckets, count, and sum)
+	// is reset, and the created timestamp is set to the current time.
+	//
+	// Otherwise, the resolution of the native histogram is reduced by
+	// doubling the width of each bucket (i.e. decrementing the schema),
+	// which merges pairs of adjacent buckets. This is repeated until the
+	// limit is met again or the lowest resolution is reached. The reduced
+	// resolution stays in place until the next reset.
+	NativeHistogramMaxBucketNumber  uint32
+	NativeHistogramMinResetDuration time.Duration
+}
+
+// NewHistogram creates a new Histogram based on the provided HistogramOpts. It
+// panics if the buckets in HistogramOpts are not in strictly increasing order.
+func NewHistogram(opts HistogramOpts) Histogram {
+	return newHistogram(
+		NewDescWithUnit(
+			BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+			opts.Help,
+			opts.Unit,
+			nil,
+			opts.ConstLabels,
+		),
+		opts,
+	)
+}
+
+func newHistogram(desc *Desc, opts HistogramOpts, labelValues ...string) Histogram {
+	if len(desc.variableLabels) != len(labelValues) {
+		panic(errInconsistentCardinality)
+	}
+
+	checkBucketLabel(desc)
+
+	if len(opts.Buckets) == 0 && opts.NativeHistogramBucketFactor <= 1 {
+		opts.Buckets = DefBuckets
+	}
+
+	h := &histogram{
+		desc:        desc,
+		upperBounds: checkBuckets(opts.Buckets),
+		labelPairs:  makeLabelPairs(desc, labelValues),
+		createdTs:   ptypes.TimestampNow(),
+	}
+	if opts.NativeHistogramBucketFactor > 1 {
+		h.native = newNativeHistogram(
+			opts.NativeHistogramBucketFactor,
+			opts.NativeHistogramZeroThreshold,
+			opts.NativeHistogramMaxBucketNumber,
+			opts.NativeHistogramMinResetDuration,
+		)
+	}
+	// Finally we know the final length of h.upperBounds and can make counts
+	// and exemplars. There is one more exemplar slot than regular buckets
+	// for observations that fall into the implicit +Inf bucket.
+	h.counts = make([]uint64, len(h.upperBounds))
+	h.exemplars = make([]atomic.Value, len(h.upperBounds)+1)
+
+	h.Init(h) // Init self-collection.
+	return h
+}
+
+// checkBucketLabel panics if the provided Desc uses the bucket label as a
+// variable or constant label.
+func checkBucketLabel(desc *Desc) {
+	for _, n := range desc.variableLabels {
+		if n == bucketLabel {
+			panic(errBucketLabelNotAllowed)
+		}
+	}
+	for _, lp := range desc.constLabelPairs {
+		if lp.GetName() == bucketLabel {
+			panic(errBucketLabelNotAllowed)
+		}
+	}
+}
+
+// checkBuckets panics if the provided upper bounds are not in strictly
+// increasing order. It returns the upper bounds without a trailing +Inf
+// bucket, which is always implicit.
+func checkBuckets(upperBounds []float64) []float64 {
+	for i, upperBound := range upperBounds {
+		if i < len(upperBounds)-1 {
+			if upperBound >= upperBounds[i+1] {
+				panic(fmt.Errorf(
+					"histogram buckets must be in increasing order: %f >= %f",
+					upperBound, upperBounds[i+1],
+				))
+			}
+		} else {
+			if math.IsInf(upperBound, +1) {
+				// The +Inf bucket is implicit. Remove it here.
+				upperBounds = upperBounds[:i]
+			}
+		}
+	}
+	return upperBounds
+}
+
+type histogram struct {
+	// sumBits contains the bits of the float64 representing the sum of all
+	// observations. sumBits and count have to go first in the struct to
+	// guarantee alignment for atomic operations.
+	// http://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	sumBits uint64
+	count   uint64
+
+	SelfCollector
+	// layoutMtx protects the bucket layout, i.e. upperBounds, counts, and
+	// exemplars (but not the elements of counts and exemplars, which are
+	// updated atomically), and createdTs. Observations and Write only need
+	// a read lock, SetBuckets and ResetBuckets take the write lock. A native
+	// histogram, if configured, has a mutex of its own.
+	layoutMtx sync.RWMutex
+
+	desc *Desc
+
+	upperBounds []float64
+	counts      []uint64
+	exemplars   []atomic.Value // One more than buckets (to include +Inf), each a *dto.Exemplar.
+
+	// native is nil unless a native histogram has been configured.
+	native *nativeHistogram
+
+	labelPairs []*dto.LabelPair
+	createdTs  *timestamp.Timestamp
+}
+
+func (h *histogram) Desc() *Desc {
+	return h.desc
+}
+
+func (h *histogram) Observe(v float64) {
+	h.layoutMtx.RLock()
+	reset := h.observe(v, sort.SearchFloat64s(h.upperBounds, v))
+	h.layoutMtx.RUnlock()
+
+	if reset {
+		h.resetNative(v)
+	}
+}
+
+func (h *histogram) ObserveWithExemplar(v float64, e Labels) {
+	h.layoutMtx.RLock()
+	i := sort.SearchFloat64s(h.upperBounds, v)
+	reset := h.observe(v, i)
+	h.updateExemplar(v, i, e)
+	h.layoutMtx.RUnlock()
+
+	if reset {
+		h.resetNative(v)
+	}
+}
+
+// observe is the implementation for Observe without the bucket search, which
+// has to be done by the caller. It needs layoutMtx (at least) read-locked. It
+// returns true if the native histogram has exceeded its bucket limit and wants
+// the whole histogram to be reset, which the caller has to do via resetNative
+// after releasing layoutMtx.
+func (h *histogram) observe(v float64, i int) bool {
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	var reset bool
+	if h.native != nil {
+		reset = h.native.observe(v)
+	}
+	atomic.AddUint64(&h.count, 1)
+	for {
+		oldBits := atomic.LoadUint64(&h.sumBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+		if atomic.CompareAndSwapUint64(&h.sumBits, oldBits, newBits) {
+			break
+		}
+	}
+	return reset
+}
+
+func (h *histogram) Write(out *dto.Metric) error {
+	h.layoutMtx.RLock()
+	defer h.layoutMtx.RUnlock()
+
+	his := &dto.Histogram{}
+	buckets := make([]*dto.Bucket, len(h.upperBounds))
+
+	his.SampleSum = proto.Float64(math.Float64frombits(atomic.LoadUint64(&h.sumBits)))
+	his.SampleCount = proto.Uint64(atomic.LoadUint64(&h.count))
+	his.CreatedTimestamp = h.createdTs
+	var count uint64
+	for i, upperBound := range h.upperBounds {
+		count += atomic.LoadUint64(&h.counts[i])
+		buckets[i] = &dto.Bucket{
+			CumulativeCount: proto.Uint64(count),
+			UpperBound:      proto.Float64(upperBound),
+		}
+		if e, ok := h.exemplars[i].Load().(*dto.Exemplar); ok && e != nil {
+			buckets[i].Exemplar = e
+		}
+	}
+	// The +Inf bucket is implicit and therefore not part of the bucket
+	// list. It is only added explicitly if it carries an exemplar.
+	if e, ok := h.exemplars[len(h.upperBounds)].Load().(*dto.Exemplar); ok && e != nil {
+		buckets = append(buckets, &dto.Bucket{
+			CumulativeCount: proto.Uint64(his.GetSampleCount()),
+			UpperBound:      proto.Float64(math.Inf(1)),
+			Exemplar:        e,
+		})
+	}
+	his.Bucket = buckets
+	if h.native != nil {
+		h.native.write(his)
+	}
+	out.Histogram = his
+	out.Label = h.labelPairs
+	return nil
+}
+
+func (h *histogram) SetBuckets(buckets []float64) {
+	h.layoutMtx.Lock()
+	defer h.layoutMtx.Unlock()
+
+	upperBounds := h.newUpperBounds(buckets)
+	counts := make([]uint64, len(upperBounds))
+	exemplars := make([]atomic.Value, len(upperBounds)+1)
+	for i, upperBound := range h.upperBounds {
+		// Counts of old buckets beyond the highest new upper bound end
+		// up in the implicit +Inf bucket.
+		if j := sort.SearchFloat64s(upperBounds, upperBound); j < len(counts) {
+			counts[j] += h.counts[i]
+		}
+	}
+	for i := range h.exemplars {
+		// Exemplars are moved to the new bucket their value falls into.
+		if e, ok := h.exemplars[i].Load().(*dto.Exemplar); ok && e != nil {
+			exemplars[sort.SearchFloat64s(upperBounds, e.GetValue())].Store(e)
+		}
+	}
+	h.upperBounds, h.counts, h.exemplars = upperBounds, counts, exemplars
+}
+
+func (h *histogram) ResetBuckets(buckets []float64) {
+	h.layoutMtx.Lock()
+	defer h.layoutMtx.Unlock()
+
+	h.reset(h.newUpperBounds(buckets))
+}
+
+// resetNative resets the histogram on behalf of a native histogram that has
+// exceeded its bucket limit upon observing v. As other goroutines might have
+// requested the same in the meantime, the native histogram is asked again
+// while holding the write lock.
+func (h *histogram) resetNative(v float64) {
+	h.layoutMtx.Lock()
+	defer h.layoutMtx.Unlock()
+
+	if h.native.resetDue() {
+		h.reset(h.upperBounds)
+		// Observe v again so that the observation that triggered the
+		// reset is not lost.
+		h.observe(v, sort.SearchFloat64s(h.upperBounds, v))
+	}
+}
+
+// reset resets the histogram to the provided upper bounds. It needs layoutMtx
+// locked.
+func (h *histogram) reset(upperBounds []float64) {
+	h.upperBounds = upperBounds
+	h.counts = make([]uint64, len(h.upperBounds))
+	h.exemplars = make([]atomic.Value, len(h.upperBounds)+1)
+	atomic.StoreUint64(&h.count, 0)
+	atomic.StoreUint64(&h.sumBits, 0)
+	if h.native != nil {
+		h.native.reset()
+	}
+	h.createdTs = ptypes.TimestampNow()
+}
+
+// newUpperBounds checks the provided buckets in the same way as newHistogram
+// does and returns the resulting upper bounds.
+func (h *histogram) newUpperBounds(buckets []float64) []float64 {
+	if len(buckets) == 0 && h.native == nil {
+		buckets = DefBuckets
+	}
+	// Copy the buckets as checkBuckets might return the provided slice.
+	return checkBuckets(append([]float64(nil), buckets...))
+}
+
+func (h *histogram) updateExemplar(v float64, bucket int, l Labels) {
+	if l == nil {
+		return
+	}
+	e, err := newExemplar(v, time.Now(), l)
+	if err != nil {
+		panic(err)
+	}
+	h.exemplars[bucket].Store(e)
+}
+
+// nativeHistogram holds the sparse buckets of a native histogram. Buckets are
+// identified by their index, where the bucket with index i has an upper
+// (inclusive) bound of (2^(2^-schema))^i. Buckets are only created once they
+// receive their first observation.
+type nativeHistogram struct {
+	mtx sync.Mutex // Protects schema, zeroCount, positive, negative, and lastReset.
+
+	schema        int32
+	zeroThreshold float64
+
+	zeroCount          uint64
+	positive, negative map[int]uint64
+
+	// Configuration of the bucket limit. maxBuckets is zero if the number
+	// of buckets is not limited.
+	initialSchema    int32
+	maxBuckets       uint32
+	minResetDuration time.Duration
+
+	lastReset time.Time
+}
+
+func newNativeHistogram(
+	bucketFactor, zeroThreshold float64,
+	maxBuckets uint32,
+	minResetDuration time.Duration,
+) *nativeHistogram {
+	switch {
+	case zeroThreshold == 0:
+		zeroThreshold = DefNativeHistogramZeroThreshold
+	case zeroThreshold < 0:
+		zeroThreshold = 0
+	}
+	schema := pickSchema(bucketFactor)
+	return &nativeHistogram{
+		schema:           schema,
+		zeroThreshold:    zeroThreshold,
+		positive:         map[int]uint64{},
+		negative:         map[int]uint64{},
+		initialSchema:    schema,
+		maxBuckets:       maxBuckets,
+		minResetDuration: minResetDuration,
+		lastReset:        time.Now(),
+	}
+}
+
+// reset removes all observations from the native histogram and restores its
+// initial resolution.
+func (nh *nativeHistogram) reset() {
+	nh.mtx.Lock()
+	defer nh.mtx.Unlock()
+
+	nh.schema = nh.initialSchema
+	nh.zeroCount = 0
+	nh.positive = map[int]uint64{}
+	nh.negative = map[int]uint64{}
+	nh.lastReset = time.Now()
+}
+
+// resetDue returns true if the native histogram exceeds its bucket limit and
+// may be reset according to its minimum reset duration.
+func (nh *nativeHistogram) resetDue() bool {
+	nh.mtx.Lock()
+	defer nh.mtx.Unlock()
+
+	return nh.resetDueLocked()
+}
+
+// resetDueLocked is the implementation of resetDue. It needs mtx locked.
+func (nh *nativeHistogram) resetDueLocked() bool {
+	return nh.maxBuckets > 0 &&
+		uint32(len(nh.positive)+len(nh.negative)) > nh.maxBuckets &&
+		nh.minResetDuration > 0 &&
+		time.Since(nh.lastReset) >= nh.minResetDuration
+}
+
+// limitBuckets enforces the bucket limit by reducing the resolution or by
+// requesting a reset. It returns true in the latter case. It needs mtx
+// locked.
+func (nh *nativeHistogram) limitBuckets() bool {
+	if nh.maxBuckets == 0 {
+		return false
+	}
+	for uint32(len(nh.positive)+len(nh.negative)) > nh.maxBuckets {
+		if nh.resetDueLocked() {
+			return true
+		}
+		if nh.schema <= nativeHistogramSchemaMinimum {
+			// Nothing more we can do until the next reset.
+			return false
+		}
+		nh.doubleBucketWidth()
+	}
+	return false
+}
+
+// doubleBucketWidth decrements the schema by one and merges the buckets
+// accordingly. The bucket with index i at the old schema becomes part of the
+// bucket with index ceil(i/2) at the new schema. It needs mtx locked.
+func (nh *nativeHistogram) doubleBucketWidth() {
+	nh.schema--
+	nh.positive = mergeBucketPairs(nh.positive)
+	nh.negative = mergeBucketPairs(nh.negative)
+}
+
+// mergeBucketPairs returns the buckets resulting from merging each pair of
+// adjacent buckets in the provided map of bucket indices to counts.
+func mergeBucketPairs(buckets map[int]uint64) map[int]uint64 {
+	merged := make(map[int]uint64, len(buckets)/2+1)
+	for k, count := range buckets {
+		if k != math.MaxInt32 { // The bucket for +Inf stays where it is.
+			// Arithmetic shifting results in ceil(k/2) for negative
+			// indices, too.
+			k = (k + 1) >> 1
+		}
+		merged[k] += count
+	}
+	return merged
+}
+
+// pickSchema returns the largest number n between -4 and 8 such that
+// 2^(2^-n) is less or equal the provided bucketFactor.
+func pickSchema(bucketFactor float64) int32 {
+	floor := math.Floor(math.Log2(math.Log2(bucketFactor)))
+	switch {
+	case floor <= -nativeHistogramSchemaMaximum:
+		return nativeHistogramSchemaMaximum
+	case floor >= -nativeHistogramSchemaMinimum:
+		return nativeHistogramSchemaMinimum
+	default:
+		return -int32(floor)
+	}
+}
+
+// observe adds the observation to the native histogram. It returns true if the
+// native histogram requests a reset of the whole histogram, see limitBuckets.
+func (nh *nativeHistogram) observe(v float64) bool {
+	if math.IsNaN(v) {
+		// NaN observations only make it into the count and sum.
+		return false
+	}
+	abs := math.Abs(v)
+
+	nh.mtx.Lock()
+	defer nh.mtx.Unlock()
+
+	switch {
+	case abs <= nh.zeroThreshold:
+		nh.zeroCount++
+	case v > 0:
+		nh.positive[nh.bucketKey(abs)]++
+	default:
+		nh.negative[nh.bucketKey(abs)]++
+	}
+	return nh.limitBuckets()
+}
+
+// bucketKey returns the index of the bucket the provided absolute value
+// belongs into.
+func (nh *nativeHistogram) bucketKey(abs float64) int {
+	if math.IsInf(abs, +1) {
+		return math.MaxInt32
+	}
+	frac, exp := math.Frexp(abs)
+	if nh.schema > 0 {
+		bounds := nativeHistogramBounds[nh.schema]
+		return sort.SearchFloat64s(bounds, frac) + (exp-1)*len(bounds)
+	}
+	key := exp
+	if frac == 0.5 {
+		key--
+	}
+	offset := (1 << uint(-nh.schema)) - 1
+	return (key + offset) >> uint(-nh.schema)
+}
+
+func (nh *nativeHistogram) write(his *dto.Histogram) {
+	nh.mtx.Lock()
+	defer nh.mtx.Unlock()
+
+	his.Schema = proto.Int32(nh.schema)
+	his.ZeroThreshold = proto.Float64(nh.zeroThreshold)
+	his.ZeroCount = proto.Uint64(nh.zeroCount)
+	his.PositiveSpan, his.PositiveDelta = makeBuckets(nh.positive)
+	his.NegativeSpan, his.NegativeDelta = makeBuckets(nh.negative)
+
+	if nh.zeroThreshold == 0 && nh.zeroCount == 0 &&
+		len(his.PositiveSpan) == 0 && len(his.NegativeSpan) == 0 {
+		// Without any buckets and with a zero threshold of zero, the
+		// histogram would be indistinguishable from a regular one.
+		// Add a no-op span to mark it as a native histogram.
+		his.PositiveSpan = []*dto.BucketSpan{{
+			Offset: proto.Int32(0),
+			Length: proto.Uint32(0),
+		}}
+	}
+}
+
+// makeBuckets converts the provided map of bucket indices to counts into the
+// span and delta representation used in the protobuf format.
+func makeBuckets(buckets map[int]uint64) ([]*dto.BucketSpan, []int64) {
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+	keys := make([]int, 0, len(buckets))
+	for k := range buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	var (
+		spans     []*dto.BucketSpan
+		deltas    = make([]int64, 0, len(keys))
+		prevCount int64
+		nextKey   int
+	)
+	for i, k := range keys {
+		if i == 0 || k != nextKey {
+			// Start a new span. The offset of the first span is
+			// relative to index zero, all following offsets are
+			// relative to the end of the previous span.
+			offset := k
+			if i > 0 {
+				offset = k - nextKey
+			}
+			spans = append(spans, &dto.BucketSpan{
+				Offset: proto.Int32(int32(offset)),
+				Length: proto.Uint32(0),
+			})
+		}
+		span := spans[len(spans)-1]
+		*span.Length++
+		count := int64(buckets[k])
+		deltas = append(deltas, count-prevCount)
+		prevCount = count
+		nextKey = k + 1
+	}
+	return spans, deltas
+}
+
+// HistogramVec is a Collector that bundles a set of Histograms that all share
+// the same Desc, but have different values for their variable labels. This is
+// used if you want to count the same thing partitioned by various dimensions
+// (e.g. http request latencies, partitioned by status code and method). Create
+// instances with NewHistogramVec.
+type HistogramVec struct {
+	MetricVec
+}
+
+// NewHistogramVec creates a new HistogramVec based on the provided
+// HistogramOpts and partitioned by the given label names. At least one label
+// name must be provided.
+func NewHistogramVec(opts HistogramOpts, labelNames []string) *HistogramVec {
+	desc := NewDescWithUnit(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		opts.Unit,
+		labelNames,
+		opts.ConstLabels,
+	)
+	return &HistogramVec{
+		MetricVec: MetricVec{
+			children: map[uint64]Metric{},
+			desc:     desc,
+			hash:     fnv.New64a(),
+			newMetric: func(lvs ...string) Metric {
+				return newHistogram(desc, opts, lvs...)
+			},
+		},
+	}
+}
+
+// GetMetricWithLabelValues replaces the method of the same name in
+// MetricVec. The difference is that this method returns an Observer and not a
+// Metric so that no type conversion to an Observer is required. The returned
+// Observer is a Histogram, so that a type conversion to Histogram is possible if
+// needed.
+func (m *HistogramVec) GetMetricWithLabelValues(lvs ...string) (Observer, error) {
+	metric, err := m.MetricVec.GetMetricWithLabelValues(lvs...)
+	if metric != nil {
+		return metric.(Observer), err
+	}
+	return nil, err
+}
+
+// GetMetricWith replaces the method of the same name in MetricVec. The
+// difference is that this method returns an Observer and not a Metric so that
+// no type conversion to an Observer is required. See also
+// GetMetricWithLabelValues.
+func (m *HistogramVec) GetMetricWith(labels Labels) (Observer, error) {
+	metric, err := m.MetricVec.GetMetricWith(labels)
+	if metric != nil {
+		return metric.(Observer), err
+	}
+	return nil, err
+}
+
+// WithLabelValues works as GetMetricWithLabelValues, but panics where
+// GetMetricWithLabelValues would have returned an error. By not returning an
+// error, WithLabelValues allows shortcuts like
+//     myVec.WithLabelValues("404", "GET").Observe(42.21)
+func (m *HistogramVec) WithLabelValues(lvs ...string) Observer {
+	return m.MetricVec.WithLabelValues(lvs...).(Observer)
+}
+
+// With works as GetMetricWith, but panics where GetMetricWithLabels would have
+// returned an error. By not returning an error, With allows shortcuts like
+//     myVec.With(Labels{"code": "404", "method": "GET"}).Observe(42.21)
+func (m *HistogramVec) With(labels Labels) Observer {
+	return m.MetricVec.With(labels).(Observer)
+}
+
+// CurryWith returns a vector curried with the provided labels. See the
+// CurryWith method of MetricVec for details. The difference is that this method
+// returns an ObserverVec and not a MetricVec. The returned ObserverVec is a
+// *HistogramVec, so that a type conversion to *HistogramVec is possible if needed.
+func (m *HistogramVec) CurryWith(labels Labels) (ObserverVec, error) {
+	curried := &HistogramVec{}
+	if err := m.MetricVec.curryInto(&curried.MetricVec, labels); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *HistogramVec) MustCurryWith(labels Labels) ObserverVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
+type constHistogram struct {
+	desc       *Desc
+	count      uint64
+	sum        float64
+	buckets    map[float64]uint64
+	labelPairs []*dto.LabelPair
+}
+
+func (h *constHistogram) Desc() *Desc {
+	return h.desc
+}
+
+func (h *constHistogram) Write(out *dto.Metric) error {
+	his := &dto.Histogram{}
+	buckets := make([]*dto.Bucket, 0, len(h.buckets))
+
+	his.SampleCount = proto.Uint64(h.count)
+	his.SampleSum = proto.Float64(h.sum)
+
+	for upperBound, count := range h.buckets {
+		buckets = append(buckets, &dto.Bucket{
+			CumulativeCount: proto.Uint64(count),
+			UpperBound:      proto.Float64(upperBound),
+		})
+	}
+
+	if len(buckets) > 0 {
+		sort.Sort(buckSort(buckets))
+	}
+	his.Bucket = buckets
+
+	out.Histogram = his
+	out.Label = h.labelPairs
+
+	return nil
+}
+
+// NewConstHistogram returns a metric representing a Prometheus histogram with
+// fixed values for the count, sum, and bucket counts. As those parameters
+// cannot be changed, the returned value does not implement the Histogram
+// interface (but only the Metric interface). Users of this package will not
+// have much use for it in regular operations. However, when implementing custom
+// Collectors, it is useful as a throw-away metric that is generated on the fly
+// to send it to Prometheus in the Collect method.
+//
+// buckets is a map of upper bounds to cumulative counts, excluding the +Inf
+// bucket.
+//
+// NewConstHistogram returns an error if the length of labelValues is not
+// consistent with the variable labels in Desc.
+func NewConstHistogram(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	buckets map[float64]uint64,
+	labelValues ...string,
+) (Metric, error) {
+	if len(desc.variableLabels) != len(labelValues) {
+		return nil, errInconsistentCardinality
+	}
+	return &constHistogram{
+		desc:       desc,
+		count:      count,
+		sum:        sum,
+		buckets:    buckets,
+		labelPairs: makeLabelPairs(desc, labelValues),
+	}, nil
+}
+
+// MustNewConstHistogram is a version of NewConstHistogram that panics where
+// NewConstHistogram would have returned an error.
+func MustNewConstHistogram(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	buckets map[float64]uint64,
+	labelValues ...string,
+) Metric {
+	m, err := NewConstHistogram(desc, count, sum, buckets, labelValues...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+type buckSort []*dto.Bucket
+
+func (s buckSort) Len() int {
+	return len(s)
+}
+
+func (s buckSort) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+func (s buckSort) Less(i, j int) bool {
+	return s[i].GetUpperBound() < s[j].GetUpperBound()
+}
@@ -0,0 +1,916 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func benchmarkHistogramObserve(w int, b *testing.B) {
+	b.StopTimer()
+
+	wg := new(sync.WaitGroup)
+	wg.Add(w)
+
+	g := new(sync.WaitGroup)
+	g.Add(1)
+
+	s := NewHistogram(HistogramOpts{})
+
+	for i := 0; i < w; i++ {
+		go func() {
+			g.Wait()
+
+			for i := 0; i < b.N; i++ {
+				s.Observe(float64(i))
+			}
+
+			wg.Done()
+		}()
+	}
+
+	b.StartTimer()
+	g.Done()
+	wg.Wait()
+}
+
+func BenchmarkHistogramObserve1(b *testing.B) {
+	benchmarkHistogramObserve(1, b)
+}
+
+func BenchmarkHistogramObserve2(b *testing.B) {
+	benchmarkHistogramObserve(2, b)
+}
+
+func BenchmarkHistogramObserve4(b *testing.B) {
+	benchmarkHistogramObserve(4, b)
+}
+
+func BenchmarkHistogramObserve8(b *testing.B) {
+	benchmarkHistogramObserve(8, b)
+}
+
+func benchmarkHistogramWrite(w int, b *testing.B) {
+	b.StopTimer()
+
+	wg := new(sync.WaitGroup)
+	wg.Add(w)
+
+	g := new(sync.WaitGroup)
+	g.Add(1)
+
+	s := NewHistogram(HistogramOpts{})
+
+	for i := 0; i < 1000000; i++ {
+		s.Observe(float64(i))
+	}
+
+	for j := 0; j < w; j++ {
+		outs := make([]dto.Metric, b.N)
+
+		go func(o []dto.Metric) {
+			g.Wait()
+
+			for i := 0; i < b.N; i++ {
+				s.Write(&o[i])
+			}
+
+			wg.Done()
+		}(outs)
+	}
+
+	b.StartTimer()
+	g.Done()
+	wg.Wait()
+}
+
+func BenchmarkHistogramWrite1(b *testing.B) {
+	benchmarkHistogramWrite(1, b)
+}
+
+func BenchmarkHistogramWrite2(b *testing.B) {
+	benchmarkHistogramWrite(2, b)
+}
+
+func BenchmarkHistogramWrite4(b *testing.B) {
+	benchmarkHistogramWrite(4, b)
+}
+
+func BenchmarkHistogramWrite8(b *testing.B) {
+	benchmarkHistogramWrite(8, b)
+}
+
+func TestHistogramConcurrency(t *testing.T) {
+	rand.Seed(42)
+
+	it := func(n uint32) bool {
+		mutations := int(n%1e4 + 1e4)
+		concLevel := int(n%5 + 1)
+		total := mutations * concLevel
+
+		var start, end sync.WaitGroup
+		start.Add(1)
+		end.Add(concLevel)
+
+		testBuckets := []float64{-2, -1, -0.5, 0, 0.5, 1, 2, math.Inf(+1)}
+
+		his := NewHistogram(HistogramOpts{
+			Name:    "test_histogram",
+			Help:    "helpless",
+			Buckets: testBuckets,
+		})
+
+		allVars := make([]float64, total)
+		var sampleSum float64
+		for i := 0; i < concLevel; i++ {
+			vals := make([]float64, mutations)
+			for j := 0; j < mutations; j++ {
+				v := rand.NormFloat64()
+				vals[j] = v
+				allVars[i*mutations+j] = v
+				sampleSum += v
+			}
+
+			go func(vals []float64) {
+				start.Wait()
+				for _, v := range vals {
+					his.Observe(v)
+				}
+				end.Done()
+			}(vals)
+		}
+		sort.Float64s(allVars)
+		start.Done()
+		end.Wait()
+
+		m := &dto.Metric{}
+		his.Write(m)
+		if got, want := int(m.Histogram.GetSampleCount()), total; got != want {
+			t.Errorf("got sample count %d, want %d", got, want)
+		}
+		if got, want := m.Histogram.GetSampleSum(), sampleSum; math.Abs((got-want)/want) > 0.001 {
+			t.Errorf("got sample sum %f, want %f", got, want)
+		}
+
+		wantCounts := getCumulativeCounts(allVars)
+
+		if got, want := len(m.Histogram.Bucket), len(testBuckets)-1; got != want {
+			t.Errorf("got %d buckets in protobuf, want %d", got, want)
+		}
+		for i, wantBound := range testBuckets {
+			if i == len(testBuckets)-1 {
+				break // No +Inf bucket in protobuf.
+			}
+			if gotBound := m.Histogram.Bucket[i].GetUpperBound(); gotBound != wantBound {
+				t.Errorf("got bound %f, want %f", gotBound, wantBound)
+			}
+			if gotCount, wantCount := m.Histogram.Bucket[i].GetCumulativeCount(), wantCounts[i]; gotCount != wantCount {
+				t.Errorf("got count %d, want %d", gotCount, wantCount)
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(it, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHistogramVecConcurrency(t *testing.T) {
+	rand.Seed(42)
+
+	it := func(n uint32) bool {
+		mutations := int(n%1e4 + 1e4)
+		concLevel := int(n%7 + 1)
+		vecLength := int(n%3 + 1)
+
+		var start, end sync.WaitGroup
+		start.Add(1)
+		end.Add(concLevel)
+
+		testBuckets := []float64{-2, -1, -0.5, 0, 0.5, 1, 2, math.Inf(+1)}
+
+		his := NewHistogramVec(
+			HistogramOpts{
+				Name:    "test_histogram",
+				Help:    "helpless",
+				Buckets: testBuckets,
+			},
+			[]string{"label"},
+		)
+
+		allVars := make([][]float64, vecLength)
+		sampleSums := make([]float64, vecLength)
+		for i := 0; i < concLevel; i++ {
+			vals := make([]float64, mutations)
+			picks := make([]int, mutations)
+			for j := 0; j < mutations; j++ {
+				v := rand.NormFloat64()
+				vals[j] = v
+				pick := rand.Intn(vecLength)
+				picks[j] = pick
+				allVars[pick] = append(allVars[pick], v)
+				sampleSums[pick] += v
+			}
+
+			go func(vals []float64) {
+				start.Wait()
+				for i, v := range vals {
+					his.WithLabelValues(strconv.Itoa(picks[i])).Observe(v)
+				}
+				end.Done()
+			}(vals)
+		}
+		for _, vars := range allVars {
+			sort.Float64s(vars)
+		}
+		start.Done()
+		end.Wait()
+
+		for i := 0; i < vecLength; i++ {
+			m := &dto.Metric{}
+			s := his.WithLabelValues(strconv.Itoa(i)).(Histogram)
+			s.Write(m)
+
+			if got, want := len(m.Histogram.Bucket), len(testBuckets)-1; got != want {
+				t.Errorf("got %d buckets in protobuf, want %d", got, want)
+			}
+			if got, want := int(m.Histogram.GetSampleCount()), len(allVars[i]); got != want {
+				t.Errorf("got sample count %d, want %d", got, want)
+			}
+			if got, want := m.Histogram.GetSampleSum(), sampleSums[i]; math.Abs((got-want)/want) > 0.001 {
+				t.Errorf("got sample sum %f, want %f", got, want)
+			}
+
+			wantCounts := getCumulativeCounts(allVars[i])
+
+			for j, wantBound := range testBuckets {
+				if j == len(testBuckets)-1 {
+					break // No +Inf bucket in protobuf.
+				}
+				if gotBound := m.Histogram.Bucket[j].GetUpperBound(); gotBound != wantBound {
+					t.Errorf("got bound %f, want %f", gotBound, wantBound)
+				}
+				if gotCount, wantCount := m.Histogram.Bucket[j].GetCumulativeCount(), wantCounts[j]; gotCount != wantCount {
+					t.Errorf("got count %d, want %d", gotCount, wantCount)
+				}
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(it, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHistogramNonMonotonicBuckets(t *testing.T) {
+	testCases := map[string][]float64{
+		"not strictly monotonic":  {1, 2, 2, 3},
+		"not monotonic at all":    {1, 2, 4, 3, 5},
+		"have +Inf in the middle": {1, 2, math.Inf(+1), 3},
+	}
+	for name, buckets := range testCases {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Buckets %v are %s but NewHistogram did not panic.", buckets, name)
+				}
+			}()
+			_ = NewHistogram(HistogramOpts{
+				Name:    "test_histogram",
+				Help:    "helpless",
+				Buckets: buckets,
+			})
+		}()
+	}
+}
+
+func TestHistogramBucketLabelNotAllowed(t *testing.T) {
+	defer func() {
+		if r := recover(); r != errBucketLabelNotAllowed {
+			t.Errorf("got panic %v, want %v", r, errBucketLabelNotAllowed)
+		}
+	}()
+	NewHistogram(HistogramOpts{
+		Name:        "test_histogram",
+		Help:        "helpless",
+		ConstLabels: Labels{bucketLabel: "42"},
+	})
+}
+
+func TestHistogramDefaultBuckets(t *testing.T) {
+	his := NewHistogram(HistogramOpts{
+		Name: "test_histogram",
+		Help: "helpless",
+	})
+	his.Observe(0.07)
+
+	m := &dto.Metric{}
+	his.Write(m)
+
+	gotBounds := make([]float64, 0, len(m.Histogram.Bucket))
+	for _, b := range m.Histogram.Bucket {
+		gotBounds = append(gotBounds, b.GetUpperBound())
+	}
+	if !reflect.DeepEqual(gotBounds, DefBuckets) {
+		t.Errorf("got bounds %v, want %v", gotBounds, DefBuckets)
+	}
+	if got, want := m.Histogram.Bucket[4].GetCumulativeCount(), uint64(1); got != want {
+		t.Errorf("got count %d in bucket with upper bound %f, want %d", got, DefBuckets[4], want)
+	}
+	if got, want := m.Histogram.Bucket[3].GetCumulativeCount(), uint64(0); got != want {
+		t.Errorf("got count %d in bucket with upper bound %f, want %d", got, DefBuckets[3], want)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	got := LinearBuckets(-15, 5, 6)
+	want := []float64{-15, -10, -5, 0, 5, 10}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("linear buckets: got %v, want %v", got, want)
+	}
+
+	got = ExponentialBuckets(100, 1.2, 3)
+	want = []float64{100, 120, 144}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exponential buckets: got %v, want %v", got, want)
+	}
+
+	got = ExponentialBucketsRange(1, 100, 3)
+	want = []float64{1, 10, 100}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exponential buckets range: got %v, want %v", got, want)
+	}
+
+	got = ExponentialBucketsRange(0.001, 10, 9)
+	if len(got) != 9 || got[0] != 0.001 || got[8] != 10 {
+		t.Errorf("exponential buckets range: got %v, want 9 buckets from 0.001 to 10", got)
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i] <= got[i-1] {
+			t.Errorf("exponential buckets range: %v not strictly increasing", got)
+		}
+	}
+}
+
+func TestBucketsPanic(t *testing.T) {
+	testCases := map[string]func(){
+		"linear with zero count":           func() { LinearBuckets(0, 1, 0) },
+		"exponential with zero count":      func() { ExponentialBuckets(1, 2, 0) },
+		"exponential with zero start":      func() { ExponentialBuckets(0, 2, 3) },
+		"exponential with factor of one":   func() { ExponentialBuckets(1, 1, 3) },
+		"exponential with negative factor": func() { ExponentialBuckets(1, -2, 3) },
+		"exponential range with count one": func() { ExponentialBucketsRange(1, 2, 1) },
+		"exponential range with zero min":  func() { ExponentialBucketsRange(0, 2, 3) },
+		"exponential range with max < min": func() { ExponentialBucketsRange(2, 1, 3) },
+	}
+	for name, f := range testCases {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestNativeHistogram(t *testing.T) {
+	scenarios := []struct {
+		name          string
+		observations  []float64
+		factor        float64
+		zeroThreshold float64
+		maxBuckets    uint32
+		minReset      time.Duration
+		buckets       []float64
+		want          *dto.Histogram
+	}{
+		{
+			name:         "no native buckets",
+			observations: []float64{1, 2, 3},
+			buckets:      []float64{2},
+			want: &dto.Histogram{
+				SampleCount: proto.Uint64(3),
+				SampleSum:   proto.Float64(6),
+				Bucket: []*dto.Bucket{
+					{CumulativeCount: proto.Uint64(2), UpperBound: proto.Float64(2)},
+				},
+			},
+		},
+		{
+			name:         "factor 1.1 results in schema 3",
+			observations: []float64{0, 1, 2, 3},
+			factor:       1.1,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(4),
+				SampleSum:     proto.Float64(6),
+				Schema:        proto.Int32(3),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(1),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(7), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(4), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{1, 0, 0},
+			},
+		},
+		{
+			name:         "factor 1.2 results in schema 2",
+			observations: []float64{0, 1, 1.2, 1.4, 1.8, 2},
+			factor:       1.2,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(6),
+				SampleSum:     proto.Float64(7.4),
+				Schema:        proto.Int32(2),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(1),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(1), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(1), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{1, 1, 0},
+			},
+		},
+		{
+			name:         "factor 4 results in schema -1",
+			observations: []float64{0.0156, 0.0625, 0.1, 0.25, 1, 1.5, 2, 3, 3.5},
+			factor:       4,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(9),
+				SampleSum:     proto.Float64(11.4281),
+				Schema:        proto.Int32(-1),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(0),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(-3), Length: proto.Uint32(5)},
+				},
+				PositiveDelta: []int64{1, 0, 1, -1, 3},
+			},
+		},
+		{
+			name:         "negative buckets",
+			observations: []float64{0, -1, -1.2, -1.4, -1.8, -2},
+			factor:       1.2,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(6),
+				SampleSum:     proto.Float64(-7.4),
+				Schema:        proto.Int32(2),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(1),
+				NegativeSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(1), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(1), Length: proto.Uint32(1)},
+				},
+				NegativeDelta: []int64{1, 1, 0},
+			},
+		},
+		{
+			name:          "wide zero bucket",
+			observations:  []float64{0, -1, -1.2, -1.4, -1.8, -2, 1, 1.2, 1.4, 1.8, 2},
+			factor:        1.2,
+			zeroThreshold: 1.4,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(11),
+				SampleSum:     proto.Float64(0),
+				Schema:        proto.Int32(2),
+				ZeroThreshold: proto.Float64(1.4),
+				ZeroCount:     proto.Uint64(7),
+				NegativeSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(4), Length: proto.Uint32(1)},
+				},
+				NegativeDelta: []int64{2},
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(4), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{2},
+			},
+		},
+		{
+			name:          "zero threshold of zero without observations",
+			factor:        1.2,
+			zeroThreshold: NativeHistogramZeroThresholdZero,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(0),
+				SampleSum:     proto.Float64(0),
+				Schema:        proto.Int32(2),
+				ZeroThreshold: proto.Float64(0),
+				ZeroCount:     proto.Uint64(0),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(0)},
+				},
+			},
+		},
+		{
+			name:         "regular and native buckets",
+			observations: []float64{0, 1, 2, 3},
+			factor:       1.1,
+			buckets:      []float64{1, 2},
+			want: &dto.Histogram{
+				SampleCount: proto.Uint64(4),
+				SampleSum:   proto.Float64(6),
+				Bucket: []*dto.Bucket{
+					{CumulativeCount: proto.Uint64(2), UpperBound: proto.Float64(1)},
+					{CumulativeCount: proto.Uint64(3), UpperBound: proto.Float64(2)},
+				},
+				Schema:        proto.Int32(3),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(1),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(7), Length: proto.Uint32(1)},
+					{Offset: proto.Int32(4), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{1, 0, 0},
+			},
+		},
+		{
+			name:         "bucket limit reduces resolution",
+			observations: []float64{0, 1, 2, 3},
+			factor:       1.1,
+			maxBuckets:   2,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(4),
+				SampleSum:     proto.Float64(6),
+				Schema:        proto.Int32(-1),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(1),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(2)},
+				},
+				PositiveDelta: []int64{1, 1},
+			},
+		},
+		{
+			name:         "bucket limit with negative buckets",
+			observations: []float64{-1, -2, -3, 1, 2, 3},
+			factor:       1.1,
+			maxBuckets:   4,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(6),
+				SampleSum:     proto.Float64(0),
+				Schema:        proto.Int32(-1),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(0),
+				NegativeSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(2)},
+				},
+				NegativeDelta: []int64{1, 1},
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(0), Length: proto.Uint32(2)},
+				},
+				PositiveDelta: []int64{1, 1},
+			},
+		},
+		{
+			name:         "bucket limit resets",
+			observations: []float64{0, 1, 2, 3},
+			factor:       1.1,
+			maxBuckets:   2,
+			minReset:     time.Nanosecond,
+			want: &dto.Histogram{
+				SampleCount:   proto.Uint64(1),
+				SampleSum:     proto.Float64(3),
+				Schema:        proto.Int32(3),
+				ZeroThreshold: proto.Float64(2.938735877055719e-39),
+				ZeroCount:     proto.Uint64(0),
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(13), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{1},
+			},
+		},
+	}
+
+	for _, s := range scenarios {
+		his := NewHistogram(HistogramOpts{
+			Name:                            "name",
+			Help:                            "help",
+			Buckets:                         s.buckets,
+			NativeHistogramBucketFactor:     s.factor,
+			NativeHistogramZeroThreshold:    s.zeroThreshold,
+			NativeHistogramMaxBucketNumber:  s.maxBuckets,
+			NativeHistogramMinResetDuration: s.minReset,
+		})
+		for _, o := range s.observations {
+			if s.minReset > 0 {
+				// Make sure the minimum reset duration has passed.
+				time.Sleep(s.minReset)
+			}
+			his.Observe(o)
+		}
+		m := &dto.Metric{}
+		if err := his.Write(m); err != nil {
+			t.Errorf("%s: unexpected error: %s", s.name, err)
+			continue
+		}
+		m.Histogram.CreatedTimestamp = nil // Varies between runs.
+		if !proto.Equal(m.Histogram, s.want) {
+			t.Errorf("%s: got %s, want %s", s.name, proto.CompactTextString(m.Histogram), proto.CompactTextString(s.want))
+		}
+	}
+}
+
+func TestPickSchema(t *testing.T) {
+	scenarios := []struct {
+		factor float64
+		schema int32
+	}{
+		{1.0001, 8},
+		{1.002, 8},
+		{1.006, 7},
+		{1.1, 3},
+		{1.2, 2},
+		{1.5, 1},
+		{2, 0},
+		{4, -1},
+		{65536, -4},
+		{1e10, -4},
+	}
+	for _, s := range scenarios {
+		if got := pickSchema(s.factor); got != s.schema {
+			t.Errorf("factor %f: got schema %d, want %d", s.factor, got, s.schema)
+		}
+	}
+}
+
+func getCumulativeCounts(vars []float64) []uint64 {
+	// Make sure this corresponds to testBuckets above.
+	counts := make([]uint64, 7)
+	for _, v := range vars {
+		for i := len(counts) - 1; i >= 0; i-- {
+			if v > []float64{-2, -1, -0.5, 0, 0.5, 1, 2}[i] {
+				break
+			}
+			counts[i]++
+		}
+	}
+	return counts
+}
+
+func TestConstHistogram(t *testing.T) {
+	desc := NewDesc("http_request_duration_seconds", "A histogram of the HTTP request durations.", []string{"code", "method"}, Labels{"owner": "example"})
+
+	h, err := NewConstHistogram(
+		desc,
+		4711, 403.34,
+		map[float64]uint64{2: 2634, 1: 2403, 0.5: 1213, 0.25: 129},
+		"200", "get",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &dto.Metric{}
+	if err := h.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	expected := &dto.Metric{
+		Label: []*dto.LabelPair{
+			{Name: proto.String("code"), Value: proto.String("200")},
+			{Name: proto.String("method"), Value: proto.String("get")},
+			{Name: proto.String("owner"), Value: proto.String("example")},
+		},
+		Histogram: &dto.Histogram{
+			SampleCount: proto.Uint64(4711),
+			SampleSum:   proto.Float64(403.34),
+			Bucket: []*dto.Bucket{
+				{CumulativeCount: proto.Uint64(129), UpperBound: proto.Float64(0.25)},
+				{CumulativeCount: proto.Uint64(1213), UpperBound: proto.Float64(0.5)},
+				{CumulativeCount: proto.Uint64(2403), UpperBound: proto.Float64(1)},
+				{CumulativeCount: proto.Uint64(2634), UpperBound: proto.Float64(2)},
+			},
+		},
+	}
+	if !proto.Equal(expected, m) {
+		t.Errorf("expected %s, got %s", proto.CompactTextString(expected), proto.CompactTextString(m))
+	}
+
+	if _, err := NewConstHistogram(desc, 1, 1, nil, "200"); err != errInconsistentCardinality {
+		t.Errorf("expected error %q, got %v", errInconsistentCardinality, err)
+	}
+}
+
+func TestHistogramExemplar(t *testing.T) {
+	histogram := NewHistogram(HistogramOpts{
+		Name:    "test",
+		Help:    "test help",
+		Buckets: []float64{1, 2, 3, 4},
+	}).(*histogram)
+
+	histogram.ObserveWithExemplar(1.5, Labels{"id": "2"})
+	histogram.ObserveWithExemplar(1.6, Labels{"id": "3"}) // Replaces the previous one.
+	histogram.ObserveWithExemplar(4, Labels{"id": "4"})
+	histogram.ObserveWithExemplar(3.5, nil) // No exemplar.
+	histogram.ObserveWithExemplar(42, Labels{"id": "inf"})
+
+	m := &dto.Metric{}
+	histogram.Write(m)
+	buckets := m.GetHistogram().GetBucket()
+	if expected, got := 5, len(buckets); expected != got {
+		t.Fatalf("expected %d buckets, got %d", expected, got)
+	}
+
+	expected := []struct {
+		upperBound, value float64
+		count             uint64
+		id                string
+	}{
+		{1, 0, 0, ""},
+		{2, 1.6, 2, "3"},
+		{3, 0, 2, ""},
+		{4, 4, 4, "4"},
+		{math.Inf(1), 42, 5, "inf"},
+	}
+	for i, want := range expected {
+		b := buckets[i]
+		if b.GetUpperBound() != want.upperBound || b.GetCumulativeCount() != want.count {
+			t.Errorf("%d. expected bucket %v/%d, got %v/%d", i, want.upperBound, want.count, b.GetUpperBound(), b.GetCumulativeCount())
+		}
+		e := b.GetExemplar()
+		if want.id == "" {
+			if e != nil {
+				t.Errorf("%d. expected no exemplar, got %v", i, e)
+			}
+			continue
+		}
+		if e == nil {
+			t.Errorf("%d. expected exemplar, got none", i)
+			continue
+		}
+		if e.GetValue() != want.value || len(e.GetLabel()) != 1 || e.GetLabel()[0].GetValue() != want.id {
+			t.Errorf("%d. expected exemplar with value %v and id %q, got %v", i, want.value, want.id, e)
+		}
+	}
+}
+
+func TestHistogramCreatedTimestamp(t *testing.T) {
+	before := time.Now()
+	his := NewHistogram(HistogramOpts{Name: "test", Help: "test help"})
+	after := time.Now()
+
+	m := &dto.Metric{}
+	his.Write(m)
+	created, err := ptypes.Timestamp(m.GetHistogram().GetCreatedTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Before(before) || created.After(after) {
+		t.Errorf("expected created timestamp between %v and %v, got %v", before, after, created)
+	}
+}
+
+func TestHistogramSetBuckets(t *testing.T) {
+	his := NewHistogram(HistogramOpts{
+		Name:    "test_histogram",
+		Help:    "helpless",
+		Buckets: []float64{1, 2, 3, 4, 5},
+	})
+	for _, v := range []float64{0.5, 1.5, 2.5, 3.5, 4.5, 5.5} {
+		his.Observe(v)
+	}
+	his.(ExemplarObserver).ObserveWithExemplar(2.2, Labels{"id": "a"})
+
+	his.SetBuckets([]float64{2, 4})
+	his.Observe(3)
+
+	m := &dto.Metric{}
+	his.Write(m)
+	h := m.GetHistogram()
+	if got, want := h.GetSampleCount(), uint64(8); got != want {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+	if got, want := h.GetSampleSum(), 23.2; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got sample sum %f, want %f", got, want)
+	}
+	wantBounds := []float64{2, 4}
+	wantCounts := []uint64{2, 6}
+	if got, want := len(h.Bucket), len(wantBounds); got != want {
+		t.Fatalf("got %d buckets, want %d", got, want)
+	}
+	for i, b := range h.Bucket {
+		if got, want := b.GetUpperBound(), wantBounds[i]; got != want {
+			t.Errorf("%d. got upper bound %f, want %f", i, got, want)
+		}
+		if got, want := b.GetCumulativeCount(), wantCounts[i]; got != want {
+			t.Errorf("%d. got cumulative count %d, want %d", i, got, want)
+		}
+	}
+	if got, want := h.Bucket[1].GetExemplar().GetValue(), 2.2; got != want {
+		t.Errorf("got exemplar value %f in bucket with upper bound 4, want %f", got, want)
+	}
+}
+
+func TestHistogramResetBuckets(t *testing.T) {
+	his := NewHistogram(HistogramOpts{
+		Name:                        "test_histogram",
+		Help:                        "helpless",
+		NativeHistogramBucketFactor: 2,
+	})
+	his.Observe(1)
+	his.Observe(3)
+
+	m := &dto.Metric{}
+	his.Write(m)
+	createdBefore := m.GetHistogram().GetCreatedTimestamp()
+
+	time.Sleep(time.Millisecond)
+	his.ResetBuckets([]float64{1, 10})
+	his.Observe(5)
+
+	m.Reset()
+	his.Write(m)
+	h := m.GetHistogram()
+	if got, want := h.GetSampleCount(), uint64(1); got != want {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+	if got, want := h.GetSampleSum(), 5.0; got != want {
+		t.Errorf("got sample sum %f, want %f", got, want)
+	}
+	if got, want := len(h.Bucket), 2; got != want {
+		t.Fatalf("got %d buckets, want %d", got, want)
+	}
+	if got, want := h.Bucket[0].GetCumulativeCount(), uint64(0); got != want {
+		t.Errorf("got cumulative count %d in first bucket, want %d", got, want)
+	}
+	if got, want := h.Bucket[1].GetCumulativeCount(), uint64(1); got != want {
+		t.Errorf("got cumulative count %d in second bucket, want %d", got, want)
+	}
+	if got, want := len(h.GetPositiveDelta()), 1; got != want {
+		t.Errorf("got %d native buckets, want %d", got, want)
+	}
+	after, err := ptypes.Timestamp(h.GetCreatedTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := ptypes.Timestamp(createdBefore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.After(before) {
+		t.Errorf("created timestamp %v not after %v", after, before)
+	}
+}
+
+func TestHistogramSetBucketsConcurrency(t *testing.T) {
+	his := NewHistogram(HistogramOpts{
+		Name: "test_histogram",
+		Help: "helpless",
+	})
+	layouts := [][]float64{DefBuckets, {1}, LinearBuckets(0, 0.1, 20)}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			his.Observe(rand.Float64())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			his.SetBuckets(layouts[i%len(layouts)])
+		}
+	}()
+	wg.Wait()
+
+	m := &dto.Metric{}
+	his.Write(m)
+	if got, want := m.GetHistogram().GetSampleCount(), uint64(1000); got != want {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+	buckets := m.GetHistogram().GetBucket()
+	if got := buckets[len(buckets)-1].GetCumulativeCount(); got > 1000 {
+		t.Errorf("got cumulative count %d in highest bucket, want at most 1000", got)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package influxdb provides a bridge to push the metrics of a Prometheus
+// Gatherer to InfluxDB, or to any other system accepting the InfluxDB line
+// protocol over HTTP, e.g. Telegraf. It is meant for mixed monitoring stacks
+// where some consumers of the metrics only read from InfluxDB.
+//
+// Each sample is written as one line with the sample name as measurement, the
+// labels as tags, and the sample value in the field "value":
+//     <name>,<label name>=<label value>,... value=<value> <timestamp>
+// Summaries and histograms are expanded into their quantiles or buckets, their
+// sum, and their count, in the same way as in the text format, so that the
+// quantiles and buckets are distinguished by the tags "quantile" and "le".
+package influxdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/internal"
+)
+
+// ErrorHandling defines how a Bridge handles errors while gathering.
+type ErrorHandling = internal.ErrorHandling
+
+// These constants cause a Bridge to behave as described if errors are
+// encountered while gathering.
+const (
+	// Push as many metrics as possible. The error is still returned by
+	// Push and logged by Run.
+	ContinueOnError = internal.ContinueOnError
+	// Return the error without pushing anything.
+	AbortOnError = internal.AbortOnError
+)
+
+// Logger is the minimal interface a Bridge needs for logging. Note that
+// log.Logger from the standard library implements this interface.
+type Logger = internal.Logger
+
+// Config defines the InfluxDB bridge config. It is mandatory to set URL. All
+// other fields are optional and can safely be left at their zero value.
+type Config struct {
+	// URL is the full URL of the write endpoint, including the database
+	// or bucket, e.g. "http://localhost:8086/write?db=metrics" for
+	// InfluxDB 1.x or
+	// "http://localhost:8086/api/v2/write?org=myorg&bucket=metrics" for
+	// InfluxDB 2.x. The timestamps are in nanoseconds, which is the
+	// default precision of both. Mandatory!
+	URL string
+
+	// Header is added to each request, e.g. {"Authorization": {"Token
+	// secret"}} for InfluxDB 2.x.
+	Header http.Header
+
+	// Interval is the time between two pushes of Run. If 0, it defaults
+	// to 15s.
+	Interval time.Duration
+
+	// Timeout is the timeout of a single push. If 0, it defaults to the
+	// Interval.
+	Timeout time.Duration
+
+	// Client is used for the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Gatherer is the source of the metrics. If nil,
+	// prometheus.DefaultGatherer is used.
+	Gatherer prometheus.Gatherer
+
+	// Logger is used by Run to log the errors of the periodic pushes. If
+	// nil, errors are not logged at all.
+	Logger Logger
+
+	// ErrorHandling defines how errors while gathering are handled.
+	ErrorHandling ErrorHandling
+}
+
+// Bridge pushes metrics to InfluxDB. Create instances with NewBridge.
+type Bridge struct {
+	url      string
+	header   http.Header
+	interval time.Duration
+	timeout  time.Duration
+	client   *http.Client
+
+	errorHandling ErrorHandling
+	logger        Logger
+
+	g prometheus.Gatherer
+}
+
+// NewBridge returns a pointer to a new Bridge struct based on the provided
+// Config. It returns an error if the URL is missing or if the ErrorHandling is
+// unknown.
+func NewBridge(c *Config) (*Bridge, error) {
+	if c.URL == "" {
+		return nil, errors.New("influxdb: missing URL")
+	}
+	if err := c.ErrorHandling.Check(); err != nil {
+		return nil, fmt.Errorf("influxdb: %s", err)
+	}
+
+	b := &Bridge{
+		url:           c.URL,
+		header:        c.Header,
+		interval:      c.Interval,
+		timeout:       c.Timeout,
+		client:        c.Client,
+		errorHandling: c.ErrorHandling,
+		logger:        c.Logger,
+		g:             c.Gatherer,
+	}
+	if b.interval == 0 {
+		b.interval = internal.DefaultBridgeInterval
+	}
+	if b.timeout == 0 {
+		b.timeout = b.interval
+	}
+	if b.client == nil {
+		b.client = http.DefaultClient
+	}
+	if b.g == nil {
+		b.g = prometheus.DefaultGatherer
+	}
+	return b, nil
+}
+
+// Run starts the event loop that pushes metrics every Interval of the Config
+// until the provided context is done. Errors are logged to the Logger of the
+// Config, if any. Run blocks, so it is usually called in its own goroutine.
+func (b *Bridge) Run(ctx context.Context) {
+	internal.RunBridge(ctx, b.interval, b.PushContext, b.logger, "error pushing to InfluxDB:")
+}
+
+// Push gathers the metrics and pushes them to InfluxDB once. It is a shortcut
+// for PushContext with a background context.
+func (b *Bridge) Push() error {
+	return b.PushContext(context.Background())
+}
+
+// PushContext works like Push but aborts the request once the provided
+// context is done. Independently, the request is aborted after the Timeout of
+// the Config. With ContinueOnError, the metrics gathered successfully are
+// pushed even if gathering returned an error, and that error is returned after
+// the push.
+func (b *Bridge) PushContext(ctx context.Context) error {
+	mfs, gatherErr := internal.GatherForBridge(b.g, b.errorHandling)
+	var buf bytes.Buffer
+	if err := writeLines(&buf, mfs, time.Now()); err != nil {
+		return err
+	}
+	if buf.Len() == 0 {
+		return gatherErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	req, err := http.NewRequest("POST", b.url, &buf)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range b.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// InfluxDB responds with StatusNoContent, but other receivers of the
+	// line protocol may use StatusOK.
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body) // Ignore any further error as this is for an error message only.
+		return fmt.Errorf("unexpected status code %d while pushing to %s: %s", resp.StatusCode, b.url, body)
+	}
+	return gatherErr
+}
+
+// writeLines writes the samples of the provided metric families to w in the
+// line protocol. Samples without a timestamp get the provided now. Samples
+// with a NaN or infinite value are skipped, as the line protocol cannot
+// represent them. Labels with an empty value are omitted, as tags must not be
+// empty.
+func writeLines(w io.Writer, mfs []*dto.MetricFamily, now time.Time) error {
+	for _, s := range internal.FlattenMetricFamilies(mfs) {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+		line := measurementEscaper.Replace(s.Name)
+		for _, lp := range s.Labels {
+			if lp.Value == "" {
+				continue
+			}
+			line += "," + tagEscaper.Replace(lp.Name) + "=" + tagEscaper.Replace(lp.Value)
+		}
+		ts := now.UnixNano()
+		if s.TimestampMs != 0 {
+			ts = s.TimestampMs * int64(time.Millisecond)
+		}
+		if _, err := fmt.Fprintf(
+			w, "%s value=%s %d\n", line, strconv.FormatFloat(s.Value, 'g', -1, 64), ts,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `, "\n", `\n`)
+)
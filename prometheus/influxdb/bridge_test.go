@@ -0,0 +1,149 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWriteLines(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cv := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "requests_total", Help: "Requests."},
+		[]string{"path", "code"},
+	)
+	cv.WithLabelValues("/a b,c=d", "200").Add(3)
+	cv.WithLabelValues("", "500").Inc()
+	nan := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nan", Help: "Not a number."})
+	nan.Set(math.NaN())
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "latency_seconds",
+		Help:    "Latency.",
+		Buckets: []float64{0.5},
+	})
+	h.Observe(0.25)
+	reg.MustRegister(cv, nan, h)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeLines(&buf, mfs, time.Unix(1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	want := `latency_seconds_bucket,le=0.5 value=1 1000000000
+latency_seconds_bucket,le=+Inf value=1 1000000000
+latency_seconds_sum value=0.25 1000000000
+latency_seconds_count value=1 1000000000
+requests_total,code=200,path=/a\ b\,c\=d value=3 1000000000
+requests_total,code=500 value=1 1000000000
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestWriteLinesTimestamp(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	desc := prometheus.NewDesc("mirrored", "Mirrored from elsewhere.", nil, nil)
+	reg.MustRegister(&constCollector{prometheus.NewMetricWithTimestamp(
+		time.Unix(1500000000, 123456789),
+		prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1),
+	)})
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeLines(&buf, mfs, time.Unix(1, 0)); err != nil {
+		t.Fatal(err)
+	}
+	// Timestamps have millisecond resolution and are written in
+	// nanoseconds.
+	if got, want := buf.String(), "mirrored value=1 1500000000123000000\n"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+type constCollector struct {
+	m prometheus.Metric
+}
+
+func (c *constCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.m.Desc() }
+func (c *constCollector) Collect(ch chan<- prometheus.Metric) { ch <- c.m }
+
+func TestPush(t *testing.T) {
+	var (
+		lastMethod, lastPath, lastAuth, lastBody string
+		status                                   = http.StatusNoContent
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastMethod = r.Method
+		lastPath = r.URL.RequestURI()
+		lastAuth = r.Header.Get("Authorization")
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		lastBody = string(body)
+		w.WriteHeader(status)
+		w.Write([]byte("fake error"))
+	}))
+	defer ts.Close()
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature", Help: "Temperature."})
+	g.Set(21.5)
+	reg.MustRegister(g)
+
+	b, err := NewBridge(&Config{
+		URL:      ts.URL + "/api/v2/write?org=o&bucket=b",
+		Header:   http.Header{"Authorization": {"Token secret"}},
+		Gatherer: reg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != "POST" {
+		t.Errorf("want method POST, got %s", lastMethod)
+	}
+	if want := "/api/v2/write?org=o&bucket=b"; lastPath != want {
+		t.Errorf("want path %q, got %q", want, lastPath)
+	}
+	if lastAuth != "Token secret" {
+		t.Errorf("want Authorization header %q, got %q", "Token secret", lastAuth)
+	}
+	if !strings.HasPrefix(lastBody, "temperature value=21.5 ") {
+		t.Errorf("unexpected body %q", lastBody)
+	}
+
+	status = http.StatusBadRequest
+	if err := b.Push(); err == nil || !strings.Contains(err.Error(), "fake error") {
+		t.Errorf("want error with response body, got %v", err)
+	}
+}
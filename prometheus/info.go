@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import "fmt"
+
+// Info is a Metric that exposes textual metadata about the monitored target,
+// e.g. the version and revision of the running binary or settings of its
+// configuration. The metadata is carried by the labels of the metric while its
+// value is always 1. In the exposition, an Info is represented as a gauge. By
+// convention, the name of an Info metric ends with "_info", e.g.
+// "myapp_build_info".
+//
+// Both the labels and the value of an Info are fixed at construction time. An
+// Info has therefore no methods in addition to those of Metric and
+// Collector. If the metadata changes, e.g. after reloading the configuration,
+// unregister the old Info and register a new one.
+//
+// To create Info instances, use NewInfo.
+type Info interface {
+	Metric
+	Collector
+}
+
+// InfoOpts is an alias for Opts. See there for doc comments.
+type InfoOpts Opts
+
+// NewInfo creates a new Info based on the provided InfoOpts. The provided
+// labels carry the metadata to expose. They are merged with the ConstLabels in
+// the InfoOpts (which may be nil). The labels are copied, so that later
+// modifications of the map do not affect the Info. NewInfo panics if a label
+// name occurs both in labels and in the ConstLabels of the InfoOpts.
+func NewInfo(opts InfoOpts, labels Labels) Info {
+	constLabels := make(Labels, len(opts.ConstLabels)+len(labels))
+	for name, value := range opts.ConstLabels {
+		constLabels[name] = value
+	}
+	for name, value := range labels {
+		if _, ok := constLabels[name]; ok {
+			panic(fmt.Errorf("label %q of info metric is already present in ConstLabels", name))
+		}
+		constLabels[name] = value
+	}
+	desc := NewDescWithUnit(
+		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
+		opts.Help,
+		opts.Unit,
+		nil,
+		constLabels,
+	)
+	result := &info{
+		constMetric: constMetric{
+			desc:       desc,
+			valType:    GaugeValue,
+			val:        1,
+			labelPairs: desc.constLabelPairs,
+		},
+	}
+	result.Init(result) // Init self-collection.
+	return result
+}
+
+type info struct {
+	SelfCollector
+	constMetric
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/text"
+)
+
+func TestInfo(t *testing.T) {
+	labels := Labels{"version": "1.2.3", "revision": "abcdef"}
+	info := NewInfo(InfoOpts{
+		Namespace:   "myapp",
+		Name:        "build_info",
+		Help:        "A metric with a constant '1' value labeled by version and revision.",
+		ConstLabels: Labels{"instance": "a"},
+	}, labels)
+
+	// Modifying the map must not affect the Info.
+	labels["version"] = "changed"
+
+	m := &dto.Metric{}
+	if err := info.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := `instance="a",revision="abcdef",version="1.2.3"`, labelPairsString(m.GetLabel()); expected != got {
+		t.Errorf("expected labels %s, got %s", expected, got)
+	}
+	if expected, got := 1., m.GetGauge().GetValue(); expected != got {
+		t.Errorf("expected value %f, got %f", expected, got)
+	}
+
+	r := NewRegistry()
+	r.collectChecksEnabled = true
+	if err := r.Register(info); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := writeGathered(&buf, r, text.MetricFamilyToText); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP myapp_build_info A metric with a constant '1' value labeled by version and revision.
+# TYPE myapp_build_info gauge
+myapp_build_info{instance="a",revision="abcdef",version="1.2.3"} 1
+`
+	if got := buf.String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestInfoLabelCollision(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for label already present in ConstLabels")
+		}
+	}()
+	NewInfo(InfoOpts{
+		Name:        "build_info",
+		Help:        "help",
+		ConstLabels: Labels{"version": "1"},
+	}, Labels{"version": "2"})
+}
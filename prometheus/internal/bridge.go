@@ -0,0 +1,93 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultBridgeInterval is the default time between two pushes of a bridge.
+const DefaultBridgeInterval = 15 * time.Second
+
+// ErrorHandling defines how a bridge handles errors while gathering. The
+// bridge packages expose it under their own name.
+type ErrorHandling int
+
+// These constants cause a bridge to behave as described if errors are
+// encountered while gathering.
+const (
+	// Ignore errors while gathering and push as many metrics as
+	// possible. The error is still returned by the push and logged by the
+	// periodic pushes.
+	ContinueOnError ErrorHandling = iota
+	// Return upon the first error encountered while gathering, without
+	// pushing anything.
+	AbortOnError
+)
+
+// Check returns an error if the ErrorHandling is unknown.
+func (eh ErrorHandling) Check() error {
+	switch eh {
+	case ContinueOnError, AbortOnError:
+		return nil
+	default:
+		return fmt.Errorf("unknown error handling %d", eh)
+	}
+}
+
+// Logger is the minimal interface a bridge needs for logging. Note that
+// log.Logger from the standard library implements this interface, and it is
+// easy to implement by custom loggers, if they don't do so already anyway.
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// Gatherer is the same as prometheus.Gatherer, which cannot be imported here.
+type Gatherer interface {
+	Gather() ([]*dto.MetricFamily, error)
+}
+
+// GatherForBridge gathers from the provided Gatherer and applies the provided
+// ErrorHandling: With ContinueOnError, the MetricFamilies gathered
+// successfully are returned together with the error. With AbortOnError, no
+// MetricFamilies are returned if gathering failed.
+func GatherForBridge(g Gatherer, eh ErrorHandling) ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gather()
+	if err != nil && eh == AbortOnError {
+		return nil, err
+	}
+	return mfs, err
+}
+
+// RunBridge calls push every interval until the provided context is done. The
+// errors of push are logged to the provided Logger, if not nil, prefixed by
+// msg, unless they are caused by the context being done.
+func RunBridge(ctx context.Context, interval time.Duration, push func(context.Context) error, logger Logger, msg string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := push(ctx); err != nil && logger != nil && ctx.Err() == nil {
+				logger.Println(msg, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
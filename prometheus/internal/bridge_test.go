@@ -0,0 +1,105 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+type gathererFunc func() ([]*dto.MetricFamily, error)
+
+func (f gathererFunc) Gather() ([]*dto.MetricFamily, error) { return f() }
+
+func TestErrorHandlingCheck(t *testing.T) {
+	for i, s := range []struct {
+		eh      ErrorHandling
+		wantErr bool
+	}{
+		{eh: ContinueOnError},
+		{eh: AbortOnError},
+		{eh: 42, wantErr: true},
+	} {
+		if err := s.eh.Check(); (err != nil) != s.wantErr {
+			t.Errorf("%d. got error %v, want error %v", i, err, s.wantErr)
+		}
+	}
+}
+
+func TestGatherForBridge(t *testing.T) {
+	gatherErr := errors.New("gather failed")
+	partial := []*dto.MetricFamily{{Name: proto.String("up")}}
+	g := gathererFunc(func() ([]*dto.MetricFamily, error) { return partial, gatherErr })
+
+	mfs, err := GatherForBridge(g, ContinueOnError)
+	if err != gatherErr || len(mfs) != 1 {
+		t.Errorf("ContinueOnError: got %d metric families and error %v, want 1 and %v", len(mfs), err, gatherErr)
+	}
+	mfs, err = GatherForBridge(g, AbortOnError)
+	if err != gatherErr || len(mfs) != 0 {
+		t.Errorf("AbortOnError: got %d metric families and error %v, want 0 and %v", len(mfs), err, gatherErr)
+	}
+}
+
+type chanLogger chan string
+
+func (l chanLogger) Println(v ...interface{}) {
+	select {
+	case l <- fmt.Sprintln(v...):
+	default:
+	}
+}
+
+func TestRunBridge(t *testing.T) {
+	logger := make(chanLogger, 1)
+	pushes := make(chan struct{}, 10)
+	push := func(ctx context.Context) error {
+		select {
+		case pushes <- struct{}{}:
+		default:
+		}
+		return errors.New("push failed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunBridge(ctx, 10*time.Millisecond, push, logger, "error pushing:")
+		close(done)
+	}()
+	select {
+	case line := <-logger:
+		if !strings.HasPrefix(line, "error pushing: push failed") {
+			t.Errorf("unexpected log line %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for log line")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunBridge did not return after its context was done")
+	}
+	if len(pushes) == 0 {
+		t.Error("no pushes")
+	}
+}
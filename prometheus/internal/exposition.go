@@ -0,0 +1,263 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package internal contains the parts of the HTTP exposition that are shared by
+// the prometheus package and its promhttp sub-package, i.e. the negotiation of
+// the exposition format and content encoding and the streaming of the encoded
+// MetricFamilies. It also contains the parts shared by the bridges to other
+// monitoring systems, i.e. the flattening of MetricFamilies into samples and
+// the loop of the periodic pushes. It is not meant to be used by any other
+// package.
+package internal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/_vendor/goautoneg"
+	"github.com/prometheus/client_golang/model"
+	"github.com/prometheus/client_golang/text"
+)
+
+// The content types of the supported exposition formats. They have to be kept
+// in sync with the exported constants of the same name in the prometheus
+// package.
+const (
+	DelimitedTelemetryContentType        = `application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited`
+	TextTelemetryContentType             = `text/plain; version=0.0.4`
+	ProtoTextTelemetryContentType        = `application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=text`
+	ProtoCompactTextTelemetryContentType = `application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=compact-text`
+	OpenMetricsTelemetryContentType      = `application/openmetrics-text; version=1.0.0; charset=utf-8`
+	JSONTelemetryContentType             = `application/json; proto=io.prometheus.client.MetricFamily`
+)
+
+const (
+	bufioWriterSize = 32 * 1024
+
+	contentTypeHeader     = "Content-Type"
+	contentEncodingHeader = "Content-Encoding"
+
+	acceptEncodingHeader = "Accept-Encoding"
+	acceptHeader         = "Accept"
+)
+
+// Encoder is a function that writes a dto.MetricFamily to an io.Writer in a
+// certain encoding. It returns the number of bytes written and any error
+// encountered.
+type Encoder func(io.Writer, *dto.MetricFamily) (int, error)
+
+// bufioPool holds bufio.Writers for reuse by WriteMetricFamilies.
+var bufioPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriterSize(nil, bufioWriterSize)
+	},
+}
+
+// WriteMetricFamilies encodes the provided MetricFamilies in the format
+// negotiated with the client and streams the result to w. The encoded
+// MetricFamilies are written as they are encoded rather than assembling the
+// whole response in memory first, so the response has no "Content-Length"
+// header. If compress is true, the response is compressed with the content
+// encoding negotiated with the client. If the request contains "name[]" query
+// parameters, only the metric families with those names are written.
+//
+// If encoding or writing fails, the error is returned, but parts of the
+// response might have been sent already.
+func WriteMetricFamilies(w http.ResponseWriter, req *http.Request, mfs []*dto.MetricFamily, compress bool) error {
+	if names := req.URL.Query()["name[]"]; len(names) > 0 {
+		mfs = filterByName(mfs, names)
+	}
+	enc, contentType, escaping := NegotiateEncoder(req)
+	writer, encoding := DecorateWriter(req, w, compress)
+	if closer, ok := writer.(io.Closer); ok {
+		// Make sure the writer is closed on early return, too.
+		defer closer.Close()
+	}
+	header := w.Header()
+	header.Set(contentTypeHeader, contentType)
+	if encoding != "" {
+		header.Set(contentEncodingHeader, encoding)
+	}
+
+	// Buffer the many small writes of the encoders.
+	bw := bufioPool.Get().(*bufio.Writer)
+	bw.Reset(writer)
+	defer func() {
+		bw.Reset(nil)
+		bufioPool.Put(bw)
+	}()
+	for _, mf := range mfs {
+		if _, err := enc(bw, text.EscapeMetricFamily(mf, escaping)); err != nil {
+			return err
+		}
+	}
+	if strings.HasPrefix(contentType, OpenMetricsTelemetryContentType) {
+		if _, err := text.FinalizeOpenMetrics(bw); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if closer, ok := writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// filterByName returns the MetricFamilies with one of the provided names in a
+// new slice. The provided slice might be owned by the Gatherer and is
+// therefore not modified.
+func filterByName(mfs []*dto.MetricFamily, names []string) []*dto.MetricFamily {
+	allowed := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		allowed[name] = struct{}{}
+	}
+	kept := make([]*dto.MetricFamily, 0, len(names))
+	for _, mf := range mfs {
+		if _, ok := allowed[mf.GetName()]; ok {
+			kept = append(kept, mf)
+		}
+	}
+	return kept
+}
+
+// NegotiateEncoder returns the Encoder and the content type for the format
+// negotiated via the "Accept" header of the request, together with the
+// EscapingScheme to apply to the names of the encoded MetricFamilies.
+func NegotiateEncoder(req *http.Request) (Encoder, string, model.EscapingScheme) {
+	accepts := goautoneg.ParseAccept(req.Header.Get(acceptHeader))
+	for _, accept := range accepts {
+		var (
+			enc         Encoder
+			contentType string
+		)
+		switch {
+		case accept.Type == "application" &&
+			accept.SubType == "vnd.google.protobuf" &&
+			accept.Params["proto"] == "io.prometheus.client.MetricFamily":
+			switch accept.Params["encoding"] {
+			case "delimited":
+				enc, contentType = text.WriteProtoDelimited, DelimitedTelemetryContentType
+			case "text":
+				enc, contentType = text.WriteProtoText, ProtoTextTelemetryContentType
+			case "compact-text":
+				enc, contentType = text.WriteProtoCompactText, ProtoCompactTextTelemetryContentType
+			default:
+				continue
+			}
+		case accept.Type == "application" &&
+			accept.SubType == "openmetrics-text" &&
+			(accept.Params["version"] == "1.0.0" || accept.Params["version"] == ""):
+			enc, contentType = text.MetricFamilyToOpenMetrics, OpenMetricsTelemetryContentType
+		case accept.Type == "application" &&
+			accept.SubType == "json" &&
+			accept.Params["proto"] == "io.prometheus.client.MetricFamily":
+			enc, contentType = text.MetricFamilyToJSON, JSONTelemetryContentType
+		case accept.Type == "text" &&
+			accept.SubType == "plain" &&
+			(accept.Params["version"] == "0.0.4" || accept.Params["version"] == ""):
+			enc, contentType = text.MetricFamilyToText, TextTelemetryContentType
+		default:
+			continue
+		}
+		// A client that states an escaping scheme gets it confirmed in
+		// the content type. An unknown scheme is ignored.
+		if scheme, err := model.ToEscapingScheme(accept.Params[model.EscapingKey]); err == nil {
+			return enc, contentType + "; " + model.EscapingKey + "=" + scheme.String(), scheme
+		}
+		return enc, contentType, model.NameEscapingScheme
+	}
+	return text.MetricFamilyToText, TextTelemetryContentType, model.NameEscapingScheme
+}
+
+// Compressors maps the supported content encodings to functions that return a
+// writer compressing into the provided writer. The compressed data is complete
+// once the returned writer is closed. Compressors for further encodings can be
+// added at init time, e.g. zstd with the "zstd" build tag.
+var Compressors = map[string]func(io.Writer) io.WriteCloser{
+	"gzip": newPooledGzipWriter,
+}
+
+// gzipPool holds gzip.Writers for reuse, as each of them allocates a
+// considerable amount of memory.
+var gzipPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// pooledGzipWriter is a gzip.Writer taken from gzipPool. Closing it puts it
+// back into the pool. Further calls of Close are no-ops.
+type pooledGzipWriter struct {
+	*gzip.Writer
+}
+
+func newPooledGzipWriter(w io.Writer) io.WriteCloser {
+	gz := gzipPool.Get().(*gzip.Writer)
+	gz.Reset(w)
+	return &pooledGzipWriter{gz}
+}
+
+func (w *pooledGzipWriter) Close() error {
+	if w.Writer == nil {
+		return nil
+	}
+	err := w.Writer.Close()
+	gzipPool.Put(w.Writer)
+	w.Writer = nil
+	return err
+}
+
+// DecorateWriter wraps a writer to handle compression if requested and if
+// compress is true. The first encoding in the "Accept-Encoding" header that is
+// found in Compressors is used. It returns the decorated writer and the
+// appropriate "Content-Encoding" header (which is empty if no compression is
+// enabled). A decorated writer has to be closed by the caller.
+func DecorateWriter(request *http.Request, writer io.Writer, compress bool) (io.Writer, string) {
+	if !compress {
+		return writer, ""
+	}
+	header := request.Header.Get(acceptEncodingHeader)
+	parts := strings.Split(header, ",")
+	for _, part := range parts {
+		params := strings.Split(part, ";")
+		encoding := strings.TrimSpace(params[0])
+		newCompressor, ok := Compressors[encoding]
+		if !ok || acceptsNothing(params[1:]) {
+			continue
+		}
+		return newCompressor(writer), encoding
+	}
+	return writer, ""
+}
+
+// acceptsNothing returns whether the provided parameters of an entry in an
+// "Accept-Encoding" header contain "q=0", i.e. the encoding is not acceptable.
+func acceptsNothing(params []string) bool {
+	for _, param := range params {
+		param = strings.Replace(param, " ", "", -1)
+		if strings.HasPrefix(param, "q=") {
+			q, err := strconv.ParseFloat(param[2:], 64)
+			return err == nil && q == 0
+		}
+	}
+	return false
+}
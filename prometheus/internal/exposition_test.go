@@ -0,0 +1,214 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/model"
+)
+
+func TestNegotiateEncoder(t *testing.T) {
+	scenarios := []struct {
+		accept          string
+		wantContentType string
+	}{
+		{"", TextTelemetryContentType},
+		{"*/*", TextTelemetryContentType},
+		{"application/json", TextTelemetryContentType},
+		{`application/json;schema="prometheus/telemetry";version=0.0.2`, TextTelemetryContentType},
+		{"application/json;proto=io.prometheus.client.MetricFamily", JSONTelemetryContentType},
+		{"text/plain", TextTelemetryContentType},
+		{"text/plain;version=0.0.4", TextTelemetryContentType},
+		{"text/plain;version=0.0.5", TextTelemetryContentType},
+		{"application/openmetrics-text", OpenMetricsTelemetryContentType},
+		{"application/openmetrics-text;version=1.0.0", OpenMetricsTelemetryContentType},
+		{"application/openmetrics-text;version=2.0.0", TextTelemetryContentType},
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited", DelimitedTelemetryContentType},
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=text", ProtoTextTelemetryContentType},
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=compact-text", ProtoCompactTextTelemetryContentType},
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily", TextTelemetryContentType},
+		{"text/plain;q=0.5,application/openmetrics-text;version=1.0.0;q=0.8", OpenMetricsTelemetryContentType},
+		{"application/openmetrics-text;version=1.0.0;q=0.3,application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7", DelimitedTelemetryContentType},
+	}
+	for i, s := range scenarios {
+		request, _ := http.NewRequest("GET", "/", nil)
+		if s.accept != "" {
+			request.Header.Set(acceptHeader, s.accept)
+		}
+		if _, got, _ := NegotiateEncoder(request); got != s.wantContentType {
+			t.Errorf("%d. got content type %q for Accept %q, want %q", i, got, s.accept, s.wantContentType)
+		}
+	}
+}
+
+func TestNegotiateEncoderEscaping(t *testing.T) {
+	scenarios := []struct {
+		accept          string
+		wantContentType string
+		wantEscaping    model.EscapingScheme
+	}{
+		{"", TextTelemetryContentType, model.NameEscapingScheme},
+		{"text/plain;version=0.0.4", TextTelemetryContentType, model.NameEscapingScheme},
+		{"text/plain;version=0.0.4;escaping=allow-utf-8", TextTelemetryContentType + "; escaping=allow-utf-8", model.NoEscaping},
+		{"text/plain;escaping=dots", TextTelemetryContentType + "; escaping=dots", model.DotsEscaping},
+		{"text/plain;escaping=unknown", TextTelemetryContentType, model.NameEscapingScheme},
+		{"application/openmetrics-text;version=1.0.0;escaping=values", OpenMetricsTelemetryContentType + "; escaping=values", model.ValueEncodingEscaping},
+		{"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;escaping=underscores", DelimitedTelemetryContentType + "; escaping=underscores", model.UnderscoreEscaping},
+	}
+	for i, s := range scenarios {
+		request, _ := http.NewRequest("GET", "/", nil)
+		if s.accept != "" {
+			request.Header.Set(acceptHeader, s.accept)
+		}
+		_, contentType, escaping := NegotiateEncoder(request)
+		if contentType != s.wantContentType {
+			t.Errorf("%d. got content type %q for Accept %q, want %q", i, contentType, s.accept, s.wantContentType)
+		}
+		if escaping != s.wantEscaping {
+			t.Errorf("%d. got escaping scheme %s for Accept %q, want %s", i, escaping, s.accept, s.wantEscaping)
+		}
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestDecorateWriter(t *testing.T) {
+	// Register a fake encoding so that the test does not depend on the
+	// build tags.
+	Compressors["fake"] = func(w io.Writer) io.WriteCloser {
+		return nopWriteCloser{w}
+	}
+	defer delete(Compressors, "fake")
+
+	scenarios := []struct {
+		acceptEncoding string
+		compress       bool
+		wantEncoding   string
+	}{
+		{"", true, ""},
+		{"deflate", true, ""},
+		{"gzip", true, "gzip"},
+		{"gzip", false, ""},
+		{"gzip;q=0.5", true, "gzip"},
+		{"gzip; q=0", true, ""},
+		{"gzip;q=0.0, fake", true, "fake"},
+		{"deflate, fake, gzip", true, "fake"},
+		{"deflate, gzip, fake", true, "gzip"},
+		{" fake ;q=1 ", true, "fake"},
+	}
+	for i, s := range scenarios {
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set(acceptEncodingHeader, s.acceptEncoding)
+		var buf bytes.Buffer
+		writer, encoding := DecorateWriter(request, &buf, s.compress)
+		if encoding != s.wantEncoding {
+			t.Errorf("%d. got encoding %q for %q, want %q", i, encoding, s.acceptEncoding, s.wantEncoding)
+		}
+		if closer, ok := writer.(io.Closer); ok {
+			if encoding == "" {
+				t.Errorf("%d. got closable writer without encoding", i)
+			}
+			if err := closer.Close(); err != nil {
+				t.Errorf("%d. %s", i, err)
+			}
+		}
+	}
+}
+
+// countingResponseWriter counts the calls of Write.
+type countingResponseWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *countingResponseWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestWriteMetricFamiliesStreaming(t *testing.T) {
+	mf := &dto.MetricFamily{
+		Name: proto.String("test_counter"),
+		Help: proto.String("help"),
+		Type: dto.MetricType_COUNTER.Enum(),
+	}
+	var want bytes.Buffer
+	want.WriteString("# HELP test_counter help\n# TYPE test_counter counter\n")
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("%05d", i)
+		mf.Metric = append(mf.Metric, &dto.Metric{
+			Label:   []*dto.LabelPair{{Name: proto.String("id"), Value: proto.String(id)}},
+			Counter: &dto.Counter{Value: proto.Float64(1)},
+		})
+		fmt.Fprintf(&want, "test_counter{id=%q} 1\n", id)
+	}
+	if want.Len() <= 2*bufioWriterSize {
+		t.Fatalf("expected response of %d bytes is too small for this test", want.Len())
+	}
+
+	writer := &countingResponseWriter{ResponseRecorder: httptest.NewRecorder()}
+	request, _ := http.NewRequest("GET", "/", nil)
+	if err := WriteMetricFamilies(writer, request, []*dto.MetricFamily{mf}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := writer.Body.String(); got != want.String() {
+		t.Errorf("got unexpected body of %d bytes, want %d bytes", len(got), want.Len())
+	}
+	if got := writer.Header().Get("Content-Length"); got != "" {
+		t.Errorf("got Content-Length %q for streamed response", got)
+	}
+	// The response is written in chunks of the bufio.Writer's size.
+	if min := want.Len() / bufioWriterSize; writer.writes < min {
+		t.Errorf("got %d writes, want at least %d", writer.writes, min)
+	}
+	if max := want.Len()/bufioWriterSize + 1; writer.writes > max {
+		t.Errorf("got %d writes, want at most %d", writer.writes, max)
+	}
+}
+
+func TestWriteMetricFamiliesNameFilter(t *testing.T) {
+	mfs := []*dto.MetricFamily{
+		{Name: proto.String("a"), Type: dto.MetricType_UNTYPED.Enum(), Metric: []*dto.Metric{{Untyped: &dto.Untyped{Value: proto.Float64(1)}}}},
+		{Name: proto.String("b"), Type: dto.MetricType_UNTYPED.Enum(), Metric: []*dto.Metric{{Untyped: &dto.Untyped{Value: proto.Float64(2)}}}},
+		{Name: proto.String("c"), Type: dto.MetricType_UNTYPED.Enum(), Metric: []*dto.Metric{{Untyped: &dto.Untyped{Value: proto.Float64(3)}}}},
+	}
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/?name[]=a&name[]=c", nil)
+	if err := WriteMetricFamilies(writer, request, mfs, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "# TYPE a untyped\na 1\n# TYPE c untyped\nc 3\n"
+	if got := writer.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		if got := mfs[i].GetName(); got != name {
+			t.Errorf("%d. provided slice was modified, got %q, want %q", i, got, name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// LabelPair is a label name and value of a Sample.
+type LabelPair struct {
+	Name, Value string
+}
+
+// Sample is a single sample of a gathered metric family, as it would appear as
+// one line in the text format, e.g. one bucket of a histogram.
+type Sample struct {
+	Name string
+	// Labels are sorted by name. They include the "quantile" and "le"
+	// labels of summaries and histograms.
+	Labels []LabelPair
+	Value  float64
+	// Type is the type of the metric family the sample belongs to.
+	Type dto.MetricType
+	// TimestampMs is the timestamp of the metric in milliseconds since the
+	// epoch, or 0 if the metric has no timestamp.
+	TimestampMs int64
+}
+
+// FlattenMetricFamilies returns the samples of the provided metric families in
+// the same way as they are exposed in the text format: Summaries and histograms
+// are expanded into their quantiles or buckets, their sum, and their count. It
+// is meant for bridges to monitoring systems that only understand flat
+// samples. Metrics that do not match the type of their family are skipped.
+func FlattenMetricFamilies(mfs []*dto.MetricFamily) []Sample {
+	var samples []Sample
+	for _, mf := range mfs {
+		name, typ := mf.GetName(), mf.GetType()
+		for _, m := range mf.GetMetric() {
+			add := func(suffix string, v float64, extraName, extraValue string) {
+				labels := make([]LabelPair, 0, len(m.GetLabel())+1)
+				for _, lp := range m.GetLabel() {
+					labels = append(labels, LabelPair{lp.GetName(), lp.GetValue()})
+				}
+				if extraName != "" {
+					labels = append(labels, LabelPair{extraName, extraValue})
+				}
+				sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+				samples = append(samples, Sample{
+					Name:        name + suffix,
+					Labels:      labels,
+					Value:       v,
+					Type:        typ,
+					TimestampMs: m.GetTimestampMs(),
+				})
+			}
+			switch {
+			case typ == dto.MetricType_COUNTER && m.Counter != nil:
+				add("", m.Counter.GetValue(), "", "")
+			case typ == dto.MetricType_GAUGE && m.Gauge != nil:
+				add("", m.Gauge.GetValue(), "", "")
+			case typ == dto.MetricType_UNTYPED && m.Untyped != nil:
+				add("", m.Untyped.GetValue(), "", "")
+			case typ == dto.MetricType_SUMMARY && m.Summary != nil:
+				for _, q := range m.Summary.GetQuantile() {
+					add("", q.GetValue(), "quantile", fmt.Sprint(q.GetQuantile()))
+				}
+				add("_sum", m.Summary.GetSampleSum(), "", "")
+				add("_count", float64(m.Summary.GetSampleCount()), "", "")
+			case (typ == dto.MetricType_HISTOGRAM || typ == dto.MetricType_GAUGE_HISTOGRAM) && m.Histogram != nil:
+				infSeen := false
+				for _, b := range m.Histogram.GetBucket() {
+					add("_bucket", float64(b.GetCumulativeCount()), "le", fmt.Sprint(b.GetUpperBound()))
+					if math.IsInf(b.GetUpperBound(), +1) {
+						infSeen = true
+					}
+				}
+				if !infSeen {
+					add("_bucket", float64(m.Histogram.GetSampleCount()), "le", "+Inf")
+				}
+				add("_sum", m.Histogram.GetSampleSum(), "", "")
+				add("_count", float64(m.Histogram.GetSampleCount()), "", "")
+			}
+		}
+	}
+	return samples
+}
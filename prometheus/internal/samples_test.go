@@ -0,0 +1,75 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestFlattenMetricFamilies(t *testing.T) {
+	mfs := []*dto.MetricFamily{
+		{
+			Name: proto.String("requests_total"),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{
+					{Name: proto.String("method"), Value: proto.String("get")},
+					{Name: proto.String("code"), Value: proto.String("200")},
+				},
+				Counter:     &dto.Counter{Value: proto.Float64(42)},
+				TimestampMs: proto.Int64(1234),
+			}},
+		},
+		{
+			Name: proto.String("latency_seconds"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(3),
+					SampleSum:   proto.Float64(1.5),
+					Bucket: []*dto.Bucket{
+						{UpperBound: proto.Float64(0.5), CumulativeCount: proto.Uint64(2)},
+					},
+				},
+			}},
+		},
+		{
+			// A metric not matching the type of its family is skipped.
+			Name:   proto.String("broken"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Counter: &dto.Counter{Value: proto.Float64(1)}}},
+		},
+	}
+
+	want := []Sample{
+		{
+			Name:        "requests_total",
+			Labels:      []LabelPair{{"code", "200"}, {"method", "get"}},
+			Value:       42,
+			Type:        dto.MetricType_COUNTER,
+			TimestampMs: 1234,
+		},
+		{Name: "latency_seconds_bucket", Labels: []LabelPair{{"le", "0.5"}}, Value: 2, Type: dto.MetricType_HISTOGRAM},
+		{Name: "latency_seconds_bucket", Labels: []LabelPair{{"le", "+Inf"}}, Value: 3, Type: dto.MetricType_HISTOGRAM},
+		{Name: "latency_seconds_sum", Labels: []LabelPair{}, Value: 1.5, Type: dto.MetricType_HISTOGRAM},
+		{Name: "latency_seconds_count", Labels: []LabelPair{}, Value: 3, Type: dto.MetricType_HISTOGRAM},
+	}
+	if got := FlattenMetricFamilies(mfs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
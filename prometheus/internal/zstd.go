@@ -0,0 +1,64 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build zstd
+
+package internal
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Building with the "zstd" build tag adds support for the zstd content
+// encoding. It compresses large responses considerably faster than gzip.
+func init() {
+	Compressors["zstd"] = newPooledZstdWriter
+}
+
+// zstdPool holds zstd.Encoders for reuse, as each of them allocates large
+// window buffers.
+var zstdPool = sync.Pool{
+	New: func() interface{} {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			// Only happens with invalid options.
+			panic(err)
+		}
+		return enc
+	},
+}
+
+// pooledZstdWriter is a zstd.Encoder taken from zstdPool. Closing it puts it
+// back into the pool. Further calls of Close are no-ops.
+type pooledZstdWriter struct {
+	*zstd.Encoder
+}
+
+func newPooledZstdWriter(w io.Writer) io.WriteCloser {
+	enc := zstdPool.Get().(*zstd.Encoder)
+	enc.Reset(w)
+	return &pooledZstdWriter{enc}
+}
+
+func (w *pooledZstdWriter) Close() error {
+	if w.Encoder == nil {
+		return nil
+	}
+	err := w.Encoder.Close()
+	zstdPool.Put(w.Encoder)
+	w.Encoder = nil
+	return err
+}
@@ -0,0 +1,56 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+// +build zstd
+
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestPooledZstdWriter(t *testing.T) {
+	// The second round gets the Encoder from the first one out of the pool.
+	for i, want := range []string{"first response", "second response"} {
+		var buf bytes.Buffer
+		w := Compressors["zstd"](&buf)
+		if _, err := w.Write([]byte(want)); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		// Closing again must not put the Encoder into the pool twice.
+		if err := w.Close(); err != nil {
+			t.Fatalf("%d. unexpected error on second Close: %s", i, err)
+		}
+
+		dec, err := zstd.NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(dec)
+		dec.Close()
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		if string(got) != want {
+			t.Errorf("%d. got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -15,15 +15,18 @@ package prometheus
 
 import (
 	"strings"
+	"time"
 
 	dto "github.com/prometheus/client_model/go"
+
+	"github.com/golang/protobuf/proto"
 )
 
 // A Metric models a single sample value with its meta data being exported to
 // Prometheus. Implementers of Metric in this package inclued Gauge, Counter,
-// Untyped, and Summary. Users can implement their own Metric types, but that
-// should be rarely needed. See the example for SelfCollector, which is also an
-// example for a user-implemented Metric.
+// Untyped, Summary, and Histogram. Users can implement their own Metric types,
+// but that should be rarely needed. See the example for SelfCollector, which is
+// also an example for a user-implemented Metric.
 type Metric interface {
 	// Desc returns the descriptor for the Metric. This method idempotently
 	// returns the same descriptor throughout the lifetime of the
@@ -73,6 +76,18 @@ type Opts struct {
 	// string.
 	Help string
 
+	// Unit is the unit of the metric's values, e.g. "seconds" or
+	// "bytes". It is optional and exposed as metadata in the OpenMetrics
+	// and protocol buffer formats. A valid unit starts with a lowercase
+	// letter and consists of lowercase letters, digits, and underscores,
+	// but does not end with an underscore. By convention, the
+	// unit is also the suffix of the metric name, e.g. in
+	// "http_request_duration_seconds", which can be enforced with
+	// EnableUnitSuffixChecks.
+	//
+	// Metrics with the same fully-qualified name must have the same Unit.
+	Unit string
+
 	// ConstLabels are used to attach fixed labels to this metric. Metrics
 	// with the same fully-qualified name must have the same label names in
 	// their ConstLabels.
@@ -162,3 +177,32 @@ func NewInvalidMetric(desc *Desc, err error) Metric {
 func (m *invalidMetric) Desc() *Desc { return m.desc }
 
 func (m *invalidMetric) Write(*dto.Metric) error { return m.err }
+
+type timestampedMetric struct {
+	Metric
+	t time.Time
+}
+
+func (m timestampedMetric) Write(pb *dto.Metric) error {
+	e := m.Metric.Write(pb)
+	pb.TimestampMs = proto.Int64(m.t.Unix()*1000 + int64(m.t.Nanosecond()/1000000))
+	return e
+}
+
+// NewMetricWithTimestamp returns a new Metric wrapping the provided Metric in a
+// way that it has an explicit timestamp set to the provided Time. This is only
+// useful in rare cases as the timestamp of a Prometheus metric should usually
+// be set by the Prometheus server during scraping. Exceptions include mirroring
+// metrics with given timestamps from other metric sources, e.g. a Collector
+// exporting values that were sampled by a remote monitoring API at a known
+// time in the past.
+//
+// NewMetricWithTimestamp works best with MustNewConstMetric,
+// MustNewConstHistogram, and MustNewConstSummary, see example.
+//
+// Currently, the exposition formats used by Prometheus are limited to
+// millisecond resolution. Thus, the provided time will be rounded down to the
+// next full millisecond value.
+func NewMetricWithTimestamp(t time.Time, m Metric) Metric {
+	return timestampedMetric{Metric: m, t: t}
+}
@@ -13,7 +13,24 @@
 
 package prometheus
 
-import "testing"
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labelPairsString renders the provided label pairs like the constLabels of a
+// Desc, e.g. a="1",b="2".
+func labelPairsString(lps []*dto.LabelPair) string {
+	pairs := make([]string, 0, len(lps))
+	for _, lp := range lps {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", lp.GetName(), lp.GetValue()))
+	}
+	return strings.Join(pairs, ",")
+}
 
 func TestBuildFQName(t *testing.T) {
 	scenarios := []struct{ namespace, subsystem, name, result string }{
@@ -33,3 +50,50 @@ func TestBuildFQName(t *testing.T) {
 		}
 	}
 }
+
+func TestNewMetricWithTimestamp(t *testing.T) {
+	desc := NewDesc("mirrored_value", "A value sampled elsewhere.", []string{"region"}, nil)
+	ts := time.Unix(1257894000, 12345678)
+
+	m := NewMetricWithTimestamp(ts, MustNewConstMetric(desc, GaugeValue, 42, "eu"))
+	if m.Desc() != desc {
+		t.Errorf("expected wrapped metric to keep its Desc")
+	}
+
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := int64(1257894000012), pb.GetTimestampMs(); expected != got {
+		t.Errorf("expected timestamp %d, got %d", expected, got)
+	}
+	if expected, got := 42., pb.GetGauge().GetValue(); expected != got {
+		t.Errorf("expected value %f, got %f", expected, got)
+	}
+	if expected, got := `region="eu"`, labelPairsString(pb.GetLabel()); expected != got {
+		t.Errorf("expected labels %s, got %s", expected, got)
+	}
+}
+
+func TestOptsFQName(t *testing.T) {
+	const want = "ns_sub_name"
+	scenarios := []Collector{
+		NewCounter(CounterOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}),
+		NewGauge(GaugeOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}),
+		NewUntyped(UntypedOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}),
+		NewSummary(SummaryOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}),
+		NewHistogram(HistogramOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}),
+		NewGaugeHistogram(GaugeHistogramOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}),
+		NewInfo(InfoOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}, nil),
+		NewEnum(EnumOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help", States: []string{"a"}}),
+		NewCounterVec(CounterOpts{Namespace: "ns", Subsystem: "sub", Name: "name", Help: "help"}, []string{"l"}),
+	}
+
+	for i, c := range scenarios {
+		ch := make(chan *Desc, 1)
+		c.Describe(ch)
+		if got := (<-ch).fqName; got != want {
+			t.Errorf("%d. want %s, got %s", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestObserverVec(t *testing.T) {
+	vecs := []ObserverVec{
+		NewSummaryVec(SummaryOpts{
+			Name: "test_summary",
+			Help: "helpless",
+		}, []string{"handler", "code"}),
+		NewHistogramVec(HistogramOpts{
+			Name: "test_histogram",
+			Help: "helpless",
+		}, []string{"handler", "code"}),
+	}
+
+	for i, vec := range vecs {
+		curried := vec.MustCurryWith(Labels{"handler": "/api"})
+		curried.WithLabelValues("200").Observe(1)
+		curried.With(Labels{"code": "200"}).Observe(2)
+		if _, err := curried.GetMetricWithLabelValues("200", "spurious"); err == nil {
+			t.Errorf("%d. expected error for inconsistent label cardinality", i)
+		}
+
+		o, err := vec.GetMetricWith(Labels{"handler": "/api", "code": "200"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &dto.Metric{}
+		o.(Metric).Write(m)
+		var count uint64
+		switch {
+		case m.Summary != nil:
+			count = m.GetSummary().GetSampleCount()
+		case m.Histogram != nil:
+			count = m.GetHistogram().GetSampleCount()
+		default:
+			t.Errorf("%d. unexpected metric %s", i, m)
+		}
+		if got, want := count, uint64(2); got != want {
+			t.Errorf("%d. got sample count %d, want %d", i, got, want)
+		}
+	}
+}
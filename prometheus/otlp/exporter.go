@@ -0,0 +1,225 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otlp provides an exporter to push the metrics of a Prometheus
+// Gatherer to an OpenTelemetry collector via OTLP/HTTP. It is meant for
+// migrations to OpenTelemetry, so that code instrumented with Prometheus can
+// emit its metrics to both systems without being re-instrumented.
+//
+// The metrics are sent in the JSON encoding of OTLP, which every OTLP/HTTP
+// receiver accepts. OTLP/gRPC is not supported, as it requires the generated
+// OTLP protocol buffers, which this module does not depend on. Counters are
+// exported as monotonic cumulative sums, gauges and untyped metrics as
+// gauges, histograms as cumulative histograms with the same bucket
+// boundaries, native histograms as exponential histograms with the same
+// buckets, and summaries as summaries with the same quantiles. Cumulative
+// metrics start at their created timestamp if they have one. Labels become
+// attributes of the data points.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/internal"
+)
+
+// DefaultEndpoint is the default URL of the OTLP/HTTP metrics receiver of an
+// OpenTelemetry collector.
+const DefaultEndpoint = "http://localhost:4318/v1/metrics"
+
+// ErrorHandling defines how an Exporter handles errors while gathering.
+type ErrorHandling = internal.ErrorHandling
+
+// These constants cause an Exporter to behave as described if errors are
+// encountered while gathering.
+const (
+	// Push as many metrics as possible. The error is still returned by
+	// Push and logged by Run.
+	ContinueOnError = internal.ContinueOnError
+	// Return the error without pushing anything.
+	AbortOnError = internal.AbortOnError
+)
+
+// Logger is the minimal interface an Exporter needs for logging. Note that
+// log.Logger from the standard library implements this interface.
+type Logger = internal.Logger
+
+// Config defines the OTLP exporter config. The zero value of Config is a
+// reasonable default, exporting the metrics of prometheus.DefaultGatherer to
+// a collector on localhost.
+type Config struct {
+	// Endpoint is the full URL of the OTLP/HTTP metrics receiver. If
+	// empty, DefaultEndpoint is used.
+	Endpoint string
+
+	// Header is added to each request, e.g. for authentication.
+	Header http.Header
+
+	// ResourceAttributes describe the entity producing the metrics,
+	// e.g. {"service.name": "myapp"}.
+	ResourceAttributes map[string]string
+
+	// Interval is the time between two pushes of Run. If 0, it defaults
+	// to 15s.
+	Interval time.Duration
+
+	// Timeout is the timeout of a single push. If 0, it defaults to the
+	// Interval.
+	Timeout time.Duration
+
+	// Client is used for the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// Gatherer is the source of the metrics. If nil,
+	// prometheus.DefaultGatherer is used.
+	Gatherer prometheus.Gatherer
+
+	// Logger is used by Run to log the errors of the periodic pushes. If
+	// nil, errors are not logged at all.
+	Logger Logger
+
+	// ErrorHandling defines how errors while gathering are handled.
+	ErrorHandling ErrorHandling
+}
+
+// Exporter pushes metrics to an OpenTelemetry collector. Create instances with
+// NewExporter.
+type Exporter struct {
+	endpoint string
+	header   http.Header
+	resource resource
+	interval time.Duration
+	timeout  time.Duration
+	client   *http.Client
+
+	errorHandling ErrorHandling
+	logger        Logger
+
+	g prometheus.Gatherer
+
+	// start is the start time of the cumulative sums, histograms, and
+	// summaries.
+	start time.Time
+}
+
+// NewExporter returns a pointer to a new Exporter struct based on the
+// provided Config. It returns an error if the ErrorHandling is unknown.
+func NewExporter(c *Config) (*Exporter, error) {
+	if err := c.ErrorHandling.Check(); err != nil {
+		return nil, fmt.Errorf("otlp: %s", err)
+	}
+
+	e := &Exporter{
+		endpoint:      c.Endpoint,
+		header:        c.Header,
+		interval:      c.Interval,
+		timeout:       c.Timeout,
+		client:        c.Client,
+		errorHandling: c.ErrorHandling,
+		logger:        c.Logger,
+		g:             c.Gatherer,
+		start:         time.Now(),
+	}
+	for k, v := range c.ResourceAttributes {
+		e.resource.Attributes = append(e.resource.Attributes, keyValue{Key: k, Value: anyValue{StringValue: v}})
+	}
+	sort.Slice(e.resource.Attributes, func(i, j int) bool {
+		return e.resource.Attributes[i].Key < e.resource.Attributes[j].Key
+	})
+	if e.endpoint == "" {
+		e.endpoint = DefaultEndpoint
+	}
+	if e.interval == 0 {
+		e.interval = internal.DefaultBridgeInterval
+	}
+	if e.timeout == 0 {
+		e.timeout = e.interval
+	}
+	if e.client == nil {
+		e.client = http.DefaultClient
+	}
+	if e.g == nil {
+		e.g = prometheus.DefaultGatherer
+	}
+	return e, nil
+}
+
+// Run starts the event loop that pushes metrics every Interval of the Config
+// until the provided context is done. Errors are logged to the Logger of the
+// Config, if any. Run blocks, so it is usually called in its own goroutine.
+func (e *Exporter) Run(ctx context.Context) {
+	internal.RunBridge(ctx, e.interval, e.PushContext, e.logger, "error exporting to OTLP endpoint:")
+}
+
+// Push gathers the metrics and exports them once. It is a shortcut for
+// PushContext with a background context.
+func (e *Exporter) Push() error {
+	return e.PushContext(context.Background())
+}
+
+// PushContext works like Push but aborts the request once the provided
+// context is done. Independently, the request is aborted after the Timeout of
+// the Config. With ContinueOnError, the metrics gathered successfully are
+// exported even if gathering returned an error, and that error is returned
+// after the export.
+func (e *Exporter) PushContext(ctx context.Context) error {
+	mfs, gatherErr := internal.GatherForBridge(e.g, e.errorHandling)
+	metrics := translate(mfs, e.start, time.Now())
+	if len(metrics) == 0 {
+		return gatherErr
+	}
+
+	body, err := json.Marshal(exportMetricsServiceRequest{
+		ResourceMetrics: []resourceMetrics{{
+			Resource: e.resource,
+			ScopeMetrics: []scopeMetrics{{
+				Scope:   scope{Name: scopeName},
+				Metrics: metrics,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range e.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body) // Ignore any further error as this is for an error message only.
+		return fmt.Errorf("unexpected status code %d while exporting to %s: %s", resp.StatusCode, e.endpoint, body)
+	}
+	return gatherErr
+}
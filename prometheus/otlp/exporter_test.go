@@ -0,0 +1,269 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTranslate(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cv := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "requests_total", Help: "Requests."},
+		[]string{"method", "code"},
+	)
+	cv.WithLabelValues("get", "200").Add(3)
+	nan := prometheus.NewGauge(prometheus.GaugeOpts{Name: "nan", Help: "Not a number."})
+	nan.Set(math.NaN())
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "latency_seconds",
+		Help:    "Latency.",
+		Buckets: []float64{0.5, 1},
+	})
+	h.Observe(0.25)
+	h.Observe(0.75)
+	h.Observe(0.8)
+	h.Observe(2)
+	s := prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       "size_bytes",
+		Help:       "Size.",
+		Objectives: map[float64]float64{0.5: 0.05},
+	})
+	s.Observe(10)
+	reg.MustRegister(cv, nan, h, s)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The counter starts at its created timestamp, the other metrics at the
+	// start of the exporter.
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			switch {
+			case m.Counter != nil:
+				m.Counter.CreatedTimestamp = &timestamp.Timestamp{Seconds: 150, Nanos: 5}
+			case m.Histogram != nil:
+				m.Histogram.CreatedTimestamp = nil
+			case m.Summary != nil:
+				m.Summary.CreatedTimestamp = nil
+			}
+		}
+	}
+
+	start, now := time.Unix(100, 0), time.Unix(200, 0)
+	want := []metric{
+		{
+			Name:        "latency_seconds",
+			Description: "Latency.",
+			Histogram: &histogram{
+				AggregationTemporality: aggregationTemporalityCumulative,
+				DataPoints: []histogramDataPoint{{
+					StartTimeUnixNano: "100000000000",
+					TimeUnixNano:      "200000000000",
+					Count:             "4",
+					Sum:               3.8,
+					BucketCounts:      []string{"1", "2", "1"},
+					ExplicitBounds:    []float64{0.5, 1},
+				}},
+			},
+		},
+		{
+			Name:        "requests_total",
+			Description: "Requests.",
+			Sum: &sum{
+				AggregationTemporality: aggregationTemporalityCumulative,
+				IsMonotonic:            true,
+				DataPoints: []numberDataPoint{{
+					Attributes: []keyValue{
+						{Key: "code", Value: anyValue{StringValue: "200"}},
+						{Key: "method", Value: anyValue{StringValue: "get"}},
+					},
+					StartTimeUnixNano: "150000000005",
+					TimeUnixNano:      "200000000000",
+					AsDouble:          3,
+				}},
+			},
+		},
+		{
+			Name:        "size_bytes",
+			Description: "Size.",
+			Summary: &summary{
+				DataPoints: []summaryDataPoint{{
+					StartTimeUnixNano: "100000000000",
+					TimeUnixNano:      "200000000000",
+					Count:             "1",
+					Sum:               10,
+					QuantileValues:    []quantileValue{{Quantile: 0.5, Value: 10}},
+				}},
+			},
+		},
+	}
+	if got := translate(mfs, start, now); !reflect.DeepEqual(got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("want\n%s\ngot\n%s", wantJSON, gotJSON)
+	}
+}
+
+func TestTranslateNativeHistogram(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:                        "native_seconds",
+		Help:                        "Native.",
+		NativeHistogramBucketFactor: 2,
+	})
+	h.Observe(1.5)
+	reg.MustRegister(h)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs = append(mfs, &dto.MetricFamily{
+		Name: proto.String("sparse_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{
+			Histogram: &dto.Histogram{
+				SampleCount:      proto.Uint64(8),
+				SampleSum:        proto.Float64(-1),
+				CreatedTimestamp: &timestamp.Timestamp{Seconds: 150},
+				Schema:           proto.Int32(0),
+				ZeroThreshold:    proto.Float64(0.001),
+				ZeroCount:        proto.Uint64(1),
+				// Buckets 1 and 2, then a gap, then bucket 4.
+				PositiveSpan: []*dto.BucketSpan{
+					{Offset: proto.Int32(1), Length: proto.Uint32(2)},
+					{Offset: proto.Int32(1), Length: proto.Uint32(1)},
+				},
+				PositiveDelta: []int64{1, 1, -1},
+				NegativeSpan:  []*dto.BucketSpan{{Offset: proto.Int32(0), Length: proto.Uint32(1)}},
+				NegativeDelta: []int64{3},
+			},
+		}},
+	})
+
+	got := translate(mfs, time.Unix(100, 0), time.Unix(200, 0))
+	if len(got) != 2 {
+		t.Fatalf("got %d metrics, want 2", len(got))
+	}
+	for _, m := range got {
+		if m.Histogram != nil || m.ExponentialHistogram == nil {
+			t.Fatalf("%s: want exponential histogram, got %+v", m.Name, m)
+		}
+	}
+
+	// The observation of 1.5 falls into the bucket (1, 2], which has
+	// index 1 in a native histogram and index 0 in OTLP.
+	dp := got[0].ExponentialHistogram.DataPoints[0]
+	if want := (buckets{Offset: 0, BucketCounts: []string{"1"}}); !reflect.DeepEqual(dp.Positive, want) {
+		t.Errorf("want positive buckets %+v, got %+v", want, dp.Positive)
+	}
+
+	want := exponentialHistogramDataPoint{
+		StartTimeUnixNano: "150000000000",
+		TimeUnixNano:      "200000000000",
+		Count:             "8",
+		Sum:               -1,
+		Scale:             0,
+		ZeroCount:         "1",
+		ZeroThreshold:     0.001,
+		Positive:          buckets{Offset: 0, BucketCounts: []string{"1", "2", "0", "1"}},
+		Negative:          buckets{Offset: -1, BucketCounts: []string{"3"}},
+	}
+	if got := got[1].ExponentialHistogram.DataPoints[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestPush(t *testing.T) {
+	var (
+		lastMethod, lastContentType, lastAuth string
+		lastBody                              exportMetricsServiceRequest
+		status                                = http.StatusOK
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastMethod = r.Method
+		lastContentType = r.Header.Get("Content-Type")
+		lastAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&lastBody); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("fake error"))
+	}))
+	defer ts.Close()
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature", Help: "Temperature."})
+	g.Set(21.5)
+	reg.MustRegister(g)
+
+	e, err := NewExporter(&Config{
+		Endpoint:           ts.URL + "/v1/metrics",
+		Header:             http.Header{"Authorization": {"Bearer secret"}},
+		ResourceAttributes: map[string]string{"service.name": "test", "host.name": "localhost"},
+		Gatherer:           reg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Push(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != "POST" {
+		t.Errorf("want method POST, got %s", lastMethod)
+	}
+	if lastContentType != "application/json" {
+		t.Errorf("want content type application/json, got %s", lastContentType)
+	}
+	if lastAuth != "Bearer secret" {
+		t.Errorf("want Authorization header %q, got %q", "Bearer secret", lastAuth)
+	}
+	if len(lastBody.ResourceMetrics) != 1 {
+		t.Fatalf("want 1 resource, got %d", len(lastBody.ResourceMetrics))
+	}
+	rm := lastBody.ResourceMetrics[0]
+	wantAttrs := []keyValue{
+		{Key: "host.name", Value: anyValue{StringValue: "localhost"}},
+		{Key: "service.name", Value: anyValue{StringValue: "test"}},
+	}
+	if !reflect.DeepEqual(rm.Resource.Attributes, wantAttrs) {
+		t.Errorf("want resource attributes %v, got %v", wantAttrs, rm.Resource.Attributes)
+	}
+	if len(rm.ScopeMetrics) != 1 || rm.ScopeMetrics[0].Scope.Name != scopeName {
+		t.Fatalf("unexpected scope metrics %+v", rm.ScopeMetrics)
+	}
+	ms := rm.ScopeMetrics[0].Metrics
+	if len(ms) != 1 || ms[0].Name != "temperature" || ms[0].Gauge == nil || ms[0].Gauge.DataPoints[0].AsDouble != 21.5 {
+		t.Errorf("unexpected metrics %+v", ms)
+	}
+
+	status = http.StatusBadRequest
+	if err := e.Push(); err == nil || !strings.Contains(err.Error(), "fake error") {
+		t.Errorf("want error with response body, got %v", err)
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The types below mirror the messages of the OTLP metrics protocol
+// (opentelemetry/proto/metrics/v1) in their JSON encoding. Following the
+// protobuf JSON mapping, 64-bit integers are encoded as strings, and enums
+// are encoded as integers, as required by OTLP/JSON.
+
+// aggregationTemporalityCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE.
+const aggregationTemporalityCumulative = 2
+
+// scopeName is the instrumentation scope of all exported metrics.
+const scopeName = "github.com/prometheus/client_golang/prometheus/otlp"
+
+type exportMetricsServiceRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type metric struct {
+	Name                 string                `json:"name"`
+	Description          string                `json:"description,omitempty"`
+	Unit                 string                `json:"unit,omitempty"`
+	Gauge                *gauge                `json:"gauge,omitempty"`
+	Sum                  *sum                  `json:"sum,omitempty"`
+	Histogram            *histogram            `json:"histogram,omitempty"`
+	ExponentialHistogram *exponentialHistogram `json:"exponentialHistogram,omitempty"`
+	Summary              *summary              `json:"summary,omitempty"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type exponentialHistogram struct {
+	DataPoints             []exponentialHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                             `json:"aggregationTemporality"`
+}
+
+type summary struct {
+	DataPoints []summaryDataPoint `json:"dataPoints"`
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsDouble          float64    `json:"asDouble"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+}
+
+type exponentialHistogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	Scale             int32      `json:"scale"`
+	ZeroCount         string     `json:"zeroCount"`
+	ZeroThreshold     float64    `json:"zeroThreshold"`
+	Positive          buckets    `json:"positive"`
+	Negative          buckets    `json:"negative"`
+}
+
+type buckets struct {
+	Offset       int32    `json:"offset"`
+	BucketCounts []string `json:"bucketCounts"`
+}
+
+type summaryDataPoint struct {
+	Attributes        []keyValue      `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	QuantileValues    []quantileValue `json:"quantileValues"`
+}
+
+type quantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// translate converts the provided metric families into OTLP metrics. Counters
+// become monotonic cumulative sums, gauges and untyped metrics become gauges,
+// and histograms (including gauge histograms) and summaries keep their
+// buckets and quantiles. Native histograms become exponential histograms,
+// unless the family also has classic buckets, which are then preferred, as a
+// metric has only one type in OTLP. Metrics that do not match the type of
+// their family are skipped, as are values that cannot be encoded in JSON,
+// i.e. NaN and infinite values, and float histograms, which this library does
+// not create.
+//
+// The start of the cumulative aggregation is the created timestamp of a
+// metric if it has one, or the provided start time otherwise. The provided
+// now is used for metrics without a timestamp.
+func translate(mfs []*dto.MetricFamily, start, now time.Time) []metric {
+	defaultStart := unixNano(start)
+	var metrics []metric
+	for _, mf := range mfs {
+		m := metric{
+			Name:        mf.GetName(),
+			Description: mf.GetHelp(),
+			Unit:        mf.GetUnit(),
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			m.Sum = &sum{
+				AggregationTemporality: aggregationTemporalityCumulative,
+				IsMonotonic:            true,
+			}
+			for _, pm := range mf.GetMetric() {
+				if pm.Counter == nil || !isFinite(pm.Counter.GetValue()) {
+					continue
+				}
+				m.Sum.DataPoints = append(m.Sum.DataPoints, numberDataPoint{
+					Attributes:        attributes(pm.GetLabel()),
+					StartTimeUnixNano: startTime(pm.Counter.GetCreatedTimestamp(), defaultStart),
+					TimeUnixNano:      sampleTime(pm, now),
+					AsDouble:          pm.Counter.GetValue(),
+				})
+			}
+			if len(m.Sum.DataPoints) == 0 {
+				continue
+			}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			m.Gauge = &gauge{}
+			for _, pm := range mf.GetMetric() {
+				var v float64
+				switch {
+				case mf.GetType() == dto.MetricType_GAUGE && pm.Gauge != nil:
+					v = pm.Gauge.GetValue()
+				case mf.GetType() == dto.MetricType_UNTYPED && pm.Untyped != nil:
+					v = pm.Untyped.GetValue()
+				default:
+					continue
+				}
+				if !isFinite(v) {
+					continue
+				}
+				m.Gauge.DataPoints = append(m.Gauge.DataPoints, numberDataPoint{
+					Attributes:   attributes(pm.GetLabel()),
+					TimeUnixNano: sampleTime(pm, now),
+					AsDouble:     v,
+				})
+			}
+			if len(m.Gauge.DataPoints) == 0 {
+				continue
+			}
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			if isNativeFamily(mf) {
+				m.ExponentialHistogram = &exponentialHistogram{AggregationTemporality: aggregationTemporalityCumulative}
+				for _, pm := range mf.GetMetric() {
+					if !isNative(pm.Histogram) || pm.Histogram.GetSampleCountFloat() > 0 ||
+						!isFinite(pm.Histogram.GetSampleSum()) {
+						continue
+					}
+					m.ExponentialHistogram.DataPoints = append(
+						m.ExponentialHistogram.DataPoints, exponentialHistogramPoint(pm, defaultStart, now),
+					)
+				}
+				if len(m.ExponentialHistogram.DataPoints) == 0 {
+					continue
+				}
+				break
+			}
+			m.Histogram = &histogram{AggregationTemporality: aggregationTemporalityCumulative}
+			for _, pm := range mf.GetMetric() {
+				if pm.Histogram == nil || !isFinite(pm.Histogram.GetSampleSum()) {
+					continue
+				}
+				m.Histogram.DataPoints = append(m.Histogram.DataPoints, histogramPoint(pm, defaultStart, now))
+			}
+			if len(m.Histogram.DataPoints) == 0 {
+				continue
+			}
+		case dto.MetricType_SUMMARY:
+			m.Summary = &summary{}
+			for _, pm := range mf.GetMetric() {
+				if pm.Summary == nil || !isFinite(pm.Summary.GetSampleSum()) {
+					continue
+				}
+				dp := summaryDataPoint{
+					Attributes:        attributes(pm.GetLabel()),
+					StartTimeUnixNano: startTime(pm.Summary.GetCreatedTimestamp(), defaultStart),
+					TimeUnixNano:      sampleTime(pm, now),
+					Count:             strconv.FormatUint(pm.Summary.GetSampleCount(), 10),
+					Sum:               pm.Summary.GetSampleSum(),
+					QuantileValues:    []quantileValue{},
+				}
+				for _, q := range pm.Summary.GetQuantile() {
+					if !isFinite(q.GetValue()) {
+						continue
+					}
+					dp.QuantileValues = append(dp.QuantileValues, quantileValue{
+						Quantile: q.GetQuantile(),
+						Value:    q.GetValue(),
+					})
+				}
+				m.Summary.DataPoints = append(m.Summary.DataPoints, dp)
+			}
+			if len(m.Summary.DataPoints) == 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// histogramPoint converts the cumulative buckets of the provided metric into
+// the per-bucket counts of OTLP. An explicit +Inf bucket is dropped, as OTLP
+// always has an implicit overflow bucket.
+func histogramPoint(pm *dto.Metric, defaultStart string, now time.Time) histogramDataPoint {
+	h := pm.Histogram
+	dp := histogramDataPoint{
+		Attributes:        attributes(pm.GetLabel()),
+		StartTimeUnixNano: startTime(h.GetCreatedTimestamp(), defaultStart),
+		TimeUnixNano:      sampleTime(pm, now),
+		Count:             strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:               h.GetSampleSum(),
+		BucketCounts:      []string{},
+		ExplicitBounds:    []float64{},
+	}
+	var prev uint64
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), +1) {
+			break
+		}
+		dp.ExplicitBounds = append(dp.ExplicitBounds, b.GetUpperBound())
+		dp.BucketCounts = append(dp.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-prev, 10))
+		prev = b.GetCumulativeCount()
+	}
+	dp.BucketCounts = append(dp.BucketCounts, strconv.FormatUint(h.GetSampleCount()-prev, 10))
+	return dp
+}
+
+// isNativeFamily returns whether the histograms of the provided family are
+// exported as exponential histograms, i.e. whether none of them has classic
+// buckets and at least one of them is a native histogram.
+func isNativeFamily(mf *dto.MetricFamily) bool {
+	native := false
+	for _, pm := range mf.GetMetric() {
+		if len(pm.GetHistogram().GetBucket()) > 0 {
+			return false
+		}
+		if isNative(pm.GetHistogram()) {
+			native = true
+		}
+	}
+	return native
+}
+
+// isNative returns whether the provided histogram is a native histogram. A
+// native histogram without any observations is still marked as such by a zero
+// threshold, a zero count, or an empty span.
+func isNative(h *dto.Histogram) bool {
+	return h.GetZeroThreshold() > 0 || h.GetZeroCount() > 0 || h.GetZeroCountFloat() > 0 ||
+		len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0
+}
+
+// exponentialHistogramPoint converts the native buckets of the provided
+// metric into OTLP buckets. The schema of a native histogram is the scale in
+// OTLP, but the bucket with index i has the upper bound base^i in a native
+// histogram and the lower bound base^i in OTLP, so the offsets are shifted by
+// one.
+func exponentialHistogramPoint(pm *dto.Metric, defaultStart string, now time.Time) exponentialHistogramDataPoint {
+	h := pm.Histogram
+	return exponentialHistogramDataPoint{
+		Attributes:        attributes(pm.GetLabel()),
+		StartTimeUnixNano: startTime(h.GetCreatedTimestamp(), defaultStart),
+		TimeUnixNano:      sampleTime(pm, now),
+		Count:             strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:               h.GetSampleSum(),
+		Scale:             h.GetSchema(),
+		ZeroCount:         strconv.FormatUint(h.GetZeroCount(), 10),
+		ZeroThreshold:     h.GetZeroThreshold(),
+		Positive:          exponentialBuckets(h.GetPositiveSpan(), h.GetPositiveDelta()),
+		Negative:          exponentialBuckets(h.GetNegativeSpan(), h.GetNegativeDelta()),
+	}
+}
+
+// exponentialBuckets decodes the spans and delta-encoded counts of native
+// buckets into the dense counts of OTLP, filling the gaps between the spans
+// with zeros.
+func exponentialBuckets(spans []*dto.BucketSpan, deltas []int64) buckets {
+	b := buckets{BucketCounts: []string{}}
+	var (
+		count int64
+		next  int
+	)
+	for i, span := range spans {
+		if i == 0 {
+			b.Offset = span.GetOffset() - 1
+		} else {
+			for j := int32(0); j < span.GetOffset(); j++ {
+				b.BucketCounts = append(b.BucketCounts, "0")
+			}
+		}
+		for j := uint32(0); j < span.GetLength() && next < len(deltas); j++ {
+			count += deltas[next]
+			next++
+			b.BucketCounts = append(b.BucketCounts, strconv.FormatInt(count, 10))
+		}
+	}
+	if len(b.BucketCounts) == 0 {
+		b.Offset = 0
+	}
+	return b
+}
+
+// attributes converts label pairs into OTLP attributes, sorted by key.
+func attributes(lps []*dto.LabelPair) []keyValue {
+	if len(lps) == 0 {
+		return nil
+	}
+	attrs := make([]keyValue, len(lps))
+	for i, lp := range lps {
+		attrs[i] = keyValue{Key: lp.GetName(), Value: anyValue{StringValue: lp.GetValue()}}
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+// sampleTime returns the timestamp of the provided metric in nanoseconds since
+// the epoch, or now if the metric has no timestamp.
+func sampleTime(pm *dto.Metric, now time.Time) string {
+	if pm.TimestampMs != nil {
+		return strconv.FormatInt(pm.GetTimestampMs()*int64(time.Millisecond), 10)
+	}
+	return unixNano(now)
+}
+
+// startTime returns the provided created timestamp in nanoseconds since the
+// epoch, or defaultStart if there is none.
+func startTime(ts *timestamp.Timestamp, defaultStart string) string {
+	if ts == nil {
+		return defaultStart
+	}
+	return strconv.FormatInt(ts.GetSeconds()*int64(time.Second)+int64(ts.GetNanos()), 10)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
@@ -13,6 +13,14 @@
 
 package prometheus
 
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
 type processCollector struct {
 	pid             int
 	collectFn       func(chan<- Metric)
@@ -21,6 +29,31 @@ type processCollector struct {
 	openFDs, maxFDs Gauge
 	vsize, rss      Gauge
 	startTime       Gauge
+	errors          Counter // nil unless errors are reported.
+}
+
+// ProcessCollectorOpts bundles the options for creating a process collector
+// with NewProcessCollectorWithOpts. All fields are optional and can safely be
+// left at their zero value.
+type ProcessCollectorOpts struct {
+	// PidFn is called on each collect to determine the process to export
+	// metrics for. If PidFn is nil, the metrics of the process with PID
+	// Pid are exported. Use NewPidFileFn to monitor a process that writes
+	// its PID into a pidfile.
+	PidFn func() (int, error)
+	// Pid is the PID of the process to export metrics for. It is only used
+	// if PidFn is nil. If both are left at their zero value, the metrics of
+	// the current process are exported.
+	Pid int
+	// Namespace is prepended to the names of all metrics, see
+	// NewProcessCollector.
+	Namespace string
+	// If ReportErrors is true, the collector additionally exports the
+	// counter process_collector_errors_total, which counts the collects
+	// that failed partially or entirely, e.g. because PidFn returned an
+	// error or the process did not exist. Otherwise, such errors are
+	// silently ignored.
+	ReportErrors bool
 }
 
 // NewProcessCollector returns a collector which exports the current state of
@@ -42,6 +75,33 @@ func NewProcessCollectorPIDFn(
 	pidFn func() (int, error),
 	namespace string,
 ) *processCollector {
+	return NewProcessCollectorWithOpts(ProcessCollectorOpts{
+		PidFn:     pidFn,
+		Namespace: namespace,
+	})
+}
+
+// NewProcessCollectorWithOpts returns a collector which exports the current
+// state of process metrics including cpu, memory and file descriptor usage as
+// well as the process start time, configured by the given
+// ProcessCollectorOpts. It is useful for exporters that run next to the
+// process they monitor, e.g. a legacy daemon that cannot be instrumented
+// directly.
+//
+// The metrics are read from procfs on Linux, Plan 9, and Solaris, and via the
+// process APIs on Windows, where the file descriptors are the open handles. On
+// Darwin, only the CPU time and the file descriptors of the current process are
+// available. Metrics that cannot be read are omitted rather than exported as
+// zero. Enable ReportErrors to observe such failures.
+func NewProcessCollectorWithOpts(opts ProcessCollectorOpts) *processCollector {
+	pidFn, namespace := opts.PidFn, opts.Namespace
+	if pidFn == nil {
+		pid := opts.Pid
+		if pid == 0 {
+			pid = os.Getpid()
+		}
+		pidFn = func() (int, error) { return pid, nil }
+	}
 	c := processCollector{
 		pidFn:     pidFn,
 		collectFn: func(chan<- Metric) {},
@@ -77,6 +137,13 @@ func NewProcessCollectorPIDFn(
 			Help:      "Start time of the process since unix epoch in seconds.",
 		}),
 	}
+	if opts.ReportErrors {
+		c.errors = NewCounter(CounterOpts{
+			Namespace: namespace,
+			Name:      "process_collector_errors_total",
+			Help:      "Total number of collects of process metrics that failed partially or entirely.",
+		})
+	}
 
 	// Set up process metric collection if supported by the runtime.
 	if processCollectSupported() {
@@ -94,9 +161,40 @@ func (c *processCollector) Describe(ch chan<- *Desc) {
 	ch <- c.vsize.Desc()
 	ch <- c.rss.Desc()
 	ch <- c.startTime.Desc()
+	if c.errors != nil {
+		ch <- c.errors.Desc()
+	}
 }
 
 // Collect returns the current state of all metrics of the collector.
 func (c *processCollector) Collect(ch chan<- Metric) {
 	c.collectFn(ch)
+	if c.errors != nil {
+		ch <- c.errors
+	}
+}
+
+// reportError counts a failed collect if errors are reported.
+func (c *processCollector) reportError() {
+	if c.errors != nil {
+		c.errors.Inc()
+	}
+}
+
+// NewPidFileFn returns a function that reads the PID of a process from the
+// given pidfile. The function is meant to be used as the PidFn of a
+// ProcessCollectorOpts, or with NewProcessCollectorPIDFn. As the pidfile is
+// read on each call, the process may be restarted with a different PID.
+func NewPidFileFn(pidFilePath string) func() (int, error) {
+	return func() (int, error) {
+		content, err := ioutil.ReadFile(pidFilePath)
+		if err != nil {
+			return 0, fmt.Errorf("can't read pid file %q: %s", pidFilePath, err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			return 0, fmt.Errorf("can't parse pid file %q: %s", pidFilePath, err)
+		}
+		return pid, nil
+	}
 }
@@ -0,0 +1,83 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build darwin
+
+package prometheus
+
+import (
+	"os"
+	"syscall"
+)
+
+func processCollectSupported() bool {
+	return true
+}
+
+// processCollect reads the process metrics via system calls. Without cgo, the
+// memory sizes and the start time of a process are not accessible on
+// Darwin. Only the CPU time and the file descriptors are exported, and only for
+// the process the collector runs in. Collecting the metrics of another process
+// is counted as an error.
+func (c *processCollector) processCollect(ch chan<- Metric) {
+	pid, err := c.pidFn()
+	if err != nil || pid != os.Getpid() {
+		c.reportError()
+		return
+	}
+
+	var failed bool
+
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err == nil {
+		c.cpuTotal.Set(float64(usage.Utime.Nano()+usage.Stime.Nano()) / 1e9)
+		ch <- c.cpuTotal
+	} else {
+		failed = true
+	}
+
+	if fds, err := openFDsSelf(); err == nil {
+		c.openFDs.Set(float64(fds))
+		ch <- c.openFDs
+	} else {
+		failed = true
+	}
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err == nil {
+		c.maxFDs.Set(float64(limit.Cur))
+		ch <- c.maxFDs
+	} else {
+		failed = true
+	}
+
+	if failed {
+		c.reportError()
+	}
+}
+
+// openFDsSelf returns the number of open file descriptors of the current
+// process by listing /dev/fd.
+func openFDsSelf() (int, error) {
+	d, err := os.Open("/dev/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	// Do not count the file descriptor of /dev/fd itself.
+	return len(names) - 1, nil
+}
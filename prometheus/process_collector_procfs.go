@@ -29,14 +29,18 @@ func processCollectSupported() bool {
 func (c *processCollector) processCollect(ch chan<- Metric) {
 	pid, err := c.pidFn()
 	if err != nil {
+		c.reportError()
 		return
 	}
 
 	p, err := procfs.NewProc(pid)
 	if err != nil {
+		c.reportError()
 		return
 	}
 
+	var failed bool
+
 	if stat, err := p.NewStat(); err == nil {
 		c.cpuTotal.Set(stat.CPUTime())
 		ch <- c.cpuTotal
@@ -48,16 +52,28 @@ func (c *processCollector) processCollect(ch chan<- Metric) {
 		if startTime, err := stat.StartTime(); err == nil {
 			c.startTime.Set(startTime)
 			ch <- c.startTime
+		} else {
+			failed = true
 		}
+	} else {
+		failed = true
 	}
 
 	if fds, err := p.FileDescriptorsLen(); err == nil {
 		c.openFDs.Set(float64(fds))
 		ch <- c.openFDs
+	} else {
+		failed = true
 	}
 
 	if limits, err := p.NewLimits(); err == nil {
 		c.maxFDs.Set(float64(limits.OpenFiles))
 		ch <- c.maxFDs
+	} else {
+		failed = true
+	}
+
+	if failed {
+		c.reportError()
 	}
 }
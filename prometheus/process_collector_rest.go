@@ -12,6 +12,8 @@
 // limitations under the License.
 
 // +build !linux,!plan9,!solaris !cgo
+// +build !windows
+// +build !darwin
 
 package prometheus
 
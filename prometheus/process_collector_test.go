@@ -1,10 +1,12 @@
 package prometheus
 
 import (
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 
@@ -16,7 +18,7 @@ func TestProcessCollector(t *testing.T) {
 		t.Skipf("skipping TestProcessCollector, procfs not available: %s", err)
 	}
 
-	registry := newRegistry()
+	registry := NewRegistry()
 	registry.Register(NewProcessCollector(os.Getpid(), ""))
 	registry.Register(NewProcessCollectorPIDFn(
 		func() (int, error) { return os.Getpid(), nil }, "foobar"))
@@ -52,3 +54,120 @@ func TestProcessCollector(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessCollectorReportErrors(t *testing.T) {
+	if _, err := procfs.Self(); err != nil {
+		t.Skipf("skipping TestProcessCollectorReportErrors, procfs not available: %s", err)
+	}
+
+	pid := os.Getpid()
+	var pidErr error
+	c := NewProcessCollectorWithOpts(ProcessCollectorOpts{
+		PidFn:        func() (int, error) { return pid, pidErr },
+		ReportErrors: true,
+	})
+	registry := NewRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	errorCount := func() float64 {
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "process_collector_errors_total" {
+				return mf.GetMetric()[0].GetCounter().GetValue()
+			}
+		}
+		t.Fatal("process_collector_errors_total not exported")
+		return 0
+	}
+
+	if got := errorCount(); got != 0 {
+		t.Errorf("got %v errors, want 0", got)
+	}
+	pidErr = errors.New("pid unknown")
+	if got := errorCount(); got != 1 {
+		t.Errorf("got %v errors, want 1", got)
+	}
+
+	// Without ReportErrors, the error counter is not exported.
+	ch := make(chan *Desc, 10)
+	NewProcessCollector(pid, "").Describe(ch)
+	close(ch)
+	for desc := range ch {
+		if desc.fqName == "process_collector_errors_total" {
+			t.Error("got process_collector_errors_total without ReportErrors")
+		}
+	}
+}
+
+func TestProcessCollectorZeroOpts(t *testing.T) {
+	if _, err := procfs.Self(); err != nil {
+		t.Skipf("skipping TestProcessCollectorZeroOpts, procfs not available: %s", err)
+	}
+
+	registry := NewRegistry()
+	if err := registry.Register(NewProcessCollectorWithOpts(ProcessCollectorOpts{ReportErrors: true})); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		m := mf.GetMetric()[0]
+		got[mf.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+	}
+	if got["process_collector_errors_total"] != 0 {
+		t.Errorf("got %v errors, want 0", got["process_collector_errors_total"])
+	}
+	if got["process_open_fds"] <= 0 {
+		t.Errorf("got %v open fds, want the open fds of the current process", got["process_open_fds"])
+	}
+}
+
+func TestNewPidFileFn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_pid_file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	validPath := filepath.Join(dir, "valid.pid")
+	if err := ioutil.WriteFile(validPath, []byte("4242\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	invalidPath := filepath.Join(dir, "invalid.pid")
+	if err := ioutil.WriteFile(invalidPath, []byte("not a pid"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		path    string
+		pid     int
+		wantErr bool
+	}{
+		{path: validPath, pid: 4242},
+		{path: invalidPath, wantErr: true},
+		{path: filepath.Join(dir, "missing.pid"), wantErr: true},
+	}
+	for i, s := range scenarios {
+		pid, err := NewPidFileFn(s.path)()
+		if s.wantErr {
+			if err == nil {
+				t.Errorf("%d. expected error, got pid %d", i, pid)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+		}
+		if pid != s.pid {
+			t.Errorf("%d. got pid %d, want %d", i, pid, s.pid)
+		}
+	}
+}
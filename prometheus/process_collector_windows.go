@@ -0,0 +1,142 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build windows
+
+package prometheus
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modpsapi    = syscall.NewLazyDLL("psapi.dll")
+	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetProcessMemoryInfo  = modpsapi.NewProc("GetProcessMemoryInfo")
+	procGetProcessHandleCount = modkernel32.NewProc("GetProcessHandleCount")
+)
+
+const (
+	processQueryLimitedInformation = 0x1000
+	processVMRead                  = 0x0010
+
+	// maxHandles is the maximum number of handles a process can open. It
+	// is a fixed limit of the Windows kernel.
+	maxHandles = 16 * 1024 * 1024
+)
+
+// processMemoryCounters mirrors PROCESS_MEMORY_COUNTERS_EX.
+type processMemoryCounters struct {
+	cb                         uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+	PrivateUsage               uintptr
+}
+
+func processCollectSupported() bool {
+	return true
+}
+
+func getProcessMemoryInfo(handle syscall.Handle) (processMemoryCounters, error) {
+	mem := processMemoryCounters{}
+	mem.cb = uint32(unsafe.Sizeof(mem))
+	r1, _, err := procGetProcessMemoryInfo.Call(
+		uintptr(handle),
+		uintptr(unsafe.Pointer(&mem)),
+		uintptr(mem.cb),
+	)
+	if r1 == 0 {
+		return mem, err
+	}
+	return mem, nil
+}
+
+func getProcessHandleCount(handle syscall.Handle) (uint32, error) {
+	var count uint32
+	r1, _, err := procGetProcessHandleCount.Call(
+		uintptr(handle),
+		uintptr(unsafe.Pointer(&count)),
+	)
+	if r1 == 0 {
+		return 0, err
+	}
+	return count, nil
+}
+
+// fileTimeToSeconds converts a duration in a Filetime, which counts 100ns
+// intervals, into seconds.
+func fileTimeToSeconds(ft syscall.Filetime) float64 {
+	return float64(uint64(ft.HighDateTime)<<32|uint64(ft.LowDateTime)) / 1e7
+}
+
+// processCollect reads the process metrics via the Windows process APIs. The
+// virtual memory size is the private memory of the process, the resident
+// memory size is its working set, and the file descriptors are the open
+// handles.
+func (c *processCollector) processCollect(ch chan<- Metric) {
+	pid, err := c.pidFn()
+	if err != nil {
+		c.reportError()
+		return
+	}
+
+	h, err := syscall.OpenProcess(processQueryLimitedInformation|processVMRead, false, uint32(pid))
+	if err != nil {
+		c.reportError()
+		return
+	}
+	defer syscall.CloseHandle(h)
+
+	var failed bool
+
+	var creationTime, exitTime, kernelTime, userTime syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creationTime, &exitTime, &kernelTime, &userTime); err == nil {
+		c.cpuTotal.Set(fileTimeToSeconds(kernelTime) + fileTimeToSeconds(userTime))
+		ch <- c.cpuTotal
+		c.startTime.Set(float64(creationTime.Nanoseconds()) / 1e9)
+		ch <- c.startTime
+	} else {
+		failed = true
+	}
+
+	if mem, err := getProcessMemoryInfo(h); err == nil {
+		c.vsize.Set(float64(mem.PrivateUsage))
+		ch <- c.vsize
+		c.rss.Set(float64(mem.WorkingSetSize))
+		ch <- c.rss
+	} else {
+		failed = true
+	}
+
+	if handles, err := getProcessHandleCount(h); err == nil {
+		c.openFDs.Set(float64(handles))
+		ch <- c.openFDs
+	} else {
+		failed = true
+	}
+	c.maxFDs.Set(maxHandles)
+	ch <- c.maxFDs
+
+	if failed {
+		c.reportError()
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promauto provides constructors for the metric types of the
+// prometheus package that also register the created metric right away. With
+// them, the common two-step of creating a metric and registering it with
+// MustRegister becomes a single statement:
+//
+//     var httpRequests = promauto.NewCounterVec(
+//     	prometheus.CounterOpts{
+//     		Name: "http_requests_total",
+//     		Help: "Number of HTTP requests processed.",
+//     	},
+//     	[]string{"code", "method"},
+//     )
+//
+// The package-level constructors register with prometheus.DefaultRegisterer.
+// To register with a different Registerer, e.g. a custom Registry, create a
+// Factory with With and use its methods, which have the same names and
+// signatures.
+//
+// All constructors panic if the registration fails, in the same way as
+// MustRegister does. That makes them most suitable for metrics that are
+// created once, e.g. as global variables or during the initialization of an
+// application. The panic on a duplicate registration is intentional: the
+// metric returned in that case would not be collected.
+package promauto
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// NewCounter works like the function of the same name in the prometheus
+// package, but it automatically registers the Counter with the
+// prometheus.DefaultRegisterer. If the registration fails, NewCounter panics.
+func NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	return With(prometheus.DefaultRegisterer).NewCounter(opts)
+}
+
+// NewCounterVec works like the function of the same name in the prometheus
+// package, but it automatically registers the CounterVec with the
+// prometheus.DefaultRegisterer. If the registration fails, NewCounterVec
+// panics.
+func NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	return With(prometheus.DefaultRegisterer).NewCounterVec(opts, labelNames)
+}
+
+// NewCounterFunc works like the function of the same name in the prometheus
+// package, but it automatically registers the CounterFunc with the
+// prometheus.DefaultRegisterer. If the registration fails, NewCounterFunc
+// panics.
+func NewCounterFunc(opts prometheus.CounterOpts, function func() float64) prometheus.CounterFunc {
+	return With(prometheus.DefaultRegisterer).NewCounterFunc(opts, function)
+}
+
+// NewGauge works like the function of the same name in the prometheus package,
+// but it automatically registers the Gauge with the
+// prometheus.DefaultRegisterer. If the registration fails, NewGauge panics.
+func NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	return With(prometheus.DefaultRegisterer).NewGauge(opts)
+}
+
+// NewGaugeVec works like the function of the same name in the prometheus
+// package, but it automatically registers the GaugeVec with the
+// prometheus.DefaultRegisterer. If the registration fails, NewGaugeVec panics.
+func NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	return With(prometheus.DefaultRegisterer).NewGaugeVec(opts, labelNames)
+}
+
+// NewGaugeFunc works like the function of the same name in the prometheus
+// package, but it automatically registers the GaugeFunc with the
+// prometheus.DefaultRegisterer. If the registration fails, NewGaugeFunc panics.
+func NewGaugeFunc(opts prometheus.GaugeOpts, function func() float64) prometheus.GaugeFunc {
+	return With(prometheus.DefaultRegisterer).NewGaugeFunc(opts, function)
+}
+
+// NewSummary works like the function of the same name in the prometheus
+// package, but it automatically registers the Summary with the
+// prometheus.DefaultRegisterer. If the registration fails, NewSummary panics.
+func NewSummary(opts prometheus.SummaryOpts) prometheus.Summary {
+	return With(prometheus.DefaultRegisterer).NewSummary(opts)
+}
+
+// NewSummaryVec works like the function of the same name in the prometheus
+// package, but it automatically registers the SummaryVec with the
+// prometheus.DefaultRegisterer. If the registration fails, NewSummaryVec
+// panics.
+func NewSummaryVec(opts prometheus.SummaryOpts, labelNames []string) *prometheus.SummaryVec {
+	return With(prometheus.DefaultRegisterer).NewSummaryVec(opts, labelNames)
+}
+
+// NewHistogram works like the function of the same name in the prometheus
+// package, but it automatically registers the Histogram with the
+// prometheus.DefaultRegisterer. If the registration fails, NewHistogram panics.
+func NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	return With(prometheus.DefaultRegisterer).NewHistogram(opts)
+}
+
+// NewHistogramVec works like the function of the same name in the prometheus
+// package, but it automatically registers the HistogramVec with the
+// prometheus.DefaultRegisterer. If the registration fails, NewHistogramVec
+// panics.
+func NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *prometheus.HistogramVec {
+	return With(prometheus.DefaultRegisterer).NewHistogramVec(opts, labelNames)
+}
+
+// NewGaugeHistogram works like the function of the same name in the prometheus
+// package, but it automatically registers the GaugeHistogram with the
+// prometheus.DefaultRegisterer. If the registration fails, NewGaugeHistogram
+// panics.
+func NewGaugeHistogram(opts prometheus.GaugeHistogramOpts) prometheus.GaugeHistogram {
+	return With(prometheus.DefaultRegisterer).NewGaugeHistogram(opts)
+}
+
+// NewGaugeHistogramVec works like the function of the same name in the
+// prometheus package, but it automatically registers the GaugeHistogramVec with
+// the prometheus.DefaultRegisterer. If the registration fails,
+// NewGaugeHistogramVec panics.
+func NewGaugeHistogramVec(opts prometheus.GaugeHistogramOpts, labelNames []string) *prometheus.GaugeHistogramVec {
+	return With(prometheus.DefaultRegisterer).NewGaugeHistogramVec(opts, labelNames)
+}
+
+// NewUntyped works like the function of the same name in the prometheus
+// package, but it automatically registers the Untyped with the
+// prometheus.DefaultRegisterer. If the registration fails, NewUntyped panics.
+func NewUntyped(opts prometheus.UntypedOpts) prometheus.Untyped {
+	return With(prometheus.DefaultRegisterer).NewUntyped(opts)
+}
+
+// NewUntypedVec works like the function of the same name in the prometheus
+// package, but it automatically registers the UntypedVec with the
+// prometheus.DefaultRegisterer. If the registration fails, NewUntypedVec
+// panics.
+func NewUntypedVec(opts prometheus.UntypedOpts, labelNames []string) *prometheus.UntypedVec {
+	return With(prometheus.DefaultRegisterer).NewUntypedVec(opts, labelNames)
+}
+
+// NewUntypedFunc works like the function of the same name in the prometheus
+// package, but it automatically registers the UntypedFunc with the
+// prometheus.DefaultRegisterer. If the registration fails, NewUntypedFunc
+// panics.
+func NewUntypedFunc(opts prometheus.UntypedOpts, function func() float64) prometheus.UntypedFunc {
+	return With(prometheus.DefaultRegisterer).NewUntypedFunc(opts, function)
+}
+
+// NewEnum works like the function of the same name in the prometheus package,
+// but it automatically registers the Enum with the
+// prometheus.DefaultRegisterer. If the registration fails, NewEnum panics.
+func NewEnum(opts prometheus.EnumOpts) prometheus.Enum {
+	return With(prometheus.DefaultRegisterer).NewEnum(opts)
+}
+
+// NewInfo works like the function of the same name in the prometheus package,
+// but it automatically registers the Info with the
+// prometheus.DefaultRegisterer. If the registration fails, NewInfo panics.
+func NewInfo(opts prometheus.InfoOpts, labels prometheus.Labels) prometheus.Info {
+	return With(prometheus.DefaultRegisterer).NewInfo(opts, labels)
+}
+
+// Factory provides constructors for the metric types of the prometheus package
+// that register the created metric with the Registerer of the Factory. Create
+// Factory instances with With.
+type Factory struct {
+	r prometheus.Registerer
+}
+
+// With creates a Factory that registers the created metrics with the provided
+// Registerer. If the Registerer is nil, the created metrics are not registered
+// at all, which is sometimes useful in tests.
+func With(r prometheus.Registerer) Factory {
+	return Factory{r}
+}
+
+// NewCounter works like the function of the same name in the prometheus
+// package, but it automatically registers the Counter with the Factory's
+// Registerer.
+func (f Factory) NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	m := prometheus.NewCounter(opts)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewCounterVec works like the function of the same name in the prometheus
+// package, but it automatically registers the CounterVec with the Factory's
+// Registerer.
+func (f Factory) NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	m := prometheus.NewCounterVec(opts, labelNames)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewCounterFunc works like the function of the same name in the prometheus
+// package, but it automatically registers the CounterFunc with the Factory's
+// Registerer.
+func (f Factory) NewCounterFunc(opts prometheus.CounterOpts, function func() float64) prometheus.CounterFunc {
+	m := prometheus.NewCounterFunc(opts, function)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewGauge works like the function of the same name in the prometheus package,
+// but it automatically registers the Gauge with the Factory's Registerer.
+func (f Factory) NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	m := prometheus.NewGauge(opts)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewGaugeVec works like the function of the same name in the prometheus
+// package, but it automatically registers the GaugeVec with the Factory's
+// Registerer.
+func (f Factory) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	m := prometheus.NewGaugeVec(opts, labelNames)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewGaugeFunc works like the function of the same name in the prometheus
+// package, but it automatically registers the GaugeFunc with the Factory's
+// Registerer.
+func (f Factory) NewGaugeFunc(opts prometheus.GaugeOpts, function func() float64) prometheus.GaugeFunc {
+	m := prometheus.NewGaugeFunc(opts, function)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewSummary works like the function of the same name in the prometheus
+// package, but it automatically registers the Summary with the Factory's
+// Registerer.
+func (f Factory) NewSummary(opts prometheus.SummaryOpts) prometheus.Summary {
+	m := prometheus.NewSummary(opts)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewSummaryVec works like the function of the same name in the prometheus
+// package, but it automatically registers the SummaryVec with the Factory's
+// Registerer.
+func (f Factory) NewSummaryVec(opts prometheus.SummaryOpts, labelNames []string) *prometheus.SummaryVec {
+	m := prometheus.NewSummaryVec(opts, labelNames)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewHistogram works like the function of the same name in the prometheus
+// package, but it automatically registers the Histogram with the Factory's
+// Registerer.
+func (f Factory) NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	m := prometheus.NewHistogram(opts)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewHistogramVec works like the function of the same name in the prometheus
+// package, but it automatically registers the HistogramVec with the Factory's
+// Registerer.
+func (f Factory) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *prometheus.HistogramVec {
+	m := prometheus.NewHistogramVec(opts, labelNames)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewGaugeHistogram works like the function of the same name in the prometheus
+// package, but it automatically registers the GaugeHistogram with the Factory's
+// Registerer.
+func (f Factory) NewGaugeHistogram(opts prometheus.GaugeHistogramOpts) prometheus.GaugeHistogram {
+	m := prometheus.NewGaugeHistogram(opts)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewGaugeHistogramVec works like the function of the same name in the
+// prometheus package, but it automatically registers the GaugeHistogramVec with
+// the Factory's Registerer.
+func (f Factory) NewGaugeHistogramVec(opts prometheus.GaugeHistogramOpts, labelNames []string) *prometheus.GaugeHistogramVec {
+	m := prometheus.NewGaugeHistogramVec(opts, labelNames)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewUntyped works like the function of the same name in the prometheus
+// package, but it automatically registers the Untyped with the Factory's
+// Registerer.
+func (f Factory) NewUntyped(opts prometheus.UntypedOpts) prometheus.Untyped {
+	m := prometheus.NewUntyped(opts)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewUntypedVec works like the function of the same name in the prometheus
+// package, but it automatically registers the UntypedVec with the Factory's
+// Registerer.
+func (f Factory) NewUntypedVec(opts prometheus.UntypedOpts, labelNames []string) *prometheus.UntypedVec {
+	m := prometheus.NewUntypedVec(opts, labelNames)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewUntypedFunc works like the function of the same name in the prometheus
+// package, but it automatically registers the UntypedFunc with the Factory's
+// Registerer.
+func (f Factory) NewUntypedFunc(opts prometheus.UntypedOpts, function func() float64) prometheus.UntypedFunc {
+	m := prometheus.NewUntypedFunc(opts, function)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewEnum works like the function of the same name in the prometheus package,
+// but it automatically registers the Enum with the Factory's Registerer.
+func (f Factory) NewEnum(opts prometheus.EnumOpts) prometheus.Enum {
+	m := prometheus.NewEnum(opts)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
+
+// NewInfo works like the function of the same name in the prometheus package,
+// but it automatically registers the Info with the Factory's Registerer.
+func (f Factory) NewInfo(opts prometheus.InfoOpts, labels prometheus.Labels) prometheus.Info {
+	m := prometheus.NewInfo(opts, labels)
+	if f.r != nil {
+		f.r.MustRegister(m)
+	}
+	return m
+}
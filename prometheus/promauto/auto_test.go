@@ -0,0 +1,55 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promauto
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFactory(t *testing.T) {
+	r := prometheus.NewRegistry()
+	f := With(r)
+	f.NewCounter(prometheus.CounterOpts{Name: "test_counter", Help: "help"})
+	f.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "help"}, []string{"l"}).WithLabelValues("x").Set(1)
+	f.NewInfo(prometheus.InfoOpts{Name: "test_info", Help: "help"}, prometheus.Labels{"version": "1.0"})
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, mf := range mfs {
+		names = append(names, mf.GetName())
+	}
+	if got, want := len(names), 3; got != want {
+		t.Fatalf("got metric families %v, want %d of them", names, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic upon duplicate registration")
+		}
+	}()
+	f.NewCounter(prometheus.CounterOpts{Name: "test_counter", Help: "help"})
+}
+
+func TestFactoryWithoutRegisterer(t *testing.T) {
+	// Without a Registerer, the same metric can be created repeatedly.
+	f := With(nil)
+	for i := 0; i < 2; i++ {
+		f.NewCounter(prometheus.CounterOpts{Name: "test_counter", Help: "help"}).Inc()
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promgrpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ClientMetrics represents a collection of metrics to be registered on a
+// Prometheus metrics registry for a gRPC client. Create instances with
+// NewClientMetrics.
+type ClientMetrics struct {
+	started     *prometheus.CounterVec
+	handled     *prometheus.CounterVec
+	msgReceived *prometheus.CounterVec
+	msgSent     *prometheus.CounterVec
+	handling    *prometheus.HistogramVec
+}
+
+// NewClientMetrics returns a ClientMetrics object for the provided
+// MetricsOpts. Use its UnaryClientInterceptor and StreamClientInterceptor
+// methods to instrument a gRPC client connection.
+func NewClientMetrics(opts MetricsOpts) *ClientMetrics {
+	return &ClientMetrics{
+		started: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_client_started_total",
+				Help:        "Total number of RPCs started on the client.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method"},
+		),
+		handled: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_client_handled_total",
+				Help:        "Total number of RPCs completed by the client, regardless of success or failure.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"},
+		),
+		msgReceived: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_client_msg_received_total",
+				Help:        "Total number of RPC stream messages received by the client.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method"},
+		),
+		msgSent: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_client_msg_sent_total",
+				Help:        "Total number of gRPC stream messages sent by the client.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method"},
+		),
+		handling: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        "grpc_client_handling_seconds",
+				Help:        "Histogram of response latency (seconds) of the gRPC until it is finished by the application.",
+				ConstLabels: opts.ConstLabels,
+				Buckets:     opts.Buckets,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"},
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *ClientMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.started.Describe(ch)
+	m.handled.Describe(ch)
+	m.msgReceived.Describe(ch)
+	m.msgSent.Describe(ch)
+	m.handling.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *ClientMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.started.Collect(ch)
+	m.handled.Collect(ch)
+	m.msgReceived.Collect(ch)
+	m.msgSent.Collect(ch)
+	m.handling.Collect(ch)
+}
+
+// UnaryClientInterceptor returns a gRPC client interceptor for unary RPCs that
+// observes the RPCs with the metrics of the ClientMetrics.
+func (m *ClientMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		r := m.newReporter(Unary, method)
+		r.sentMessage()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			r.receivedMessage()
+		}
+		r.handled(err)
+		return err
+	}
+}
+
+// StreamClientInterceptor returns a gRPC client interceptor for streaming RPCs
+// that observes the RPCs and their stream messages with the metrics of the
+// ClientMetrics. A streaming RPC is considered handled once the last response
+// message has been received, i.e. RecvMsg returned io.EOF (or the single
+// response of a client stream has been received), or once any of the stream
+// methods failed.
+func (m *ClientMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		r := m.newReporter(streamType(desc.ClientStreams, desc.ServerStreams), method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			r.handled(err)
+			return nil, err
+		}
+		return &monitoredClientStream{ClientStream: cs, r: r, serverStreams: desc.ServerStreams}, nil
+	}
+}
+
+// clientReporter observes a single RPC.
+type clientReporter struct {
+	metrics                  *ClientMetrics
+	rpcType, service, method string
+	start                    time.Time
+	msgReceived, msgSent     prometheus.Counter
+	once                     sync.Once
+}
+
+func (m *ClientMetrics) newReporter(rpcType, fullMethod string) *clientReporter {
+	service, method := splitMethodName(fullMethod)
+	m.started.WithLabelValues(rpcType, service, method).Inc()
+	return &clientReporter{
+		metrics:     m,
+		rpcType:     rpcType,
+		service:     service,
+		method:      method,
+		start:       time.Now(),
+		msgReceived: m.msgReceived.WithLabelValues(rpcType, service, method),
+		msgSent:     m.msgSent.WithLabelValues(rpcType, service, method),
+	}
+}
+
+func (r *clientReporter) receivedMessage() {
+	r.msgReceived.Inc()
+}
+
+func (r *clientReporter) sentMessage() {
+	r.msgSent.Inc()
+}
+
+// handled observes the end of the RPC. Only the first call has an effect, as
+// SendMsg and RecvMsg of a stream may both report the end of the RPC, possibly
+// from different goroutines.
+func (r *clientReporter) handled(err error) {
+	r.once.Do(func() {
+		code := status.Code(err).String()
+		r.metrics.handled.WithLabelValues(r.rpcType, r.service, r.method, code).Inc()
+		r.metrics.handling.WithLabelValues(r.rpcType, r.service, r.method, code).Observe(time.Since(r.start).Seconds())
+	})
+}
+
+// monitoredClientStream wraps a grpc.ClientStream to count the messages sent
+// and received and to observe the end of the RPC.
+type monitoredClientStream struct {
+	grpc.ClientStream
+	r             *clientReporter
+	serverStreams bool
+}
+
+func (s *monitoredClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.r.sentMessage()
+	} else {
+		s.r.handled(err)
+	}
+	return err
+}
+
+func (s *monitoredClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.r.receivedMessage()
+		if !s.serverStreams {
+			// The single response of a client stream ends the RPC.
+			s.r.handled(nil)
+		}
+	case err == io.EOF:
+		s.r.handled(nil)
+	default:
+		s.r.handled(err)
+	}
+	return err
+}
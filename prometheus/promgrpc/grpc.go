@@ -0,0 +1,91 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promgrpc provides interceptors to instrument gRPC servers and
+// clients. The metrics follow the conventions established for gRPC in the
+// Prometheus ecosystem: For each RPC, a counter of started RPCs, a counter of
+// handled RPCs, counters of the received and sent stream messages, and a
+// histogram of the handling latency are maintained, partitioned by the type of
+// the RPC ("grpc_type"), the service ("grpc_service"), and the method
+// ("grpc_method"). The counter of handled RPCs and the histogram are also
+// partitioned by the gRPC status code ("grpc_code").
+//
+// The metrics of a server are collected by a ServerMetrics, which is a
+// prometheus.Collector and has to be registered, e.g.
+//
+//     serverMetrics := promgrpc.NewServerMetrics(promgrpc.MetricsOpts{})
+//     prometheus.MustRegister(serverMetrics)
+//     server := grpc.NewServer(
+//     	grpc.UnaryInterceptor(serverMetrics.UnaryServerInterceptor()),
+//     	grpc.StreamInterceptor(serverMetrics.StreamServerInterceptor()),
+//     )
+//
+// The metrics of a client are collected by a ClientMetrics in the same way.
+package promgrpc
+
+import (
+	"strings"
+
+	"google.golang.org/grpc"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The values of the "grpc_type" label.
+const (
+	Unary        = "unary"
+	ClientStream = "client_stream"
+	ServerStream = "server_stream"
+	BidiStream   = "bidi_stream"
+)
+
+// MetricsOpts bundles the options for creating a ServerMetrics or a
+// ClientMetrics. All fields are optional and can safely be left at their zero
+// value.
+type MetricsOpts struct {
+	// ConstLabels are attached to all metrics, e.g. to tell apart the
+	// metrics of several servers in the same process.
+	ConstLabels prometheus.Labels
+
+	// Buckets defines the buckets of the handling latency histogram in
+	// seconds. If Buckets is left empty, prometheus.DefBuckets is used.
+	Buckets []float64
+}
+
+// serverStreamType returns the value of the "grpc_type" label for a stream
+// described by a grpc.StreamServerInfo.
+func serverStreamType(info *grpc.StreamServerInfo) string {
+	return streamType(info.IsClientStream, info.IsServerStream)
+}
+
+func streamType(clientStreams, serverStreams bool) string {
+	switch {
+	case clientStreams && serverStreams:
+		return BidiStream
+	case clientStreams:
+		return ClientStream
+	case serverStreams:
+		return ServerStream
+	}
+	return Unary
+}
+
+// splitMethodName splits a full method name of the form
+// "/package.Service/Method" into the service and the method name.
+func splitMethodName(fullMethodName string) (string, string) {
+	fullMethodName = strings.TrimPrefix(fullMethodName, "/")
+	if i := strings.Index(fullMethodName, "/"); i >= 0 {
+		return fullMethodName[:i], fullMethodName[i+1:]
+	}
+	return "unknown", "unknown"
+}
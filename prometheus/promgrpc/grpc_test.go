@@ -0,0 +1,258 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeStream implements both grpc.ServerStream and grpc.ClientStream. RecvMsg
+// succeeds recvs times and then returns recvErr.
+type fakeStream struct {
+	grpc.ServerStream
+	grpc.ClientStream
+	recvs   int
+	recvErr error
+}
+
+func (s *fakeStream) SendMsg(m interface{}) error { return nil }
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	if s.recvs == 0 {
+		return s.recvErr
+	}
+	s.recvs--
+	return nil
+}
+
+func (s *fakeStream) Context() context.Context { return context.Background() }
+
+func counterValue(t *testing.T, vec *prometheus.CounterVec, lvs ...string) float64 {
+	var m dto.Metric
+	if err := vec.WithLabelValues(lvs...).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func histogramCount(t *testing.T, vec *prometheus.HistogramVec, lvs ...string) uint64 {
+	var m dto.Metric
+	if err := vec.WithLabelValues(lvs...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestSplitMethodName(t *testing.T) {
+	scenarios := []struct {
+		in, service, method string
+	}{
+		{"/grpc.health.v1.Health/Check", "grpc.health.v1.Health", "Check"},
+		{"pkg.Service/Method", "pkg.Service", "Method"},
+		{"invalid", "unknown", "unknown"},
+	}
+	for i, s := range scenarios {
+		service, method := splitMethodName(s.in)
+		if service != s.service || method != s.method {
+			t.Errorf("%d. got (%q, %q), want (%q, %q)", i, service, method, s.service, s.method)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := NewServerMetrics(MetricsOpts{})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return "resp", nil }
+	fail := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+
+	if _, err := interceptor(context.Background(), "req", info, ok); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interceptor(context.Background(), "req", info, fail); status.Code(err) != codes.NotFound {
+		t.Fatalf("got error %v, want code NotFound", err)
+	}
+
+	if got, want := counterValue(t, m.started, Unary, "pkg.Service", "Method"), 2.; got != want {
+		t.Errorf("got %v started RPCs, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.handled, Unary, "pkg.Service", "Method", "OK"), 1.; got != want {
+		t.Errorf("got %v RPCs handled with OK, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.handled, Unary, "pkg.Service", "Method", "NotFound"), 1.; got != want {
+		t.Errorf("got %v RPCs handled with NotFound, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.msgReceived, Unary, "pkg.Service", "Method"), 2.; got != want {
+		t.Errorf("got %v received messages, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.msgSent, Unary, "pkg.Service", "Method"), 1.; got != want {
+		t.Errorf("got %v sent messages, want %v", got, want)
+	}
+	if got, want := histogramCount(t, m.handling, Unary, "pkg.Service", "Method", "NotFound"), uint64(1); got != want {
+		t.Errorf("got %v observations, want %v", got, want)
+	}
+
+	if _, err := reg.Gather(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	m := NewServerMetrics(MetricsOpts{})
+	interceptor := m.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream", IsClientStream: true, IsServerStream: true}
+
+	err := interceptor(nil, &fakeStream{recvs: 3, recvErr: io.EOF}, info, func(srv interface{}, ss grpc.ServerStream) error {
+		for {
+			if err := ss.RecvMsg(nil); err != nil {
+				break
+			}
+			ss.SendMsg(nil)
+		}
+		return errors.New("something failed")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if got, want := counterValue(t, m.msgReceived, BidiStream, "pkg.Service", "Stream"), 3.; got != want {
+		t.Errorf("got %v received messages, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.msgSent, BidiStream, "pkg.Service", "Stream"), 3.; got != want {
+		t.Errorf("got %v sent messages, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.handled, BidiStream, "pkg.Service", "Stream", "Unknown"), 1.; got != want {
+		t.Errorf("got %v RPCs handled with Unknown, want %v", got, want)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	m := NewClientMetrics(MetricsOpts{})
+	interceptor := m.UnaryClientInterceptor()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "unavailable")
+	}
+
+	err := interceptor(context.Background(), "/pkg.Service/Method", "req", nil, nil, invoker)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("got error %v, want code Unavailable", err)
+	}
+
+	if got, want := counterValue(t, m.started, Unary, "pkg.Service", "Method"), 1.; got != want {
+		t.Errorf("got %v started RPCs, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.handled, Unary, "pkg.Service", "Method", "Unavailable"), 1.; got != want {
+		t.Errorf("got %v RPCs handled with Unavailable, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.msgSent, Unary, "pkg.Service", "Method"), 1.; got != want {
+		t.Errorf("got %v sent messages, want %v", got, want)
+	}
+	if got, want := counterValue(t, m.msgReceived, Unary, "pkg.Service", "Method"), 0.; got != want {
+		t.Errorf("got %v received messages, want %v", got, want)
+	}
+	if got, want := histogramCount(t, m.handling, Unary, "pkg.Service", "Method", "Unavailable"), uint64(1); got != want {
+		t.Errorf("got %v observations, want %v", got, want)
+	}
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	scenarios := []struct {
+		desc     grpc.StreamDesc
+		stream   *fakeStream
+		rpcType  string
+		received float64
+		code     string
+	}{
+		{
+			desc:     grpc.StreamDesc{ServerStreams: true},
+			stream:   &fakeStream{recvs: 2, recvErr: io.EOF},
+			rpcType:  ServerStream,
+			received: 2,
+			code:     "OK",
+		},
+		{
+			desc:     grpc.StreamDesc{ClientStreams: true},
+			stream:   &fakeStream{recvs: 1, recvErr: io.EOF},
+			rpcType:  ClientStream,
+			received: 1,
+			code:     "OK",
+		},
+		{
+			desc:     grpc.StreamDesc{ClientStreams: true, ServerStreams: true},
+			stream:   &fakeStream{recvs: 1, recvErr: status.Error(codes.Aborted, "aborted")},
+			rpcType:  BidiStream,
+			received: 1,
+			code:     "Aborted",
+		},
+	}
+
+	for i, s := range scenarios {
+		m := NewClientMetrics(MetricsOpts{})
+		interceptor := m.StreamClientInterceptor()
+		streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return s.stream, nil
+		}
+		cs, err := interceptor(context.Background(), &s.desc, nil, "/pkg.Service/Stream", streamer)
+		if err != nil {
+			t.Fatalf("%d. unexpected error: %s", i, err)
+		}
+		cs.SendMsg(nil)
+		for cs.RecvMsg(nil) == nil {
+		}
+
+		if got := counterValue(t, m.msgReceived, s.rpcType, "pkg.Service", "Stream"); got != s.received {
+			t.Errorf("%d. got %v received messages, want %v", i, got, s.received)
+		}
+		if got, want := counterValue(t, m.msgSent, s.rpcType, "pkg.Service", "Stream"), 1.; got != want {
+			t.Errorf("%d. got %v sent messages, want %v", i, got, want)
+		}
+		if got, want := counterValue(t, m.handled, s.rpcType, "pkg.Service", "Stream", s.code), 1.; got != want {
+			t.Errorf("%d. got %v RPCs handled with %s, want %v", i, got, s.code, want)
+		}
+		if got, want := histogramCount(t, m.handling, s.rpcType, "pkg.Service", "Stream", s.code), uint64(1); got != want {
+			t.Errorf("%d. got %v observations, want %v", i, got, want)
+		}
+	}
+}
+
+func TestStreamClientInterceptorStreamerError(t *testing.T) {
+	m := NewClientMetrics(MetricsOpts{})
+	interceptor := m.StreamClientInterceptor()
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	}
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	if _, err := interceptor(context.Background(), desc, nil, "/pkg.Service/Stream", streamer); status.Code(err) != codes.Unavailable {
+		t.Fatalf("got error %v, want code Unavailable", err)
+	}
+	if got, want := counterValue(t, m.handled, ServerStream, "pkg.Service", "Stream", "Unavailable"), 1.; got != want {
+		t.Errorf("got %v RPCs handled with Unavailable, want %v", got, want)
+	}
+}
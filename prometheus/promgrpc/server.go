@@ -0,0 +1,188 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promgrpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServerMetrics represents a collection of metrics to be registered on a
+// Prometheus metrics registry for a gRPC server. Create instances with
+// NewServerMetrics.
+type ServerMetrics struct {
+	started     *prometheus.CounterVec
+	handled     *prometheus.CounterVec
+	msgReceived *prometheus.CounterVec
+	msgSent     *prometheus.CounterVec
+	handling    *prometheus.HistogramVec
+}
+
+// NewServerMetrics returns a ServerMetrics object for the provided
+// MetricsOpts. Use its UnaryServerInterceptor and StreamServerInterceptor
+// methods to instrument a gRPC server.
+func NewServerMetrics(opts MetricsOpts) *ServerMetrics {
+	return &ServerMetrics{
+		started: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_server_started_total",
+				Help:        "Total number of RPCs started on the server.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method"},
+		),
+		handled: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_server_handled_total",
+				Help:        "Total number of RPCs completed on the server, regardless of success or failure.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"},
+		),
+		msgReceived: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_server_msg_received_total",
+				Help:        "Total number of RPC stream messages received on the server.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method"},
+		),
+		msgSent: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name:        "grpc_server_msg_sent_total",
+				Help:        "Total number of gRPC stream messages sent by the server.",
+				ConstLabels: opts.ConstLabels,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method"},
+		),
+		handling: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:        "grpc_server_handling_seconds",
+				Help:        "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+				ConstLabels: opts.ConstLabels,
+				Buckets:     opts.Buckets,
+			},
+			[]string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"},
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *ServerMetrics) Describe(ch chan<- *prometheus.Desc) {
+	m.started.Describe(ch)
+	m.handled.Describe(ch)
+	m.msgReceived.Describe(ch)
+	m.msgSent.Describe(ch)
+	m.handling.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *ServerMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.started.Collect(ch)
+	m.handled.Collect(ch)
+	m.msgReceived.Collect(ch)
+	m.msgSent.Collect(ch)
+	m.handling.Collect(ch)
+}
+
+// UnaryServerInterceptor returns a gRPC server interceptor for unary RPCs that
+// observes the RPCs with the metrics of the ServerMetrics.
+func (m *ServerMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		r := m.newReporter(Unary, info.FullMethod)
+		r.receivedMessage()
+		resp, err := handler(ctx, req)
+		if err == nil {
+			r.sentMessage()
+		}
+		r.handled(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC server interceptor for streaming RPCs
+// that observes the RPCs and their stream messages with the metrics of the
+// ServerMetrics.
+func (m *ServerMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		r := m.newReporter(serverStreamType(info), info.FullMethod)
+		err := handler(srv, &monitoredServerStream{ss, r})
+		r.handled(err)
+		return err
+	}
+}
+
+// serverReporter observes a single RPC.
+type serverReporter struct {
+	metrics                  *ServerMetrics
+	rpcType, service, method string
+	start                    time.Time
+	msgReceived, msgSent     prometheus.Counter
+}
+
+func (m *ServerMetrics) newReporter(rpcType, fullMethod string) *serverReporter {
+	service, method := splitMethodName(fullMethod)
+	m.started.WithLabelValues(rpcType, service, method).Inc()
+	return &serverReporter{
+		metrics:     m,
+		rpcType:     rpcType,
+		service:     service,
+		method:      method,
+		start:       time.Now(),
+		msgReceived: m.msgReceived.WithLabelValues(rpcType, service, method),
+		msgSent:     m.msgSent.WithLabelValues(rpcType, service, method),
+	}
+}
+
+func (r *serverReporter) receivedMessage() {
+	r.msgReceived.Inc()
+}
+
+func (r *serverReporter) sentMessage() {
+	r.msgSent.Inc()
+}
+
+func (r *serverReporter) handled(err error) {
+	code := status.Code(err).String()
+	r.metrics.handled.WithLabelValues(r.rpcType, r.service, r.method, code).Inc()
+	r.metrics.handling.WithLabelValues(r.rpcType, r.service, r.method, code).Observe(time.Since(r.start).Seconds())
+}
+
+// monitoredServerStream wraps a grpc.ServerStream to count the messages sent
+// and received.
+type monitoredServerStream struct {
+	grpc.ServerStream
+	r *serverReporter
+}
+
+func (s *monitoredServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.r.sentMessage()
+	}
+	return err
+}
+
+func (s *monitoredServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.r.receivedMessage()
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPickDelegator(t *testing.T) {
+	for id, pick := range pickDelegator {
+		d := pick(&responseWriterDelegator{ResponseWriter: httptest.NewRecorder()})
+		_, isCloseNotifier := d.(http.CloseNotifier)
+		_, isFlusher := d.(http.Flusher)
+		_, isHijacker := d.(http.Hijacker)
+		_, isReaderFrom := d.(io.ReaderFrom)
+		_, isPusher := d.(http.Pusher)
+		for _, s := range []struct {
+			name string
+			bit  int
+			got  bool
+		}{
+			{"http.CloseNotifier", closeNotifier, isCloseNotifier},
+			{"http.Flusher", flusher, isFlusher},
+			{"http.Hijacker", hijacker, isHijacker},
+			{"io.ReaderFrom", readerFrom, isReaderFrom},
+			{"http.Pusher", pusher, isPusher},
+		} {
+			if want := id&s.bit != 0; s.got != want {
+				t.Errorf("%d. got implementation of %s %t, want %t", id, s.name, s.got, want)
+			}
+		}
+	}
+}
+
+// hijackingResponseWriter implements http.Hijacker and io.ReaderFrom, but
+// not http.Flusher.
+type hijackingResponseWriter struct {
+	http.ResponseWriter
+	hijacked bool
+}
+
+func (w *hijackingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func (w *hijackingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(w.ResponseWriter, r)
+}
+
+func TestNewDelegator(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &hijackingResponseWriter{ResponseWriter: rec}
+	var observed int
+	d := newDelegator(w, func(status int) { observed = status })
+
+	if _, ok := d.(http.Flusher); ok {
+		t.Error("delegator implements http.Flusher, but the wrapped writer does not")
+	}
+	h, ok := d.(http.Hijacker)
+	if !ok {
+		t.Fatal("delegator does not implement http.Hijacker")
+	}
+	if h.Hijack(); !w.hijacked {
+		t.Error("Hijack was not delegated")
+	}
+	rf, ok := d.(io.ReaderFrom)
+	if !ok {
+		t.Fatal("delegator does not implement io.ReaderFrom")
+	}
+	if _, err := rf.ReadFrom(strings.NewReader("Hello, World!")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := d.Written(), int64(len("Hello, World!")); got != want {
+		t.Errorf("got %d bytes written, want %d", got, want)
+	}
+	if got, want := observed, http.StatusOK; got != want {
+		t.Errorf("got observed status code %d, want %d", got, want)
+	}
+	if got, want := rec.Body.String(), "Hello, World!"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package promhttp provides tooling around HTTP servers for the exposition of
+// metrics.
+//
+// First, the package allows the creation of http.Handler instances to expose
+// Prometheus metrics via HTTP. promhttp.Handler acts on the
+// prometheus.DefaultGatherer. With HandlerFor, you can create a handler for a
+// custom registry or anything that implements the Gatherer interface. In
+// contrast to the handlers of the prometheus package, the behavior of the
+// handlers created by HandlerFor can be tailored with HandlerOpts, e.g.
+//
+//     http.Handle("/metrics", promhttp.HandlerFor(
+//     	registry,
+//     	promhttp.HandlerOpts{ErrorLog: log.New(os.Stderr, "", log.LstdFlags)},
+//     ))
+//
+// The exposition format and the content encoding are negotiated with the
+// client in the same way as by the prometheus package.
+//
+// Second, the package provides tooling to instrument instances of http.Handler
+// via middleware. Middleware wrappers follow the naming scheme
+// InstrumentHandlerX, where X describes the intended use of the middleware.
+// See each function's doc comment for specific details.
+//
+// Finally, the package allows for an http.RoundTripper to be instrumented via
+// middleware. Middleware wrappers follow the naming scheme
+// InstrumentRoundTripperX, where X describes the intended use of the
+// middleware. See each function's doc comment for specific details.
+package promhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/internal"
+)
+
+// scrapeTimeoutHeader is the header in which the Prometheus server states the
+// scrape timeout of the target.
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// Logger is the minimal interface HandlerOpts needs for logging. Note that
+// log.Logger from the standard library implements this interface, and it is
+// easy to implement by custom loggers, if they don't do so already anyway.
+type Logger interface {
+	Println(v ...interface{})
+}
+
+// HandlerErrorHandling defines how a Handler serving metrics will handle
+// errors.
+type HandlerErrorHandling int
+
+// These constants cause handlers serving metrics to behave as described if
+// errors are encountered.
+const (
+	// Serve an HTTP status code 500 upon the first error
+	// encountered. Report the error message in the body.
+	HTTPErrorOnError HandlerErrorHandling = iota
+	// Ignore errors and try to serve as many metrics as possible. However,
+	// if no metrics can be served, serve an HTTP status code 500 and the
+	// last error message in the body. Only use this in deliberate "best
+	// effort" metrics collection scenarios. In this case, it is highly
+	// recommended to provide other means of detecting errors: By setting an
+	// ErrorLog in HandlerOpts, the errors are logged.
+	ContinueOnError
+	// Panic upon the first error encountered (useful for "crash only" apps).
+	PanicOnError
+)
+
+// HandlerOpts specifies options how to serve metrics via an http.Handler. The
+// zero value of HandlerOpts is a reasonable default.
+type HandlerOpts struct {
+	// ErrorLog specifies an optional logger for errors collecting and
+	// serving metrics. If nil, errors are not logged at all.
+	ErrorLog Logger
+	// ErrorHandling defines how errors are handled. Note that errors are
+	// logged regardless of the configured ErrorHandling provided ErrorLog
+	// is not nil.
+	ErrorHandling HandlerErrorHandling
+	// If DisableCompression is true, the handler will never compress the
+	// response, even if requested by the client.
+	DisableCompression bool
+	// The number of concurrent HTTP requests is limited to
+	// MaxRequestsInFlight. Additional requests are responded to with 503
+	// Service Unavailable and a suitable message in the body. If
+	// MaxRequestsInFlight is 0 or negative, no limit is applied.
+	MaxRequestsInFlight int
+	// If handling a request takes longer than Timeout, it is responded to
+	// with 503 ServiceUnavailable and a suitable message. No timeout is
+	// applied if Timeout is 0 or negative. Note that with a timeout, the
+	// response is buffered in memory rather than streamed, and the
+	// gathering of the metrics is not aborted. The timeout only prevents
+	// the scrape from being answered late, possibly with inconsistent
+	// metrics.
+	Timeout time.Duration
+	// If HonorScrapeTimeoutHeader is true, the timeout for a request is
+	// derived from its "X-Prometheus-Scrape-Timeout-Seconds" header, which
+	// the Prometheus server sets to the scrape timeout of the target. If the
+	// header is missing or invalid, Timeout applies. If both are present,
+	// the shorter one applies.
+	HonorScrapeTimeoutHeader bool
+}
+
+// Handler returns an http.Handler for the prometheus.DefaultGatherer, using
+// default HandlerOpts. The handler is instrumented with InstrumentMetricHandler
+// against the prometheus.DefaultRegisterer. For more control, use
+// InstrumentMetricHandler and HandlerFor directly.
+func Handler() http.Handler {
+	return InstrumentMetricHandler(
+		prometheus.DefaultRegisterer, HandlerFor(prometheus.DefaultGatherer, HandlerOpts{}),
+	)
+}
+
+// HandlerFor returns an http.Handler for the provided Gatherer. The behavior
+// of the handler is defined by the provided HandlerOpts. If the Gatherer is a
+// prometheus.Registry, its Transactional Gatherer is used, so that the memory
+// of gathered MetricFamilies is reused between scrapes. The settings of the
+// Registry that concern serving via HTTP, like DisableCompression or
+// PanicOnCollectError, are ignored in favor of the HandlerOpts.
+//
+// As in the prometheus package, the exposition can be restricted to certain
+// metric families by adding one or more "name[]" query parameters to the
+// request.
+func HandlerFor(g prometheus.Gatherer, opts HandlerOpts) http.Handler {
+	if r, ok := g.(*prometheus.Registry); ok {
+		return HandlerForTransactional(r.Transactional(), opts)
+	}
+	return HandlerForTransactional(prometheus.ToTransactionalGatherer(g), opts)
+}
+
+// HandlerForTransactional works like HandlerFor, but for a
+// prometheus.TransactionalGatherer. The done function returned by its Gather
+// method is called once the gathered MetricFamilies have been encoded.
+func HandlerForTransactional(tg prometheus.TransactionalGatherer, opts HandlerOpts) http.Handler {
+	h := serveTransactional(tg, opts)
+	if opts.Timeout <= 0 && !opts.HonorScrapeTimeoutHeader {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		timeout := opts.Timeout
+		if opts.HonorScrapeTimeoutHeader {
+			if d, ok := scrapeTimeout(req); ok && (timeout <= 0 || d < timeout) {
+				timeout = d
+			}
+		}
+		if timeout <= 0 {
+			h.ServeHTTP(w, req)
+			return
+		}
+		http.TimeoutHandler(h, timeout, fmt.Sprintf(
+			"Exceeded configured timeout of %v.\n", timeout,
+		)).ServeHTTP(w, req)
+	})
+}
+
+// serveTransactional returns the handler created by HandlerForTransactional
+// without the timeout handling.
+func serveTransactional(tg prometheus.TransactionalGatherer, opts HandlerOpts) http.Handler {
+	var inFlightSem chan struct{}
+	if opts.MaxRequestsInFlight > 0 {
+		inFlightSem = make(chan struct{}, opts.MaxRequestsInFlight)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if inFlightSem != nil {
+			select {
+			case inFlightSem <- struct{}{}: // All good, carry on.
+				defer func() { <-inFlightSem }()
+			default:
+				http.Error(w, fmt.Sprintf(
+					"Limit of concurrent requests reached (%d), try again later.", opts.MaxRequestsInFlight,
+				), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		mfs, done, err := tg.Gather()
+		defer done()
+		if err != nil {
+			if opts.ErrorLog != nil {
+				opts.ErrorLog.Println("error gathering metrics:", err)
+			}
+			switch opts.ErrorHandling {
+			case PanicOnError:
+				panic(err)
+			case ContinueOnError:
+				if len(mfs) == 0 {
+					// Still report the error if no metrics have been gathered.
+					httpError(w, err)
+					return
+				}
+			case HTTPErrorOnError:
+				httpError(w, err)
+				return
+			}
+		}
+		if err := internal.WriteMetricFamilies(w, req, mfs, !opts.DisableCompression); err != nil {
+			if opts.ErrorLog != nil {
+				opts.ErrorLog.Println("error encoding and sending metrics:", err)
+			}
+			// Parts of the response might have been sent already, so
+			// an HTTP error cannot be served anymore.
+			if opts.ErrorHandling == PanicOnError {
+				panic(err)
+			}
+		}
+	})
+}
+
+// scrapeTimeout returns the scrape timeout stated in the
+// "X-Prometheus-Scrape-Timeout-Seconds" header of the request. The returned
+// bool is false if the header is missing or does not contain a positive number
+// of seconds.
+func scrapeTimeout(req *http.Request) (time.Duration, bool) {
+	v := req.Header.Get(scrapeTimeoutHeader)
+	if v == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || !(seconds > 0) {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// httpError removes any content-encoding header and then calls http.Error with
+// the provided error and http.StatusInternalServerError. Error contents is
+// supposed to be uncompressed plain text. Same as with a plain http.Error, this
+// must not be called if the header or any payload has already been sent.
+func httpError(rsp http.ResponseWriter, err error) {
+	rsp.Header().Del("Content-Encoding")
+	http.Error(
+		rsp,
+		"An error has occurred while serving metrics:\n\n"+err.Error(),
+		http.StatusInternalServerError,
+	)
+}
+
+// InstrumentMetricHandler is usually used with an http.Handler returned by the
+// HandlerFor function. It instruments the provided http.Handler with two
+// metrics: A counter vector "promhttp_metric_handler_requests_total" to count
+// scrapes partitioned by HTTP status code, and a gauge
+// "promhttp_metric_handler_requests_in_flight" to track the number of
+// simultaneous scrapes. This function idempotently registers collectors for
+// both metrics with the provided Registerer. It panics if the registration
+// fails. The provided metrics are useful to see how many scrapes hit the
+// monitored target (which could be from different Prometheus servers or other
+// scrapers), and how often they overlap (which would result in more than one
+// scrape in flight at the same time). Note that the scrapes-in-flight gauge
+// will contain the scrape by which it is exposed, while the scrape counter will
+// only get incremented after the scrape is complete (as only then the status
+// code is known). For tracking scrape durations, use the
+// "scrape_duration_seconds" gauge created by the Prometheus server upon each
+// scrape.
+func InstrumentMetricHandler(reg prometheus.Registerer, handler http.Handler) http.Handler {
+	cnt := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "promhttp_metric_handler_requests_total",
+			Help: "Total number of scrapes by HTTP status code.",
+		},
+		[]string{"code"},
+	)
+	// Initialize the most likely HTTP status codes.
+	cnt.WithLabelValues("200")
+	cnt.WithLabelValues("500")
+	cnt.WithLabelValues("503")
+	if err := reg.Register(cnt); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			cnt = are.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			panic(err)
+		}
+	}
+
+	gge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "promhttp_metric_handler_requests_in_flight",
+		Help: "Current number of scrapes being served.",
+	})
+	if err := reg.Register(gge); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			gge = are.ExistingCollector.(prometheus.Gauge)
+		} else {
+			panic(err)
+		}
+	}
+
+	return InstrumentHandlerCounter(cnt, InstrumentHandlerInFlight(gge, handler))
+}
@@ -0,0 +1,299 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestHandlerErrorHandling(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "the_gauge", Help: "help"}))
+	failing := prometheus.Gatherers{
+		reg,
+		prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return nil, errors.New("collect failed")
+		}),
+	}
+
+	logBuf := &bytes.Buffer{}
+	logger := log.New(logBuf, "", 0)
+	handler := HandlerFor(failing, HandlerOpts{ErrorLog: logger})
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	if got, want := writer.Body.String(), "collect failed"; !strings.Contains(got, want) {
+		t.Errorf("got body %q, want it to contain %q", got, want)
+	}
+	if got := logBuf.String(); !strings.HasPrefix(got, "error gathering metrics:") || !strings.Contains(got, "collect failed") {
+		t.Errorf("got unexpected log message %q", got)
+	}
+
+	// Without an ErrorLog, the error is only reported to the client.
+	writer = httptest.NewRecorder()
+	HandlerFor(failing, HandlerOpts{}).ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+
+	// With ContinueOnError, the successfully gathered metrics are served.
+	logBuf.Reset()
+	writer = httptest.NewRecorder()
+	HandlerFor(failing, HandlerOpts{ErrorLog: logger, ErrorHandling: ContinueOnError}).ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	if got, want := writer.Body.String(), "# HELP the_gauge help\n# TYPE the_gauge gauge\nthe_gauge 0\n"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+	if got := logBuf.String(); !strings.Contains(got, "collect failed") {
+		t.Errorf("got unexpected log message %q", got)
+	}
+
+	// If nothing has been gathered, ContinueOnError still reports the error.
+	nothing := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return nil, errors.New("collect failed")
+	})
+	writer = httptest.NewRecorder()
+	HandlerFor(nothing, HandlerOpts{ErrorHandling: ContinueOnError}).ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Error("expected panic from PanicOnError")
+			}
+		}()
+		HandlerFor(failing, HandlerOpts{ErrorHandling: PanicOnError}).ServeHTTP(httptest.NewRecorder(), request)
+	}()
+
+	writer = httptest.NewRecorder()
+	HandlerFor(reg, HandlerOpts{}).ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	if got, want := writer.Body.String(), "# HELP the_gauge help\n# TYPE the_gauge gauge\nthe_gauge 0\n"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+}
+
+func TestHandlerCompression(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "the_gauge", Help: "help"}))
+	want := "# HELP the_gauge help\n# TYPE the_gauge gauge\nthe_gauge 0\n"
+
+	scenarios := []struct {
+		opts         HandlerOpts
+		wantEncoding string
+	}{
+		{HandlerOpts{}, "gzip"},
+		{HandlerOpts{DisableCompression: true}, ""},
+	}
+	for i, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Encoding", "gzip")
+		HandlerFor(reg, s.opts).ServeHTTP(writer, request)
+		if got := writer.Header().Get("Content-Encoding"); got != s.wantEncoding {
+			t.Errorf("%d. got content encoding %q, want %q", i, got, s.wantEncoding)
+			continue
+		}
+		body := writer.Body.Bytes()
+		if s.wantEncoding == "gzip" {
+			gz, err := gzip.NewReader(writer.Body)
+			if err != nil {
+				t.Fatalf("%d. %s", i, err)
+			}
+			if body, err = ioutil.ReadAll(gz); err != nil {
+				t.Fatalf("%d. %s", i, err)
+			}
+		}
+		if got := string(body); got != want {
+			t.Errorf("%d. got body %q, want %q", i, got, want)
+		}
+	}
+}
+
+// blockingCollector blocks in Collect until its block channel is closed. It
+// signals the start of each collection on the collecting channel.
+type blockingCollector struct {
+	desc       *prometheus.Desc
+	collecting chan struct{}
+	block      chan struct{}
+}
+
+func (c blockingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c blockingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collecting <- struct{}{}
+	<-c.block
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1)
+}
+
+func TestHandlerMaxRequestsInFlight(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := blockingCollector{
+		desc:       prometheus.NewDesc("blocking_gauge", "help", nil, nil),
+		collecting: make(chan struct{}),
+		block:      make(chan struct{}),
+	}
+	reg.MustRegister(c)
+	handler := HandlerFor(reg, HandlerOpts{MaxRequestsInFlight: 1})
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	first := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(first, request)
+		close(served)
+	}()
+	<-c.collecting
+
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, request)
+	if got, want := second.Code, http.StatusServiceUnavailable; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	if got, want := second.Body.String(), "Limit of concurrent requests reached (1), try again later.\n"; got != want {
+		t.Errorf("got body %q, want %q", got, want)
+	}
+
+	close(c.block)
+	<-served
+	if got, want := first.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+
+	// Once the first request has been served, the next one succeeds.
+	go func() { <-c.collecting }()
+	third := httptest.NewRecorder()
+	handler.ServeHTTP(third, request)
+	if got, want := third.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := blockingCollector{
+		desc:       prometheus.NewDesc("blocking_gauge", "help", nil, nil),
+		collecting: make(chan struct{}, 10),
+		block:      make(chan struct{}),
+	}
+	reg.MustRegister(c)
+	defer close(c.block)
+
+	scenarios := []struct {
+		opts     HandlerOpts
+		header   string
+		wantBody string
+	}{
+		{
+			opts:     HandlerOpts{Timeout: 10 * time.Millisecond},
+			wantBody: "Exceeded configured timeout of 10ms.\n",
+		},
+		{
+			opts:     HandlerOpts{HonorScrapeTimeoutHeader: true},
+			header:   "0.01",
+			wantBody: "Exceeded configured timeout of 10ms.\n",
+		},
+		{
+			opts:     HandlerOpts{Timeout: time.Hour, HonorScrapeTimeoutHeader: true},
+			header:   "0.02",
+			wantBody: "Exceeded configured timeout of 20ms.\n",
+		},
+		{
+			opts:     HandlerOpts{Timeout: 10 * time.Millisecond, HonorScrapeTimeoutHeader: true},
+			header:   "3600",
+			wantBody: "Exceeded configured timeout of 10ms.\n",
+		},
+		{
+			opts:     HandlerOpts{Timeout: 10 * time.Millisecond, HonorScrapeTimeoutHeader: true},
+			header:   "invalid",
+			wantBody: "Exceeded configured timeout of 10ms.\n",
+		},
+	}
+	for i, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		if s.header != "" {
+			request.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", s.header)
+		}
+		HandlerFor(reg, s.opts).ServeHTTP(writer, request)
+		if got, want := writer.Code, http.StatusServiceUnavailable; got != want {
+			t.Errorf("%d. got HTTP status code %d, want %d", i, got, want)
+		}
+		if got := writer.Body.String(); got != s.wantBody {
+			t.Errorf("%d. got body %q, want %q", i, got, s.wantBody)
+		}
+	}
+}
+
+func TestInstrumentMetricHandler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	handler := InstrumentMetricHandler(reg, HandlerFor(reg, HandlerOpts{}))
+	// Do it again to test idempotency.
+	InstrumentMetricHandler(reg, HandlerFor(reg, HandlerOpts{}))
+	request, _ := http.NewRequest("GET", "/", nil)
+
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusOK; got != want {
+		t.Errorf("got HTTP status code %d, want %d", got, want)
+	}
+	for _, want := range []string{
+		"promhttp_metric_handler_requests_in_flight 1\n",
+		`promhttp_metric_handler_requests_total{code="200"} 0` + "\n",
+	} {
+		if got := writer.Body.String(); !strings.Contains(got, want) {
+			t.Errorf("got body %q, want it to contain %q", got, want)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		writer = httptest.NewRecorder()
+		handler.ServeHTTP(writer, request)
+	}
+	for _, want := range []string{
+		"promhttp_metric_handler_requests_in_flight 1\n",
+		`promhttp_metric_handler_requests_total{code="200"} 100` + "\n",
+		`promhttp_metric_handler_requests_total{code="500"} 0` + "\n",
+		`promhttp_metric_handler_requests_total{code="503"} 0` + "\n",
+	} {
+		if got := writer.Body.String(); !strings.Contains(got, want) {
+			t.Errorf("got body %q, want it to contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestClientMiddlewareAPI(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("Hello, world!"))
+	}))
+	defer backend.Close()
+
+	reg := prometheus.NewRegistry()
+	inFlightGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "client_in_flight_requests",
+		Help: "A gauge of in-flight requests for the wrapped client.",
+	})
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_api_requests_total",
+			Help: "A counter for requests from the wrapped client.",
+		},
+		[]string{"code", "method"},
+	)
+	histVec := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "request_duration_seconds",
+			Help: "A histogram of request latencies.",
+		},
+		[]string{"method"},
+	)
+	reg.MustRegister(counter, histVec, inFlightGauge)
+
+	var inFlight float64
+	transport := RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		var m dto.Metric
+		inFlightGauge.Write(&m)
+		inFlight = m.GetGauge().GetValue()
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	client := http.Client{
+		Transport: InstrumentRoundTripperInFlight(inFlightGauge,
+			InstrumentRoundTripperCounter(counter,
+				InstrumentRoundTripperDuration(histVec, transport),
+			),
+		),
+	}
+
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got, want := resp.StatusCode, http.StatusTeapot; got != want {
+		t.Errorf("got status code %d, want %d", got, want)
+	}
+	if inFlight != 1 {
+		t.Errorf("got %v requests in flight during the request, want 1", inFlight)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"client_api_requests_total": true,
+		"client_in_flight_requests": true,
+	}
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "request_duration_seconds":
+			h := mf.Metric[0]
+			if got := h.GetLabel()[0].GetValue(); got != "get" {
+				t.Errorf("got method label %q, want %q", got, "get")
+			}
+			if got := h.GetHistogram().GetSampleCount(); got != 1 {
+				t.Errorf("got sample count %d, want 1", got)
+			}
+		default:
+			m := mf.Metric[0]
+			if m.Counter != nil {
+				if got := m.GetCounter().GetValue(); got != 1 {
+					t.Errorf("%s: got counter value %v, want 1", mf.GetName(), got)
+				}
+				if got := m.GetLabel()[0].GetValue(); got != "418" {
+					t.Errorf("%s: got code label %q, want %q", mf.GetName(), got, "418")
+				}
+			} else if got := m.GetGauge().GetValue(); got != 0 {
+				t.Errorf("%s: got gauge value %v, want 0", mf.GetName(), got)
+			}
+			delete(want, mf.GetName())
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("metrics not gathered: %v", want)
+	}
+}
+
+func TestClientMiddlewareError(t *testing.T) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "client_api_requests_total", Help: "help"},
+		[]string{"code"},
+	)
+	wantErr := errors.New("connection refused")
+	rt := InstrumentRoundTripperCounter(counter, RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return nil, wantErr
+	}))
+	request, _ := http.NewRequest("GET", "http://example.org/", nil)
+	if _, err := rt.RoundTrip(request); err != wantErr {
+		t.Errorf("got error %v, want %v", err, wantErr)
+	}
+
+	ch := make(chan prometheus.Metric, 1)
+	counter.Collect(ch)
+	close(ch)
+	if n := len(ch); n != 0 {
+		t.Errorf("got %d counters after a failed request, want 0", n)
+	}
+}
+
+func TestInstrumentRoundTripperTrace(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, world!"))
+	}))
+	defer backend.Close()
+
+	var mtx sync.Mutex
+	observed := map[string]int{}
+	observe := func(name string) func(float64) {
+		return func(v float64) {
+			if v < 0 {
+				t.Errorf("%s: got negative duration %v", name, v)
+			}
+			mtx.Lock()
+			observed[name]++
+			mtx.Unlock()
+		}
+	}
+	it := &InstrumentTrace{
+		GotConn:              observe("GotConn"),
+		GotFirstResponseByte: observe("GotFirstResponseByte"),
+		ConnectStart:         observe("ConnectStart"),
+		ConnectDone:          observe("ConnectDone"),
+		WroteHeaders:         observe("WroteHeaders"),
+		WroteRequest:         observe("WroteRequest"),
+	}
+	client := http.Client{
+		Transport: InstrumentRoundTripperTrace(it, &http.Transport{}),
+	}
+
+	resp, err := client.Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	for _, name := range []string{"GotConn", "GotFirstResponseByte", "ConnectStart", "ConnectDone", "WroteHeaders", "WroteRequest"} {
+		if got := observed[name]; got != 1 {
+			t.Errorf("%s: got %d observations, want 1", name, got)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLabelCheck(t *testing.T) {
+	scenarios := map[string]struct {
+		varLabels     []string
+		constLabels   []string
+		curriedLabels []string
+		ok            bool
+	}{
+		"code as single var label": {
+			varLabels: []string{"code"},
+			ok:        true,
+		},
+		"method as single var label": {
+			varLabels: []string{"method"},
+			ok:        true,
+		},
+		"code and method as var labels": {
+			varLabels: []string{"method", "code"},
+			ok:        true,
+		},
+		"valid case with all labels used": {
+			varLabels:     []string{"code", "method"},
+			constLabels:   []string{"foo", "bar"},
+			curriedLabels: []string{"dings", "bums"},
+			ok:            true,
+		},
+		"unsupported var label": {
+			varLabels: []string{"foo"},
+			ok:        false,
+		},
+		"mixed var labels": {
+			varLabels: []string{"method", "foo", "code"},
+			ok:        false,
+		},
+		"unsupported var label but curried": {
+			varLabels:     []string{},
+			curriedLabels: []string{"foo"},
+			ok:            true,
+		},
+		"mixed var labels but unsupported curried": {
+			varLabels:     []string{"code", "method"},
+			curriedLabels: []string{"foo"},
+			ok:            true,
+		},
+		"supported label as const and curry": {
+			constLabels:   []string{"code"},
+			curriedLabels: []string{"method"},
+			ok:            true,
+		},
+		"supported label as const and curry with unsupported as var": {
+			varLabels:     []string{"foo"},
+			constLabels:   []string{"code"},
+			curriedLabels: []string{"method"},
+			ok:            false,
+		},
+		"invalid name and otherwise empty": {
+			varLabels: []string{"in-valid"},
+			ok:        false,
+		},
+	}
+
+	for name, sc := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			constLabels := prometheus.Labels{}
+			for _, l := range sc.constLabels {
+				constLabels[l] = "dummy"
+			}
+			c := prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name:        "c",
+					Help:        "c help",
+					ConstLabels: constLabels,
+				},
+				append(sc.varLabels, sc.curriedLabels...),
+			)
+			o := prometheus.NewHistogramVec(
+				prometheus.HistogramOpts{
+					Name:        "o",
+					Help:        "o help",
+					ConstLabels: constLabels,
+				},
+				append(sc.varLabels, sc.curriedLabels...),
+			)
+			for _, l := range sc.curriedLabels {
+				c = c.MustCurryWith(prometheus.Labels{l: "dummy"})
+				o = o.MustCurryWith(prometheus.Labels{l: "dummy"}).(*prometheus.HistogramVec)
+			}
+
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						if sc.ok {
+							t.Error("unexpected panic:", err)
+						}
+					} else if !sc.ok {
+						t.Error("expected panic")
+					}
+				}()
+				InstrumentHandlerCounter(c, nil)
+			}()
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						if sc.ok {
+							t.Error("unexpected panic:", err)
+						}
+					} else if !sc.ok {
+						t.Error("expected panic")
+					}
+				}()
+				checkLabels(o)
+			}()
+		})
+	}
+}
+
+func TestInstrumentHandlerCounter(t *testing.T) {
+	scenarios := []struct {
+		labels    []string
+		handler   http.HandlerFunc
+		method    string
+		wantLabel map[string]string
+	}{
+		{
+			labels:    []string{"code", "method"},
+			handler:   func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) },
+			method:    "POST",
+			wantLabel: map[string]string{"code": "418", "method": "post"},
+		},
+		{
+			labels:    []string{"code"},
+			handler:   func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("OK")) },
+			method:    "GET",
+			wantLabel: map[string]string{"code": "200"},
+		},
+		{
+			labels:    []string{"method"},
+			handler:   func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNotFound) },
+			method:    "DELETE",
+			wantLabel: map[string]string{"method": "delete"},
+		},
+		{
+			labels:    []string{},
+			handler:   func(w http.ResponseWriter, r *http.Request) {},
+			method:    "GET",
+			wantLabel: map[string]string{},
+		},
+	}
+	for i, s := range scenarios {
+		counter := prometheus.NewCounterVec(
+			prometheus.CounterOpts{Name: "http_requests_total", Help: "help"},
+			s.labels,
+		)
+		handler := InstrumentHandlerCounter(counter, s.handler)
+		request, _ := http.NewRequest(s.method, "/", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+
+		c, err := counter.GetMetricWith(prometheus.Labels(s.wantLabel))
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		var m dto.Metric
+		if err := c.Write(&m); err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		if got, want := m.GetCounter().GetValue(), 2.; got != want {
+			t.Errorf("%d. got counter value %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestInstrumentHandlerDuration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	duration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "request_duration_seconds", Help: "help"},
+		[]string{"code", "method"},
+	)
+	ttwh := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "time_to_write_header_seconds", Help: "help"},
+		[]string{"code"},
+	)
+	reg.MustRegister(duration, ttwh)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("OK"))
+	}
+	chain := InstrumentHandlerDuration(duration, InstrumentHandlerTimeToWriteHeader(ttwh, http.HandlerFunc(handler)))
+	request, _ := http.NewRequest("PUT", "/", nil)
+	chain.ServeHTTP(httptest.NewRecorder(), request)
+	// A handler that writes nothing is observed with a status code of 200.
+	InstrumentHandlerTimeToWriteHeader(ttwh, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(httptest.NewRecorder(), request)
+
+	scenarios := []struct {
+		vec    *prometheus.HistogramVec
+		labels prometheus.Labels
+	}{
+		{duration, prometheus.Labels{"code": "201", "method": "put"}},
+		{ttwh, prometheus.Labels{"code": "201"}},
+		{ttwh, prometheus.Labels{"code": "200"}},
+	}
+	for i, s := range scenarios {
+		o, err := s.vec.GetMetricWith(s.labels)
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		var m dto.Metric
+		if err := o.(prometheus.Histogram).Write(&m); err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		if got, want := m.GetHistogram().GetSampleCount(), uint64(1); got != want {
+			t.Errorf("%d. got sample count %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestInstrumentHandlerSize(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	reqSize := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{Name: "request_size_bytes", Help: "help"},
+		[]string{"method"},
+	)
+	resSize := prometheus.NewSummaryVec(
+		prometheus.SummaryOpts{Name: "response_size_bytes", Help: "help"},
+		[]string{"code"},
+	)
+	reg.MustRegister(reqSize, resSize)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Hello, "))
+		w.Write([]byte("World!"))
+	})
+	chain := InstrumentHandlerRequestSize(reqSize, InstrumentHandlerResponseSize(resSize, handler))
+
+	request, _ := http.NewRequest("POST", "http://example.org/path", strings.NewReader("some body"))
+	request.Header.Set("Foo", "Bar")
+	wantReqSize := computeApproximateRequestSize(request)
+	if min := len("http://example.org/path") + len("POST") + len("FooBar") + len("example.org") + len("some body"); wantReqSize < min {
+		t.Errorf("got approximate request size %d, want at least %d", wantReqSize, min)
+	}
+	chain.ServeHTTP(httptest.NewRecorder(), request)
+
+	scenarios := []struct {
+		vec    *prometheus.SummaryVec
+		labels prometheus.Labels
+		want   float64
+	}{
+		{reqSize, prometheus.Labels{"method": "post"}, float64(wantReqSize)},
+		{resSize, prometheus.Labels{"code": "202"}, float64(len("Hello, World!"))},
+	}
+	for i, s := range scenarios {
+		o, err := s.vec.GetMetricWith(s.labels)
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		var m dto.Metric
+		if err := o.(prometheus.Summary).Write(&m); err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		if got := m.GetSummary().GetSampleSum(); got != s.want {
+			t.Errorf("%d. got sample sum %v, want %v", i, got, s.want)
+		}
+	}
+}
+
+func TestInstrumentHandlerInFlight(t *testing.T) {
+	inFlight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "in_flight_requests", Help: "help"})
+	value := func() float64 {
+		var m dto.Metric
+		if err := inFlight.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m.GetGauge().GetValue()
+	}
+
+	var inside float64
+	handler := InstrumentHandlerInFlight(inFlight, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		inside = value()
+	}))
+	request, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	if inside != 1 {
+		t.Errorf("got %v requests in flight while handling a request, want 1", inside)
+	}
+	if got := value(); got != 0 {
+		t.Errorf("got %v requests in flight after handling a request, want 0", got)
+	}
+}
+
+type traceIDKey struct{}
+
+func TestMiddlewareWithExemplar(t *testing.T) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "http_requests_total", Help: "help"},
+		[]string{"code"},
+	)
+	duration := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "request_duration_seconds", Help: "help", Buckets: []float64{100}},
+		[]string{},
+	)
+	exemplarFromContext := WithExemplarFromContext(func(ctx context.Context) prometheus.Labels {
+		if id, ok := ctx.Value(traceIDKey{}).(string); ok {
+			return prometheus.Labels{"trace_id": id}
+		}
+		return nil
+	})
+	handler := InstrumentHandlerCounter(counter,
+		InstrumentHandlerDuration(duration, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), exemplarFromContext),
+		exemplarFromContext,
+	)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	request = request.WithContext(context.WithValue(request.Context(), traceIDKey{}, "abc123"))
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	var c, h dto.Metric
+	if err := counter.WithLabelValues("200").Write(&c); err != nil {
+		t.Fatal(err)
+	}
+	if err := duration.WithLabelValues().(prometheus.Histogram).Write(&h); err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range []*dto.Exemplar{c.GetCounter().GetExemplar(), h.GetHistogram().GetBucket()[0].GetExemplar()} {
+		if e == nil {
+			t.Errorf("%d. got no exemplar", i)
+			continue
+		}
+		if lps := e.GetLabel(); len(lps) != 1 || lps[0].GetName() != "trace_id" || lps[0].GetValue() != "abc123" {
+			t.Errorf("%d. got exemplar labels %v, want trace_id=abc123", i, lps)
+		}
+	}
+
+	// Without a trace ID in the context, the exemplars are left alone.
+	request, _ = http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	c.Reset()
+	if err := counter.WithLabelValues("200").Write(&c); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := c.GetCounter().GetValue(), 2.; got != want {
+		t.Errorf("got counter value %v, want %v", got, want)
+	}
+	if got := c.GetCounter().GetExemplar().GetLabel(); len(got) != 1 || got[0].GetValue() != "abc123" {
+		t.Errorf("got exemplar labels %v, want the previous exemplar", got)
+	}
+}
+
+type tenantKey struct{}
+
+func TestMiddlewareWithLabelFromCtx(t *testing.T) {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "http_requests_total", Help: "help"},
+		[]string{"code", "tenant"},
+	)
+	tenantFromCtx := WithLabelFromCtx("tenant", func(ctx context.Context) string {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return tenant
+		}
+		return "unknown"
+	})
+	handler := InstrumentHandlerCounter(counter, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), tenantFromCtx)
+
+	request, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	handler.ServeHTTP(httptest.NewRecorder(), request.WithContext(context.WithValue(request.Context(), tenantKey{}, "acme")))
+	handler.ServeHTTP(httptest.NewRecorder(), request.WithContext(context.WithValue(request.Context(), tenantKey{}, "acme")))
+
+	for tenant, want := range map[string]float64{"unknown": 1, "acme": 2} {
+		var m dto.Metric
+		if err := counter.WithLabelValues("200", tenant).Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.GetCounter().GetValue(); got != want {
+			t.Errorf("tenant %s: got counter value %v, want %v", tenant, got, want)
+		}
+	}
+
+	// A label from the context works without "code" and "method" labels, too.
+	byTenant := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Name: "request_duration_seconds", Help: "help"},
+		[]string{"tenant"},
+	)
+	InstrumentHandlerDuration(byTenant, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), tenantFromCtx).ServeHTTP(httptest.NewRecorder(), request)
+	var m dto.Metric
+	if err := byTenant.WithLabelValues("unknown").(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("got sample count %d, want 1", got)
+	}
+	if len(emptyLabels) != 0 {
+		t.Errorf("emptyLabels has been modified: %v", emptyLabels)
+	}
+
+	// A label from the context that the metric does not have is an error.
+	func() {
+		defer func() {
+			if err := recover(); err == nil {
+				t.Error("expected panic for undeclared label")
+			}
+		}()
+		InstrumentHandlerCounter(counter, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), WithLabelFromCtx("api_version", nil))
+	}()
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promhttp
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures the instrumentation middlewares for both handlers and
+// round trippers.
+type Option interface {
+	apply(*options)
+}
+
+// options stores the configuration resulting from the Options.
+type options struct {
+	getExemplarFn      func(requestCtx context.Context) prometheus.Labels
+	extraLabelsFromCtx map[string]LabelValueFromCtx
+}
+
+func defaultOptions() *options {
+	return &options{getExemplarFn: func(ctx context.Context) prometheus.Labels { return nil }}
+}
+
+type optionApplyFunc func(*options)
+
+func (o optionApplyFunc) apply(opt *options) { o(opt) }
+
+// WithExemplarFromContext returns an Option that attaches an exemplar to the
+// observations of counters and histograms made by the middlewares. The provided
+// function is called with the context of the request to be observed. If it returns nil,
+// the observation is made without an exemplar. Typically, the provided function
+// extracts the ID of the trace the request is part of, e.g.
+//     promhttp.WithExemplarFromContext(func(ctx context.Context) prometheus.Labels {
+//     	return prometheus.Labels{"trace_id": traceIDFromContext(ctx)}
+//     })
+//
+// Observers and Counters that do not support exemplars (see
+// prometheus.ExemplarObserver and prometheus.ExemplarAdder) are observed
+// without an exemplar.
+func WithExemplarFromContext(getExemplarFn func(requestCtx context.Context) prometheus.Labels) Option {
+	return optionApplyFunc(func(o *options) {
+		o.getExemplarFn = getExemplarFn
+	})
+}
+
+// LabelValueFromCtx is used to compute the value of an additional label from
+// the context of the request to be observed.
+type LabelValueFromCtx func(ctx context.Context) string
+
+// WithLabelFromCtx returns an Option that sets the label with the provided name
+// to the value returned by valueFn for the context of each observed request,
+// e.g. to partition the observations by the tenant or the API version a request
+// is for. The label has to be a variable label of the metric vector passed to
+// the middleware, and valueFn should only return values out of a small, bounded
+// set to keep the cardinality of the metric in check. The Option can be
+// provided several times for different labels.
+func WithLabelFromCtx(name string, valueFn LabelValueFromCtx) Option {
+	return optionApplyFunc(func(o *options) {
+		if o.extraLabelsFromCtx == nil {
+			o.extraLabelsFromCtx = map[string]LabelValueFromCtx{}
+		}
+		o.extraLabelsFromCtx[name] = valueFn
+	})
+}
+
+// extraLabelNames returns the names of the labels set by WithLabelFromCtx.
+func (o *options) extraLabelNames() []string {
+	names := make([]string, 0, len(o.extraLabelsFromCtx))
+	for name := range o.extraLabelsFromCtx {
+		names = append(names, name)
+	}
+	return names
+}
+
+// labels works like the function of the same name, but it also adds the labels
+// set by WithLabelFromCtx, computed from the provided context.
+func (o *options) labels(ctx context.Context, code, method bool, reqMethod string, status int) prometheus.Labels {
+	l := labels(code, method, reqMethod, status)
+	if len(o.extraLabelsFromCtx) == 0 {
+		return l
+	}
+	if !(code || method) {
+		// Do not modify the shared emptyLabels.
+		l = make(prometheus.Labels, len(o.extraLabelsFromCtx))
+	}
+	for name, valueFn := range o.extraLabelsFromCtx {
+		l[name] = valueFn(ctx)
+	}
+	return l
+}
+
+// applyOptions returns the options resulting from applying the provided Options
+// to the defaults.
+func applyOptions(opts []Option) *options {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	return o
+}
+
+// addWithExemplar adds the provided value to the Counter, together with the
+// provided exemplar if it is not nil and the Counter supports exemplars.
+func addWithExemplar(obs prometheus.Counter, val float64, labels prometheus.Labels) {
+	if labels == nil {
+		obs.Add(val)
+		return
+	}
+	if ea, ok := obs.(prometheus.ExemplarAdder); ok {
+		ea.AddWithExemplar(val, labels)
+		return
+	}
+	obs.Add(val)
+}
+
+// observeWithExemplar observes the provided value with the Observer, together
+// with the provided exemplar if it is not nil and the Observer supports
+// exemplars.
+func observeWithExemplar(obs prometheus.Observer, val float64, labels prometheus.Labels) {
+	if labels == nil {
+		obs.Observe(val)
+		return
+	}
+	if eo, ok := obs.(prometheus.ExemplarObserver); ok {
+		eo.ObserveWithExemplar(val, labels)
+		return
+	}
+	obs.Observe(val)
+}
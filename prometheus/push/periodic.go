@@ -0,0 +1,115 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// PeriodicOpts bundles the options for StartPeriodic. It is mandatory to set
+// Interval. All other fields are optional and can safely be left at their zero
+// value.
+type PeriodicOpts struct {
+	// Interval is the time between two pushes. Mandatory!
+	Interval time.Duration
+	// Jitter is the upper limit of a random delay added to each Interval,
+	// so that many processes started at the same time do not push in
+	// lockstep.
+	Jitter time.Duration
+	// ErrorHandler is called with the error of each failed periodic
+	// push. If nil, errors of the periodic pushes are ignored. The error of
+	// the final push is returned by Stop instead.
+	ErrorHandler func(error)
+}
+
+// PeriodicPusher pushes metrics in the background. Create instances with
+// StartPeriodic.
+type PeriodicPusher struct {
+	pusher *Pusher
+	opts   PeriodicOpts
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// StartPeriodic starts pushing with the provided Pusher every Interval of the
+// provided PeriodicOpts until Stop is called. It is meant for long-running
+// processes that cannot be scraped, e.g. because they run behind NAT. The
+// pushes use Push, i.e. HTTP method 'PUT', so that each push replaces the
+// metrics of the previous one. The first push happens after the first
+// Interval.
+//
+// The Pusher must not be used otherwise while the PeriodicPusher is running.
+// StartPeriodic panics if the Interval is not positive.
+func StartPeriodic(p *Pusher, opts PeriodicOpts) *PeriodicPusher {
+	if opts.Interval <= 0 {
+		panic("push: interval of periodic pushes must be positive")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pp := &PeriodicPusher{
+		pusher: p,
+		opts:   opts,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go pp.run(ctx)
+	return pp
+}
+
+func (pp *PeriodicPusher) run(ctx context.Context) {
+	defer close(pp.done)
+	for {
+		wait := pp.opts.Interval
+		if pp.opts.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(pp.opts.Jitter)))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		if err := pp.pusher.PushContext(ctx); err != nil && ctx.Err() == nil && pp.opts.ErrorHandler != nil {
+			pp.opts.ErrorHandler(err)
+		}
+	}
+}
+
+// Stop stops the periodic pushes, cancelling a push that is in progress, and
+// then pushes a final time, so that the Pushgateway receives the latest
+// state of the metrics. It returns the error of the final push. Calling Stop
+// more than once has no further effect and returns the same error.
+//
+// Stop is a shortcut for StopContext with a background context, i.e. the
+// final push is not bounded in time. Use StopContext if an unresponsive
+// Pushgateway must not delay the shutdown.
+func (pp *PeriodicPusher) Stop() error {
+	return pp.StopContext(context.Background())
+}
+
+// StopContext works like Stop but aborts the final push once the provided
+// context is done. Only the first call of Stop or StopContext pushes, so the
+// context of later calls has no effect.
+func (pp *PeriodicPusher) StopContext(ctx context.Context) error {
+	pp.stopOnce.Do(func() {
+		pp.cancel()
+		<-pp.done
+		pp.stopErr = pp.pusher.PushContext(ctx)
+	})
+	return pp.stopErr
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPeriodicPusher(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		requests int
+		fail     bool
+	)
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			requests++
+			if fail {
+				http.Error(w, "fake error", http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer pgw.Close()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname",
+		Help: "testhelp",
+	})
+	errs := make(chan error, 100)
+	pp := StartPeriodic(New(pgw.URL, "testjob").Collector(counter), PeriodicOpts{
+		Interval:     5 * time.Millisecond,
+		Jitter:       time.Millisecond,
+		ErrorHandler: func(err error) { errs <- err },
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	mtx.Lock()
+	periodic := requests
+	fail = true
+	mtx.Unlock()
+	if periodic < 2 {
+		t.Errorf("got %d periodic pushes, want at least 2", periodic)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("unexpected error before the Pushgateway failed: %s", err)
+	default:
+	}
+
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Error("error of failed periodic push not reported")
+	}
+
+	mtx.Lock()
+	fail = false
+	mtx.Unlock()
+	if err := pp.Stop(); err != nil {
+		t.Errorf("final push failed: %s", err)
+	}
+	mtx.Lock()
+	afterStop := requests
+	mtx.Unlock()
+	if afterStop <= periodic {
+		t.Error("no final push on Stop")
+	}
+	time.Sleep(20 * time.Millisecond)
+	mtx.Lock()
+	defer mtx.Unlock()
+	if requests != afterStop {
+		t.Errorf("got %d pushes after Stop, want none", requests-afterStop)
+	}
+	if err := pp.Stop(); err != nil {
+		t.Errorf("second Stop returned %s", err)
+	}
+}
+
+func TestPeriodicPusherStopContext(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "help"}))
+	pp := StartPeriodic(New(ts.URL, "testjob").Gatherer(reg), PeriodicOpts{Interval: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stopped := make(chan error, 1)
+	go func() { stopped <- pp.StopContext(ctx) }()
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Error("expected error from aborted final push")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("StopContext did not return after its context was done")
+	}
+}
+
+func TestStartPeriodicInvalidInterval(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("StartPeriodic with zero interval did not panic")
+		}
+	}()
+	StartPeriodic(New("localhost:9091", "testjob"), PeriodicOpts{})
+}
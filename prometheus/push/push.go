@@ -0,0 +1,492 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package push provides functions to push metrics to a Pushgateway. It uses a
+// builder approach. Create a Pusher with New and then add the various options
+// by using its methods, finally calling Add or Push, like this:
+//
+//     // Easy case:
+//     push.New("http://example.org/metrics", "my_job").Collector(myCollector).Push()
+//
+//     // Complex case:
+//     push.New("http://example.org/metrics", "my_job").
+//     	Collector(myCollector1).
+//     	Collector(myCollector2).
+//     	Gatherer(myRegistry).
+//     	Grouping("zone", "xy").
+//     	Add()
+//
+// See the examples section for more detailed examples.
+//
+// Pushing is meant for batch jobs that terminate before they could be
+// scraped. See the Pushgateway documentation for details about when (not) to
+// use it.
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/internal"
+	"github.com/prometheus/client_golang/text"
+)
+
+const (
+	contentTypeHeader = "Content-Type"
+	// jobLabel is the label that holds the job name in the pushed metrics.
+	jobLabel = "job"
+
+	// base64Suffix is appended to a label name in the request URL path to
+	// mark the following path segment as base64-encoded.
+	base64Suffix = "@base64"
+)
+
+var errJobEmpty = errors.New("job name is empty")
+
+// Format selects the exposition format in which metrics are pushed.
+type Format int
+
+// The supported Formats.
+const (
+	// FormatAuto pushes in the delimited protocol buffer format. If the
+	// Pushgateway rejects that format with status code 415 (Unsupported
+	// Media Type), the push is retried once in the text format. This is
+	// the default.
+	FormatAuto Format = iota
+	// FormatProtoDelim always pushes in the delimited protocol buffer
+	// format.
+	FormatProtoDelim
+	// FormatText always pushes in the text format.
+	FormatText
+)
+
+// encoder returns the encoder and the content type of the format.
+func (f Format) encoder() (internal.Encoder, string) {
+	if f == FormatText {
+		return text.MetricFamilyToText, prometheus.TextTelemetryContentType
+	}
+	return text.WriteProtoDelimited, prometheus.DelimitedTelemetryContentType
+}
+
+// HTTPDoer is an interface for the one method of http.Client that is used by
+// Pusher. *http.Client implements it.
+type HTTPDoer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// Pusher manages a push to the Pushgateway. Use New to create one, configure
+// it with its methods, and finally use the Add or Push method to push.
+type Pusher struct {
+	error error
+
+	url, job string
+	grouping map[string]string
+
+	gatherers  prometheus.Gatherers
+	registerer prometheus.Registerer
+	format     Format
+	retry      RetryPolicy
+
+	client             HTTPDoer
+	header             http.Header
+	useBasicAuth       bool
+	username, password string
+	bearerToken        string
+}
+
+// New creates a new Pusher to push to the provided URL with the provided job
+// name. You can use just host:port or ip:port as url, in which case “http://”
+// is added automatically. Alternatively, include the schema in the
+// URL. However, do not include the “/metrics/job/...” part.
+func New(url, job string) *Pusher {
+	var err error
+	if job == "" {
+		err = errJobEmpty
+	}
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	if strings.HasSuffix(url, "/") {
+		url = url[:len(url)-1]
+	}
+
+	reg := prometheus.NewRegistry()
+	return &Pusher{
+		error:      err,
+		url:        url,
+		job:        job,
+		grouping:   map[string]string{},
+		gatherers:  prometheus.Gatherers{reg},
+		registerer: reg,
+		client:     http.DefaultClient,
+	}
+}
+
+// Gatherer adds a Gatherer to the Pusher, from which metrics will be gathered
+// to push them to the Pushgateway. The gathered metrics must not contain a job
+// label or any label of the grouping key of their own.
+//
+// For convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Gatherer(g prometheus.Gatherer) *Pusher {
+	p.gatherers = append(p.gatherers, g)
+	return p
+}
+
+// Collector adds a Collector to the Pusher, from which metrics will be
+// collected to push them to the Pushgateway. The collected metrics must not
+// contain a job label or any label of the grouping key of their own. The
+// Collectors are registered with a Registry owned by the Pusher, so that no
+// separate Registry has to be managed for a few metrics pushed at the end of a
+// job. If the registration fails, e.g. because the Collector is inconsistent
+// with a previously added one, the error is returned by the next call of Push,
+// Add, or Delete.
+//
+// For convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Collector(c prometheus.Collector) *Pusher {
+	if p.error == nil {
+		p.error = p.registerer.Register(c)
+	}
+	return p
+}
+
+// Grouping adds a label pair to the grouping key of the Pusher, replacing any
+// previously added label pair with the same label name. Note that setting any
+// labels in the grouping key that are already contained in the metrics to push
+// will lead to an error.
+//
+// For convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Grouping(name, value string) *Pusher {
+	if p.error == nil {
+		if !model.IsValidLabelName(name) {
+			p.error = fmt.Errorf("grouping label has invalid name: %s", name)
+			return p
+		}
+		if name == jobLabel {
+			p.error = fmt.Errorf("grouping label must not be %q, use the job name instead", jobLabel)
+			return p
+		}
+		p.grouping[name] = value
+	}
+	return p
+}
+
+// Client sets a custom HTTP client for the Pusher, e.g. an *http.Client with a
+// custom TLS configuration or proxy. For convenience, this method returns a
+// pointer to the Pusher itself.
+//
+// Pusher only needs one method of the custom HTTP client: Do(*http.Request).
+// Thus, rather than requiring a fully fledged http.Client, the provided client
+// only needs to implement the HTTPDoer interface.
+//
+// If Client is not called, http.DefaultClient is used.
+func (p *Pusher) Client(c HTTPDoer) *Pusher {
+	p.client = c
+	return p
+}
+
+// BasicAuth configures the Pusher to use HTTP Basic Authentication with the
+// provided username and password. For convenience, this method returns a
+// pointer to the Pusher itself.
+func (p *Pusher) BasicAuth(username, password string) *Pusher {
+	p.useBasicAuth = true
+	p.username = username
+	p.password = password
+	return p
+}
+
+// BearerToken configures the Pusher to authenticate with the provided token in
+// the Authorization header, as usual with OAuth 2.0. It has no effect if
+// BasicAuth is used, too. For convenience, this method returns a pointer to the
+// Pusher itself.
+func (p *Pusher) BearerToken(token string) *Pusher {
+	p.bearerToken = token
+	return p
+}
+
+// Header sets custom HTTP headers for the Pusher's client, which are sent with
+// every request. Headers set by the Pusher itself, like the Content-Type and
+// the Authorization set by BasicAuth and BearerToken, take precedence. For
+// convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Header(header http.Header) *Pusher {
+	p.header = header
+	return p
+}
+
+// RetryPolicy configures the retries of failed requests to the
+// Pushgateway. Requests are retried if they fail without a response, e.g.
+// because the Pushgateway is not reachable, or with a 5xx status code. The wait
+// between two attempts starts at InitialBackoff and doubles after each retry,
+// up to MaxBackoff. Waiting ends early if the context of the request is
+// done. Use it with Pusher.Retry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. Values below 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. If it is not
+	// positive, 100ms are used.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts. If it is not
+	// positive, the wait is not capped.
+	MaxBackoff time.Duration
+}
+
+// defaultInitialBackoff is used if RetryPolicy.InitialBackoff is not positive.
+const defaultInitialBackoff = 100 * time.Millisecond
+
+// Retry configures the Pusher to retry failed requests according to the
+// provided RetryPolicy, so that a short unavailability of the Pushgateway does
+// not lose the metrics of a job. By default, requests are not retried. For
+// convenience, this method returns a pointer to the Pusher itself.
+func (p *Pusher) Retry(policy RetryPolicy) *Pusher {
+	p.retry = policy
+	return p
+}
+
+// Format configures the Pusher to push in the provided Format instead of
+// FormatAuto. Use it for Pushgateways, or proxies in front of them, that only
+// accept one format. For convenience, this method returns a pointer to the
+// Pusher itself.
+func (p *Pusher) Format(format Format) *Pusher {
+	p.format = format
+	return p
+}
+
+// Push collects/gathers all metrics from all Collectors and Gatherers added to
+// this Pusher. Then, it pushes them to the Pushgateway configured while creating
+// this Pusher, using the configured job name and any added grouping labels as
+// grouping key. Push uses HTTP method 'PUT', so that all previously pushed
+// metrics with the same grouping key are replaced with the pushed ones.
+//
+// Push returns the first error encountered by any method call (including this
+// one) in the lifetime of the Pusher.
+func (p *Pusher) Push() error {
+	return p.push(context.Background(), http.MethodPut)
+}
+
+// PushContext works like Push, but the request to the Pushgateway is bound to
+// the provided context. If the context is canceled or its deadline expires
+// before the push completes, PushContext returns the error of the context.
+func (p *Pusher) PushContext(ctx context.Context) error {
+	return p.push(ctx, http.MethodPut)
+}
+
+// Add works like Push, but only previously pushed metrics with the same name
+// (and the same grouping key) are replaced. (It uses HTTP method 'POST' to
+// push to the Pushgateway.)
+func (p *Pusher) Add() error {
+	return p.push(context.Background(), http.MethodPost)
+}
+
+// AddContext works like Add, but the request to the Pushgateway is bound to the
+// provided context. See PushContext.
+func (p *Pusher) AddContext(ctx context.Context) error {
+	return p.push(ctx, http.MethodPost)
+}
+
+// Delete sends a “DELETE” request to the Pushgateway configured while creating
+// this Pusher, using the configured job name and any added grouping labels as
+// grouping key. Any Gatherers and Collectors added to this Pusher are
+// ignored by this method.
+//
+// Delete returns the first error encountered by any method call (including
+// this one) in the lifetime of the Pusher.
+func (p *Pusher) Delete() error {
+	if p.error != nil {
+		return p.error
+	}
+	_, err := p.do(context.Background(), http.MethodDelete, nil, "", "deleting")
+	return err
+}
+
+// fullURL returns the URL of the metric group of the Pusher, i.e. the URL of
+// the Pushgateway followed by the grouping key as path, like
+// http://example.org/metrics/job/my_job/instance/localhost. Label values that
+// cannot be represented as a path segment are base64-encoded.
+func (p *Pusher) fullURL() string {
+	urlComponents := []string{}
+	if encodedJob, base64 := encodeComponent(p.job); base64 {
+		urlComponents = append(urlComponents, jobLabel+base64Suffix, encodedJob)
+	} else {
+		urlComponents = append(urlComponents, jobLabel, encodedJob)
+	}
+	names := make([]string, 0, len(p.grouping))
+	for name := range p.grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if encodedValue, base64 := encodeComponent(p.grouping[name]); base64 {
+			urlComponents = append(urlComponents, name+base64Suffix, encodedValue)
+		} else {
+			urlComponents = append(urlComponents, name, encodedValue)
+		}
+	}
+	return fmt.Sprintf("%s/metrics/%s", p.url, strings.Join(urlComponents, "/"))
+}
+
+// encodeComponent encodes the provided string with base64.RawURLEncoding in
+// case it contains '/' and as "=" in case it is empty. If neither is the case,
+// it uses url.PathEscape instead. It returns true in the former two cases.
+func encodeComponent(s string) (string, bool) {
+	if s == "" {
+		return "=", true
+	}
+	if strings.Contains(s, "/") {
+		return base64.RawURLEncoding.EncodeToString([]byte(s)), true
+	}
+	return url.PathEscape(s), false
+}
+
+func (p *Pusher) push(ctx context.Context, method string) error {
+	if p.error != nil {
+		return p.error
+	}
+	mfs, err := p.gatherers.Gather()
+	if err != nil {
+		return err
+	}
+	// Check for pushed labels that would conflict with the grouping key.
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == jobLabel {
+					return fmt.Errorf(
+						"pushed metric %s (%s) already contains %s label",
+						mf.GetName(), m, jobLabel,
+					)
+				}
+				if _, ok := p.grouping[l.GetName()]; ok {
+					return fmt.Errorf(
+						"pushed metric %s (%s) already contains grouping label %s",
+						mf.GetName(), m, l.GetName(),
+					)
+				}
+			}
+		}
+	}
+
+	formats := []Format{p.format}
+	if p.format == FormatAuto {
+		formats = []Format{FormatProtoDelim, FormatText}
+	}
+	for i, format := range formats {
+		enc, contentType := format.encoder()
+		buf := &bytes.Buffer{}
+		for _, mf := range mfs {
+			if _, err := enc(buf, mf); err != nil {
+				return err
+			}
+		}
+		status, err := p.do(ctx, method, buf.Bytes(), contentType, "pushing to")
+		if status == http.StatusUnsupportedMediaType && i < len(formats)-1 {
+			continue // Try the next format.
+		}
+		return err
+	}
+	return nil
+}
+
+// newRequest creates a request for the metric group of the Pusher with the
+// configured headers and authentication, bound to the provided context.
+func (p *Pusher) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, p.fullURL(), body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range p.header {
+		req.Header[name] = values
+	}
+	if p.useBasicAuth {
+		req.SetBasicAuth(p.username, p.password)
+	} else if p.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.bearerToken)
+	}
+	return req, nil
+}
+
+// do sends a request with the provided method, body, and content type to the
+// metric group of the Pusher, retrying according to the RetryPolicy of the
+// Pusher. It returns the status code of the last response, or 0 if there was
+// none, along with the error, if any.
+func (p *Pusher) do(ctx context.Context, method string, body []byte, contentType, action string) (int, error) {
+	backoff := p.retry.InitialBackoff
+	if backoff <= 0 {
+		backoff = defaultInitialBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err := p.newRequest(ctx, method, r)
+		if err != nil {
+			return 0, err
+		}
+		if contentType != "" {
+			req.Header.Set(contentTypeHeader, contentType)
+		}
+		status, err := p.send(req, action)
+		if err == nil || attempt >= p.retry.MaxAttempts || !retryable(ctx, status) {
+			return status, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return status, err
+		}
+		backoff *= 2
+		if p.retry.MaxBackoff > 0 && backoff > p.retry.MaxBackoff {
+			backoff = p.retry.MaxBackoff
+		}
+	}
+}
+
+// retryable returns whether a failed request with the provided status code (0
+// if the request failed without response) should be retried.
+func retryable(ctx context.Context, status int) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return status == 0 || status >= 500
+}
+
+// send sends the provided request to the Pushgateway and checks the status
+// code of the response, which it returns along with the error, if any. The
+// action is used in the error message.
+func (p *Pusher) send(req *http.Request, action string) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Depending on version and configuration of the Pushgateway, StatusOK
+	// or StatusAccepted may be returned.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		body, _ := ioutil.ReadAll(resp.Body) // Ignore any further error as this is for an error message only.
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d while %s %s: %s", resp.StatusCode, action, req.URL, body)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,536 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/text"
+)
+
+func TestPush(t *testing.T) {
+	var (
+		lastMethod string
+		lastBody   []byte
+		lastPath   string
+	)
+
+	// Fake a Pushgateway that responds with 202 to DELETE and with 200 in
+	// all other cases.
+	pgwOK := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lastMethod = r.Method
+			var err error
+			lastBody, err = ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lastPath = r.URL.EscapedPath()
+			w.Header().Set("Content-Type", `text/plain; charset=utf-8`)
+			if r.Method == http.MethodDelete {
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer pgwOK.Close()
+
+	// Fake a Pushgateway that always responds with 500.
+	pgwErr := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "fake error", http.StatusInternalServerError)
+		}),
+	)
+	defer pgwErr.Close()
+
+	metric1 := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname1",
+		Help: "testhelp1",
+	})
+	metric2 := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "testname2",
+		Help:        "testhelp2",
+		ConstLabels: prometheus.Labels{"foo": "bar", "dings": "bums"},
+	})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metric1)
+	reg.MustRegister(metric2)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, mf := range mfs {
+		if _, err := text.WriteProtoDelimited(buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantBody := buf.Bytes()
+
+	// Push some Collectors, all good.
+	if err := New(pgwOK.URL, "testjob").
+		Gatherer(reg).
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != http.MethodPut {
+		t.Errorf("got method %q for Push, want %q", lastMethod, http.MethodPut)
+	}
+	if !bytes.Equal(lastBody, wantBody) {
+		t.Errorf("got body %v, want %v", lastBody, wantBody)
+	}
+	if lastPath != "/metrics/job/testjob" {
+		t.Error("unexpected path:", lastPath)
+	}
+
+	// Add some Collectors, all good.
+	if err := New(pgwOK.URL, "testjob").
+		Gatherer(reg).
+		Add(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != http.MethodPost {
+		t.Errorf("got method %q for Add, want %q", lastMethod, http.MethodPost)
+	}
+	if !bytes.Equal(lastBody, wantBody) {
+		t.Errorf("got body %v, want %v", lastBody, wantBody)
+	}
+	if lastPath != "/metrics/job/testjob" {
+		t.Error("unexpected path:", lastPath)
+	}
+
+	// Push registry, all good, URL without scheme and with trailing slash.
+	if err := New(pgwOK.URL[len("http://"):]+"/", "testjob").
+		Gatherer(reg).
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if lastPath != "/metrics/job/testjob" {
+		t.Error("unexpected path:", lastPath)
+	}
+
+	// Push some Collectors with a broken PGW.
+	if err := New(pgwErr.URL, "testjob").
+		Gatherer(reg).
+		Push(); err == nil {
+		t.Error("push to broken Pushgateway succeeded")
+	} else {
+		if got, want := err.Error(), "unexpected status code 500 while pushing to "+pgwErr.URL+"/metrics/job/testjob: fake error\n"; got != want {
+			t.Errorf("got error %q, want %q", got, want)
+		}
+	}
+
+	// Push with an empty job name.
+	if err := New(pgwOK.URL, "").Gatherer(reg).Push(); err == nil {
+		t.Error("push with empty job succeeded")
+	}
+
+	// Push with a grouping key, all good.
+	if err := New(pgwOK.URL, "testjob").
+		Gatherer(reg).
+		Grouping("instance", "127.0.0.1:9091").
+		Grouping("zone", "zone-1").
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if lastPath != "/metrics/job/testjob/instance/127.0.0.1:9091/zone/zone-1" {
+		t.Error("unexpected path:", lastPath)
+	}
+
+	// Push with a job name and grouping label values that need encoding.
+	if err := New(pgwOK.URL, "test/job").
+		Gatherer(reg).
+		Grouping("empty", "").
+		Grouping("path", "/usr/local").
+		Grouping("space", "a b").
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if lastPath != "/metrics/job@base64/dGVzdC9qb2I/empty@base64/=/path@base64/L3Vzci9sb2NhbA/space/a%20b" {
+		t.Error("unexpected path:", lastPath)
+	}
+
+	// Push with invalid grouping labels.
+	for _, name := range []string{"job", "in-valid"} {
+		if err := New(pgwOK.URL, "testjob").
+			Gatherer(reg).
+			Grouping(name, "value").
+			Push(); err == nil {
+			t.Errorf("push with grouping label %q succeeded", name)
+		}
+	}
+
+	// Push metrics that contain a grouping label.
+	if err := New(pgwOK.URL, "testjob").
+		Gatherer(reg).
+		Grouping("foo", "baz").
+		Push(); err == nil {
+		t.Error("push with conflicting grouping label succeeded")
+	}
+
+	// Push metrics that contain a job label.
+	regWithJob := prometheus.NewRegistry()
+	regWithJob.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "testname3",
+		Help:        "testhelp3",
+		ConstLabels: prometheus.Labels{"job": "other"},
+	}))
+	if err := New(pgwOK.URL, "testjob").
+		Gatherer(regWithJob).
+		Push(); err == nil {
+		t.Error("push with job label succeeded")
+	}
+
+	// Delete, all good.
+	if err := New(pgwOK.URL, "testjob").
+		Grouping("instance", "localhost").
+		Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if lastMethod != http.MethodDelete {
+		t.Errorf("got method %q for Delete, want %q", lastMethod, http.MethodDelete)
+	}
+	if len(lastBody) != 0 {
+		t.Errorf("got body %v, want empty body", lastBody)
+	}
+	if lastPath != "/metrics/job/testjob/instance/localhost" {
+		t.Error("unexpected path:", lastPath)
+	}
+
+	// Delete with a broken PGW.
+	if err := New(pgwErr.URL, "testjob").Delete(); err == nil {
+		t.Error("delete from broken Pushgateway succeeded")
+	} else {
+		if got, want := err.Error(), "unexpected status code 500 while deleting "+pgwErr.URL+"/metrics/job/testjob: fake error\n"; got != want {
+			t.Errorf("got error %q, want %q", got, want)
+		}
+	}
+}
+
+// headerRecorder is an HTTPDoer that records the headers of the requests it
+// handles, using a wrapped http.Client.
+type headerRecorder struct {
+	client *http.Client
+	header http.Header
+}
+
+func (r *headerRecorder) Do(req *http.Request) (*http.Response, error) {
+	r.header = req.Header
+	return r.client.Do(req)
+}
+
+func TestPushAuthAndHeaders(t *testing.T) {
+	var lastHeader http.Header
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lastHeader = r.Header
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer pgw.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname",
+		Help: "testhelp",
+	}))
+
+	// Basic authentication and custom headers, sent via a custom client.
+	client := &headerRecorder{client: &http.Client{}}
+	if err := New(pgw.URL, "testjob").
+		Gatherer(reg).
+		Client(client).
+		BasicAuth("user", "secret").
+		Header(http.Header{"X-Scope-Orgid": []string{"tenant-1"}}).
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if client.header == nil {
+		t.Error("custom client not used")
+	}
+	if got, want := lastHeader.Get("Authorization"), "Basic dXNlcjpzZWNyZXQ="; got != want {
+		t.Errorf("got Authorization header %q, want %q", got, want)
+	}
+	if got, want := lastHeader.Get("X-Scope-Orgid"), "tenant-1"; got != want {
+		t.Errorf("got X-Scope-Orgid header %q, want %q", got, want)
+	}
+
+	// Bearer token.
+	if err := New(pgw.URL, "testjob").
+		BearerToken("token").
+		Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lastHeader.Get("Authorization"), "Bearer token"; got != want {
+		t.Errorf("got Authorization header %q, want %q", got, want)
+	}
+
+	// Headers set by the Pusher take precedence.
+	if err := New(pgw.URL, "testjob").
+		Gatherer(reg).
+		Header(http.Header{"Content-Type": []string{"text/plain"}}).
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := lastHeader.Get("Content-Type"), prometheus.DelimitedTelemetryContentType; got != want {
+		t.Errorf("got Content-Type header %q, want %q", got, want)
+	}
+}
+
+func TestPushContext(t *testing.T) {
+	unblock := make(chan struct{})
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-unblock
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer pgw.Close()
+	defer close(unblock)
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname",
+		Help: "testhelp",
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := New(pgw.URL, "testjob").Gatherer(reg).PushContext(ctx); err == nil {
+		t.Error("push to blocked Pushgateway succeeded")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := New(pgw.URL, "testjob").Gatherer(reg).AddContext(ctx); err == nil {
+		t.Error("add with canceled context succeeded")
+	}
+}
+
+func TestPushFormat(t *testing.T) {
+	var contentTypes []string
+	acceptProto := true
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentType := r.Header.Get("Content-Type")
+			contentTypes = append(contentTypes, contentType)
+			if !acceptProto && contentType != prometheus.TextTelemetryContentType {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer pgw.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname",
+		Help: "testhelp",
+	}))
+
+	scenarios := []struct {
+		format       Format
+		acceptProto  bool
+		contentTypes []string
+		wantErr      bool
+	}{
+		{
+			format:       FormatAuto,
+			acceptProto:  true,
+			contentTypes: []string{prometheus.DelimitedTelemetryContentType},
+		},
+		{
+			format:       FormatAuto,
+			acceptProto:  false,
+			contentTypes: []string{prometheus.DelimitedTelemetryContentType, prometheus.TextTelemetryContentType},
+		},
+		{
+			format:       FormatText,
+			acceptProto:  true,
+			contentTypes: []string{prometheus.TextTelemetryContentType},
+		},
+		{
+			format:       FormatProtoDelim,
+			acceptProto:  false,
+			contentTypes: []string{prometheus.DelimitedTelemetryContentType},
+			wantErr:      true,
+		},
+	}
+	for i, s := range scenarios {
+		contentTypes = nil
+		acceptProto = s.acceptProto
+		err := New(pgw.URL, "testjob").Gatherer(reg).Format(s.format).Push()
+		if s.wantErr != (err != nil) {
+			t.Errorf("%d. got error %v, want error: %t", i, err, s.wantErr)
+		}
+		if len(contentTypes) != len(s.contentTypes) {
+			t.Errorf("%d. got content types %q, want %q", i, contentTypes, s.contentTypes)
+			continue
+		}
+		for j := range contentTypes {
+			if contentTypes[j] != s.contentTypes[j] {
+				t.Errorf("%d. got content types %q, want %q", i, contentTypes, s.contentTypes)
+			}
+		}
+	}
+}
+
+func TestPushCollector(t *testing.T) {
+	var lastBody []byte
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var err error
+			lastBody, err = ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer pgw.Close()
+
+	metric1 := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname1",
+		Help: "testhelp1",
+	})
+	metric2 := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "testname2",
+		Help: "testhelp2",
+	})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(metric1, metric2)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	for _, mf := range mfs {
+		if _, err := text.WriteProtoDelimited(buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pushing Collectors yields the same body as pushing a Registry.
+	if err := New(pgw.URL, "testjob").
+		Collector(metric1).
+		Collector(metric2).
+		Push(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(lastBody, buf.Bytes()) {
+		t.Errorf("got body %v, want %v", lastBody, buf.Bytes())
+	}
+
+	// Adding the same Collector twice fails.
+	if err := New(pgw.URL, "testjob").
+		Collector(metric1).
+		Collector(metric1).
+		Push(); err == nil {
+		t.Error("push with duplicate Collector succeeded")
+	}
+}
+
+func TestPushRetry(t *testing.T) {
+	var (
+		requests int
+		failures int
+	)
+	pgw := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if _, err := ioutil.ReadAll(r.Body); err != nil {
+				t.Fatal(err)
+			}
+			if requests <= failures {
+				http.Error(w, "fake error", http.StatusServiceUnavailable)
+				return
+			}
+			if r.URL.Path == "/metrics/job/badrequest" {
+				http.Error(w, "fake error", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer pgw.Close()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "testname",
+		Help: "testhelp",
+	}))
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+	}
+
+	scenarios := []struct {
+		job          string
+		failures     int
+		policy       RetryPolicy
+		wantRequests int
+		wantErr      bool
+	}{
+		{job: "testjob", failures: 2, policy: policy, wantRequests: 3},
+		{job: "testjob", failures: 3, policy: policy, wantRequests: 3, wantErr: true},
+		{job: "testjob", failures: 1, wantRequests: 1, wantErr: true},
+		{job: "badrequest", policy: policy, wantRequests: 1, wantErr: true},
+	}
+	for i, s := range scenarios {
+		requests, failures = 0, s.failures
+		err := New(pgw.URL, s.job).Gatherer(reg).Retry(s.policy).Push()
+		if s.wantErr != (err != nil) {
+			t.Errorf("%d. got error %v, want error: %t", i, err, s.wantErr)
+		}
+		if requests != s.wantRequests {
+			t.Errorf("%d. got %d requests, want %d", i, requests, s.wantRequests)
+		}
+	}
+
+	// Deletes are retried, too.
+	requests, failures = 0, 1
+	if err := New(pgw.URL, "testjob").Retry(policy).Delete(); err != nil {
+		t.Error(err)
+	}
+	if requests != 2 {
+		t.Errorf("got %d requests for Delete, want 2", requests)
+	}
+
+	// Retries stop once the context is done.
+	requests, failures = 0, 10
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := New(pgw.URL, "testjob").
+		Gatherer(reg).
+		Retry(RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Hour}).
+		PushContext(ctx); err == nil {
+		t.Error("push with retries beyond the deadline succeeded")
+	}
+	if requests != 1 {
+		t.Errorf("got %d requests, want 1", requests)
+	}
+}
@@ -21,31 +21,44 @@ package prometheus
 
 import (
 	"bytes"
-	"compress/gzip"
-	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	dto "github.com/prometheus/client_model/go"
 
-	"code.google.com/p/goprotobuf/proto"
+	"github.com/golang/protobuf/proto"
 
-	"github.com/prometheus/client_golang/_vendor/goautoneg"
 	"github.com/prometheus/client_golang/model"
+	"github.com/prometheus/client_golang/prometheus/internal"
 	"github.com/prometheus/client_golang/text"
 )
 
-var (
-	defRegistry   = newDefaultRegistry()
-	errAlreadyReg = errors.New("duplicate metrics collector registration attempted")
-)
+var defRegistry = newDefaultRegistry()
+
+// DefaultRegisterer is the Registerer used by the package-level Register,
+// MustRegister, and Unregister functions. By default, it is the global
+// Prometheus registry. It may be replaced, e.g. by a Registerer created with
+// WrapRegistererWith, but only before any Collector is registered. Note that
+// RegisterOrGet and MustRegisterOrGet always act on the global registry.
+var DefaultRegisterer Registerer = defRegistry
+
+// DefaultGatherer is the Gatherer used by Handler and UninstrumentedHandler. By
+// default, it is the global Prometheus registry. It may be replaced, e.g. to
+// expose the metrics of several registries combined, but only before Handler or
+// UninstrumentedHandler is called.
+var DefaultGatherer Gatherer = defRegistry
 
 // Constants relevant to the HTTP interface.
 const (
@@ -67,6 +80,14 @@ const (
 	// telemetry data responses in protobuf compact text format.  (Only used
 	// for debugging.)
 	ProtoCompactTextTelemetryContentType = `application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=compact-text`
+	// OpenMetricsTelemetryContentType is the content type set on telemetry
+	// data responses in the OpenMetrics text format.
+	OpenMetricsTelemetryContentType = `application/openmetrics-text; version=1.0.0; charset=utf-8`
+	// JSONTelemetryContentType is the content type set on telemetry data
+	// responses in JSON format with one MetricFamily per line.  (Only used
+	// for debugging. This is not the JSON format of old Prometheus
+	// servers, which is not supported anymore.)
+	JSONTelemetryContentType = `application/json; proto=io.prometheus.client.MetricFamily`
 
 	// Constants for object pools.
 	numBufs           = 4
@@ -77,19 +98,15 @@ const (
 	capMetricChan = 1000
 	capDescChan   = 10
 
-	contentTypeHeader     = "Content-Type"
-	contentLengthHeader   = "Content-Length"
-	contentEncodingHeader = "Content-Encoding"
-
-	acceptEncodingHeader = "Accept-Encoding"
-	acceptHeader         = "Accept"
+	contentTypeHeader = "Content-Type"
 )
 
 // Handler returns the HTTP handler for the global Prometheus registry. It is
 // already instrumented with InstrumentHandler (using "prometheus" as handler
-// name). Usually the handler is used to handle the "/metrics" endpoint.
+// name). Usually the handler is used to handle the "/metrics" endpoint. The
+// promhttp package provides handlers whose behavior can be configured.
 func Handler() http.Handler {
-	return InstrumentHandler("prometheus", defRegistry)
+	return InstrumentHandler("prometheus", HandlerFor(DefaultGatherer))
 }
 
 // UninstrumentedHandler works in the same way as Handler, but the returned HTTP
@@ -98,30 +115,90 @@ func Handler() http.Handler {
 // different handler name (or with a different instrumentation approach
 // altogether). See the InstrumentHandler example.
 func UninstrumentedHandler() http.Handler {
-	return defRegistry
+	return HandlerFor(DefaultGatherer)
+}
+
+// HandlerFor returns an HTTP handler for the provided Gatherer, e.g. a
+// Registry. In contrast to Handler, the returned handler is not instrumented,
+// as the instrumentation would end up in the global Prometheus registry rather
+// than in the provided one. Use InstrumentHandler to instrument it if needed.
+//
+// If the Gatherer is a Registry, the handler behaves exactly like the
+// Registry's ServeHTTP method, i.e. it respects the PanicOnCollectError
+// setting of the Registry. For any other Gatherer, errors during gathering
+// result in an internal server error (status code 500).
+//
+// The exposition can be restricted to certain metric families by adding one or
+// more "name[]" query parameters to the request, e.g.
+// "/metrics?name[]=http_requests_total&name[]=process_cpu_seconds_total".
+//
+// To tailor the behavior of the handler, e.g. the handling and logging of
+// errors, use HandlerFor in the promhttp package instead.
+func HandlerFor(g Gatherer) http.Handler {
+	if r, ok := g.(*Registry); ok {
+		return r
+	}
+	return HandlerForTransactional(ToTransactionalGatherer(g))
+}
+
+// HandlerForTransactional works like HandlerFor, but for a
+// TransactionalGatherer. The done function returned by the Gather method of the
+// TransactionalGatherer is called once the gathered MetricFamilies have been
+// encoded.
+func HandlerForTransactional(tg TransactionalGatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := serveGathered(w, req, tg, true); err != nil {
+			http.Error(w, "An error has occurred:\n\n"+err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// AlreadyRegisteredError is returned by the Register method if the Collector to
+// be registered has already been registered before, or a different Collector
+// that collects the same metrics has been registered before. Registration fails
+// in that case, but you can detect from the kind of error what has happened.
+// The error contains fields for the existing Collector and the (rejected) new
+// Collector that equals the existing one. This can be used to find out if an
+// equal Collector has been registered before and switch over to using the old
+// one, as demonstrated in the example.
+type AlreadyRegisteredError struct {
+	ExistingCollector, NewCollector Collector
+}
+
+func (err AlreadyRegisteredError) Error() string {
+	return "duplicate metrics collector registration attempted"
 }
 
 // Register registers a new Collector to be included in metrics collection. It
 // returns an error if the descriptors provided by the Collector are invalid or
 // if they - in combination with descriptors of already registered Collectors -
 // do not fulfill the consistency and uniqueness criteria described in the Desc
-// documentation.
+// documentation. If an equal Collector has been registered before, the
+// returned error is an AlreadyRegisteredError.
+//
+// A Collector whose Describe method does not yield any descriptor is registered
+// as an unchecked Collector. No consistency checks are performed at
+// registration time for unchecked Collectors, and their collected metrics are
+// not required to match any registered descriptor. This is meant for
+// Collectors that cannot know their metric set ahead of time, e.g. exporters
+// proxying the metrics of another system. It is the responsibility of the
+// implementer of an unchecked Collector to keep its metrics consistent with
+// each other and with the metrics of other Collectors. Registering an
+// unchecked Collector twice is not detected, and an unchecked Collector
+// cannot be unregistered.
 //
 // Do not register the same Collector multiple times concurrently. (Registering
 // the same Collector twice would result in an error anyway, but on top of that,
 // it is not safe to do so concurrently.)
 func Register(m Collector) error {
-	_, err := defRegistry.Register(m)
-	return err
+	return DefaultRegisterer.Register(m)
 }
 
-// MustRegister works like Register but panics where Register would have
-// returned an error.
-func MustRegister(m Collector) {
-	err := Register(m)
-	if err != nil {
-		panic(err)
-	}
+// MustRegister registers the provided Collectors with the DefaultRegisterer and
+// panics if any error occurs. It is meant for registering all the Collectors
+// of an application in one statement, e.g. in an init function.
+func MustRegister(cs ...Collector) {
+	DefaultRegisterer.MustRegister(cs...)
 }
 
 // RegisterOrGet works like Register but does not return an error if a Collector
@@ -140,19 +217,15 @@ func RegisterOrGet(m Collector) (Collector, error) {
 // MustRegisterOrGet works like Register but panics where RegisterOrGet would
 // have returned an error.
 func MustRegisterOrGet(m Collector) Collector {
-	existing, err := RegisterOrGet(m)
-	if err != nil {
-		panic(err)
-	}
-	return existing
+	return defRegistry.MustRegisterOrGet(m)
 }
 
 // Unregister unregisters the Collector that equals the Collector passed in as
 // an argument. (Two Collectors are considered equal if their Describe method
 // yields the same set of descriptors.) The function returns whether a Collector
-// was unregistered.
+// was unregistered. Unchecked Collectors (see Register) cannot be unregistered.
 func Unregister(c Collector) bool {
-	return defRegistry.Unregister(c)
+	return DefaultRegisterer.Unregister(c)
 }
 
 // SetMetricFamilyInjectionHook sets a function that is called whenever metrics
@@ -167,14 +240,14 @@ func Unregister(c Collector) bool {
 // performed on the returned protobufs (besides the name checks described
 // above). The function must be callable at any time and concurrently.
 func SetMetricFamilyInjectionHook(hook func() []*dto.MetricFamily) {
-	defRegistry.metricFamilyInjectionHook = hook
+	defRegistry.SetMetricFamilyInjectionHook(hook)
 }
 
 // PanicOnCollectError sets the behavior whether a panic is caused upon an error
 // while metrics are collected and served to the http endpoint. By default, an
 // internal server error (status code 500) is served with an error message.
 func PanicOnCollectError(b bool) {
-	defRegistry.panicOnCollectError = b
+	defRegistry.PanicOnCollectError(b)
 }
 
 // EnableCollectChecks enables (or disables) additional consistency checks
@@ -184,7 +257,68 @@ func PanicOnCollectError(b bool) {
 // errors. It can be helpful to enable these checks while working with custom
 // Collectors or Metrics whose correctness is not well established yet.
 func EnableCollectChecks(b bool) {
-	defRegistry.collectChecksEnabled = b
+	defRegistry.EnableCollectChecks(b)
+}
+
+// EnableUnitSuffixChecks enables (or disables) checking upon registration
+// that the fully-qualified name of each descriptor with a unit ends with that
+// unit, optionally followed by "_total", e.g. "http_request_duration_seconds"
+// for the unit "seconds" or "sent_bytes_total" for the unit "bytes". A
+// Collector violating the convention fails to register. Descriptors without a
+// unit are not affected.
+func EnableUnitSuffixChecks(b bool) {
+	defRegistry.EnableUnitSuffixChecks(b)
+}
+
+// SetCollectConcurrency sets the maximum number of Collectors whose Collect
+// method is called concurrently during metrics collection. By default (or if n
+// is not positive), the Collect methods of all registered Collectors are called
+// at once. A limit keeps the number of goroutines in check if many Collectors
+// are registered. As the collected metrics are sorted before they are
+// delivered, the result does not depend on the order in which the Collectors
+// finish. Set the limit before metrics collection begins.
+func SetCollectConcurrency(n int) {
+	defRegistry.SetCollectConcurrency(n)
+}
+
+// DisableCompression disables (or re-enables) the compression of the metrics
+// served via HTTP. By default, a response is compressed if the request has an
+// "Accept-Encoding: gzip" header. If built with the "zstd" build tag, the zstd
+// encoding is supported, too. The first supported encoding listed in the
+// request header is used. Disabling the compression saves CPU
+// time at the expense of bandwidth, which can be preferable if the scraping
+// Prometheus server is close by, or if the response is compressed elsewhere,
+// e.g. by a reverse proxy.
+func DisableCompression(b bool) {
+	defRegistry.DisableCompression(b)
+}
+
+// DisableSorting disables (or re-enables) the sorting of the gathered
+// metrics. By default, the label pairs of each Metric are sorted by label name,
+// and the Metrics within each MetricFamily are sorted by their label values
+// (and by their timestamps if the label values are equal), so that the output
+// is deterministic. Disabling the sorting saves CPU time for registries with
+// many Metrics, but the Metrics of a MetricFamily are then served in no
+// particular order, and Metrics with unsorted label pairs (which none of the
+// Metric implementations of this package create) are served as such. The
+// MetricFamilies themselves are always sorted by name. The label pairs of
+// MetricFamilies injected with SetMetricFamilyInjectionHook are never sorted,
+// so the hook has to provide them sorted if deterministic output is required.
+func DisableSorting(b bool) {
+	defRegistry.DisableSorting(b)
+}
+
+// SetCollectTimeout sets a timeout for the Collect method of each Collector
+// during metrics collection. If a Collector has not finished collecting within
+// the timeout, the metrics it has sent so far are used and it is abandoned (its
+// Collect method keeps running in the background until it returns, but its
+// remaining metrics are discarded). Metrics collection then returns the
+// successfully collected metrics together with a MultiError containing a
+// CollectTimeoutError for each offending Collector. By default (or if d is not
+// positive), there is no timeout. Set the timeout before metrics collection
+// begins.
+func SetCollectTimeout(d time.Duration) {
+	defRegistry.SetCollectTimeout(d)
 }
 
 // Push triggers a metric collection and pushes all collected metrics to the
@@ -196,15 +330,292 @@ func EnableCollectChecks(b bool) {
 // Note that all previously pushed metrics with the same job and instance will
 // be replaced with the metrics pushed by this call. (It uses HTTP method 'PUT'
 // to push to the Pushgateway.)
+//
+// The push package provides a more flexible Pusher, which can push any
+// Gatherer and supports the current URL scheme of the Pushgateway.
 func Push(job, instance, addr string) error {
-	return defRegistry.Push(job, instance, addr, "PUT")
+	return defRegistry.Push(job, instance, addr)
 }
 
 // PushAdd works like Push, but only previously pushed metrics with the same
 // name (and the same job and instance) will be replaced. (It uses HTTP method
 // 'POST' to push to the Pushgateway.)
 func PushAdd(job, instance, addr string) error {
-	return defRegistry.Push(job, instance, addr, "POST")
+	return defRegistry.PushAdd(job, instance, addr)
+}
+
+// Registerer is the interface for the part of a registry in charge of
+// registering and unregistering Collectors. Registry implements it. Code that
+// only needs to register Collectors should accept a Registerer rather than a
+// Registry, so that callers can pass in a wrapped Registerer, e.g. one created
+// by WrapRegistererWith.
+type Registerer interface {
+	// Register registers a new Collector. See the Register function for
+	// details.
+	Register(Collector) error
+	// MustRegister works like Register but registers any number of
+	// Collectors and panics upon the first registration that causes an
+	// error.
+	MustRegister(...Collector)
+	// Unregister unregisters the Collector that equals the Collector
+	// passed in as an argument. See the Unregister function for details.
+	Unregister(Collector) bool
+}
+
+// Gatherer is the interface for the part of a registry in charge of gathering
+// the collected metrics into a number of MetricFamilies. It allows exposition,
+// pushing, and other consumers of metrics to work with any source of
+// MetricFamilies, not only with a Registry.
+type Gatherer interface {
+	// Gather calls the Collect method of the registered Collectors and then
+	// gathers the collected metrics into a lexicographically sorted slice
+	// of MetricFamily protobufs. Within each MetricFamily, the Metrics are
+	// sorted by their label values. The returned MetricFamilies are owned
+	// by the caller, i.e. they may be modified freely.
+	Gather() ([]*dto.MetricFamily, error)
+}
+
+// GathererFunc turns a function into a Gatherer.
+type GathererFunc func() ([]*dto.MetricFamily, error)
+
+// Gather implements Gatherer.
+func (gf GathererFunc) Gather() ([]*dto.MetricFamily, error) {
+	return gf()
+}
+
+// TransactionalGatherer is a variant of Gatherer whose Gather method
+// additionally returns a done function. The returned MetricFamilies are only
+// valid until done is called, which allows the implementation to reuse their
+// memory for the next call of Gather. The caller must call done exactly once
+// after it has finished with the MetricFamilies (also if an error is
+// returned), and it must neither modify nor retain the MetricFamilies.
+type TransactionalGatherer interface {
+	// Gather works like the method of the same name of Gatherer, but also
+	// returns a done function to be called once the returned
+	// MetricFamilies are not needed anymore.
+	Gather() (_ []*dto.MetricFamily, done func(), err error)
+}
+
+// ToTransactionalGatherer turns the provided Gatherer into a
+// TransactionalGatherer whose done function does nothing.
+func ToTransactionalGatherer(g Gatherer) TransactionalGatherer {
+	return noTransactionGatherer{g}
+}
+
+type noTransactionGatherer struct {
+	g Gatherer
+}
+
+func (g noTransactionGatherer) Gather() ([]*dto.MetricFamily, func(), error) {
+	mfs, err := g.g.Gather()
+	return mfs, func() {}, err
+}
+
+// Gatherers is a slice of Gatherer instances that implements the Gatherer
+// interface itself. Its Gather method calls Gather on all Gatherers in the
+// slice and merges the results into one slice of MetricFamilies, sorted by name,
+// with their Metrics and label pairs sorted as described for DisableSorting. A
+// typical use case is exposing the metrics of an application's Registry
+// together with those of a library's private Registry on one endpoint, e.g.
+//     HandlerFor(Gatherers{appRegistry, libRegistry})
+//
+// MetricFamilies with the same name are merged. Their help strings, units, and
+// metric types must be equal, and no Metric must be gathered more than once
+// (i.e. two Metrics within a MetricFamily must differ in their label
+// pairs). Violations are reported as errors, and the offending MetricFamily or
+// Metric is skipped. Errors of the individual Gatherers are reported,
+// too. Gather always returns the MetricFamilies that could be merged
+// successfully, even if it returns an error.
+type Gatherers []Gatherer
+
+// Gather implements Gatherer.
+func (gs Gatherers) Gather() ([]*dto.MetricFamily, error) {
+	var (
+		metricFamiliesByName = map[string]*dto.MetricFamily{}
+		metricHashes         = map[uint64]struct{}{}
+		errs                 MultiError
+	)
+	for i, g := range gs {
+		mfs, err := g.Gather()
+		if multiErr, ok := err.(MultiError); ok {
+			for _, err := range multiErr {
+				errs = append(errs, fmt.Errorf("[from Gatherer #%d] %w", i+1, err))
+			}
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("[from Gatherer #%d] %w", i+1, err))
+		}
+		for _, mf := range mfs {
+			existingMF, exists := metricFamiliesByName[mf.GetName()]
+			if exists {
+				if existingMF.GetHelp() != mf.GetHelp() {
+					errs = append(errs, fmt.Errorf(
+						"gathered metric family %s has help %q but should have %q",
+						mf.GetName(), mf.GetHelp(), existingMF.GetHelp(),
+					))
+					continue
+				}
+				if existingMF.GetType() != mf.GetType() {
+					errs = append(errs, fmt.Errorf(
+						"gathered metric family %s has type %s but should have %s",
+						mf.GetName(), mf.GetType(), existingMF.GetType(),
+					))
+					continue
+				}
+				if existingMF.GetUnit() != mf.GetUnit() {
+					errs = append(errs, fmt.Errorf(
+						"gathered metric family %s has unit %q but should have %q",
+						mf.GetName(), mf.GetUnit(), existingMF.GetUnit(),
+					))
+					continue
+				}
+			} else {
+				existingMF = &dto.MetricFamily{
+					Name: mf.Name,
+					Help: mf.Help,
+					Unit: mf.Unit,
+					Type: mf.Type,
+				}
+				metricFamiliesByName[mf.GetName()] = existingMF
+			}
+			for _, m := range mf.Metric {
+				m.Label = sortedLabelPairs(m.Label)
+				h := hashMetric(mf.GetName(), m.Label)
+				if _, exists := metricHashes[h]; exists {
+					errs = append(errs, fmt.Errorf(
+						"gathered metric %s %s was gathered before with the same name and label pairs",
+						mf.GetName(), m,
+					))
+					continue
+				}
+				metricHashes[h] = struct{}{}
+				existingMF.Metric = append(existingMF.Metric, m)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(metricFamiliesByName))
+	for name, mf := range metricFamiliesByName {
+		sort.Sort(metricSorter(mf.Metric))
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		result = append(result, metricFamiliesByName[name])
+	}
+
+	return result, errs.MaybeNil()
+}
+
+// MultiError is a slice of errors implementing the error interface. It is used
+// by Gather (of a Registry as well as of Gatherers) to report all errors that
+// occurred during a single gathering. The individual errors are usually
+// CollectErrors or CollectTimeoutErrors, which identify the offending Metric
+// or Collector.
+type MultiError []error
+
+func (errs MultiError) Error() string {
+	if len(errs) == 0 {
+		return ""
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, "* "+err.Error())
+	}
+	return fmt.Sprintf(
+		"%d error(s) occurred while gathering:\n%s",
+		len(errs), strings.Join(msgs, "\n"),
+	)
+}
+
+// Unwrap returns the individual errors, so that errors.Is and errors.As find
+// any of them.
+func (errs MultiError) Unwrap() []error {
+	return errs
+}
+
+// MaybeUnwrap returns nil if the MultiError is empty, the only contained error
+// if it contains exactly one error, and the MultiError itself otherwise.
+func (errs MultiError) MaybeUnwrap() error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// MaybeNil returns nil if the MultiError is empty and the MultiError itself
+// otherwise. Use it to return a MultiError as an error, as an empty MultiError
+// would otherwise result in a non-nil error.
+func (errs MultiError) MaybeNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// CollectError is reported by Gather for a Metric that could not be collected,
+// e.g. because its Write method failed or because it is inconsistent with
+// previously collected Metrics. The Metric is skipped, but gathering continues.
+type CollectError struct {
+	// Desc is the descriptor of the offending Metric.
+	Desc *Desc
+	Err  error
+}
+
+func (err CollectError) Error() string {
+	return fmt.Sprintf("error collecting metric %v: %s", err.Desc, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err CollectError) Unwrap() error {
+	return err.Err
+}
+
+// CollectPanicError is reported by Gather if the Describe or Collect method of a
+// Collector panics during collection. The panic is recovered, the Metrics sent
+// by the Collector before the panic are used, and gathering continues with the
+// other Collectors.
+type CollectPanicError struct {
+	Collector Collector
+	// Value is the value passed to panic.
+	Value interface{}
+}
+
+func (err CollectPanicError) Error() string {
+	return fmt.Sprintf("collecting metrics from %T panicked: %v", err.Collector, err.Value)
+}
+
+// CollectTimeoutError is reported by Gather if the Collect method of a
+// Collector has not returned within the timeout set with SetCollectTimeout.
+type CollectTimeoutError struct {
+	Collector Collector
+	Timeout   time.Duration
+}
+
+func (err CollectTimeoutError) Error() string {
+	return fmt.Sprintf("collecting metrics from %T timed out after %v", err.Collector, err.Timeout)
+}
+
+// hashMetric returns a hash of the provided metric name and label pairs. As
+// the label pairs are expected to be sorted, equal label sets result in equal
+// hashes.
+func hashMetric(name string, labelPairs []*dto.LabelPair) uint64 {
+	h := fnv.New64a()
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	buf.WriteByte(model.SeparatorByte)
+	for _, lp := range labelPairs {
+		buf.WriteString(lp.GetName())
+		buf.WriteByte(model.SeparatorByte)
+		buf.WriteString(lp.GetValue())
+		buf.WriteByte(model.SeparatorByte)
+	}
+	h.Write(buf.Bytes())
+	return h.Sum64()
 }
 
 // encoder is a function that writes a dto.MetricFamily to an io.Writer in a
@@ -213,28 +624,98 @@ func PushAdd(job, instance, addr string) error {
 // encoders.
 type encoder func(io.Writer, *dto.MetricFamily) (int, error)
 
-type registry struct {
+// Registry registers Collectors, collects their metrics, and exposes them via
+// HTTP or pushes them to a Pushgateway. The package-level functions like
+// Register, Unregister, Handler, and Push all operate on the global Prometheus
+// registry, which is simply a Registry created by the package with the process
+// and Go collectors pre-registered. Libraries and tests that want to keep
+// their metrics separate from the global state can create their own Registry
+// instances with NewRegistry.
+//
+// The methods of Registry work in the same way as the package-level functions
+// of the same name. See there for details.
+type Registry struct {
 	mtx                       sync.RWMutex
 	collectorsByID            map[uint64]Collector // ID is a hash of the descIDs.
-	descIDs                   map[uint64]struct{}
-	dimHashesByName           map[string]uint64
+	uncheckedCollectors       []Collector
+	descIDs                   map[uint64]*Desc
+	descsByName               map[string]*Desc // First registered Desc per fqName.
 	bufPool                   chan *bytes.Buffer
 	metricFamilyPool          chan *dto.MetricFamily
 	metricPool                chan *dto.Metric
 	metricFamilyInjectionHook func() []*dto.MetricFamily
 
 	panicOnCollectError, collectChecksEnabled bool
+	pedanticChecksEnabled                     bool
+	collectConcurrency                        int
+	collectTimeout                            time.Duration
+	compressionDisabled                       bool
+	sortingDisabled                           bool
+	unitSuffixChecksEnabled                   bool
+}
+
+// NewRegistry creates a new, empty Registry. In contrast to the global
+// Prometheus registry, it has no Collectors pre-registered.
+func NewRegistry() *Registry {
+	return &Registry{
+		collectorsByID:   map[uint64]Collector{},
+		descIDs:          map[uint64]*Desc{},
+		descsByName:      map[string]*Desc{},
+		bufPool:          make(chan *bytes.Buffer, numBufs),
+		metricFamilyPool: make(chan *dto.MetricFamily, numMetricFamilies),
+		metricPool:       make(chan *dto.Metric, numMetrics),
+	}
+}
+
+// NewPedanticRegistry returns a Registry that checks during collection that
+// each collected Metric is consistent with the Descs provided by the Describe
+// method of the Collector that collected it (and not merely with any registered
+// Desc). It also performs the checks enabled with EnableCollectChecks and
+// checks the validity of the collected values, e.g. it rejects counters with a
+// negative value, histograms with decreasing bucket counts, and label values
+// that are not valid UTF-8. Violations are reported as errors during
+// collection.
+//
+// The pedantic checks inflict a considerable performance penalty. The
+// pedantic Registry is therefore meant for testing custom Collector
+// implementations rather than for production use.
+func NewPedanticRegistry() *Registry {
+	r := NewRegistry()
+	r.collectChecksEnabled = true
+	r.pedanticChecksEnabled = true
+	return r
 }
 
-func (r *registry) Register(c Collector) (Collector, error) {
+// Register registers a new Collector with the Registry. See the Register
+// function for details.
+func (r *Registry) Register(c Collector) error {
+	_, err := r.register(c)
+	return err
+}
+
+// MustRegister registers the provided Collectors with the Registry and panics
+// upon the first registration that causes an error.
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// register is the implementation of Register and RegisterOrGet. It returns the
+// registered Collector, which is the already registered one if an equal
+// Collector was registered before (in which case an AlreadyRegisteredError is
+// returned alongside).
+func (r *Registry) register(c Collector) (Collector, error) {
 	descChan := make(chan *Desc, capDescChan)
 	go func() {
 		c.Describe(descChan)
 		close(descChan)
 	}()
 
-	newDescIDs := map[uint64]struct{}{}
-	newDimHashesByName := map[string]uint64{}
+	newDescIDs := map[uint64]*Desc{}
+	newDescsByName := map[string]*Desc{}
 	var collectorID uint64 // Just a sum of all desc IDs.
 	var duplicateDescErr error
 
@@ -248,43 +729,72 @@ func (r *registry) Register(c Collector) (Collector, error) {
 			return c, fmt.Errorf("descriptor %s is invalid: %s", desc, desc.err)
 		}
 
+		if r.unitSuffixChecksEnabled && !desc.hasUnitSuffix() {
+			return nil, fmt.Errorf("descriptor %s has a name that does not end with its unit", desc)
+		}
+
 		// Is the descID unique?
 		// (In other words: Is the fqName + constLabel combination unique?)
-		if _, exists := r.descIDs[desc.id]; exists {
-			duplicateDescErr = fmt.Errorf("descriptor %s already exists with the same fully-qualified name and const label values", desc)
+		if existing, exists := r.descIDs[desc.id]; exists {
+			duplicateDescErr = fmt.Errorf(
+				"descriptor %s already exists with the same fully-qualified name and const label values, previously registered descriptor is %s",
+				desc, existing,
+			)
 		}
 		// If it is not a duplicate desc in this collector, add it to
 		// the collectorID.  (We allow duplicate descs within the same
 		// collector, but their existence must be a no-op.)
 		if _, exists := newDescIDs[desc.id]; !exists {
-			newDescIDs[desc.id] = struct{}{}
+			newDescIDs[desc.id] = desc
 			collectorID += desc.id
 		}
 
 		// Are all the label names and the help string consistent with
 		// previous descriptors of the same name?
 		// First check existing descriptors...
-		if dimHash, exists := r.dimHashesByName[desc.fqName]; exists {
-			if dimHash != desc.dimHash {
-				return nil, fmt.Errorf("a previously registered descriptor with the same fully-qualified name as %s has different label names or a different help string", desc)
+		if existing, exists := r.descsByName[desc.fqName]; exists {
+			if existing.dimHash != desc.dimHash {
+				return nil, fmt.Errorf(
+					"a previously registered descriptor with the same fully-qualified name as %s has different label names or a different help string, previously registered descriptor is %s",
+					desc, existing,
+				)
+			}
+			if existing.unit != desc.unit {
+				return nil, fmt.Errorf(
+					"a previously registered descriptor with the same fully-qualified name as %s has a different unit, previously registered descriptor is %s",
+					desc, existing,
+				)
 			}
 		} else {
 			// ...then check the new descriptors already seen.
-			if dimHash, exists := newDimHashesByName[desc.fqName]; exists {
-				if dimHash != desc.dimHash {
-					return nil, fmt.Errorf("descriptors reported by collector have inconsistent label names or help strings for the same fully-qualified name, offender is %s", desc)
+			if seen, exists := newDescsByName[desc.fqName]; exists {
+				if seen.dimHash != desc.dimHash {
+					return nil, fmt.Errorf(
+						"descriptors reported by collector have inconsistent label names or help strings for the same fully-qualified name, offenders are %s and %s",
+						seen, desc,
+					)
+				}
+				if seen.unit != desc.unit {
+					return nil, fmt.Errorf(
+						"descriptors reported by collector have inconsistent units for the same fully-qualified name, offenders are %s and %s",
+						seen, desc,
+					)
 				}
 			} else {
-				newDimHashesByName[desc.fqName] = desc.dimHash
+				newDescsByName[desc.fqName] = desc
 			}
 		}
 	}
-	// Did anything happen at all?
+	// A Collector without descriptors is registered unchecked.
 	if len(newDescIDs) == 0 {
-		return nil, errors.New("collector has no descriptors")
+		r.uncheckedCollectors = append(r.uncheckedCollectors, c)
+		return c, nil
 	}
 	if existing, exists := r.collectorsByID[collectorID]; exists {
-		return existing, errAlreadyReg
+		return existing, AlreadyRegisteredError{
+			ExistingCollector: existing,
+			NewCollector:      c,
+		}
 	}
 	// If the collectorID is new, but at least one of the descs existed
 	// before, we are in trouble.
@@ -294,24 +804,39 @@ func (r *registry) Register(c Collector) (Collector, error) {
 
 	// Only after all tests have passed, actually register.
 	r.collectorsByID[collectorID] = c
-	for hash := range newDescIDs {
-		r.descIDs[hash] = struct{}{}
+	for hash, desc := range newDescIDs {
+		r.descIDs[hash] = desc
 	}
-	for name, dimHash := range newDimHashesByName {
-		r.dimHashesByName[name] = dimHash
+	for name, desc := range newDescsByName {
+		r.descsByName[name] = desc
 	}
 	return c, nil
 }
 
-func (r *registry) RegisterOrGet(m Collector) (Collector, error) {
-	existing, err := r.Register(m)
-	if err != nil && err != errAlreadyReg {
+// RegisterOrGet works like Register but returns the previously registered
+// Collector if an equal Collector has been registered before. See the
+// RegisterOrGet function for details.
+func (r *Registry) RegisterOrGet(c Collector) (Collector, error) {
+	existing, err := r.register(c)
+	if _, ok := err.(AlreadyRegisteredError); err != nil && !ok {
 		return nil, err
 	}
 	return existing, nil
 }
 
-func (r *registry) Unregister(c Collector) bool {
+// MustRegisterOrGet works like RegisterOrGet but panics where RegisterOrGet
+// would have returned an error.
+func (r *Registry) MustRegisterOrGet(c Collector) Collector {
+	existing, err := r.RegisterOrGet(c)
+	if err != nil {
+		panic(err)
+	}
+	return existing
+}
+
+// Unregister unregisters the Collector that equals the Collector passed in as
+// an argument. It returns whether a Collector was unregistered.
+func (r *Registry) Unregister(c Collector) bool {
 	descChan := make(chan *Desc, capDescChan)
 	go func() {
 		c.Describe(descChan)
@@ -326,6 +851,10 @@ func (r *registry) Unregister(c Collector) bool {
 			descIDs[desc.id] = struct{}{}
 		}
 	}
+	if len(descIDs) == 0 {
+		// Unchecked Collectors cannot be identified.
+		return false
+	}
 
 	r.mtx.RLock()
 	if _, exists := r.collectorsByID[collectorID]; !exists {
@@ -341,19 +870,86 @@ func (r *registry) Unregister(c Collector) bool {
 	for id := range descIDs {
 		delete(r.descIDs, id)
 	}
-	// dimHashesByName is left untouched as those must be consistent
+	// descsByName is left untouched as those must be consistent
 	// throughout the lifetime of a program.
 	return true
 }
 
-func (r *registry) Push(job, instance, addr, method string) error {
+// SetMetricFamilyInjectionHook sets a function that is called whenever the
+// metrics of the Registry are collected. See the SetMetricFamilyInjectionHook
+// function for details.
+func (r *Registry) SetMetricFamilyInjectionHook(hook func() []*dto.MetricFamily) {
+	r.metricFamilyInjectionHook = hook
+}
+
+// PanicOnCollectError sets whether the Registry panics upon an error while its
+// metrics are collected. See the PanicOnCollectError function for details.
+func (r *Registry) PanicOnCollectError(b bool) {
+	r.panicOnCollectError = b
+}
+
+// EnableCollectChecks enables (or disables) additional consistency checks
+// while the metrics of the Registry are collected. See the EnableCollectChecks
+// function for details.
+func (r *Registry) EnableCollectChecks(b bool) {
+	r.collectChecksEnabled = b
+}
+
+// EnableUnitSuffixChecks enables (or disables) checking the names of the
+// descriptors registered with the Registry for unit suffixes. See the
+// EnableUnitSuffixChecks function for details.
+func (r *Registry) EnableUnitSuffixChecks(b bool) {
+	r.unitSuffixChecksEnabled = b
+}
+
+// SetCollectConcurrency sets the maximum number of Collectors of the Registry
+// that are collected concurrently. See the SetCollectConcurrency function for
+// details.
+func (r *Registry) SetCollectConcurrency(n int) {
+	r.collectConcurrency = n
+}
+
+// DisableCompression disables (or re-enables) the compression of the
+// responses served by the Registry. See the DisableCompression function for
+// details.
+func (r *Registry) DisableCompression(b bool) {
+	r.compressionDisabled = b
+}
+
+// DisableSorting disables (or re-enables) the sorting of the Metrics gathered
+// by the Registry. See the DisableSorting function for details.
+func (r *Registry) DisableSorting(b bool) {
+	r.sortingDisabled = b
+}
+
+// SetCollectTimeout sets a timeout for the Collect method of each Collector of
+// the Registry. See the SetCollectTimeout function for details.
+func (r *Registry) SetCollectTimeout(d time.Duration) {
+	r.collectTimeout = d
+}
+
+// Push triggers a metric collection and pushes all collected metrics of the
+// Registry to the Pushgateway specified by addr. See the Push function for
+// details.
+func (r *Registry) Push(job, instance, addr string) error {
+	return r.push(job, instance, addr, "PUT")
+}
+
+// PushAdd works like Push, but only previously pushed metrics with the same
+// name (and the same job and instance) will be replaced. See the PushAdd
+// function for details.
+func (r *Registry) PushAdd(job, instance, addr string) error {
+	return r.push(job, instance, addr, "POST")
+}
+
+func (r *Registry) push(job, instance, addr, method string) error {
 	u := fmt.Sprintf("http://%s/metrics/jobs/%s", addr, url.QueryEscape(job))
 	if instance != "" {
 		u += "/instances/" + url.QueryEscape(instance)
 	}
 	buf := r.getBuf()
 	defer r.giveBuf(buf)
-	if _, err := r.writePB(buf, text.WriteProtoDelimited); err != nil {
+	if _, err := writeGathered(buf, r, text.WriteProtoDelimited); err != nil {
 		if r.panicOnCollectError {
 			panic(err)
 		}
@@ -375,32 +971,94 @@ func (r *registry) Push(job, instance, addr, method string) error {
 	return nil
 }
 
-func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	enc, contentType := chooseEncoder(req)
-	buf := r.getBuf()
-	defer r.giveBuf(buf)
-	writer, encoding := decorateWriter(req, buf)
-	if _, err := r.writePB(writer, enc); err != nil {
+// ServeHTTP implements http.Handler. It serves the collected metrics of the
+// Registry in the format negotiated with the client.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if err := serveGathered(w, req, r.Transactional(), !r.compressionDisabled); err != nil {
 		if r.panicOnCollectError {
 			panic(err)
 		}
 		http.Error(w, "An error has occurred:\n\n"+err.Error(), http.StatusInternalServerError)
-		return
 	}
-	if closer, ok := writer.(io.Closer); ok {
-		closer.Close()
-	}
-	header := w.Header()
-	header.Set(contentTypeHeader, contentType)
-	header.Set(contentLengthHeader, fmt.Sprint(buf.Len()))
-	if encoding != "" {
-		header.Set(contentEncodingHeader, encoding)
+}
+
+// serveGathered gathers the metrics from the provided Gatherer and streams
+// them to w in the format negotiated with the client, see
+// internal.WriteMetricFamilies for details.
+//
+// If gathering fails, nothing is written to w and the error is returned. If
+// encoding or writing fails, the error is returned, too, but parts of the
+// response might have been sent already.
+func serveGathered(w http.ResponseWriter, req *http.Request, tg TransactionalGatherer, compress bool) error {
+	mfs, done, err := tg.Gather()
+	defer done()
+	if err != nil {
+		return err
 	}
-	w.Write(buf.Bytes())
+	return internal.WriteMetricFamilies(w, req, mfs, compress)
+}
+
+// Gather implements Gatherer. Metrics that cannot be collected are skipped. In
+// that case, Gather returns the successfully collected MetricFamilies together
+// with a MultiError that contains a CollectError for each skipped Metric.
+func (r *Registry) Gather() ([]*dto.MetricFamily, error) {
+	mfs, _, err := r.gather(false)
+	return mfs, err
+}
+
+// Transactional returns a TransactionalGatherer for the Registry. Its Gather
+// method works like the Gather method of the Registry, but the memory of the
+// returned MetricFamilies is reused by later calls once done has been called.
+// This reduces the allocations per scrape considerably for large registries.
+// The MetricFamilies injected with SetMetricFamilyInjectionHook are not
+// reused, as they are owned by the hook.
+func (r *Registry) Transactional() TransactionalGatherer {
+	return transactionalRegistry{r}
+}
+
+type transactionalRegistry struct {
+	r *Registry
+}
+
+func (tr transactionalRegistry) Gather() ([]*dto.MetricFamily, func(), error) {
+	return tr.r.gather(true)
 }
 
-func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
-	var metricHashes map[uint64]struct{}
+// gather is the implementation of Gather. If pooled is true, the returned
+// MetricFamilies and Metrics are taken from the pools of the Registry, and the
+// returned done function gives them back. Otherwise, done does nothing.
+func (r *Registry) gather(pooled bool) (_ []*dto.MetricFamily, done func(), _ error) {
+	var pooledMFs []*dto.MetricFamily
+	var pooledMetrics []*dto.Metric
+	done = func() {
+		for _, mf := range pooledMFs {
+			r.giveMetricFamily(mf)
+		}
+		for _, m := range pooledMetrics {
+			r.giveMetric(m)
+		}
+	}
+	newMetricFamily := func() *dto.MetricFamily {
+		if !pooled {
+			return &dto.MetricFamily{}
+		}
+		mf := r.getMetricFamily()
+		pooledMFs = append(pooledMFs, mf)
+		return mf
+	}
+	newMetric := func() *dto.Metric {
+		if !pooled {
+			return &dto.Metric{}
+		}
+		m := r.getMetric()
+		pooledMetrics = append(pooledMetrics, m)
+		return m
+	}
+
+	var (
+		metricHashes map[uint64]struct{}
+		errs         MultiError
+	)
 	if r.collectChecksEnabled {
 		metricHashes = make(map[uint64]struct{})
 	}
@@ -408,22 +1066,78 @@ func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
 	wg := sync.WaitGroup{}
 
 	r.mtx.RLock()
-	metricFamiliesByName := make(map[string]*dto.MetricFamily, len(r.dimHashesByName))
+	metricFamiliesByName := make(map[string]*dto.MetricFamily, len(r.descsByName))
 
 	// Scatter.
-	// (Collectors could be complex and slow, so we call them all at once.)
-	wg.Add(len(r.collectorsByID))
+	// (Collectors could be complex and slow, so we call them concurrently,
+	// by default all at once.)
+	var (
+		collectFuncs  = make(chan func(), len(r.collectorsByID)+len(r.uncheckedCollectors))
+		collectorErrs MultiError
+		// gatherDone is set once collectorErrs has been read. Collectors
+		// abandoned after a timeout might still panic afterwards. Their
+		// errors are dropped rather than attributed to a later call.
+		gatherDone bool
+		errsMtx    sync.Mutex
+	)
+	addCollectorErr := func(err error) {
+		errsMtx.Lock()
+		if !gatherDone {
+			collectorErrs = append(collectorErrs, err)
+		}
+		errsMtx.Unlock()
+	}
+	addCollectFunc := func(c Collector, collectFrom func(Collector, chan<- Metric)) {
+		// Panics are recovered within the Collector itself, as
+		// collectFrom might call its methods in separate goroutines.
+		rc := recoveringCollector{
+			Collector: c,
+			recovered: func(v interface{}) {
+				addCollectorErr(CollectPanicError{Collector: c, Value: v})
+			},
+		}
+		collect := func(ch chan<- Metric) { collectFrom(rc, ch) }
+		if r.collectTimeout <= 0 {
+			collectFuncs <- func() { collect(metricChan) }
+			return
+		}
+		timeout := r.collectTimeout
+		collectFuncs <- func() {
+			if !collectWithTimeout(collect, metricChan, timeout) {
+				addCollectorErr(CollectTimeoutError{Collector: c, Timeout: timeout})
+			}
+		}
+	}
+	for _, collector := range r.collectorsByID {
+		if r.pedanticChecksEnabled {
+			addCollectFunc(collector, collectPedantically)
+		} else {
+			addCollectFunc(collector, Collector.Collect)
+		}
+	}
+	for _, collector := range r.uncheckedCollectors {
+		addCollectFunc(collector, collectUnchecked)
+	}
+	close(collectFuncs)
+	r.mtx.RUnlock()
+
+	workers := len(collectFuncs)
+	if r.collectConcurrency > 0 && r.collectConcurrency < workers {
+		workers = r.collectConcurrency
+	}
+	wg.Add(workers)
 	go func() {
 		wg.Wait()
 		close(metricChan)
 	}()
-	for _, collector := range r.collectorsByID {
-		go func(collector Collector) {
+	for i := 0; i < workers; i++ {
+		go func() {
 			defer wg.Done()
-			collector.Collect(metricChan)
-		}(collector)
+			for collect := range collectFuncs {
+				collect()
+			}
+		}()
 	}
-	r.mtx.RUnlock()
 
 	// Drain metricChan in case of premature return.
 	defer func() {
@@ -436,49 +1150,82 @@ func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
 		// This could be done concurrently, too, but it required locking
 		// of metricFamiliesByName (and of metricHashes if checks are
 		// enabled). Most likely not worth it.
-		desc := metric.Desc()
-		metricFamily, ok := metricFamiliesByName[desc.fqName]
-		if !ok {
-			metricFamily = r.getMetricFamily()
-			defer r.giveMetricFamily(metricFamily)
-			metricFamily.Name = proto.String(desc.fqName)
-			metricFamily.Help = proto.String(desc.help)
-			metricFamiliesByName[desc.fqName] = metricFamily
+		checked := true
+		if um, ok := metric.(uncheckedMetric); ok {
+			metric, checked = um.Metric, false
 		}
-		dtoMetric := r.getMetric()
-		defer r.giveMetric(dtoMetric)
+		// A Metric that cannot be collected is skipped, and the error
+		// is reported alongside the successfully collected Metrics.
+		desc := metric.Desc()
+		dtoMetric := newMetric()
 		if err := metric.Write(dtoMetric); err != nil {
-			// TODO: Consider different means of error reporting so
-			// that a single erroneous metric could be skipped
-			// instead of blowing up the whole collection.
-			return 0, fmt.Errorf("error collecting metric %v: %s", desc, err)
+			errs = append(errs, CollectError{Desc: desc, Err: err})
+			continue
+		}
+		if !r.sortingDisabled {
+			dtoMetric.Label = sortedLabelPairs(dtoMetric.Label)
 		}
+		var metricType dto.MetricType
 		switch {
-		case metricFamily.Type != nil:
-			// Type already set. We are good.
 		case dtoMetric.Gauge != nil:
-			metricFamily.Type = dto.MetricType_GAUGE.Enum()
+			metricType = dto.MetricType_GAUGE
 		case dtoMetric.Counter != nil:
-			metricFamily.Type = dto.MetricType_COUNTER.Enum()
+			metricType = dto.MetricType_COUNTER
 		case dtoMetric.Summary != nil:
-			metricFamily.Type = dto.MetricType_SUMMARY.Enum()
+			metricType = dto.MetricType_SUMMARY
+		case dtoMetric.Histogram != nil:
+			if isGaugeHistogramMetric(metric) {
+				metricType = dto.MetricType_GAUGE_HISTOGRAM
+			} else {
+				metricType = dto.MetricType_HISTOGRAM
+			}
 		case dtoMetric.Untyped != nil:
-			metricFamily.Type = dto.MetricType_UNTYPED.Enum()
+			metricType = dto.MetricType_UNTYPED
 		default:
-			return 0, fmt.Errorf("empty metric collected: %s", dtoMetric)
+			errs = append(errs, CollectError{
+				Desc: desc,
+				Err:  fmt.Errorf("empty metric collected: %s", dtoMetric),
+			})
+			continue
+		}
+		metricFamily, ok := metricFamiliesByName[desc.fqName]
+		if !ok {
+			metricFamily = newMetricFamily()
+			metricFamily.Name = proto.String(desc.fqName)
+			metricFamily.Help = proto.String(desc.help)
+			if desc.unit != "" {
+				metricFamily.Unit = proto.String(desc.unit)
+			}
+			metricFamily.Type = metricType.Enum()
+			metricFamiliesByName[desc.fqName] = metricFamily
 		}
 		if r.collectChecksEnabled {
-			if err := r.checkConsistency(metricFamily, dtoMetric, desc, metricHashes); err != nil {
-				return 0, err
+			if err := r.checkConsistency(metricFamily, dtoMetric, desc, metricHashes, checked); err != nil {
+				errs = append(errs, CollectError{Desc: desc, Err: err})
+				continue
+			}
+		}
+		if r.pedanticChecksEnabled {
+			if err := checkMetricValues(dtoMetric, desc); err != nil {
+				errs = append(errs, CollectError{Desc: desc, Err: err})
+				continue
 			}
 		}
 		metricFamily.Metric = append(metricFamily.Metric, dtoMetric)
 	}
 
+	// Drop the MetricFamilies all of whose Metrics have been skipped.
+	for name, mf := range metricFamiliesByName {
+		if len(mf.Metric) == 0 {
+			delete(metricFamiliesByName, name)
+		}
+	}
+
 	if r.metricFamilyInjectionHook != nil {
 		for _, mf := range r.metricFamilyInjectionHook() {
 			if _, exists := metricFamiliesByName[mf.GetName()]; exists {
-				return 0, fmt.Errorf("metric family with duplicate name injected: %s", mf)
+				errs = append(errs, fmt.Errorf("metric family with duplicate name injected: %s", mf))
+				continue
 			}
 			metricFamiliesByName[mf.GetName()] = mf
 		}
@@ -486,21 +1233,99 @@ func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
 
 	// Now that MetricFamilies are all set, sort their Metrics
 	// lexicographically by their label values.
-	for _, mf := range metricFamiliesByName {
-		sort.Sort(metricSorter(mf.Metric))
+	if !r.sortingDisabled {
+		for _, mf := range metricFamiliesByName {
+			sort.Sort(metricSorter(mf.Metric))
+		}
 	}
 
-	// Write out MetricFamilies sorted by their name.
+	// Return MetricFamilies sorted by their name.
 	names := make([]string, 0, len(metricFamiliesByName))
 	for name := range metricFamiliesByName {
 		names = append(names, name)
 	}
 	sort.Strings(names)
 
-	var written int
+	result := make([]*dto.MetricFamily, 0, len(names))
 	for _, name := range names {
-		w, err := writeEncoded(w, metricFamiliesByName[name])
-		written += w
+		result = append(result, metricFamiliesByName[name])
+	}
+	// Collectors that timed out might still be running, so collectorErrs
+	// has to be read under errsMtx, too.
+	errsMtx.Lock()
+	gatherDone = true
+	errs = append(errs, collectorErrs...)
+	errsMtx.Unlock()
+	return result, done, errs.MaybeNil()
+}
+
+// collectWithTimeout calls collect and forwards the collected Metrics to ch. It
+// returns false if collect has not returned within the timeout, in which case
+// the Metrics collected afterwards are discarded.
+func collectWithTimeout(collect func(chan<- Metric), ch chan<- Metric, timeout time.Duration) bool {
+	collectedChan := make(chan Metric, capMetricChan)
+	go func() {
+		collect(collectedChan)
+		close(collectedChan)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case metric, ok := <-collectedChan:
+			if !ok {
+				return true
+			}
+			ch <- metric
+		case <-timer.C:
+			// Drain collectedChan so that collect can return.
+			go func() {
+				for _ = range collectedChan {
+				}
+			}()
+			return false
+		}
+	}
+}
+
+// WriteToTextfile gathers the metrics from the provided Gatherer and writes
+// them in the text exposition format (version 0.0.4, including HELP and TYPE
+// lines and escaped label values) to the file with the provided name. The file
+// is written to a temporary file in the same directory first and then renamed,
+// so that readers like the textfile collector of the Node Exporter never see a
+// partially written file. If gathering fails, no file is written.
+func WriteToTextfile(filename string, g Gatherer) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := writeGathered(tmp, g, text.MetricFamilyToText); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// writeGathered gathers the metrics from the provided Gatherer and writes them
+// to w with the provided encoder. It returns the number of bytes written and
+// any error encountered.
+func writeGathered(w io.Writer, g Gatherer, writeEncoded encoder) (int, error) {
+	mfs, err := g.Gather()
+	if err != nil {
+		return 0, err
+	}
+	var written int
+	for _, mf := range mfs {
+		n, err := writeEncoded(w, mf)
+		written += n
 		if err != nil {
 			return written, err
 		}
@@ -508,12 +1333,139 @@ func (r *registry) writePB(w io.Writer, writeEncoded encoder) (int, error) {
 	return written, nil
 }
 
-func (r *registry) checkConsistency(metricFamily *dto.MetricFamily, dtoMetric *dto.Metric, desc *Desc, metricHashes map[uint64]struct{}) error {
+// collectPedantically calls Collect on the provided Collector and forwards the
+// collected Metrics to ch. Metrics whose Desc has not been provided by the
+// Describe method of the Collector are replaced by invalid Metrics, which
+// results in an error upon writing them.
+func collectPedantically(c Collector, ch chan<- Metric) {
+	descIDs := map[uint64]struct{}{}
+	descChan := make(chan *Desc, capDescChan)
+	go func() {
+		c.Describe(descChan)
+		close(descChan)
+	}()
+	for desc := range descChan {
+		descIDs[desc.id] = struct{}{}
+	}
+
+	collectedChan := make(chan Metric, capMetricChan)
+	go func() {
+		c.Collect(collectedChan)
+		close(collectedChan)
+	}()
+	for metric := range collectedChan {
+		desc := metric.Desc()
+		if _, ok := descIDs[desc.id]; !ok {
+			metric = NewInvalidMetric(desc, fmt.Errorf(
+				"collected metric with descriptor %s that has not been provided by the Describe method of its collector",
+				desc,
+			))
+		}
+		ch <- metric
+	}
+}
+
+// recoveringCollector wraps a Collector and recovers panics in its Describe and
+// Collect methods, which are then reported to the recovered function. After a
+// panic, the method returns normally so that collection can continue with the
+// other Collectors.
+type recoveringCollector struct {
+	Collector
+	recovered func(interface{})
+}
+
+func (c recoveringCollector) Describe(ch chan<- *Desc) {
+	defer c.recover()
+	c.Collector.Describe(ch)
+}
+
+func (c recoveringCollector) Collect(ch chan<- Metric) {
+	defer c.recover()
+	c.Collector.Collect(ch)
+}
+
+func (c recoveringCollector) recover() {
+	if v := recover(); v != nil {
+		c.recovered(v)
+	}
+}
+
+// uncheckedMetric marks a Metric collected from an unchecked Collector so that
+// Gather can skip the checks against registered descriptors.
+type uncheckedMetric struct {
+	Metric
+}
+
+// collectUnchecked calls Collect on the provided unchecked Collector and
+// forwards the collected Metrics to ch, each wrapped in an uncheckedMetric.
+func collectUnchecked(c Collector, ch chan<- Metric) {
+	collectedChan := make(chan Metric, capMetricChan)
+	go func() {
+		c.Collect(collectedChan)
+		close(collectedChan)
+	}()
+	for metric := range collectedChan {
+		ch <- uncheckedMetric{metric}
+	}
+}
+
+// checkMetricValues checks the values of the provided Metric for validity. It
+// is only used by a pedantic Registry.
+func checkMetricValues(dtoMetric *dto.Metric, desc *Desc) error {
+	for _, lp := range dtoMetric.Label {
+		if !utf8.ValidString(lp.GetValue()) {
+			return fmt.Errorf(
+				"collected metric %q with descriptor %s has a label value that is not valid UTF-8: %q",
+				dtoMetric, desc, lp.GetValue(),
+			)
+		}
+	}
+	if c := dtoMetric.Counter; c != nil {
+		if v := c.GetValue(); v < 0 || math.IsNaN(v) {
+			return fmt.Errorf(
+				"collected counter %q with descriptor %s has invalid value %v",
+				dtoMetric, desc, v,
+			)
+		}
+	}
+	if s := dtoMetric.Summary; s != nil {
+		for _, q := range s.Quantile {
+			if rank := q.GetQuantile(); rank < 0 || rank > 1 || math.IsNaN(rank) {
+				return fmt.Errorf(
+					"collected summary %q with descriptor %s has invalid quantile rank %v",
+					dtoMetric, desc, rank,
+				)
+			}
+		}
+	}
+	if h := dtoMetric.Histogram; h != nil {
+		var prevCount uint64
+		for _, b := range h.Bucket {
+			count := b.GetCumulativeCount()
+			if count < prevCount || count > h.GetSampleCount() {
+				return fmt.Errorf(
+					"collected histogram %q with descriptor %s has inconsistent bucket counts",
+					dtoMetric, desc,
+				)
+			}
+			prevCount = count
+		}
+	}
+	return nil
+}
+
+// checkConsistency checks the provided Metric for consistency with its
+// MetricFamily, its Desc, and previously collected Metrics. If registered is
+// true, the Desc of the Metric must also be registered, which is not the case
+// for Metrics collected from unchecked Collectors.
+func (r *Registry) checkConsistency(metricFamily *dto.MetricFamily, dtoMetric *dto.Metric, desc *Desc, metricHashes map[uint64]struct{}, registered bool) error {
 
 	// Type consistency with metric family.
 	if metricFamily.GetType() == dto.MetricType_GAUGE && dtoMetric.Gauge == nil ||
 		metricFamily.GetType() == dto.MetricType_COUNTER && dtoMetric.Counter == nil ||
 		metricFamily.GetType() == dto.MetricType_SUMMARY && dtoMetric.Summary == nil ||
+		metricFamily.GetType() == dto.MetricType_HISTOGRAM && dtoMetric.Histogram == nil ||
+		metricFamily.GetType() == dto.MetricType_GAUGE_HISTOGRAM && dtoMetric.Histogram == nil ||
 		metricFamily.GetType() == dto.MetricType_UNTYPED && dtoMetric.Untyped == nil {
 		return fmt.Errorf(
 			"collected metric %q is not a %s",
@@ -576,6 +1528,10 @@ func (r *registry) checkConsistency(metricFamily *dto.MetricFamily, dtoMetric *d
 	}
 	metricHashes[metricHash] = struct{}{}
 
+	if !registered {
+		return nil
+	}
+
 	r.mtx.RLock() // Remaining checks need the read lock.
 	defer r.mtx.RUnlock()
 
@@ -587,7 +1543,7 @@ func (r *registry) checkConsistency(metricFamily *dto.MetricFamily, dtoMetric *d
 	return nil
 }
 
-func (r *registry) getBuf() *bytes.Buffer {
+func (r *Registry) getBuf() *bytes.Buffer {
 	select {
 	case buf := <-r.bufPool:
 		return buf
@@ -596,7 +1552,7 @@ func (r *registry) getBuf() *bytes.Buffer {
 	}
 }
 
-func (r *registry) giveBuf(buf *bytes.Buffer) {
+func (r *Registry) giveBuf(buf *bytes.Buffer) {
 	buf.Reset()
 	select {
 	case r.bufPool <- buf:
@@ -604,7 +1560,7 @@ func (r *registry) giveBuf(buf *bytes.Buffer) {
 	}
 }
 
-func (r *registry) getMetricFamily() *dto.MetricFamily {
+func (r *Registry) getMetricFamily() *dto.MetricFamily {
 	select {
 	case mf := <-r.metricFamilyPool:
 		return mf
@@ -613,15 +1569,19 @@ func (r *registry) getMetricFamily() *dto.MetricFamily {
 	}
 }
 
-func (r *registry) giveMetricFamily(mf *dto.MetricFamily) {
+func (r *Registry) giveMetricFamily(mf *dto.MetricFamily) {
+	// Keep the capacity of the Metric slice. The Metrics themselves are
+	// given back separately.
+	metrics := mf.Metric[:0]
 	mf.Reset()
+	mf.Metric = metrics
 	select {
 	case r.metricFamilyPool <- mf:
 	default:
 	}
 }
 
-func (r *registry) getMetric() *dto.Metric {
+func (r *Registry) getMetric() *dto.Metric {
 	select {
 	case m := <-r.metricPool:
 		return m
@@ -630,7 +1590,7 @@ func (r *registry) getMetric() *dto.Metric {
 	}
 }
 
-func (r *registry) giveMetric(m *dto.Metric) {
+func (r *Registry) giveMetric(m *dto.Metric) {
 	m.Reset()
 	select {
 	case r.metricPool <- m:
@@ -638,67 +1598,13 @@ func (r *registry) giveMetric(m *dto.Metric) {
 	}
 }
 
-func newRegistry() *registry {
-	return &registry{
-		collectorsByID:   map[uint64]Collector{},
-		descIDs:          map[uint64]struct{}{},
-		dimHashesByName:  map[string]uint64{},
-		bufPool:          make(chan *bytes.Buffer, numBufs),
-		metricFamilyPool: make(chan *dto.MetricFamily, numMetricFamilies),
-		metricPool:       make(chan *dto.Metric, numMetrics),
-	}
-}
-
-func newDefaultRegistry() *registry {
-	r := newRegistry()
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
 	r.Register(NewProcessCollector(os.Getpid(), ""))
 	r.Register(NewGoCollector())
 	return r
 }
 
-func chooseEncoder(req *http.Request) (encoder, string) {
-	accepts := goautoneg.ParseAccept(req.Header.Get(acceptHeader))
-	for _, accept := range accepts {
-		switch {
-		case accept.Type == "application" &&
-			accept.SubType == "vnd.google.protobuf" &&
-			accept.Params["proto"] == "io.prometheus.client.MetricFamily":
-			switch accept.Params["encoding"] {
-			case "delimited":
-				return text.WriteProtoDelimited, DelimitedTelemetryContentType
-			case "text":
-				return text.WriteProtoText, ProtoTextTelemetryContentType
-			case "compact-text":
-				return text.WriteProtoCompactText, ProtoCompactTextTelemetryContentType
-			default:
-				continue
-			}
-		case accept.Type == "text" &&
-			accept.SubType == "plain" &&
-			(accept.Params["version"] == "0.0.4" || accept.Params["version"] == ""):
-			return text.MetricFamilyToText, TextTelemetryContentType
-		default:
-			continue
-		}
-	}
-	return text.MetricFamilyToText, TextTelemetryContentType
-}
-
-// decorateWriter wraps a writer to handle gzip compression if requested.  It
-// returns the decorated writer and the appropriate "Content-Encoding" header
-// (which is empty if no compression is enabled).
-func decorateWriter(request *http.Request, writer io.Writer) (io.Writer, string) {
-	header := request.Header.Get(acceptEncodingHeader)
-	parts := strings.Split(header, ",")
-	for _, part := range parts {
-		part := strings.TrimSpace(part)
-		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
-			return gzip.NewWriter(writer), "gzip"
-		}
-	}
-	return writer, ""
-}
-
 type metricSorter []*dto.Metric
 
 func (s metricSorter) Len() int {
@@ -711,11 +1617,36 @@ func (s metricSorter) Swap(i, j int) {
 
 func (s metricSorter) Less(i, j int) bool {
 	for n, lp := range s[i].Label {
+		if n >= len(s[j].Label) {
+			// Only possible for merged MetricFamilies, see Gatherers.
+			return false
+		}
 		vi := lp.GetValue()
 		vj := s[j].Label[n].GetValue()
 		if vi != vj {
 			return vi < vj
 		}
 	}
-	return true
+	if len(s[i].Label) != len(s[j].Label) {
+		return true
+	}
+	// Metrics with equal label values can only be told apart by their
+	// timestamps. A Metric without a timestamp goes first.
+	if s[i].TimestampMs == nil {
+		return s[j].TimestampMs != nil
+	}
+	return s[j].TimestampMs != nil && s[i].GetTimestampMs() < s[j].GetTimestampMs()
+}
+
+// sortedLabelPairs returns the label pairs sorted by name. If they are not
+// sorted already, a sorted copy is returned, so that the order of a slice the
+// Metric might still use is left alone.
+func sortedLabelPairs(lps []*dto.LabelPair) []*dto.LabelPair {
+	if sort.IsSorted(LabelPairSorter(lps)) {
+		return lps
+	}
+	sorted := make([]*dto.LabelPair, len(lps))
+	copy(sorted, lps)
+	sort.Sort(LabelPairSorter(sorted))
+	return sorted
 }
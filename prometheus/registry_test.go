@@ -21,12 +21,27 @@ package prometheus
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"code.google.com/p/goprotobuf/proto"
+	"github.com/golang/protobuf/proto"
 	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/model"
+	"github.com/prometheus/client_golang/prometheus/internal"
+	"github.com/prometheus/client_golang/text"
 )
 
 type fakeResponseWriter struct {
@@ -58,6 +73,10 @@ func testHandler(t testing.TB) {
 
 	metricVec.WithLabelValues("val1").Inc()
 	metricVec.WithLabelValues("val2").Inc()
+	// Created timestamps vary between runs. Remove them to keep the
+	// expected output below reproducible.
+	metricVec.WithLabelValues("val1").(*counter).createdTs = nil
+	metricVec.WithLabelValues("val2").(*counter).createdTs = nil
 
 	varintBuf := make([]byte, binary.MaxVarintLen32)
 
@@ -439,7 +458,7 @@ metric: <
 		},
 	}
 	for i, scenario := range scenarios {
-		registry := newRegistry()
+		registry := NewRegistry()
 		registry.collectChecksEnabled = true
 
 		if scenario.withCounter {
@@ -478,6 +497,427 @@ metric: <
 	}
 }
 
+func TestUnregister(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter(CounterOpts{
+		Name: "test_counter",
+		Help: "test help",
+	})
+	if err := r.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Unregister(c) {
+		t.Fatal("expected counter to be unregistered")
+	}
+	if r.Unregister(c) {
+		t.Error("unregistering the counter a second time unexpectedly succeeded")
+	}
+
+	var buf bytes.Buffer
+	if _, err := writeGathered(&buf, r, text.MetricFamilyToText); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "" {
+		t.Errorf("expected no exposition after unregistering, got %q", got)
+	}
+
+	// The descriptors have been freed, so an equal counter can be
+	// registered again.
+	if err := r.Register(NewCounter(CounterOpts{
+		Name: "test_counter",
+		Help: "test help",
+	})); err != nil {
+		t.Errorf("registering an equal counter after unregistering failed: %s", err)
+	}
+}
+
+func TestMustRegisterVariadic(t *testing.T) {
+	r := NewRegistry()
+	c1 := NewCounter(CounterOpts{Name: "test_counter_1", Help: "test help"})
+	c2 := NewCounter(CounterOpts{Name: "test_counter_2", Help: "test help"})
+	g := NewGauge(GaugeOpts{Name: "test_gauge", Help: "test help"})
+	r.MustRegister(c1, c2, g)
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 3; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+
+	// Registration stops at the first failure, i.e. the Collectors after
+	// the duplicate are not registered.
+	c3 := NewCounter(CounterOpts{Name: "test_counter_3", Help: "test help"})
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic upon duplicate registration")
+			}
+		}()
+		r.MustRegister(c1, c3)
+	}()
+	if r.Unregister(c3) {
+		t.Error("collector after the duplicate was unexpectedly registered")
+	}
+}
+
+// streamingCollector creates its descriptors and metrics on the fly while
+// sending them, as a Collector proxying many upstream metrics would do.
+type streamingCollector struct {
+	n int
+}
+
+func (c streamingCollector) desc(i int) *Desc {
+	return NewDesc(fmt.Sprintf("streamed_metric_%d", i), "test help", nil, nil)
+}
+
+func (c streamingCollector) Describe(ch chan<- *Desc) {
+	for i := 0; i < c.n; i++ {
+		ch <- c.desc(i)
+	}
+}
+
+func (c streamingCollector) Collect(ch chan<- Metric) {
+	for i := 0; i < c.n; i++ {
+		ch <- MustNewConstMetric(c.desc(i), GaugeValue, float64(i))
+	}
+}
+
+func TestStreamingDescribe(t *testing.T) {
+	const n = 10000
+	r := NewRegistry()
+	c := streamingCollector{n: n}
+	if err := r.Register(c); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(mfs); got != n {
+		t.Errorf("got %d metric families, want %d", got, n)
+	}
+	if !r.Unregister(c) {
+		t.Error("expected streaming collector to be unregistered")
+	}
+}
+
+func TestRegistryIsolation(t *testing.T) {
+	r1, r2 := NewRegistry(), NewRegistry()
+	c1 := NewCounter(CounterOpts{Name: "test_counter", Help: "test help"})
+	c2 := NewCounter(CounterOpts{Name: "test_counter", Help: "test help"})
+	// Equal collectors can be registered with different registries.
+	if err := r1.Register(c1); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.Register(c2); err != nil {
+		t.Fatal(err)
+	}
+	c1.Inc()
+	c1.(*counter).createdTs = nil
+	c2.(*counter).createdTs = nil
+
+	for i, s := range []struct {
+		r    *Registry
+		want string
+	}{
+		{r1, "# HELP test_counter test help\n# TYPE test_counter counter\ntest_counter 1\n"},
+		{r2, "# HELP test_counter test help\n# TYPE test_counter counter\ntest_counter 0\n"},
+	} {
+		writer := &fakeResponseWriter{header: http.Header{}}
+		request, _ := http.NewRequest("GET", "/", nil)
+		HandlerFor(s.r).ServeHTTP(writer, request)
+		if got := writer.body.String(); got != s.want {
+			t.Errorf("%d. expected %q, got %q", i, s.want, got)
+		}
+	}
+}
+
+func TestGather(t *testing.T) {
+	r := NewRegistry()
+	vec := NewGaugeVec(GaugeOpts{Name: "b_gauge", Help: "test help"}, []string{"l"})
+	vec.WithLabelValues("y").Set(2)
+	vec.WithLabelValues("x").Set(1)
+	r.MustRegister(vec)
+	r.MustRegister(NewGauge(GaugeOpts{Name: "a_gauge", Help: "test help"}))
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs), 2; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	if got, want := mfs[0].GetName(), "a_gauge"; got != want {
+		t.Errorf("got first metric family %q, want %q", got, want)
+	}
+	if got, want := mfs[1].GetName(), "b_gauge"; got != want {
+		t.Errorf("got second metric family %q, want %q", got, want)
+	}
+	if got, want := mfs[1].Metric[0].Label[0].GetValue(), "x"; got != want {
+		t.Errorf("got first label value %q, want %q", got, want)
+	}
+
+	// The result is owned by the caller and must not affect later calls.
+	mfs[1].Metric = nil
+	if mfs, err = r.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(mfs[1].Metric), 2; got != want {
+		t.Errorf("got %d metrics after modifying a previous result, want %d", got, want)
+	}
+}
+
+func TestHandlerForGatherer(t *testing.T) {
+	mf := &dto.MetricFamily{
+		Name: proto.String("external"),
+		Help: proto.String("external help"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			{Gauge: &dto.Gauge{Value: proto.Float64(3)}},
+		},
+	}
+	var gatherErr error
+	handler := HandlerFor(GathererFunc(func() ([]*dto.MetricFamily, error) {
+		if gatherErr != nil {
+			return nil, gatherErr
+		}
+		return []*dto.MetricFamily{mf}, nil
+	}))
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(writer, request)
+	if got, want := writer.Body.String(), "# HELP external external help\n# TYPE external gauge\nexternal 3\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	gatherErr = errors.New("gather failed")
+	writer = httptest.NewRecorder()
+	handler.ServeHTTP(writer, request)
+	if got, want := writer.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("got status code %d, want %d", got, want)
+	}
+}
+
+func TestGatherers(t *testing.T) {
+	newVec := func(value string) *GaugeVec {
+		vec := NewGaugeVec(GaugeOpts{Name: "shared", Help: "shared help"}, []string{"source"})
+		vec.WithLabelValues(value).Set(1)
+		return vec
+	}
+	app, lib := NewRegistry(), NewRegistry()
+	app.MustRegister(newVec("app"))
+	lib.MustRegister(newVec("lib"))
+	lib.MustRegister(NewGauge(GaugeOpts{Name: "lib_only", Help: "lib help"}))
+
+	mfs, err := Gatherers{app, lib}.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		text.MetricFamilyToText(&buf, mf)
+	}
+	want := `# HELP lib_only lib help
+# TYPE lib_only gauge
+lib_only 0
+# HELP shared shared help
+# TYPE shared gauge
+shared{source="app"} 1
+shared{source="lib"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	inconsistent := GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{{
+			Name: proto.String("shared"),
+			Help: proto.String("other help"),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{
+				{Gauge: &dto.Gauge{Value: proto.Float64(2)}},
+			},
+		}}, nil
+	})
+	failing := GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return nil, errors.New("gather failed")
+	})
+	mfs, err = Gatherers{app, lib, app, inconsistent, failing}.Gather()
+	if err == nil {
+		t.Fatal("expected error, got none")
+	}
+	for _, want := range []string{
+		"3 error(s) occurred",
+		"gathered metric shared ",
+		"was gathered before with the same name and label pairs",
+		`has help "other help" but should have "shared help"`,
+		"[from Gatherer #5] gather failed",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %q", want, err)
+		}
+	}
+	// The consistent part is still returned.
+	if got, want := len(mfs), 2; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	if got, want := len(mfs[1].Metric), 2; got != want {
+		t.Errorf("got %d merged metrics, want %d", got, want)
+	}
+}
+
+// staticCollector is a Collector that describes and collects a fixed set of
+// Descs and Metrics, even if they do not match.
+type staticCollector struct {
+	descs   []*Desc
+	metrics []Metric
+}
+
+func (c *staticCollector) Describe(ch chan<- *Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+func (c *staticCollector) Collect(ch chan<- Metric) {
+	for _, m := range c.metrics {
+		ch <- m
+	}
+}
+
+func TestPedanticRegistry(t *testing.T) {
+	descA := NewDesc("test_a", "help", nil, nil)
+	descB := NewDesc("test_b", "help", nil, nil)
+	histDesc := NewDesc("test_histogram", "help", nil, nil)
+
+	scenarios := []struct {
+		collectors []Collector
+		wantErr    string
+	}{
+		{
+			collectors: []Collector{
+				&staticCollector{
+					descs:   []*Desc{descA},
+					metrics: []Metric{MustNewConstMetric(descA, CounterValue, 1)},
+				},
+			},
+		},
+		{
+			// The collected Desc is registered, but by another
+			// Collector.
+			collectors: []Collector{
+				&staticCollector{
+					descs:   []*Desc{descA},
+					metrics: []Metric{MustNewConstMetric(descB, GaugeValue, 1)},
+				},
+				&staticCollector{descs: []*Desc{descB}},
+			},
+			wantErr: "has not been provided by the Describe method",
+		},
+		{
+			collectors: []Collector{
+				&staticCollector{
+					descs:   []*Desc{descA},
+					metrics: []Metric{MustNewConstMetric(descA, CounterValue, -1)},
+				},
+			},
+			wantErr: "has invalid value -1",
+		},
+		{
+			collectors: []Collector{
+				&staticCollector{
+					descs: []*Desc{histDesc},
+					metrics: []Metric{MustNewConstHistogram(
+						histDesc, 5, 10, map[float64]uint64{1: 3, 2: 2},
+					)},
+				},
+			},
+			wantErr: "inconsistent bucket counts",
+		},
+		{
+			collectors: []Collector{
+				&staticCollector{
+					descs: []*Desc{NewDesc("test_vec", "help", []string{"l"}, nil)},
+					metrics: []Metric{MustNewConstMetric(
+						NewDesc("test_vec", "help", []string{"l"}, nil),
+						GaugeValue, 1, "\xff",
+					)},
+				},
+			},
+			wantErr: "not valid UTF-8",
+		},
+	}
+
+	for i, s := range scenarios {
+		r := NewPedanticRegistry()
+		for _, c := range s.collectors {
+			if err := r.Register(c); err != nil {
+				t.Fatalf("%d. unexpected registration error: %s", i, err)
+			}
+		}
+		_, err := r.Gather()
+		switch {
+		case s.wantErr == "" && err != nil:
+			t.Errorf("%d. unexpected error: %s", i, err)
+		case s.wantErr != "" && err == nil:
+			t.Errorf("%d. expected error containing %q, got none", i, s.wantErr)
+		case s.wantErr != "" && !strings.Contains(err.Error(), s.wantErr):
+			t.Errorf("%d. expected error containing %q, got %q", i, s.wantErr, err)
+		}
+	}
+
+	// A regular Registry does not notice any of the above.
+	r := NewRegistry()
+	r.MustRegister(&staticCollector{
+		descs:   []*Desc{descA},
+		metrics: []Metric{MustNewConstMetric(descA, CounterValue, -1)},
+	})
+	if _, err := r.Gather(); err != nil {
+		t.Errorf("unexpected error from regular registry: %s", err)
+	}
+}
+
+func TestAlreadyRegisteredError(t *testing.T) {
+	r := NewRegistry()
+	existing := NewCounter(CounterOpts{Name: "test", Help: "help"})
+	r.MustRegister(existing)
+
+	duplicate := NewCounter(CounterOpts{Name: "test", Help: "help"})
+	err := r.Register(duplicate)
+	are, ok := err.(AlreadyRegisteredError)
+	if !ok {
+		t.Fatalf("expected AlreadyRegisteredError, got %v", err)
+	}
+	if are.ExistingCollector != existing {
+		t.Error("unexpected existing collector in error")
+	}
+	if are.NewCollector != duplicate {
+		t.Error("unexpected new collector in error")
+	}
+
+	// The same works through a wrapping Registerer, yielding the unwrapped
+	// Collectors.
+	wrapped := WrapRegistererWith(Labels{"shard": "1"}, NewRegistry())
+	wrapped.MustRegister(existing)
+	err = wrapped.Register(duplicate)
+	if are, ok = err.(AlreadyRegisteredError); !ok {
+		t.Fatalf("expected AlreadyRegisteredError, got %v", err)
+	}
+	if are.ExistingCollector != existing {
+		t.Error("unexpected existing collector in error from wrapping registerer")
+	}
+	if are.NewCollector != duplicate {
+		t.Error("unexpected new collector in error from wrapping registerer")
+	}
+
+	if got, err := r.RegisterOrGet(duplicate); err != nil || got != existing {
+		t.Errorf("RegisterOrGet returned %v, %v; want the existing collector", got, err)
+	}
+}
+
 func TestHandler(t *testing.T) {
 	testHandler(t)
 }
@@ -487,3 +927,681 @@ func BenchmarkHandler(b *testing.B) {
 		testHandler(b)
 	}
 }
+
+func TestUncheckedCollector(t *testing.T) {
+	descA := NewDesc("test_a", "help", nil, nil)
+	descB := NewDesc("test_b", "help", []string{"l"}, nil)
+	unchecked := &staticCollector{
+		metrics: []Metric{
+			MustNewConstMetric(descA, GaugeValue, 1),
+			MustNewConstMetric(descB, GaugeValue, 2, "x"),
+		},
+	}
+
+	r := NewPedanticRegistry()
+	if err := r.Register(unchecked); err != nil {
+		t.Fatalf("unexpected error registering unchecked collector: %s", err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got, want := len(mfs), 2; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	if r.Unregister(unchecked) {
+		t.Error("unchecked collector was unexpectedly unregistered")
+	}
+
+	// The remaining consistency checks still apply to unchecked metrics.
+	r.MustRegister(&staticCollector{
+		descs:   []*Desc{NewDesc("test_c", "help", nil, nil)},
+		metrics: []Metric{MustNewConstMetric(NewDesc("test_c", "help", nil, nil), GaugeValue, 1)},
+	})
+	r.MustRegister(&staticCollector{
+		metrics: []Metric{MustNewConstMetric(NewDesc("test_c", "other help", nil, nil), GaugeValue, 1)},
+	})
+	if _, err := r.Gather(); err == nil || !strings.Contains(err.Error(), "has help") {
+		t.Errorf("expected help inconsistency error, got %v", err)
+	}
+}
+
+// slowCollector collects a single gauge after a delay and keeps track of how
+// many slowCollectors are collecting at the same time.
+type slowCollector struct {
+	desc           *Desc
+	active, maxAct *int32
+}
+
+func (c slowCollector) Describe(ch chan<- *Desc) {
+	ch <- c.desc
+}
+
+func (c slowCollector) Collect(ch chan<- Metric) {
+	n := atomic.AddInt32(c.active, 1)
+	for {
+		max := atomic.LoadInt32(c.maxAct)
+		if n <= max || atomic.CompareAndSwapInt32(c.maxAct, max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(c.active, -1)
+	ch <- MustNewConstMetric(c.desc, GaugeValue, 1)
+}
+
+func TestCollectConcurrency(t *testing.T) {
+	const numCollectors, limit = 6, 2
+	var active, maxActive int32
+
+	r := NewRegistry()
+	r.SetCollectConcurrency(limit)
+	for i := numCollectors - 1; i >= 0; i-- {
+		r.MustRegister(slowCollector{
+			desc:   NewDesc(fmt.Sprintf("test_slow_%d", i), "help", nil, nil),
+			active: &active,
+			maxAct: &maxActive,
+		})
+	}
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&maxActive); got > limit {
+		t.Errorf("got %d concurrent collections, want at most %d", got, limit)
+	}
+	if got, want := len(mfs), numCollectors; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	for i, mf := range mfs {
+		if got, want := mf.GetName(), fmt.Sprintf("test_slow_%d", i); got != want {
+			t.Errorf("%d. got metric family %q, want %q", i, got, want)
+		}
+	}
+}
+
+// blockingCollector sends a first metric and then blocks until released.
+type blockingCollector struct {
+	desc    *Desc
+	release chan struct{}
+}
+
+func (c blockingCollector) Describe(ch chan<- *Desc) {
+	ch <- c.desc
+}
+
+func (c blockingCollector) Collect(ch chan<- Metric) {
+	ch <- MustNewConstMetric(c.desc, GaugeValue, 1, "first")
+	<-c.release
+	ch <- MustNewConstMetric(c.desc, GaugeValue, 2, "second")
+}
+
+func TestCollectTimeout(t *testing.T) {
+	blocking := blockingCollector{
+		desc:    NewDesc("test_blocking", "help", []string{"l"}, nil),
+		release: make(chan struct{}),
+	}
+	defer close(blocking.release)
+
+	r := NewRegistry()
+	r.SetCollectTimeout(50 * time.Millisecond)
+	r.MustRegister(blocking)
+	r.MustRegister(NewGauge(GaugeOpts{Name: "test_gauge", Help: "help"}))
+
+	mfs, err := r.Gather()
+	multiErr, ok := err.(MultiError)
+	if !ok || len(multiErr) != 1 {
+		t.Fatalf("expected MultiError with one error, got %v", err)
+	}
+	timeoutErr, ok := multiErr[0].(CollectTimeoutError)
+	if !ok {
+		t.Fatalf("expected CollectTimeoutError, got %v", multiErr[0])
+	}
+	if timeoutErr.Collector != Collector(blocking) {
+		t.Errorf("unexpected collector in timeout error: %v", timeoutErr.Collector)
+	}
+
+	// The metrics collected before the timeout are still returned.
+	if got, want := len(mfs), 2; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	if got, want := mfs[0].GetName(), "test_blocking"; got != want {
+		t.Errorf("got metric family %q, want %q", got, want)
+	}
+	if got, want := len(mfs[0].Metric), 1; got != want {
+		t.Errorf("got %d metrics from blocking collector, want %d", got, want)
+	}
+}
+
+// latePanickingCollector panics once released, i.e. typically after the
+// Registry has given up on it.
+type latePanickingCollector struct {
+	desc     *Desc
+	release  chan struct{}
+	panicked chan struct{}
+}
+
+func (c latePanickingCollector) Describe(ch chan<- *Desc) {
+	ch <- c.desc
+}
+
+func (c latePanickingCollector) Collect(ch chan<- Metric) {
+	<-c.release
+	defer close(c.panicked)
+	panic("collector is buggy")
+}
+
+// TestCollectTimeoutLatePanic is best run with -race, as the late panic is
+// recovered concurrently with the end of Gather.
+func TestCollectTimeoutLatePanic(t *testing.T) {
+	late := latePanickingCollector{
+		desc:     NewDesc("test_late", "help", nil, nil),
+		release:  make(chan struct{}),
+		panicked: make(chan struct{}),
+	}
+
+	r := NewRegistry()
+	r.SetCollectTimeout(10 * time.Millisecond)
+	r.MustRegister(late)
+
+	// Release the collector while Gather is about to return.
+	time.AfterFunc(20*time.Millisecond, func() { close(late.release) })
+	_, err := r.Gather()
+	<-late.panicked
+	// Give the recovery of the panic a moment to report its error.
+	time.Sleep(10 * time.Millisecond)
+
+	multiErr, ok := err.(MultiError)
+	if !ok || len(multiErr) != 1 {
+		t.Fatalf("expected MultiError with one error, got %v", err)
+	}
+	if _, ok := multiErr[0].(CollectTimeoutError); !ok {
+		t.Errorf("expected CollectTimeoutError, got %v", multiErr[0])
+	}
+}
+
+func TestGatherMultiError(t *testing.T) {
+	descA := NewDesc("test_a", "help", nil, nil)
+	errA := errors.New("metric a is broken")
+	descB := NewDesc("test_b", "help", nil, nil)
+	errB := errors.New("metric b is broken")
+	descC := NewDesc("test_c", "help", nil, nil)
+
+	r := NewRegistry()
+	r.MustRegister(&staticCollector{
+		descs:   []*Desc{descA},
+		metrics: []Metric{NewInvalidMetric(descA, errA)},
+	})
+	r.MustRegister(&staticCollector{
+		descs:   []*Desc{descB},
+		metrics: []Metric{NewInvalidMetric(descB, errB)},
+	})
+	r.MustRegister(&staticCollector{
+		descs:   []*Desc{descC},
+		metrics: []Metric{MustNewConstMetric(descC, GaugeValue, 1)},
+	})
+
+	mfs, err := r.Gather()
+	multiErr, ok := err.(MultiError)
+	if !ok {
+		t.Fatalf("expected MultiError, got %v", err)
+	}
+	if got, want := len(multiErr), 2; got != want {
+		t.Fatalf("got %d errors, want %d", got, want)
+	}
+	for _, want := range []error{errA, errB} {
+		if !errors.Is(err, want) {
+			t.Errorf("expected %q to be among the errors", want)
+		}
+	}
+	descs := map[*Desc]bool{}
+	for _, e := range multiErr {
+		var collectErr CollectError
+		if !errors.As(e, &collectErr) {
+			t.Fatalf("expected CollectError, got %v", e)
+		}
+		descs[collectErr.Desc] = true
+	}
+	if !descs[descA] || !descs[descB] {
+		t.Errorf("errors not attributed to the offending descriptors: %v", multiErr)
+	}
+
+	// The healthy metric is still gathered.
+	if got, want := len(mfs), 1; got != want {
+		t.Fatalf("got %d metric families, want %d", got, want)
+	}
+	if got, want := mfs[0].GetName(), "test_c"; got != want {
+		t.Errorf("got metric family %q, want %q", got, want)
+	}
+
+	if got := (MultiError{}).MaybeUnwrap(); got != nil {
+		t.Errorf("expected nil from empty MultiError, got %v", got)
+	}
+	if got := (MultiError{errA}).MaybeUnwrap(); got != errA {
+		t.Errorf("expected single error, got %v", got)
+	}
+	if got := (MultiError{errA, errB}).MaybeUnwrap(); !reflect.DeepEqual(got, MultiError{errA, errB}) {
+		t.Errorf("expected MultiError, got %v", got)
+	}
+}
+
+// panickingCollector sends one metric and panics afterwards.
+type panickingCollector struct {
+	desc *Desc
+}
+
+func (c panickingCollector) Describe(ch chan<- *Desc) {
+	ch <- c.desc
+}
+
+func (c panickingCollector) Collect(ch chan<- Metric) {
+	ch <- MustNewConstMetric(c.desc, GaugeValue, 1, "before")
+	panic("collector is buggy")
+}
+
+func TestCollectPanic(t *testing.T) {
+	panicking := panickingCollector{desc: NewDesc("test_panicking", "help", []string{"l"}, nil)}
+
+	for _, r := range []*Registry{NewRegistry(), NewPedanticRegistry()} {
+		r.MustRegister(panicking)
+		r.MustRegister(NewGauge(GaugeOpts{Name: "test_gauge", Help: "help"}))
+
+		mfs, err := r.Gather()
+		var panicErr CollectPanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatalf("expected CollectPanicError, got %v", err)
+		}
+		if panicErr.Collector != Collector(panicking) {
+			t.Errorf("unexpected collector in panic error: %v", panicErr.Collector)
+		}
+		if got, want := panicErr.Value, "collector is buggy"; got != want {
+			t.Errorf("got panic value %v, want %v", got, want)
+		}
+		if got, want := len(mfs), 2; got != want {
+			t.Errorf("got %d metric families, want %d", got, want)
+		}
+	}
+}
+
+func TestRegisterDescConflicts(t *testing.T) {
+	existing := NewDesc("test_metric", "help", []string{"a"}, Labels{"c": "1"})
+
+	scenarios := []struct {
+		collector Collector
+		wantDescs []*Desc
+	}{
+		{
+			// Same fqName and const labels, but a different collector.
+			collector: &staticCollector{descs: []*Desc{
+				NewDesc("test_metric", "help", []string{"a"}, Labels{"c": "1"}),
+				NewDesc("test_other", "help", nil, nil),
+			}},
+			wantDescs: []*Desc{existing},
+		},
+		{
+			// Same fqName, but different label names.
+			collector: &staticCollector{descs: []*Desc{
+				NewDesc("test_metric", "help", []string{"b"}, Labels{"c": "2"}),
+			}},
+			wantDescs: []*Desc{existing},
+		},
+		{
+			// Same fqName, but a different help string.
+			collector: &staticCollector{descs: []*Desc{
+				NewDesc("test_metric", "other help", []string{"a"}, Labels{"c": "2"}),
+			}},
+			wantDescs: []*Desc{existing},
+		},
+		{
+			// Inconsistent descriptors within the new collector.
+			collector: &staticCollector{descs: []*Desc{
+				NewDesc("test_new", "help", []string{"a"}, nil),
+				NewDesc("test_new", "help", []string{"b"}, nil),
+			}},
+			wantDescs: []*Desc{
+				NewDesc("test_new", "help", []string{"a"}, nil),
+				NewDesc("test_new", "help", []string{"b"}, nil),
+			},
+		},
+	}
+
+	for i, s := range scenarios {
+		r := NewRegistry()
+		r.MustRegister(&staticCollector{descs: []*Desc{existing}})
+		err := r.Register(s.collector)
+		if err == nil {
+			t.Errorf("%d. expected registration error, got none", i)
+			continue
+		}
+		for _, desc := range s.wantDescs {
+			if !strings.Contains(err.Error(), desc.String()) {
+				t.Errorf("%d. expected error %q to name descriptor %s", i, err, desc)
+			}
+		}
+	}
+}
+
+func TestWriteToTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_write_to_textfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "metrics.prom")
+
+	r := NewRegistry()
+	vec := NewGaugeVec(GaugeOpts{Name: "test_gauge", Help: "help with \\ and\nnewline"}, []string{"l"})
+	vec.WithLabelValues(`value with "quotes"`).Set(1)
+	r.MustRegister(vec)
+
+	if err := WriteToTextfile(filename, r); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_gauge help with \\ and\nnewline
+# TYPE test_gauge gauge
+test_gauge{l="value with \"quotes\""} 1
+`
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files in directory, want 1", len(files))
+	}
+}
+
+func TestHandlerOpenMetrics(t *testing.T) {
+	r := NewRegistry()
+	c := NewCounter(CounterOpts{Name: "test_total", Help: "help"})
+	c.(*counter).createdTs = nil
+	r.MustRegister(c)
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	HandlerFor(r).ServeHTTP(writer, request)
+	if got, want := writer.Header().Get(contentTypeHeader), OpenMetricsTelemetryContentType; got != want {
+		t.Errorf("got content type %q, want %q", got, want)
+	}
+	want := "# HELP test help\n# TYPE test counter\ntest_total 0.0\n# EOF\n"
+	if got := writer.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestContentTypesInSync(t *testing.T) {
+	scenarios := []struct{ got, want string }{
+		{DelimitedTelemetryContentType, internal.DelimitedTelemetryContentType},
+		{TextTelemetryContentType, internal.TextTelemetryContentType},
+		{ProtoTextTelemetryContentType, internal.ProtoTextTelemetryContentType},
+		{ProtoCompactTextTelemetryContentType, internal.ProtoCompactTextTelemetryContentType},
+		{OpenMetricsTelemetryContentType, internal.OpenMetricsTelemetryContentType},
+		{JSONTelemetryContentType, internal.JSONTelemetryContentType},
+	}
+	for i, s := range scenarios {
+		if s.got != s.want {
+			t.Errorf("%d. got content type %q, want %q", i, s.got, s.want)
+		}
+	}
+}
+
+func TestHandlerUTF8Names(t *testing.T) {
+	defer func(s model.ValidationScheme) { model.NameValidationScheme = s }(model.NameValidationScheme)
+	model.NameValidationScheme = model.UTF8Validation
+
+	vec := NewGaugeVec(
+		GaugeOpts{Name: "test.gauge", Help: "help"},
+		[]string{"label.name"},
+	)
+	vec.WithLabelValues("value").Set(1)
+	r := NewRegistry()
+	r.MustRegister(vec, NewGauge(GaugeOpts{Name: "legacy_gauge", Help: "help"}))
+
+	scenarios := []struct {
+		accept string
+		want   string
+	}{
+		{
+			accept: "text/plain;version=0.0.4;escaping=allow-utf-8",
+			want: `# HELP legacy_gauge help
+# TYPE legacy_gauge gauge
+legacy_gauge 0
+# HELP "test.gauge" help
+# TYPE "test.gauge" gauge
+{"test.gauge","label.name"="value"} 1
+`,
+		},
+		{
+			accept: "text/plain;version=0.0.4",
+			want: `# HELP legacy_gauge help
+# TYPE legacy_gauge gauge
+legacy_gauge 0
+# HELP test_gauge help
+# TYPE test_gauge gauge
+test_gauge{label_name="value"} 1
+`,
+		},
+		{
+			accept: "text/plain;version=0.0.4;escaping=values",
+			want: `# HELP legacy_gauge help
+# TYPE legacy_gauge gauge
+legacy_gauge 0
+# HELP U__test_2e_gauge help
+# TYPE U__test_2e_gauge gauge
+U__test_2e_gauge{U__label_2e_name="value"} 1
+`,
+		},
+	}
+	for i, s := range scenarios {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept", s.accept)
+		r.ServeHTTP(writer, request)
+		if got := writer.Body.String(); got != s.want {
+			t.Errorf("%d. got %q, want %q", i, got, s.want)
+		}
+	}
+}
+
+func TestHandlerCompression(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(NewGauge(GaugeOpts{Name: "test_gauge", Help: "help"}))
+	want := "# HELP test_gauge help\n# TYPE test_gauge gauge\ntest_gauge 0\n"
+
+	serve := func() *httptest.ResponseRecorder {
+		writer := httptest.NewRecorder()
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Encoding", "deflate, gzip;q=0.9")
+		r.ServeHTTP(writer, request)
+		return writer
+	}
+
+	// Serve twice to exercise the reuse of pooled gzip.Writers.
+	for i := 0; i < 2; i++ {
+		writer := serve()
+		if got := writer.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("%d. got content encoding %q, want gzip", i, got)
+		}
+		gz, err := gzip.NewReader(writer.Body)
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		got, err := ioutil.ReadAll(gz)
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		if string(got) != want {
+			t.Errorf("%d. got %q, want %q", i, got, want)
+		}
+	}
+
+	r.DisableCompression(true)
+	writer := serve()
+	if got := writer.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("got content encoding %q with compression disabled", got)
+	}
+	if got := writer.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// unsortedMetric writes its label pairs in reverse order of their names.
+type unsortedMetric struct {
+	desc        *Desc
+	labelPairs  []*dto.LabelPair
+	timestampMs int64
+}
+
+func (m unsortedMetric) Desc() *Desc {
+	return m.desc
+}
+
+func (m unsortedMetric) Write(out *dto.Metric) error {
+	out.Label = m.labelPairs
+	out.Gauge = &dto.Gauge{Value: proto.Float64(1)}
+	if m.timestampMs != 0 {
+		out.TimestampMs = proto.Int64(m.timestampMs)
+	}
+	return nil
+}
+
+func TestGatherSorting(t *testing.T) {
+	desc := NewDesc("test_metric", "help", []string{"b", "a"}, nil)
+	newMetric := func(a, b string, ts int64) Metric {
+		return unsortedMetric{
+			desc: desc,
+			labelPairs: []*dto.LabelPair{
+				{Name: proto.String("b"), Value: proto.String(b)},
+				{Name: proto.String("a"), Value: proto.String(a)},
+			},
+			timestampMs: ts,
+		}
+	}
+	metrics := []Metric{
+		newMetric("2", "1", 0),
+		newMetric("1", "2", 5),
+		newMetric("1", "2", 3),
+		newMetric("1", "1", 0),
+		newMetric("1", "2", 0),
+	}
+	sortedPairs := func(mfs []*dto.MetricFamily) string {
+		var got []string
+		for _, m := range mfs[0].Metric {
+			var lps []string
+			for _, lp := range m.Label {
+				lps = append(lps, lp.GetName()+"="+lp.GetValue())
+			}
+			got = append(got, fmt.Sprintf("%s@%d", strings.Join(lps, ","), m.GetTimestampMs()))
+		}
+		return strings.Join(got, " ")
+	}
+
+	r := NewRegistry()
+	r.MustRegister(&staticCollector{descs: []*Desc{desc}, metrics: metrics})
+	r.MustRegister(&staticCollector{
+		descs:   []*Desc{NewDesc("another_metric", "help", nil, nil)},
+		metrics: []Metric{MustNewConstMetric(NewDesc("another_metric", "help", nil, nil), GaugeValue, 1)},
+	})
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 2 || mfs[0].GetName() != "another_metric" || mfs[1].GetName() != "test_metric" {
+		t.Fatalf("got unsorted MetricFamilies %v", mfs)
+	}
+	want := "a=1,b=1@0 a=1,b=2@0 a=1,b=2@3 a=1,b=2@5 a=2,b=1@0"
+	if got := sortedPairs(mfs[1:]); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	// The label pairs of the Metric itself are left alone.
+	if got := metrics[0].(unsortedMetric).labelPairs[0].GetName(); got != "b" {
+		t.Errorf("label pairs of the collected Metric were reordered")
+	}
+
+	r.DisableSorting(true)
+	mfs, err = r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "b=1,a=2@0 b=2,a=1@5 b=2,a=1@3 b=1,a=1@0 b=2,a=1@0"
+	if got := sortedPairs(mfs[1:]); got != want {
+		t.Errorf("with sorting disabled, got %s, want %s", got, want)
+	}
+}
+
+func TestUnit(t *testing.T) {
+	for i, unit := range []string{"Seconds", "_bytes", "bytes_", "1bytes", "by.tes"} {
+		desc := NewDescWithUnit("test_metric", "help", unit, nil, nil)
+		if !strings.Contains(NewRegistry().Register(&staticCollector{descs: []*Desc{desc}}).Error(), "not a valid unit") {
+			t.Errorf("%d. expected unit %q to be invalid", i, unit)
+		}
+	}
+
+	r := NewRegistry()
+	hist := NewHistogram(HistogramOpts{
+		Name:    "request_duration_seconds",
+		Help:    "help",
+		Unit:    "seconds",
+		Buckets: []float64{1},
+	})
+	if err := r.Register(hist); err != nil {
+		t.Fatal(err)
+	}
+	// Same name, different unit.
+	err := r.Register(NewGauge(GaugeOpts{
+		Name: "request_duration_seconds",
+		Help: "help",
+		Unit: "milliseconds",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "different unit") {
+		t.Errorf("got error %v, want error about different unit", err)
+	}
+
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mfs[0].GetUnit(); got != "seconds" {
+		t.Errorf("got unit %q, want %q", got, "seconds")
+	}
+
+	writer := httptest.NewRecorder()
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	r.ServeHTTP(writer, request)
+	if got, want := writer.Body.String(), "# UNIT request_duration_seconds seconds\n"; !strings.Contains(got, want) {
+		t.Errorf("got %q, want it to contain %q", got, want)
+	}
+
+	r.EnableUnitSuffixChecks(true)
+	if err := r.Register(NewCounter(CounterOpts{
+		Name: "sent_bytes_total",
+		Help: "help",
+		Unit: "bytes",
+	})); err != nil {
+		t.Errorf("unexpected error for name with unit suffix: %s", err)
+	}
+	if err := r.Register(NewGauge(GaugeOpts{
+		Name: "memory_usage",
+		Help: "help",
+		Unit: "bytes",
+	})); err == nil {
+		t.Error("expected error for name without unit suffix")
+	}
+	if err := r.Register(NewGauge(GaugeOpts{
+		Name: "memory_usage",
+		Help: "help",
+	})); err != nil {
+		t.Errorf("unexpected error for name without unit: %s", err)
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statsd provides a bridge to push the metrics of a Prometheus
+// Gatherer to a StatsD or DogStatsD agent. It is meant for environments whose
+// only metrics sink is a StatsD agent, so that libraries instrumented with
+// Prometheus can be used there nonetheless.
+//
+// Summaries and histograms are expanded into their quantiles or buckets, their
+// sum, and their count, in the same way as in the text format. StatsD counters
+// are increments, so the bridge keeps the last pushed value of each counter
+// sample and sends the difference. This applies to counters and to the
+// buckets, sums, and counts of histograms and summaries. All other samples
+// are sent as gauges. In plain StatsD, a negative gauge value would be applied
+// as a decrement, so the gauge is set to 0 right before.
+//
+// With the DogStatsD flavor, labels are sent as tags:
+//     <prefix>.<name>:<value>|<type>|#<label name>:<label value>,...
+// Plain StatsD has no tags, so labels are flattened into the name instead:
+//     <prefix>.<name>.<label name>.<label value>...:<value>|<type>
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/internal"
+)
+
+const defaultMaxPacketSize = 1432 // Fits into an Ethernet frame with IPv6 headers.
+
+// Flavor selects the dialect of the StatsD protocol.
+type Flavor int
+
+// The supported flavors of the StatsD protocol.
+const (
+	// StatsD is the original protocol without tags.
+	StatsD Flavor = iota
+	// DogStatsD is the Datadog dialect, which supports tags.
+	DogStatsD
+)
+
+// ErrorHandling defines how a Bridge handles errors while gathering.
+type ErrorHandling = internal.ErrorHandling
+
+// These constants cause a Bridge to behave as described if errors are
+// encountered while gathering.
+const (
+	// Push as many metrics as possible. The error is still returned by
+	// Push and logged by Run.
+	ContinueOnError = internal.ContinueOnError
+	// Return the error without pushing anything.
+	AbortOnError = internal.AbortOnError
+)
+
+// Logger is the minimal interface a Bridge needs for logging. Note that
+// log.Logger from the standard library implements this interface.
+type Logger = internal.Logger
+
+// Config defines the StatsD bridge config. It is mandatory to set Addr. All
+// other fields are optional and can safely be left at their zero value.
+type Config struct {
+	// Addr is the UDP address of the StatsD agent in the form "host:port",
+	// e.g. "localhost:8125". Mandatory!
+	Addr string
+
+	// Flavor is the dialect of the protocol. The default is StatsD.
+	Flavor Flavor
+
+	// Prefix is prepended to the name of all metrics, separated by a
+	// ".". If empty, no prefix is used.
+	Prefix string
+
+	// Interval is the time between two pushes of Run. If 0, it defaults
+	// to 15s.
+	Interval time.Duration
+
+	// MaxPacketSize is the maximum size in bytes of a datagram. Several
+	// metrics are sent in one datagram, separated by newlines, as long as
+	// they fit. If 0, it defaults to 1432.
+	MaxPacketSize int
+
+	// Gatherer is the source of the metrics. If nil,
+	// prometheus.DefaultGatherer is used.
+	Gatherer prometheus.Gatherer
+
+	// Logger is used by Run to log the errors of the periodic pushes. If
+	// nil, errors are not logged at all.
+	Logger Logger
+
+	// ErrorHandling defines how errors while gathering are handled.
+	ErrorHandling ErrorHandling
+}
+
+// Bridge pushes metrics to a StatsD agent. Create instances with NewBridge.
+type Bridge struct {
+	addr          string
+	flavor        Flavor
+	prefix        string
+	interval      time.Duration
+	maxPacketSize int
+
+	errorHandling ErrorHandling
+	logger        Logger
+
+	g prometheus.Gatherer
+
+	mtx sync.Mutex // Protects last and serializes pushes.
+	// last contains the last pushed value of each counter sample, keyed
+	// by its line without value.
+	last map[string]float64
+}
+
+// NewBridge returns a pointer to a new Bridge struct based on the provided
+// Config. It returns an error if the Addr is missing or if the Flavor or the
+// ErrorHandling is unknown.
+func NewBridge(c *Config) (*Bridge, error) {
+	if c.Addr == "" {
+		return nil, errors.New("statsd: missing Addr")
+	}
+	switch c.Flavor {
+	case StatsD, DogStatsD:
+	default:
+		return nil, fmt.Errorf("statsd: unknown flavor %d", c.Flavor)
+	}
+	if err := c.ErrorHandling.Check(); err != nil {
+		return nil, fmt.Errorf("statsd: %s", err)
+	}
+
+	b := &Bridge{
+		addr:          c.Addr,
+		flavor:        c.Flavor,
+		prefix:        c.Prefix,
+		interval:      c.Interval,
+		maxPacketSize: c.MaxPacketSize,
+		errorHandling: c.ErrorHandling,
+		logger:        c.Logger,
+		g:             c.Gatherer,
+		last:          map[string]float64{},
+	}
+	if b.interval == 0 {
+		b.interval = internal.DefaultBridgeInterval
+	}
+	if b.maxPacketSize == 0 {
+		b.maxPacketSize = defaultMaxPacketSize
+	}
+	if b.g == nil {
+		b.g = prometheus.DefaultGatherer
+	}
+	return b, nil
+}
+
+// Run starts the event loop that pushes metrics every Interval of the Config
+// until the provided context is done. Errors are logged to the Logger of the
+// Config, if any. Run blocks, so it is usually called in its own goroutine.
+func (b *Bridge) Run(ctx context.Context) {
+	internal.RunBridge(ctx, b.interval, func(context.Context) error { return b.Push() }, b.logger, "error pushing to StatsD:")
+}
+
+// Push gathers the metrics and sends them to the StatsD agent once. With
+// ContinueOnError, the metrics gathered successfully are sent even if
+// gathering returned an error, and that error is returned after sending.
+//
+// As UDP is connectionless, Push usually does not notice if the agent is
+// unreachable.
+func (b *Bridge) Push() error {
+	mfs, gatherErr := internal.GatherForBridge(b.g, b.errorHandling)
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	lines := b.lines(mfs)
+	if len(lines) == 0 {
+		return gatherErr
+	}
+
+	conn, err := net.Dial("udp", b.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, packet := range packets(lines, b.maxPacketSize) {
+		if _, err := conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return gatherErr
+}
+
+// lines returns the StatsD lines for the provided metric families and updates
+// the last pushed values of the counter samples. The caller must hold mtx.
+// Samples with a NaN or infinite value are skipped, as StatsD agents cannot
+// parse them. An element of the result may contain several newline-separated
+// lines that have to be sent in the same datagram.
+func (b *Bridge) lines(mfs []*dto.MetricFamily) []string {
+	var lines []string
+	for _, s := range internal.FlattenMetricFamilies(mfs) {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+		name, tags := b.nameAndTags(s)
+		v, typ := s.Value, "g"
+		if isCounter(s) {
+			key := name + tags
+			last, ok := b.last[key]
+			b.last[key] = v
+			// After a reset, the whole new value is the increment.
+			if ok && v >= last {
+				v -= last
+			}
+			typ = "c"
+		}
+		line := name + ":" + strconv.FormatFloat(v, 'g', -1, 64) + "|" + typ + tags
+		if typ == "g" && v < 0 && b.flavor == StatsD {
+			// In plain StatsD, a signed gauge value changes the
+			// gauge rather than setting it. Set it to 0 first, in
+			// the same datagram so that the order is kept.
+			line = name + ":0|g\n" + line
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// nameAndTags returns the metric name of the provided sample, including the
+// prefix, and the tag suffix of the line (empty for the StatsD flavor).
+func (b *Bridge) nameAndTags(s internal.Sample) (string, string) {
+	name := sanitize(s.Name)
+	if b.prefix != "" {
+		name = b.prefix + "." + name
+	}
+	if b.flavor != DogStatsD {
+		for _, lp := range s.Labels {
+			name += "." + sanitize(lp.Name) + "." + sanitize(lp.Value)
+		}
+		return name, ""
+	}
+	if len(s.Labels) == 0 {
+		return name, ""
+	}
+	tags := make([]string, len(s.Labels))
+	for i, lp := range s.Labels {
+		tags[i] = lp.Name + ":" + sanitizeTag(lp.Value)
+	}
+	return name, "|#" + strings.Join(tags, ",")
+}
+
+// isCounter returns whether the provided sample only ever goes up, so that it
+// has to be sent as a StatsD counter.
+func isCounter(s internal.Sample) bool {
+	switch s.Type {
+	case dto.MetricType_COUNTER:
+		return true
+	case dto.MetricType_SUMMARY:
+		// The quantiles are the only summary samples without suffix.
+		return strings.HasSuffix(s.Name, "_sum") || strings.HasSuffix(s.Name, "_count")
+	case dto.MetricType_HISTOGRAM:
+		return true
+	default:
+		return false
+	}
+}
+
+// packets joins the provided lines with newlines into packets of at most
+// maxSize bytes. A line longer than maxSize gets a packet of its own.
+func packets(lines []string, maxSize int) [][]byte {
+	var (
+		result [][]byte
+		buf    bytes.Buffer
+	)
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxSize {
+			result = append(result, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		result = append(result, buf.Bytes())
+	}
+	return result
+}
+
+// sanitize replaces all characters that would break the name of a StatsD
+// metric by "_". In particular, "." would otherwise introduce an additional
+// level in the name.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// sanitizeTag replaces the characters that separate the parts of a DogStatsD
+// line by "_".
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', '\n', ':':
+			return '_'
+		default:
+			return r
+		}
+	}, s)
+}
@@ -0,0 +1,219 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func newTestRegistry() (*prometheus.Registry, *prometheus.CounterVec, prometheus.Histogram) {
+	reg := prometheus.NewRegistry()
+	cv := prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "requests_total", Help: "Requests."},
+		[]string{"method"},
+	)
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "temperature", Help: "Temperature."})
+	g.Set(21.5)
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "latency_seconds",
+		Help:    "Latency.",
+		Buckets: []float64{0.5},
+	})
+	reg.MustRegister(cv, g, h)
+	return reg, cv, h
+}
+
+func TestLines(t *testing.T) {
+	reg, cv, h := newTestRegistry()
+	cv.WithLabelValues("get").Add(3)
+	h.Observe(0.25)
+
+	scenarios := []struct {
+		flavor Flavor
+		want   []string
+	}{
+		{
+			flavor: StatsD,
+			want: []string{
+				"app.latency_seconds_bucket.le.0_5:1|c",
+				"app.latency_seconds_bucket.le._Inf:1|c",
+				"app.latency_seconds_sum:0.25|c",
+				"app.latency_seconds_count:1|c",
+				"app.requests_total.method.get:3|c",
+				"app.temperature:21.5|g",
+			},
+		},
+		{
+			flavor: DogStatsD,
+			want: []string{
+				"app.latency_seconds_bucket:1|c|#le:0.5",
+				"app.latency_seconds_bucket:1|c|#le:+Inf",
+				"app.latency_seconds_sum:0.25|c",
+				"app.latency_seconds_count:1|c",
+				"app.requests_total:3|c|#method:get",
+				"app.temperature:21.5|g",
+			},
+		},
+	}
+	for i, s := range scenarios {
+		b, err := NewBridge(&Config{Addr: "localhost:8125", Flavor: s.flavor, Prefix: "app", Gatherer: reg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := b.lines(mfs); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%d. want %q, got %q", i, s.want, got)
+		}
+	}
+}
+
+func TestNegativeGauge(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "balance", Help: "Balance."})
+	g.Set(-5)
+	reg.MustRegister(g)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		flavor Flavor
+		want   []string
+	}{
+		{flavor: StatsD, want: []string{"balance:0|g\nbalance:-5|g"}},
+		{flavor: DogStatsD, want: []string{"balance:-5|g"}},
+	}
+	for i, s := range scenarios {
+		b, err := NewBridge(&Config{Addr: "localhost:8125", Flavor: s.flavor, Gatherer: reg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := b.lines(mfs)
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%d. want %q, got %q", i, s.want, got)
+		}
+		// The reset to 0 and the value must not be split up.
+		if got, want := len(packets(got, len("balance:0|g"))), 1; got != want {
+			t.Errorf("%d. got %d packets, want %d", i, got, want)
+		}
+	}
+}
+
+func TestCounterDeltas(t *testing.T) {
+	reg, cv, _ := newTestRegistry()
+	b, err := NewBridge(&Config{Addr: "localhost:8125", Gatherer: reg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counterLine := func() string {
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range b.lines(mfs) {
+			if strings.HasPrefix(l, "requests_total.") {
+				return l
+			}
+		}
+		t.Fatal("no counter line found")
+		return ""
+	}
+
+	c := cv.WithLabelValues("get")
+	c.Add(5)
+	if got, want := counterLine(), "requests_total.method.get:5|c"; got != want {
+		t.Errorf("first push: want %q, got %q", want, got)
+	}
+	c.Add(2)
+	if got, want := counterLine(), "requests_total.method.get:2|c"; got != want {
+		t.Errorf("second push: want %q, got %q", want, got)
+	}
+	if got, want := counterLine(), "requests_total.method.get:0|c"; got != want {
+		t.Errorf("third push: want %q, got %q", want, got)
+	}
+}
+
+func TestPackets(t *testing.T) {
+	scenarios := []struct {
+		lines   []string
+		maxSize int
+		want    []string
+	}{
+		{lines: nil, maxSize: 10, want: nil},
+		{lines: []string{"a:1|c", "b:2|c"}, maxSize: 11, want: []string{"a:1|c\nb:2|c"}},
+		{lines: []string{"a:1|c", "b:2|c"}, maxSize: 10, want: []string{"a:1|c", "b:2|c"}},
+		{lines: []string{"too_long:1|c", "b:2|c"}, maxSize: 5, want: []string{"too_long:1|c", "b:2|c"}},
+	}
+	for i, s := range scenarios {
+		var got []string
+		for _, p := range packets(s.lines, s.maxSize) {
+			got = append(got, string(p))
+		}
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%d. want %q, got %q", i, s.want, got)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reg, cv, _ := newTestRegistry()
+	cv.WithLabelValues("get").Inc()
+	b, err := NewBridge(&Config{
+		Addr:          conn.LocalAddr().String(),
+		Flavor:        DogStatsD,
+		Gatherer:      reg,
+		MaxPacketSize: 40,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(got) < 6 {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("got %q so far: %s", got, err)
+		}
+		if n > 40 {
+			t.Errorf("packet of %d bytes exceeds MaxPacketSize", n)
+		}
+		got = append(got, strings.Split(string(buf[:n]), "\n")...)
+	}
+	sort.Strings(got)
+	if want := "requests_total:1|c|#method:get"; got[4] != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
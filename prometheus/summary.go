@@ -16,11 +16,15 @@ package prometheus
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"code.google.com/p/goprotobuf/proto"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 
 	dto "github.com/prometheus/client_model/go"
 
@@ -35,6 +39,9 @@ import (
 // Summary provides the median, the 90th and the 99th percentile of the latency
 // as rank estimations.
 //
+// Like Counters, Summaries report the time of their creation as a created
+// timestamp in the protocol buffer exposition format.
+//
 // To create Summary instances, use NewSummary.
 type Summary interface {
 	Metric
@@ -80,6 +87,10 @@ type SummaryOpts struct {
 	// string.
 	Help string
 
+	// Unit is the unit of the observed values, e.g. "seconds". See the
+	// Opts documentation for details.
+	Unit string
+
 	// ConstLabels are used to attach fixed labels to this
 	// Summary. Summaries with the same fully-qualified name must have the
 	// same label names in their ConstLabels.
@@ -100,7 +111,12 @@ type SummaryOpts struct {
 	ConstLabels Labels
 
 	// Objectives defines the quantile rank estimates with their respective
-	// absolute error. The default value is DefObjectives.
+	// absolute error. If Objectives is nil, the default value DefObjectives
+	// is used. If Objectives is an empty but non-nil map, the Summary
+	// tracks only the sum and the count of observations and exposes no
+	// quantiles at all. This avoids the considerable cost of the quantile
+	// estimation if only sum and count are needed. MaxAge, AgeBuckets, and
+	// BufCap are irrelevant in that case.
 	Objectives map[float64]float64
 
 	// MaxAge defines the duration for which an observation stays relevant
@@ -143,9 +159,10 @@ type SummaryOpts struct {
 // NewSummary creates a new Summary based on the provided SummaryOpts.
 func NewSummary(opts SummaryOpts) Summary {
 	return newSummary(
-		NewDesc(
+		NewDescWithUnit(
 			BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 			opts.Help,
+			opts.Unit,
 			nil,
 			opts.ConstLabels,
 		),
@@ -158,7 +175,7 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 		panic(errInconsistentCardinality)
 	}
 
-	if len(opts.Objectives) == 0 {
+	if opts.Objectives == nil {
 		opts.Objectives = DefObjectives
 	}
 
@@ -177,6 +194,17 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 		opts.BufCap = DefBufCap
 	}
 
+	if len(opts.Objectives) == 0 {
+		// No quantiles requested, so use the lightweight implementation.
+		s := &noObjectivesSummary{
+			desc:       desc,
+			labelPairs: makeLabelPairs(desc, labelValues),
+			createdTs:  ptypes.TimestampNow(),
+		}
+		s.Init(s) // Init self-collection.
+		return s
+	}
+
 	s := &summary{
 		desc: desc,
 
@@ -184,6 +212,7 @@ func newSummary(desc *Desc, opts SummaryOpts, labelValues ...string) Summary {
 		sortedObjectives: make([]float64, 0, len(opts.Objectives)),
 
 		labelPairs: makeLabelPairs(desc, labelValues),
+		createdTs:  ptypes.TimestampNow(),
 
 		hotBuf:         make([]float64, 0, opts.BufCap),
 		coldBuf:        make([]float64, 0, opts.BufCap),
@@ -219,6 +248,7 @@ type summary struct {
 	sortedObjectives []float64
 
 	labelPairs []*dto.LabelPair
+	createdTs  *timestamp.Timestamp
 
 	sum float64
 	cnt uint64
@@ -265,6 +295,7 @@ func (s *summary) Write(out *dto.Metric) error {
 	s.flushColdBuf()
 	sum.SampleCount = proto.Uint64(s.cnt)
 	sum.SampleSum = proto.Float64(s.sum)
+	sum.CreatedTimestamp = s.createdTs
 
 	for _, rank := range s.sortedObjectives {
 		qs = append(qs, &dto.Quantile{
@@ -285,6 +316,49 @@ func (s *summary) Write(out *dto.Metric) error {
 	return nil
 }
 
+// noObjectivesSummary is a Summary without any quantile objectives. It only
+// tracks the sum and the count of observations, which can be done lock-free.
+type noObjectivesSummary struct {
+	// sumBits contains the bits of the float64 representing the sum of all
+	// observations. sumBits and count have to go first in the struct to
+	// guarantee alignment for atomic operations.
+	// http://golang.org/pkg/sync/atomic/#pkg-note-BUG
+	sumBits uint64
+	count   uint64
+
+	SelfCollector
+
+	desc *Desc
+
+	labelPairs []*dto.LabelPair
+	createdTs  *timestamp.Timestamp
+}
+
+func (s *noObjectivesSummary) Desc() *Desc {
+	return s.desc
+}
+
+func (s *noObjectivesSummary) Observe(v float64) {
+	for {
+		oldBits := atomic.LoadUint64(&s.sumBits)
+		newBits := math.Float64bits(math.Float64frombits(oldBits) + v)
+		if atomic.CompareAndSwapUint64(&s.sumBits, oldBits, newBits) {
+			break
+		}
+	}
+	atomic.AddUint64(&s.count, 1)
+}
+
+func (s *noObjectivesSummary) Write(out *dto.Metric) error {
+	out.Summary = &dto.Summary{
+		SampleCount:      proto.Uint64(atomic.LoadUint64(&s.count)),
+		SampleSum:        proto.Float64(math.Float64frombits(atomic.LoadUint64(&s.sumBits))),
+		CreatedTimestamp: s.createdTs,
+	}
+	out.Label = s.labelPairs
+	return nil
+}
+
 func (s *summary) newStream() *quantile.Stream {
 	return quantile.NewTargeted(s.objectives)
 }
@@ -368,9 +442,10 @@ type SummaryVec struct {
 // partitioned by the given label names. At least one label name must be
 // provided.
 func NewSummaryVec(opts SummaryOpts, labelNames []string) *SummaryVec {
-	desc := NewDesc(
+	desc := NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		labelNames,
 		opts.ConstLabels,
 	)
@@ -387,23 +462,26 @@ func NewSummaryVec(opts SummaryOpts, labelNames []string) *SummaryVec {
 }
 
 // GetMetricWithLabelValues replaces the method of the same name in
-// MetricVec. The difference is that this method returns a Summary and not a
-// Metric so that no type conversion is required.
-func (m *SummaryVec) GetMetricWithLabelValues(lvs ...string) (Summary, error) {
+// MetricVec. The difference is that this method returns an Observer and not a
+// Metric so that no type conversion to an Observer is required. The returned
+// Observer is a Summary, so that a type conversion to Summary is possible if
+// needed.
+func (m *SummaryVec) GetMetricWithLabelValues(lvs ...string) (Observer, error) {
 	metric, err := m.MetricVec.GetMetricWithLabelValues(lvs...)
 	if metric != nil {
-		return metric.(Summary), err
+		return metric.(Observer), err
 	}
 	return nil, err
 }
 
 // GetMetricWith replaces the method of the same name in MetricVec. The
-// difference is that this method returns a Summary and not a Metric so that no
-// type conversion is required.
-func (m *SummaryVec) GetMetricWith(labels Labels) (Summary, error) {
+// difference is that this method returns an Observer and not a Metric so that
+// no type conversion to an Observer is required. See also
+// GetMetricWithLabelValues.
+func (m *SummaryVec) GetMetricWith(labels Labels) (Observer, error) {
 	metric, err := m.MetricVec.GetMetricWith(labels)
 	if metric != nil {
-		return metric.(Summary), err
+		return metric.(Observer), err
 	}
 	return nil, err
 }
@@ -411,14 +489,122 @@ func (m *SummaryVec) GetMetricWith(labels Labels) (Summary, error) {
 // WithLabelValues works as GetMetricWithLabelValues, but panics where
 // GetMetricWithLabelValues would have returned an error. By not returning an
 // error, WithLabelValues allows shortcuts like
-//     myVec.WithLabelValues("404", "GET").Add(42)
-func (m *SummaryVec) WithLabelValues(lvs ...string) Summary {
-	return m.MetricVec.WithLabelValues(lvs...).(Summary)
+//     myVec.WithLabelValues("404", "GET").Observe(42.21)
+func (m *SummaryVec) WithLabelValues(lvs ...string) Observer {
+	return m.MetricVec.WithLabelValues(lvs...).(Observer)
 }
 
 // With works as GetMetricWith, but panics where GetMetricWithLabels would have
 // returned an error. By not returning an error, With allows shortcuts like
-//     myVec.With(Labels{"code": "404", "method": "GET"}).Add(42)
-func (m *SummaryVec) With(labels Labels) Summary {
-	return m.MetricVec.With(labels).(Summary)
+//     myVec.With(Labels{"code": "404", "method": "GET"}).Observe(42.21)
+func (m *SummaryVec) With(labels Labels) Observer {
+	return m.MetricVec.With(labels).(Observer)
+}
+
+// CurryWith returns a vector curried with the provided labels. See the
+// CurryWith method of MetricVec for details. The difference is that this method
+// returns an ObserverVec and not a MetricVec. The returned ObserverVec is a
+// *SummaryVec, so that a type conversion to *SummaryVec is possible if needed.
+func (m *SummaryVec) CurryWith(labels Labels) (ObserverVec, error) {
+	curried := &SummaryVec{}
+	if err := m.MetricVec.curryInto(&curried.MetricVec, labels); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *SummaryVec) MustCurryWith(labels Labels) ObserverVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
+type constSummary struct {
+	desc       *Desc
+	count      uint64
+	sum        float64
+	quantiles  map[float64]float64
+	labelPairs []*dto.LabelPair
+}
+
+func (s *constSummary) Desc() *Desc {
+	return s.desc
+}
+
+func (s *constSummary) Write(out *dto.Metric) error {
+	sum := &dto.Summary{}
+	qs := make([]*dto.Quantile, 0, len(s.quantiles))
+
+	sum.SampleCount = proto.Uint64(s.count)
+	sum.SampleSum = proto.Float64(s.sum)
+
+	for rank, q := range s.quantiles {
+		qs = append(qs, &dto.Quantile{
+			Quantile: proto.Float64(rank),
+			Value:    proto.Float64(q),
+		})
+	}
+
+	if len(qs) > 0 {
+		sort.Sort(quantSort(qs))
+	}
+	sum.Quantile = qs
+
+	out.Summary = sum
+	out.Label = s.labelPairs
+
+	return nil
+}
+
+// NewConstSummary returns a metric representing a Prometheus summary with fixed
+// values for the count, sum, and quantiles. As those parameters cannot be
+// changed, the returned value does not implement the Summary interface (but
+// only the Metric interface). Users of this package will not have much use for
+// it in regular operations. However, when implementing custom Collectors, it is
+// useful as a throw-away metric that is generated on the fly to send it to
+// Prometheus in the Collect method.
+//
+// quantiles maps ranks to quantile values. For example, a median latency of
+// 0.23s and a 99th percentile latency of 0.56s would be expressed as:
+//     map[float64]float64{0.5: 0.23, 0.99: 0.56}
+//
+// NewConstSummary returns an error if the length of labelValues is not
+// consistent with the variable labels in Desc.
+func NewConstSummary(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	quantiles map[float64]float64,
+	labelValues ...string,
+) (Metric, error) {
+	if len(desc.variableLabels) != len(labelValues) {
+		return nil, errInconsistentCardinality
+	}
+	return &constSummary{
+		desc:       desc,
+		count:      count,
+		sum:        sum,
+		quantiles:  quantiles,
+		labelPairs: makeLabelPairs(desc, labelValues),
+	}, nil
+}
+
+// MustNewConstSummary is a version of NewConstSummary that panics where
+// NewConstSummary would have returned an error.
+func MustNewConstSummary(
+	desc *Desc,
+	count uint64,
+	sum float64,
+	quantiles map[float64]float64,
+	labelValues ...string,
+) Metric {
+	m, err := NewConstSummary(desc, count, sum, quantiles, labelValues...)
+	if err != nil {
+		panic(err)
+	}
+	return m
 }
@@ -17,11 +17,15 @@ import (
 	"math"
 	"math/rand"
 	"sort"
+	"strconv"
 	"sync"
 	"testing"
 	"testing/quick"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
 	dto "github.com/prometheus/client_model/go"
 )
 
@@ -238,7 +242,7 @@ func TestSummaryVecConcurrency(t *testing.T) {
 			go func(vals []float64) {
 				start.Wait()
 				for i, v := range vals {
-					sum.WithLabelValues(string('A' + picks[i])).Observe(v)
+					sum.WithLabelValues(strconv.Itoa(picks[i])).Observe(v)
 				}
 				end.Done()
 			}(vals)
@@ -251,7 +255,7 @@ func TestSummaryVecConcurrency(t *testing.T) {
 
 		for i := 0; i < vecLength; i++ {
 			m := &dto.Metric{}
-			s := sum.WithLabelValues(string('A' + i))
+			s := sum.WithLabelValues(strconv.Itoa(i)).(Summary)
 			s.Write(m)
 			if got, want := int(*m.Summary.SampleCount), len(allVars[i]); got != want {
 				t.Errorf("got sample count %d for label %c, want %d", got, 'A'+i, want)
@@ -326,3 +330,159 @@ func getBounds(vars []float64, q, ε float64) (min, max float64) {
 	}
 	return
 }
+
+func TestConstSummary(t *testing.T) {
+	desc := NewDesc("http_request_duration_seconds", "A summary of the HTTP request durations.", []string{"code", "method"}, Labels{"owner": "example"})
+
+	s, err := NewConstSummary(
+		desc,
+		4711, 403.34,
+		map[float64]float64{0.99: 0.56, 0.5: 0.23, 0.9: 0.5},
+		"200", "get",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &dto.Metric{}
+	if err := s.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	expected := &dto.Metric{
+		Label: []*dto.LabelPair{
+			{Name: proto.String("code"), Value: proto.String("200")},
+			{Name: proto.String("method"), Value: proto.String("get")},
+			{Name: proto.String("owner"), Value: proto.String("example")},
+		},
+		Summary: &dto.Summary{
+			SampleCount: proto.Uint64(4711),
+			SampleSum:   proto.Float64(403.34),
+			Quantile: []*dto.Quantile{
+				{Quantile: proto.Float64(0.5), Value: proto.Float64(0.23)},
+				{Quantile: proto.Float64(0.9), Value: proto.Float64(0.5)},
+				{Quantile: proto.Float64(0.99), Value: proto.Float64(0.56)},
+			},
+		},
+	}
+	if !proto.Equal(expected, m) {
+		t.Errorf("expected %s, got %s", proto.CompactTextString(expected), proto.CompactTextString(m))
+	}
+
+	if _, err := NewConstSummary(desc, 1, 1, nil, "200"); err != errInconsistentCardinality {
+		t.Errorf("expected error %q, got %v", errInconsistentCardinality, err)
+	}
+}
+
+func TestSummaryCreatedTimestamp(t *testing.T) {
+	before := time.Now()
+	sum := NewSummary(SummaryOpts{Name: "test", Help: "test help"})
+	after := time.Now()
+
+	m := &dto.Metric{}
+	sum.Write(m)
+	created, err := ptypes.Timestamp(m.GetSummary().GetCreatedTimestamp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Before(before) || created.After(after) {
+		t.Errorf("expected created timestamp between %v and %v, got %v", before, after, created)
+	}
+}
+
+func TestSummaryOpts(t *testing.T) {
+	scenarios := []struct {
+		opts           SummaryOpts
+		streamDuration time.Duration
+		ageBuckets     int
+		bufCap         int
+	}{
+		{
+			opts:           SummaryOpts{},
+			streamDuration: DefMaxAge / DefAgeBuckets,
+			ageBuckets:     DefAgeBuckets,
+			bufCap:         DefBufCap,
+		},
+		{
+			opts:           SummaryOpts{MaxAge: time.Minute, AgeBuckets: 3, BufCap: 1000},
+			streamDuration: 20 * time.Second,
+			ageBuckets:     3,
+			bufCap:         1000,
+		},
+	}
+	for i, s := range scenarios {
+		s.opts.Name = "test"
+		s.opts.Help = "helpless"
+		sum := NewSummary(s.opts).(*summary)
+		if got, want := sum.streamDuration, s.streamDuration; got != want {
+			t.Errorf("%d. got stream duration %v, want %v", i, got, want)
+		}
+		if got, want := len(sum.streams), s.ageBuckets; got != want {
+			t.Errorf("%d. got %d age buckets, want %d", i, got, want)
+		}
+		if got, want := cap(sum.hotBuf), s.bufCap; got != want {
+			t.Errorf("%d. got buffer capacity %d, want %d", i, got, want)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected panic for negative MaxAge")
+		}
+	}()
+	NewSummary(SummaryOpts{Name: "test", Help: "helpless", MaxAge: -time.Second})
+}
+
+func TestSummaryWithoutObjectives(t *testing.T) {
+	sum := NewSummary(SummaryOpts{
+		Name:       "test_summary",
+		Help:       "helpless",
+		Objectives: map[float64]float64{},
+	})
+	if _, ok := sum.(*noObjectivesSummary); !ok {
+		t.Fatalf("got %T, want *noObjectivesSummary", sum)
+	}
+	sum.Observe(1.5)
+	sum.Observe(2)
+	sum.Observe(-0.5)
+
+	m := &dto.Metric{}
+	sum.Write(m)
+	if got, want := m.GetSummary().GetSampleCount(), uint64(3); got != want {
+		t.Errorf("got sample count %d, want %d", got, want)
+	}
+	if got, want := m.GetSummary().GetSampleSum(), 3.0; got != want {
+		t.Errorf("got sample sum %f, want %f", got, want)
+	}
+	if got := len(m.GetSummary().GetQuantile()); got != 0 {
+		t.Errorf("got %d quantiles, want none", got)
+	}
+
+	// A nil Objectives map still results in the default objectives.
+	m.Reset()
+	NewSummary(SummaryOpts{Name: "test_summary", Help: "helpless"}).Write(m)
+	if got, want := len(m.GetSummary().GetQuantile()), len(DefObjectives); got != want {
+		t.Errorf("got %d quantiles, want %d", got, want)
+	}
+}
+
+func TestSummaryConstLabels(t *testing.T) {
+	vec := NewSummaryVec(
+		SummaryOpts{
+			Name:        "test_summary",
+			Help:        "helpless",
+			ConstLabels: Labels{"stream": "b", "a": "1"},
+			Objectives:  map[float64]float64{},
+		},
+		[]string{"code"},
+	)
+	vec.WithLabelValues("200").Observe(1)
+
+	m := &dto.Metric{}
+	vec.WithLabelValues("200").(Summary).Write(m)
+	if expected, got := `a="1",code="200",stream="b"`, labelPairsString(m.GetLabel()); expected != got {
+		t.Errorf("expected labels %s, got %s", expected, got)
+	}
+	if expected, got := uint64(1), m.GetSummary().GetSampleCount(); expected != got {
+		t.Errorf("expected sample count %d, got %d", expected, got)
+	}
+}
@@ -33,10 +33,11 @@ type Untyped interface {
 	// Dec decrements the Untyped metric by 1.
 	Dec()
 	// Add adds the given value to the Untyped metric. (The value can be
-	// negative, resulting in a decrease.)
+	// negative, resulting in a decrease.) It panics if the value is NaN.
 	Add(float64)
 	// Sub subtracts the given value from the Untyped metric. (The value can
-	// be negative, resulting in an increase.)
+	// be negative, resulting in an increase.) It panics if the value is
+	// NaN.
 	Sub(float64)
 }
 
@@ -45,9 +46,10 @@ type UntypedOpts Opts
 
 // NewUntyped creates a new Untyped metric from the provided UntypedOpts.
 func NewUntyped(opts UntypedOpts) Untyped {
-	return newValue(NewDesc(
+	return newValue(NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		nil,
 		opts.ConstLabels,
 	), UntypedValue, 0)
@@ -65,9 +67,10 @@ type UntypedVec struct {
 // partitioned by the given label names. At least one label name must be
 // provided.
 func NewUntypedVec(opts UntypedOpts, labelNames []string) *UntypedVec {
-	desc := NewDesc(
+	desc := NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		labelNames,
 		opts.ConstLabels,
 	)
@@ -120,6 +123,27 @@ func (m *UntypedVec) With(labels Labels) Untyped {
 	return m.MetricVec.With(labels).(Untyped)
 }
 
+// CurryWith returns a vector curried with the provided labels. See the
+// CurryWith method of MetricVec for details. The difference is that this method
+// returns a UntypedVec and not a MetricVec.
+func (m *UntypedVec) CurryWith(labels Labels) (*UntypedVec, error) {
+	curried := &UntypedVec{}
+	if err := m.MetricVec.curryInto(&curried.MetricVec, labels); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *UntypedVec) MustCurryWith(labels Labels) *UntypedVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
 // UntypedFunc is an Untyped whose value is determined at collect time by
 // calling a provided function.
 //
@@ -136,9 +160,10 @@ type UntypedFunc interface {
 // the case where an UntypedFunc is directly registered with Prometheus, the
 // provided function must be concurrency-safe.
 func NewUntypedFunc(opts UntypedOpts, function func() float64) UntypedFunc {
-	return newValueFunc(NewDesc(
+	return newValueFunc(NewDescWithUnit(
 		BuildFQName(opts.Namespace, opts.Subsystem, opts.Name),
 		opts.Help,
+		opts.Unit,
 		nil,
 		opts.ConstLabels,
 	), UntypedValue, function)
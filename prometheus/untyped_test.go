@@ -0,0 +1,82 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/prometheus/client_golang/text"
+)
+
+func TestUntypedFunc(t *testing.T) {
+	uf := NewUntypedFunc(
+		UntypedOpts{
+			Name:        "test_name",
+			Help:        "test help",
+			ConstLabels: Labels{"a": "1", "b": "2"},
+		},
+		func() float64 { return -3.1415 },
+	)
+
+	if expected, got := `Desc{fqName: "test_name", help: "test help", constLabels: {a="1",b="2"}, variableLabels: []}`, uf.Desc().String(); expected != got {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	m := &dto.Metric{}
+	uf.Write(m)
+
+	if expected, got := `a="1",b="2"`, labelPairsString(m.GetLabel()); expected != got {
+		t.Errorf("expected labels %s, got %s", expected, got)
+	}
+	if expected, got := -3.1415, m.GetUntyped().GetValue(); expected != got {
+		t.Errorf("expected value %f, got %f", expected, got)
+	}
+}
+
+func TestUntypedFuncCollection(t *testing.T) {
+	value := 1.
+	uf := NewUntypedFunc(
+		UntypedOpts{
+			Name: "test_name",
+			Help: "test help",
+		},
+		func() float64 { return value },
+	)
+
+	r := NewRegistry()
+	r.collectChecksEnabled = true
+	if err := r.Register(uf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []float64{1, 42, -7} {
+		value = v
+		var buf bytes.Buffer
+		if _, err := writeGathered(&buf, r, text.MetricFamilyToText); err != nil {
+			t.Fatal(err)
+		}
+		expected := "# HELP test_name test help\n# TYPE test_name untyped\ntest_name " + fmt.Sprint(v) + "\n"
+		if got := buf.String(); expected != got {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+
+	if !r.Unregister(uf) {
+		t.Error("expected UntypedFunc to be unregistered")
+	}
+}
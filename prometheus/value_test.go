@@ -0,0 +1,87 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestNewConstMetric(t *testing.T) {
+	desc := NewDesc(
+		"sample_value",
+		"sample value",
+		[]string{"zeta", "alpha"},
+		Labels{"const": "label"},
+	)
+
+	labels := []*dto.LabelPair{
+		{Name: proto.String("alpha"), Value: proto.String("a")},
+		{Name: proto.String("const"), Value: proto.String("label")},
+		{Name: proto.String("zeta"), Value: proto.String("z")},
+	}
+	scenarios := []struct {
+		valueType ValueType
+		value     float64
+		want      *dto.Metric
+	}{
+		{CounterValue, 42, &dto.Metric{Label: labels, Counter: &dto.Counter{Value: proto.Float64(42)}}},
+		{GaugeValue, -1, &dto.Metric{Label: labels, Gauge: &dto.Gauge{Value: proto.Float64(-1)}}},
+		{UntypedValue, 3.1415, &dto.Metric{Label: labels, Untyped: &dto.Untyped{Value: proto.Float64(3.1415)}}},
+	}
+
+	for i, s := range scenarios {
+		metric, err := NewConstMetric(desc, s.valueType, s.value, "z", "a")
+		if err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+			continue
+		}
+		if metric.Desc() != desc {
+			t.Errorf("%d. metric has unexpected descriptor %s", i, metric.Desc())
+		}
+		m := &dto.Metric{}
+		if err := metric.Write(m); err != nil {
+			t.Errorf("%d. unexpected error: %s", i, err)
+			continue
+		}
+		if !proto.Equal(m, s.want) {
+			t.Errorf("%d. want %s, got %s", i, proto.CompactTextString(s.want), proto.CompactTextString(m))
+		}
+	}
+}
+
+func TestNewConstMetricInvalidLabelValues(t *testing.T) {
+	desc := NewDesc("sample_value", "sample value", []string{"a", "b"}, nil)
+
+	for i, lvs := range [][]string{
+		{},
+		{"x"},
+		{"x", "y", "z"},
+	} {
+		if _, err := NewConstMetric(desc, GaugeValue, 1, lvs...); err != errInconsistentCardinality {
+			t.Errorf("%d. want error %q, got %v", i, errInconsistentCardinality, err)
+		}
+		func() {
+			defer func() {
+				if e := recover(); e != errInconsistentCardinality {
+					t.Errorf("%d. want panic %q, got %v", i, errInconsistentCardinality, e)
+				}
+			}()
+			MustNewConstMetric(desc, GaugeValue, 1, lvs...)
+		}()
+	}
+}
@@ -23,13 +23,19 @@ import (
 // MetricVec is a Collector to bundle metrics of the same name that
 // differ in their label values. MetricVec is usually not used directly but as a
 // building block for implementations of vectors of a given metric
-// type. GaugeVec, CounterVec, SummaryVec, and UntypedVec are examples already
-// provided in this package.
+// type. GaugeVec, CounterVec, SummaryVec, HistogramVec, and UntypedVec are
+// examples already provided in this package.
 type MetricVec struct {
-	mtx      sync.RWMutex // Protects not only children, but also hash and buf.
+	mtx      sync.RWMutex // Protects not only children, but also labelValues, hash, and buf.
 	children map[uint64]Metric
 	desc     *Desc
 
+	// labelValues contains the label values of each child, keyed by the
+	// same hash as children. It is needed to delete children by partial
+	// label matches. As it is populated together with children, it is
+	// allocated lazily.
+	labelValues map[uint64][]string
+
 	// hash is our own hash instance to avoid repeated allocations.
 	hash hash.Hash64
 	// buf is used to copy string contents into it for hashing,
@@ -37,6 +43,19 @@ type MetricVec struct {
 	buf bytes.Buffer
 
 	newMetric func(labelValues ...string) Metric
+
+	// root and curry are only set in a vector created by CurryWith. root
+	// is the original (uncurried) vector, which holds all the children,
+	// and curry contains the pre-bound label values, sorted by index.
+	root  *MetricVec
+	curry []curriedLabelValue
+}
+
+// curriedLabelValue is a label value pre-bound with CurryWith. The index
+// refers to the position of the label in the VariableLabels of the Desc.
+type curriedLabelValue struct {
+	index int
+	value string
 }
 
 // Describe implements Collector. The length of the returned slice
@@ -45,8 +64,13 @@ func (m *MetricVec) Describe(ch chan<- *Desc) {
 	ch <- m.desc
 }
 
-// Collect implements Collector.
+// Collect implements Collector. A curried vector collects all metrics of the
+// vector it was created from.
 func (m *MetricVec) Collect(ch chan<- Metric) {
+	if m.root != nil {
+		m.root.Collect(ch)
+		return
+	}
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 
@@ -59,8 +83,9 @@ func (m *MetricVec) Collect(ch chan<- Metric) {
 // values (same order as the VariableLabels in Desc). If that combination of
 // label values is accessed for the first time, a new Metric is created.
 // Keeping the Metric for later use is possible (and should be considered if
-// performance is critical), but keep in mind that Reset, DeleteLabelValues and
-// Delete can be used to delete the Metric from the MetricVec. In that case, the
+// performance is critical), but keep in mind that Reset, DeleteLabelValues,
+// Delete, and DeletePartialMatch can be used to delete the Metric from the
+// MetricVec. In that case, the
 // Metric will still exist, but it will not be exported anymore, even if a
 // Metric with the same label values is created later. See also the CounterVec
 // example.
@@ -75,6 +100,13 @@ func (m *MetricVec) Collect(ch chan<- Metric) {
 // with a performance overhead (for creating and processing the Labels map).
 // See also the GaugeVec example.
 func (m *MetricVec) GetMetricWithLabelValues(lvs ...string) (Metric, error) {
+	if m.root != nil {
+		full, err := m.uncurryLabelValues(lvs)
+		if err != nil {
+			return nil, err
+		}
+		return m.root.GetMetricWithLabelValues(full...)
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
@@ -97,6 +129,13 @@ func (m *MetricVec) GetMetricWithLabelValues(lvs ...string) (Metric, error) {
 // GetMetricWithLabelValues(...string). See there for pros and cons of the two
 // methods.
 func (m *MetricVec) GetMetricWith(labels Labels) (Metric, error) {
+	if m.root != nil {
+		full, err := m.uncurryLabels(labels)
+		if err != nil {
+			return nil, err
+		}
+		return m.root.GetMetricWith(full)
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
@@ -149,6 +188,13 @@ func (m *MetricVec) With(labels Labels) Metric {
 // with a performance overhead (for creating and processing the Labels map).
 // See also the CounterVec example.
 func (m *MetricVec) DeleteLabelValues(lvs ...string) bool {
+	if m.root != nil {
+		full, err := m.uncurryLabelValues(lvs)
+		if err != nil {
+			return false
+		}
+		return m.root.DeleteLabelValues(full...)
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
@@ -156,11 +202,7 @@ func (m *MetricVec) DeleteLabelValues(lvs ...string) bool {
 	if err != nil {
 		return false
 	}
-	if _, has := m.children[h]; !has {
-		return false
-	}
-	delete(m.children, h)
-	return true
+	return m.deleteByHash(h)
 }
 
 // Delete deletes the metric where the variable labels are the same as those
@@ -174,6 +216,13 @@ func (m *MetricVec) DeleteLabelValues(lvs ...string) bool {
 // This method is used for the same purpose as DeleteLabelValues(...string). See
 // there for pros and cons of the two methods.
 func (m *MetricVec) Delete(labels Labels) bool {
+	if m.root != nil {
+		full, err := m.uncurryLabels(labels)
+		if err != nil {
+			return false
+		}
+		return m.root.Delete(full)
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
@@ -181,21 +230,217 @@ func (m *MetricVec) Delete(labels Labels) bool {
 	if err != nil {
 		return false
 	}
-	if _, has := m.children[h]; !has {
-		return false
+	return m.deleteByHash(h)
+}
+
+// DeletePartialMatch deletes all metrics where the variable labels contain all
+// of those passed in as labels. The order of the labels does not matter. For
+// example, with the variable labels "tenant" and "method",
+//     myVec.DeletePartialMatch(Labels{"tenant": "foo"})
+// deletes the metrics of tenant "foo" for all methods. It returns the number
+// of metrics deleted.
+//
+// Labels with names that are not among the VariableLabels in the Desc of the
+// MetricVec can never match an actual Metric, so nothing is deleted in that
+// case. In a curried vector, the same is true for labels that are already
+// curried, while the curried labels are implicitly part of the match.
+func (m *MetricVec) DeletePartialMatch(labels Labels) int {
+	if m.root != nil {
+		full := make(Labels, len(labels)+len(m.curry))
+		for name, value := range labels {
+			full[name] = value
+		}
+		for _, c := range m.curry {
+			name := m.desc.variableLabels[c.index]
+			if _, ok := labels[name]; ok {
+				return 0
+			}
+			full[name] = c.value
+		}
+		return m.root.DeletePartialMatch(full)
 	}
-	delete(m.children, h)
-	return true
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	// Translate the label names into indices of the label values.
+	indices := make(map[int]string, len(labels))
+	for name, value := range labels {
+		i := m.labelIndex(name)
+		if i < 0 {
+			return 0
+		}
+		indices[i] = value
+	}
+
+	deleted := 0
+	for h, lvs := range m.labelValues {
+		matches := true
+		for i, value := range indices {
+			if lvs[i] != value {
+				matches = false
+				break
+			}
+		}
+		if matches && m.deleteByHash(h) {
+			deleted++
+		}
+	}
+	return deleted
 }
 
-// Reset deletes all metrics in this vector.
+// Reset deletes all metrics in this vector. In a curried vector, only the
+// metrics matching the curried labels are deleted.
 func (m *MetricVec) Reset() {
+	if m.root != nil {
+		m.DeletePartialMatch(Labels{})
+		return
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 
 	for h := range m.children {
 		delete(m.children, h)
 	}
+	for h := range m.labelValues {
+		delete(m.labelValues, h)
+	}
+}
+
+// CurryWith returns a vector curried with the provided labels, i.e. the
+// returned vector has those labels pre-set for all labeled operations
+// performed on it. The cardinality of the curried vector is reduced
+// accordingly. The order of the remaining labels stays the same (just with the
+// curried labels taken out of the sequence - which is relevant for the
+// (GetMetric)WithLabelValues methods). It is possible to curry a curried
+// vector, but only with labels not yet used for currying before. This is
+// useful, for example, if a middleware sets the "handler" label once and
+// passes the curried vector down to code that only knows about the "method"
+// and "code" labels:
+//     handlerReqs := httpReqs.MustCurryWith(Labels{"handler": "/api"})
+//     handlerReqs.WithLabelValues("GET", "200").Inc()
+//
+// The metrics contained in the curried vector are shared with the original
+// vector. A curried vector must therefore not be registered. Register the
+// original vector instead, which collects all metrics, no matter whether they
+// were created through the original or through a curried vector.
+//
+// CurryWith returns an error if a label name is not among the VariableLabels
+// of the Desc or has been curried before.
+func (m *MetricVec) CurryWith(labels Labels) (*MetricVec, error) {
+	curried := &MetricVec{}
+	if err := m.curryInto(curried, labels); err != nil {
+		return nil, err
+	}
+	return curried, nil
+}
+
+// MustCurryWith works as CurryWith but panics where CurryWith would have
+// returned an error.
+func (m *MetricVec) MustCurryWith(labels Labels) *MetricVec {
+	vec, err := m.CurryWith(labels)
+	if err != nil {
+		panic(err)
+	}
+	return vec
+}
+
+// curryInto sets up the provided empty vector as a version of m curried with
+// the provided labels. It is used by the CurryWith methods of the various
+// vector types.
+func (m *MetricVec) curryInto(curried *MetricVec, labels Labels) error {
+	var (
+		curry = make([]curriedLabelValue, 0, len(m.curry)+len(labels))
+		iCurry int
+		found  int
+	)
+	for i, name := range m.desc.variableLabels {
+		value, ok := labels[name]
+		if iCurry < len(m.curry) && m.curry[iCurry].index == i {
+			if ok {
+				return fmt.Errorf("label name %q is already curried", name)
+			}
+			curry = append(curry, m.curry[iCurry])
+			iCurry++
+			continue
+		}
+		if ok {
+			curry = append(curry, curriedLabelValue{i, value})
+			found++
+		}
+	}
+	if found != len(labels) {
+		return fmt.Errorf("%d unknown label(s) found during currying", len(labels)-found)
+	}
+
+	curried.desc = m.desc
+	curried.root = m
+	if m.root != nil {
+		curried.root = m.root
+	}
+	curried.curry = curry
+	return nil
+}
+
+// uncurryLabelValues returns the full slice of label values for a curried
+// vector by merging the curried label values into the provided ones.
+func (m *MetricVec) uncurryLabelValues(lvs []string) ([]string, error) {
+	if len(lvs)+len(m.curry) != len(m.desc.variableLabels) {
+		return nil, errInconsistentCardinality
+	}
+	full := make([]string, 0, len(m.desc.variableLabels))
+	iCurry, iLVs := 0, 0
+	for i := range m.desc.variableLabels {
+		if iCurry < len(m.curry) && m.curry[iCurry].index == i {
+			full = append(full, m.curry[iCurry].value)
+			iCurry++
+			continue
+		}
+		full = append(full, lvs[iLVs])
+		iLVs++
+	}
+	return full, nil
+}
+
+// uncurryLabels returns the full Labels map for a curried vector by merging
+// the curried labels into the provided ones.
+func (m *MetricVec) uncurryLabels(labels Labels) (Labels, error) {
+	if len(labels)+len(m.curry) != len(m.desc.variableLabels) {
+		return nil, errInconsistentCardinality
+	}
+	full := make(Labels, len(m.desc.variableLabels))
+	for name, value := range labels {
+		full[name] = value
+	}
+	for _, c := range m.curry {
+		name := m.desc.variableLabels[c.index]
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("label name %q is already curried", name)
+		}
+		full[name] = c.value
+	}
+	return full, nil
+}
+
+// deleteByHash deletes the metric with the given hash. It returns true if a
+// metric was deleted. The caller must hold the write lock.
+func (m *MetricVec) deleteByHash(h uint64) bool {
+	if _, has := m.children[h]; !has {
+		return false
+	}
+	delete(m.children, h)
+	delete(m.labelValues, h)
+	return true
+}
+
+// labelIndex returns the index of the provided name in the VariableLabels of
+// the Desc or -1 if there is no such label.
+func (m *MetricVec) labelIndex(name string) int {
+	for i, l := range m.desc.variableLabels {
+		if l == name {
+			return i
+		}
+	}
+	return -1
 }
 
 func (m *MetricVec) hashLabelValues(vals []string) (uint64, error) {
@@ -236,6 +481,10 @@ func (m *MetricVec) getOrCreateMetric(hash uint64, labelValues ...string) Metric
 		copiedLabelValues := append(make([]string, 0, len(labelValues)), labelValues...)
 		metric = m.newMetric(copiedLabelValues...)
 		m.children[hash] = metric
+		if m.labelValues == nil {
+			m.labelValues = map[uint64][]string{}
+		}
+		m.labelValues[hash] = copiedLabelValues
 	}
 	return metric
 }
@@ -16,6 +16,8 @@ package prometheus
 import (
 	"hash/fnv"
 	"testing"
+
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestDelete(t *testing.T) {
@@ -89,3 +91,225 @@ func TestDeleteLabelValues(t *testing.T) {
 		t.Errorf("got %v, want %v", got, want)
 	}
 }
+
+func TestDeleteStopsCollection(t *testing.T) {
+	vec := NewCounterVec(CounterOpts{
+		Name: "test",
+		Help: "helpless",
+	}, []string{"peer"})
+
+	vec.WithLabelValues("a").Add(3)
+	vec.WithLabelValues("b").Add(5)
+	if got, want := collectCount(vec), 2; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+
+	if !vec.DeleteLabelValues("a") {
+		t.Fatal("expected metric to be deleted")
+	}
+	if got, want := collectCount(vec), 1; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+
+	// A child created again starts from scratch.
+	m := &dto.Metric{}
+	vec.WithLabelValues("a").Write(m)
+	if got, want := m.GetCounter().GetValue(), 0.; got != want {
+		t.Errorf("got value %v, want %v", got, want)
+	}
+}
+
+func collectCount(c Collector) int {
+	ch := make(chan Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	n := 0
+	for _ = range ch {
+		n++
+	}
+	return n
+}
+
+func TestDeletePartialMatch(t *testing.T) {
+	desc := NewDesc("test", "helpless", []string{"tenant", "method", "code"}, nil)
+	vec := MetricVec{
+		children: map[uint64]Metric{},
+		desc:     desc,
+		hash:     fnv.New64a(),
+		newMetric: func(lvs ...string) Metric {
+			return newValue(desc, UntypedValue, 0, lvs...)
+		},
+	}
+
+	for _, lvs := range [][]string{
+		{"foo", "GET", "200"},
+		{"foo", "GET", "404"},
+		{"foo", "POST", "200"},
+		{"bar", "GET", "200"},
+		{"bar", "POST", "500"},
+	} {
+		vec.WithLabelValues(lvs...).(Untyped).Set(42)
+	}
+
+	scenarios := []struct {
+		labels    Labels
+		deleted   int
+		remaining int
+	}{
+		{Labels{"unknown": "foo"}, 0, 5},
+		{Labels{"tenant": "foo", "unknown": "x"}, 0, 5},
+		{Labels{"tenant": "baz"}, 0, 5},
+		{Labels{"tenant": "foo", "code": "200"}, 2, 3},
+		{Labels{"method": "POST", "code": "500"}, 1, 2},
+		{Labels{"tenant": "foo"}, 1, 1},
+		{Labels{}, 1, 0}, // Empty labels match everything.
+	}
+	for i, s := range scenarios {
+		if got, want := vec.DeletePartialMatch(s.labels), s.deleted; got != want {
+			t.Errorf("%d. got %d deleted, want %d", i, got, want)
+		}
+		if got, want := collectCount(&vec), s.remaining; got != want {
+			t.Errorf("%d. got %d remaining, want %d", i, got, want)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	vec := NewGaugeVec(GaugeOpts{
+		Name: "test",
+		Help: "helpless",
+	}, []string{"l1"})
+
+	for _, lv := range []string{"v1", "v2", "v3"} {
+		vec.WithLabelValues(lv).Set(42)
+	}
+	if got, want := collectCount(vec), 3; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+
+	vec.Reset()
+	if got, want := collectCount(vec), 0; got != want {
+		t.Errorf("got %d collected metrics after reset, want %d", got, want)
+	}
+	if got, want := vec.DeletePartialMatch(Labels{}), 0; got != want {
+		t.Errorf("got %d deleted after reset, want %d", got, want)
+	}
+
+	// The vector is fully usable after a reset.
+	vec.WithLabelValues("v1").Set(1)
+	if got, want := collectCount(vec), 1; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+}
+
+func TestCurryWith(t *testing.T) {
+	vec := NewCounterVec(CounterOpts{
+		Name: "test",
+		Help: "helpless",
+	}, []string{"handler", "method", "code"})
+
+	curried, err := vec.CurryWith(Labels{"handler": "/api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	curried.WithLabelValues("GET", "200").Inc()
+	curried.With(Labels{"code": "404", "method": "GET"}).Add(2)
+
+	// Curry a curried vector.
+	curried.MustCurryWith(Labels{"code": "200"}).WithLabelValues("POST").Add(3)
+
+	scenarios := []struct {
+		lvs   []string
+		value float64
+	}{
+		{[]string{"/api", "GET", "200"}, 1},
+		{[]string{"/api", "GET", "404"}, 2},
+		{[]string{"/api", "POST", "200"}, 3},
+	}
+	for i, s := range scenarios {
+		m := &dto.Metric{}
+		vec.WithLabelValues(s.lvs...).Write(m)
+		if got, want := m.GetCounter().GetValue(), s.value; got != want {
+			t.Errorf("%d. got %v, want %v", i, got, want)
+		}
+	}
+	if got, want := collectCount(curried), 3; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+
+	vec.WithLabelValues("/other", "GET", "200").Inc()
+	if !curried.DeleteLabelValues("GET", "404") {
+		t.Error("expected metric to be deleted via curried vector")
+	}
+	if !curried.Delete(Labels{"method": "POST", "code": "200"}) {
+		t.Error("expected metric to be deleted via curried vector")
+	}
+	curried.Reset() // Only deletes the metrics of handler "/api".
+	if got, want := collectCount(vec), 1; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+}
+
+func TestCurryWithErrors(t *testing.T) {
+	vec := NewGaugeVec(GaugeOpts{
+		Name: "test",
+		Help: "helpless",
+	}, []string{"handler", "method"})
+
+	if _, err := vec.CurryWith(Labels{"unknown": "x"}); err == nil {
+		t.Error("expected error for unknown label")
+	}
+	curried := vec.MustCurryWith(Labels{"handler": "/api"})
+	if _, err := curried.CurryWith(Labels{"handler": "/other"}); err == nil {
+		t.Error("expected error for label curried twice")
+	}
+	if _, err := curried.GetMetricWithLabelValues("/api", "GET"); err != errInconsistentCardinality {
+		t.Errorf("expected %v, got %v", errInconsistentCardinality, err)
+	}
+	if _, err := curried.GetMetricWith(Labels{"handler": "/api"}); err == nil {
+		t.Error("expected error for curried label in label map")
+	}
+	if got, want := curried.DeletePartialMatch(Labels{"handler": "/api"}), 0; got != want {
+		t.Errorf("got %d deleted, want %d", got, want)
+	}
+}
+
+func TestGetMetricWith(t *testing.T) {
+	vec := NewUntypedVec(UntypedOpts{
+		Name: "test",
+		Help: "helpless",
+	}, []string{"l1", "l2"})
+
+	u, err := vec.GetMetricWith(Labels{"l2": "v2", "l1": "v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Set(42)
+	if got, want := vec.WithLabelValues("v1", "v2"), u; got != want {
+		t.Error("expected map-based and positional access to return the same metric")
+	}
+
+	scenarios := []Labels{
+		{"l1": "v1"},                         // Missing label.
+		{"l1": "v1", "l2": "v2", "l3": "v3"}, // Too many labels.
+		{"l1": "v1", "l3": "v3"},             // Unknown label.
+	}
+	for i, labels := range scenarios {
+		if _, err := vec.GetMetricWith(labels); err == nil {
+			t.Errorf("%d. expected error for labels %v", i, labels)
+		}
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("%d. expected With to panic for labels %v", i, labels)
+				}
+			}()
+			vec.With(labels)
+		}()
+	}
+	if got, want := collectCount(vec), 1; got != want {
+		t.Errorf("got %d collected metrics, want %d", got, want)
+	}
+}
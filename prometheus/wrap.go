@@ -0,0 +1,225 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// WrapRegistererWith returns a Registerer wrapping the provided Registerer.
+// Collectors registered with the returned Registerer are registered with the
+// wrapped Registerer in a modified way: Every Desc they describe and every
+// Metric they collect gets the provided labels added as constant labels. This
+// allows a library to be instantiated several times, e.g. once per shard, with
+// each instance distinguished by a label, without changing the instrumentation
+// code of the library:
+//     lib.New(WrapRegistererWith(Labels{"shard": "3"}, registry))
+//
+// If a Desc already has a label with the same name as one of the provided
+// labels, registration fails. If a collected Metric does, writing it fails. The
+// labels are copied, so that later modifications of the map have no effect.
+//
+// Unregistering a Collector via the returned Registerer works as expected, as
+// the Collector is wrapped in the same way before it is unregistered from the
+// wrapped Registerer.
+//
+// If the provided Registerer is nil, the returned Registerer is a no-op
+// Registerer, i.e. registration always succeeds and unregistration always
+// reports that nothing was unregistered.
+func WrapRegistererWith(labels Labels, reg Registerer) Registerer {
+	constLabels := make(Labels, len(labels))
+	for name, value := range labels {
+		constLabels[name] = value
+	}
+	return &wrappingRegisterer{
+		wrappedRegisterer: reg,
+		labels:            constLabels,
+	}
+}
+
+// WrapRegistererWithPrefix returns a Registerer wrapping the provided
+// Registerer. Collectors registered with the returned Registerer are registered
+// with the wrapped Registerer in a modified way: The provided prefix is
+// prepended to the fully-qualified name of every Desc they describe and every
+// Metric they collect. This allows an application to namespace the metrics of
+// a library it embeds:
+//     lib.New(WrapRegistererWithPrefix("myapp_", registry))
+//
+// The prefix is prepended as is, i.e. it should usually end with "_". The
+// resulting names must be valid metric names, otherwise registration fails.
+//
+// Wrapping a Registerer returned by WrapRegistererWith (or the other way
+// round) combines both modifications. Unregistering and a nil Registerer are
+// handled as described for WrapRegistererWith.
+func WrapRegistererWithPrefix(prefix string, reg Registerer) Registerer {
+	return &wrappingRegisterer{
+		wrappedRegisterer: reg,
+		prefix:            prefix,
+	}
+}
+
+type wrappingRegisterer struct {
+	wrappedRegisterer Registerer
+	prefix            string
+	labels            Labels
+}
+
+func (r *wrappingRegisterer) Register(c Collector) error {
+	if r.wrappedRegisterer == nil {
+		return nil
+	}
+	err := r.wrappedRegisterer.Register(r.wrap(c))
+	if are, ok := err.(AlreadyRegisteredError); ok {
+		// Hand out the unwrapped Collectors so that callers can use
+		// the existing Collector as usual.
+		if wc, ok := are.ExistingCollector.(*wrappingCollector); ok {
+			are.ExistingCollector = wc.wrappedCollector
+		}
+		are.NewCollector = c
+		return are
+	}
+	return err
+}
+
+func (r *wrappingRegisterer) MustRegister(cs ...Collector) {
+	if r.wrappedRegisterer == nil {
+		return
+	}
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *wrappingRegisterer) Unregister(c Collector) bool {
+	if r.wrappedRegisterer == nil {
+		return false
+	}
+	return r.wrappedRegisterer.Unregister(r.wrap(c))
+}
+
+func (r *wrappingRegisterer) wrap(c Collector) Collector {
+	return &wrappingCollector{
+		wrappedCollector: c,
+		prefix:           r.prefix,
+		labels:           r.labels,
+	}
+}
+
+// wrappingCollector adds a prefix and labels to the Descs and Metrics of the
+// wrapped Collector.
+type wrappingCollector struct {
+	wrappedCollector Collector
+	prefix           string
+	labels           Labels
+}
+
+func (c *wrappingCollector) Describe(ch chan<- *Desc) {
+	wrappedCh := make(chan *Desc)
+	go func() {
+		c.wrappedCollector.Describe(wrappedCh)
+		close(wrappedCh)
+	}()
+	for desc := range wrappedCh {
+		ch <- wrapDesc(desc, c.prefix, c.labels)
+	}
+}
+
+func (c *wrappingCollector) Collect(ch chan<- Metric) {
+	wrappedCh := make(chan Metric)
+	go func() {
+		c.wrappedCollector.Collect(wrappedCh)
+		close(wrappedCh)
+	}()
+	for m := range wrappedCh {
+		ch <- &wrappingMetric{
+			wrappedMetric: m,
+			prefix:        c.prefix,
+			labels:        c.labels,
+		}
+	}
+}
+
+// wrappingMetric adds a prefix to the Desc and labels to the Desc and the
+// written label pairs of the wrapped Metric.
+type wrappingMetric struct {
+	wrappedMetric Metric
+	prefix        string
+	labels        Labels
+}
+
+func (m *wrappingMetric) Desc() *Desc {
+	return wrapDesc(m.wrappedMetric.Desc(), m.prefix, m.labels)
+}
+
+func (m *wrappingMetric) Write(out *dto.Metric) error {
+	if err := m.wrappedMetric.Write(out); err != nil {
+		return err
+	}
+	if len(m.labels) == 0 {
+		return nil
+	}
+	// Do not modify the label pairs written by the wrapped Metric in place,
+	// as they are usually shared with later calls of Write.
+	labelPairs := make([]*dto.LabelPair, 0, len(out.Label)+len(m.labels))
+	for _, lp := range out.Label {
+		if _, exists := m.labels[lp.GetName()]; exists {
+			return fmt.Errorf(
+				"attempted to add label %q to metric %s, but the label is already present",
+				lp.GetName(), out,
+			)
+		}
+		labelPairs = append(labelPairs, lp)
+	}
+	for name, value := range m.labels {
+		labelPairs = append(labelPairs, &dto.LabelPair{
+			Name:  proto.String(name),
+			Value: proto.String(value),
+		})
+	}
+	sort.Sort(LabelPairSorter(labelPairs))
+	out.Label = labelPairs
+	return nil
+}
+
+// wrapDesc returns a new Desc that equals the provided one but has the provided
+// prefix prepended to its fully-qualified name and the provided labels added to
+// its constant labels.
+func wrapDesc(desc *Desc, prefix string, labels Labels) *Desc {
+	if desc.err != nil || prefix == "" && len(labels) == 0 {
+		return desc
+	}
+	constLabels := make(Labels, len(desc.constLabelPairs)+len(labels))
+	for _, lp := range desc.constLabelPairs {
+		constLabels[lp.GetName()] = lp.GetValue()
+	}
+	for name, value := range labels {
+		if _, exists := constLabels[name]; exists {
+			return NewInvalidDesc(fmt.Errorf(
+				"attempted wrapping with already existing label name %q in descriptor %s",
+				name, desc,
+			))
+		}
+		constLabels[name] = value
+	}
+	// NewDesc will notice if a variable label name collides with one of the
+	// added labels.
+	return NewDescWithUnit(prefix+desc.fqName, desc.help, desc.unit, desc.variableLabels, constLabels)
+}
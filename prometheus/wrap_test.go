@@ -0,0 +1,134 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/text"
+)
+
+func TestWrapRegistererWith(t *testing.T) {
+	r := NewRegistry()
+	r.EnableCollectChecks(true)
+	for _, shard := range []string{"1", "2"} {
+		vec := NewGaugeVec(
+			GaugeOpts{
+				Name:        "queue_length",
+				Help:        "Length of the queue.",
+				ConstLabels: Labels{"a": "x"},
+			},
+			[]string{"queue"},
+		)
+		vec.WithLabelValues("q" + shard).Set(1)
+		if err := WrapRegistererWith(Labels{"shard": shard}, r).Register(vec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := writeGathered(&buf, r, text.MetricFamilyToText); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP queue_length Length of the queue.
+# TYPE queue_length gauge
+queue_length{a="x",queue="q1",shard="1"} 1
+queue_length{a="x",queue="q2",shard="2"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestWrapRegistererWithErrors(t *testing.T) {
+	r := NewRegistry()
+	scenarios := []struct {
+		labels Labels
+		c      Collector
+	}{
+		{ // Collision with a constant label.
+			labels: Labels{"a": "y"},
+			c: NewGauge(GaugeOpts{
+				Name:        "test",
+				Help:        "help",
+				ConstLabels: Labels{"a": "x"},
+			}),
+		},
+		{ // Collision with a variable label.
+			labels: Labels{"a": "y"},
+			c:      NewGaugeVec(GaugeOpts{Name: "test", Help: "help"}, []string{"a"}),
+		},
+		{ // Invalid label name.
+			labels: Labels{"__a": "y"},
+			c:      NewGauge(GaugeOpts{Name: "test", Help: "help"}),
+		},
+	}
+	for i, s := range scenarios {
+		if err := WrapRegistererWith(s.labels, r).Register(s.c); err == nil {
+			t.Errorf("%d. expected error, got none", i)
+		}
+	}
+}
+
+func TestWrapRegistererWithUnregister(t *testing.T) {
+	r := NewRegistry()
+	g := NewGauge(GaugeOpts{Name: "test", Help: "help"})
+	wrapped := WrapRegistererWith(Labels{"shard": "1"}, r)
+	wrapped.MustRegister(g)
+	// The unwrapped Gauge is a different Collector.
+	if r.Unregister(g) {
+		t.Error("unregistering the unwrapped gauge unexpectedly succeeded")
+	}
+	if !wrapped.Unregister(g) {
+		t.Error("expected wrapped gauge to be unregistered")
+	}
+}
+
+func TestWrapRegistererWithNil(t *testing.T) {
+	wrapped := WrapRegistererWith(Labels{"shard": "1"}, nil)
+	g := NewGauge(GaugeOpts{Name: "test", Help: "help"})
+	if err := wrapped.Register(g); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	wrapped.MustRegister(g)
+	if wrapped.Unregister(g) {
+		t.Error("unregistering from a no-op registerer unexpectedly succeeded")
+	}
+}
+
+func TestWrapRegistererWithPrefix(t *testing.T) {
+	r := NewRegistry()
+	r.EnableCollectChecks(true)
+	c := NewCounter(CounterOpts{Name: "requests_total", Help: "Total requests."})
+	c.(*counter).createdTs = nil
+	c.Inc()
+	WrapRegistererWithPrefix("myapp_", WrapRegistererWith(Labels{"lib": "x"}, r)).MustRegister(c)
+
+	var buf bytes.Buffer
+	if _, err := writeGathered(&buf, r, text.MetricFamilyToText); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP myapp_requests_total Total requests.
+# TYPE myapp_requests_total counter
+myapp_requests_total{lib="x"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if err := WrapRegistererWithPrefix("0invalid_", r).Register(c); err == nil {
+		t.Error("expected error for invalid prefix, got none")
+	}
+}
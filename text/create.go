@@ -24,8 +24,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"strings"
 
+	"github.com/prometheus/client_golang/model"
+
 	dto "github.com/prometheus/client_model/go"
 )
 
@@ -54,7 +57,7 @@ func MetricFamilyToText(out io.Writer, in *dto.MetricFamily) (int, error) {
 	if in.Help != nil {
 		n, err := fmt.Fprintf(
 			out, "# HELP %s %s\n",
-			name, escapeString(*in.Help, false),
+			formatMetricName(name), escapeString(*in.Help, false),
 		)
 		written += n
 		if err != nil {
@@ -62,9 +65,15 @@ func MetricFamilyToText(out io.Writer, in *dto.MetricFamily) (int, error) {
 		}
 	}
 	metricType := in.GetType()
+	typeName := strings.ToLower(metricType.String())
+	if metricType == dto.MetricType_GAUGE_HISTOGRAM {
+		// The text format has no type for gauge histograms. They are
+		// exposed as regular histograms.
+		typeName = "histogram"
+	}
 	n, err := fmt.Fprintf(
 		out, "# TYPE %s %s\n",
-		name, strings.ToLower(metricType.String()),
+		formatMetricName(name), typeName,
 	)
 	written += n
 	if err != nil {
@@ -139,6 +148,54 @@ func MetricFamilyToText(out io.Writer, in *dto.MetricFamily) (int, error) {
 				float64(metric.Summary.GetSampleCount()),
 				out,
 			)
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			if metric.Histogram == nil {
+				return written, fmt.Errorf(
+					"expected histogram in metric %s", metric,
+				)
+			}
+			infSeen := false
+			for _, q := range metric.Histogram.Bucket {
+				n, err = writeSample(
+					name+"_bucket", metric,
+					"le", fmt.Sprint(q.GetUpperBound()),
+					float64(q.GetCumulativeCount()),
+					out,
+				)
+				written += n
+				if err != nil {
+					return written, err
+				}
+				if math.IsInf(q.GetUpperBound(), +1) {
+					infSeen = true
+				}
+			}
+			if !infSeen {
+				n, err = writeSample(
+					name+"_bucket", metric,
+					"le", "+Inf",
+					float64(metric.Histogram.GetSampleCount()),
+					out,
+				)
+				if err != nil {
+					return written, err
+				}
+				written += n
+			}
+			n, err = writeSample(
+				name+"_sum", metric, "", "",
+				metric.Histogram.GetSampleSum(),
+				out,
+			)
+			if err != nil {
+				return written, err
+			}
+			written += n
+			n, err = writeSample(
+				name+"_count", metric, "", "",
+				float64(metric.Histogram.GetSampleCount()),
+				out,
+			)
 		default:
 			return written, fmt.Errorf(
 				"unexpected type in metric %s", metric,
@@ -164,13 +221,8 @@ func writeSample(
 	out io.Writer,
 ) (int, error) {
 	var written int
-	n, err := fmt.Fprint(out, name)
-	written += n
-	if err != nil {
-		return written, err
-	}
-	n, err = labelPairsToText(
-		metric.Label,
+	n, err := writeNameAndLabelPairs(
+		name, metric.Label,
 		additionalLabelName, additionalLabelValue,
 		out,
 	)
@@ -198,6 +250,31 @@ func writeSample(
 	return written, nil
 }
 
+// writeNameAndLabelPairs writes the metric name followed by the label pairs as
+// labelPairsToText does. If the name is not a valid metric name according to
+// model.LegacyValidation, it is written quoted as the first element within the
+// curly braces instead, as required for UTF-8 names.
+func writeNameAndLabelPairs(
+	name string,
+	in []*dto.LabelPair,
+	additionalLabelName, additionalLabelValue string,
+	out io.Writer,
+) (int, error) {
+	if model.IsValidLegacyMetricName(name) {
+		written, err := fmt.Fprint(out, name)
+		if err != nil {
+			return written, err
+		}
+		n, err := labelPairsToText(in, additionalLabelName, additionalLabelValue, out)
+		return written + n, err
+	}
+	return labelPairsWithNameToText(
+		`"`+escapeString(name, true)+`"`, in,
+		additionalLabelName, additionalLabelValue,
+		out,
+	)
+}
+
 // labelPairsToText converts a slice of LabelPair proto messages plus the
 // explicitly given additional label pair into text formatted as required by the
 // text format and writes it to 'out'. An empty slice in combination with an
@@ -210,15 +287,34 @@ func labelPairsToText(
 	additionalLabelName, additionalLabelValue string,
 	out io.Writer,
 ) (int, error) {
-	if len(in) == 0 && additionalLabelName == "" {
+	return labelPairsWithNameToText("", in, additionalLabelName, additionalLabelValue, out)
+}
+
+// labelPairsWithNameToText works like labelPairsToText, but if quotedName is
+// not empty, it is written as the first element within the curly braces.
+func labelPairsWithNameToText(
+	quotedName string,
+	in []*dto.LabelPair,
+	additionalLabelName, additionalLabelValue string,
+	out io.Writer,
+) (int, error) {
+	if len(in) == 0 && additionalLabelName == "" && quotedName == "" {
 		return 0, nil
 	}
 	var written int
 	separator := '{'
+	if quotedName != "" {
+		n, err := fmt.Fprintf(out, "%c%s", separator, quotedName)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		separator = ','
+	}
 	for _, lp := range in {
 		n, err := fmt.Fprintf(
 			out, `%c%s="%s"`,
-			separator, lp.GetName(), escapeString(lp.GetValue(), true),
+			separator, formatLabelName(lp.GetName()), escapeString(lp.GetValue(), true),
 		)
 		written += n
 		if err != nil {
@@ -245,6 +341,26 @@ func labelPairsToText(
 	return written, nil
 }
 
+// formatMetricName returns the metric name as it is written in HELP and TYPE
+// lines, i.e. unchanged if it is a valid metric name according to
+// model.LegacyValidation, or quoted and escaped otherwise.
+func formatMetricName(name string) string {
+	if model.IsValidLegacyMetricName(name) {
+		return name
+	}
+	return `"` + escapeString(name, true) + `"`
+}
+
+// formatLabelName returns the label name as it is written within the curly
+// braces, i.e. unchanged if it is a valid label name according to
+// model.LegacyValidation, or quoted and escaped otherwise.
+func formatLabelName(name string) string {
+	if model.IsValidLegacyLabelName(name) {
+		return name
+	}
+	return `"` + escapeString(name, true) + `"`
+}
+
 // escapeString replaces '\' by '\\', new line character by '\n', and - if
 // includeDoubleQuote is true - '"' by '\"'.
 func escapeString(v string, includeDoubleQuote bool) string {
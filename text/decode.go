@@ -0,0 +1,111 @@
+// Copyright 2014 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/matttproud/golang_protobuf_extensions/ext"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Decoder decodes MetricFamilies from an exposition in one of the formats
+// written by the functions of this package.
+type Decoder interface {
+	// Decode decodes the next MetricFamily into the provided one, which
+	// is reset first. It returns io.EOF once the input is exhausted.
+	Decode(*dto.MetricFamily) error
+}
+
+// NewDecoder returns a Decoder reading from r in the format given by the
+// provided content type, as found in the "Content-Type" header of a response
+// served by a Prometheus client. Supported are the delimited protobuf format
+// and the simple text format (version 0.0.4, which is also assumed if no
+// version is given). For other content types, an error is returned.
+func NewDecoder(r io.Reader, contentType string) (Decoder, error) {
+	mediatype, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content type %q: %s", contentType, err)
+	}
+	switch mediatype {
+	case "application/vnd.google.protobuf":
+		if params["proto"] != "io.prometheus.client.MetricFamily" {
+			return nil, fmt.Errorf("unrecognized protocol message %s", params["proto"])
+		}
+		if params["encoding"] != "delimited" {
+			return nil, fmt.Errorf("unsupported encoding %s", params["encoding"])
+		}
+		return &protoDecoder{r: r}, nil
+	case "text/plain":
+		if v := params["version"]; v != "" && v != "0.0.4" {
+			return nil, fmt.Errorf("unrecognized text format version %s", v)
+		}
+		return &textDecoder{r: r}, nil
+	default:
+		return nil, fmt.Errorf("unsupported media type %q", mediatype)
+	}
+}
+
+// protoDecoder decodes the delimited protobuf format. It reads one
+// MetricFamily per call of Decode.
+type protoDecoder struct {
+	r io.Reader
+}
+
+func (d *protoDecoder) Decode(v *dto.MetricFamily) error {
+	v.Reset()
+	_, err := ext.ReadDelimited(d.r, v)
+	return err
+}
+
+// textDecoder decodes the simple text format. As the samples of a
+// MetricFamily are not necessarily grouped together in that format, the whole
+// input is parsed upon the first call of Decode. The MetricFamilies are then
+// returned sorted by name.
+type textDecoder struct {
+	r      io.Reader
+	parsed bool
+	mfs    []*dto.MetricFamily
+}
+
+func (d *textDecoder) Decode(v *dto.MetricFamily) error {
+	if !d.parsed {
+		var p Parser
+		mfsByName, err := p.TextToMetricFamilies(d.r)
+		if err != nil {
+			return err
+		}
+		d.parsed = true
+		names := make([]string, 0, len(mfsByName))
+		for name := range mfsByName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			d.mfs = append(d.mfs, mfsByName[name])
+		}
+	}
+	if len(d.mfs) == 0 {
+		return io.EOF
+	}
+	v.Reset()
+	proto.Merge(v, d.mfs[0])
+	d.mfs = d.mfs[1:]
+	return nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2014 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDecoder(t *testing.T) {
+	// Sorted by name, as the text decoder returns them that way.
+	mfs := []*dto.MetricFamily{
+		&dto.MetricFamily{
+			Name: proto.String("counter"),
+			Help: proto.String("A counter."),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{
+				&dto.Metric{
+					Label: []*dto.LabelPair{
+						&dto.LabelPair{
+							Name:  proto.String("code"),
+							Value: proto.String("200"),
+						},
+					},
+					Counter: &dto.Counter{Value: proto.Float64(42)},
+				},
+				&dto.Metric{
+					Label: []*dto.LabelPair{
+						&dto.LabelPair{
+							Name:  proto.String("code"),
+							Value: proto.String("500"),
+						},
+					},
+					Counter:     &dto.Counter{Value: proto.Float64(3)},
+					TimestampMs: proto.Int64(1234567),
+				},
+			},
+		},
+		&dto.MetricFamily{
+			Name: proto.String("histogram"),
+			Help: proto.String("A histogram."),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{
+				&dto.Metric{
+					Histogram: &dto.Histogram{
+						SampleCount: proto.Uint64(7),
+						SampleSum:   proto.Float64(12.5),
+						Bucket: []*dto.Bucket{
+							&dto.Bucket{
+								UpperBound:      proto.Float64(1),
+								CumulativeCount: proto.Uint64(2),
+							},
+							&dto.Bucket{
+								UpperBound:      proto.Float64(math.Inf(+1)),
+								CumulativeCount: proto.Uint64(7),
+							},
+						},
+					},
+				},
+			},
+		},
+		&dto.MetricFamily{
+			Name: proto.String("summary"),
+			Help: proto.String("A summary."),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{
+				&dto.Metric{
+					Summary: &dto.Summary{
+						SampleCount: proto.Uint64(3),
+						SampleSum:   proto.Float64(1.5),
+						Quantile: []*dto.Quantile{
+							&dto.Quantile{
+								Quantile: proto.Float64(0.5),
+								Value:    proto.Float64(0.25),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	scenarios := []struct {
+		contentType string
+		write       func(io.Writer, *dto.MetricFamily) (int, error)
+	}{
+		{
+			contentType: `application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited`,
+			write:       WriteProtoDelimited,
+		},
+		{
+			contentType: `text/plain; version=0.0.4`,
+			write:       MetricFamilyToText,
+		},
+		{
+			contentType: `text/plain`,
+			write:       MetricFamilyToText,
+		},
+	}
+
+	for i, s := range scenarios {
+		var buf bytes.Buffer
+		for _, mf := range mfs {
+			if _, err := s.write(&buf, mf); err != nil {
+				t.Fatalf("%d. %s", i, err)
+			}
+		}
+		dec, err := NewDecoder(&buf, s.contentType)
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		for _, want := range mfs {
+			var got dto.MetricFamily
+			if err := dec.Decode(&got); err != nil {
+				t.Fatalf("%d. %s", i, err)
+			}
+			if !proto.Equal(&got, want) {
+				t.Errorf("%d. got %s, want %s", i, &got, want)
+			}
+		}
+		var mf dto.MetricFamily
+		if err := dec.Decode(&mf); err != io.EOF {
+			t.Errorf("%d. got %v after last MetricFamily, want io.EOF", i, err)
+		}
+	}
+}
+
+func TestDecoderUnsupportedContentType(t *testing.T) {
+	for i, contentType := range []string{
+		``,
+		`application/json`,
+		`text/plain; version=0.0.3`,
+		`application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=text`,
+		`application/vnd.google.protobuf; proto=foo.Bar; encoding=delimited`,
+	} {
+		if _, err := NewDecoder(strings.NewReader(""), contentType); err == nil {
+			t.Errorf("%d. expected error for content type %q", i, contentType)
+		}
+	}
+}
+
+func TestDecoderParseError(t *testing.T) {
+	dec, err := NewDecoder(strings.NewReader("metric{label=\"x} 1\n"), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mf dto.MetricFamily
+	if err := dec.Decode(&mf); err == nil {
+		t.Error("expected parse error")
+	} else if _, ok := err.(ParseError); !ok {
+		t.Errorf("got error of type %T, want ParseError", err)
+	}
+}
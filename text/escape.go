@@ -0,0 +1,87 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"github.com/prometheus/client_golang/model"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// EscapeMetricFamily returns the MetricFamily with its metric name and the
+// label names of its metrics (including those of exemplars) escaped according
+// to scheme. The provided MetricFamily is not modified. If nothing has to be
+// escaped, it is returned as is. Otherwise, an escaped copy is returned.
+func EscapeMetricFamily(in *dto.MetricFamily, scheme model.EscapingScheme) *dto.MetricFamily {
+	if scheme == model.NoEscaping || !needsEscaping(in) {
+		return in
+	}
+	out := proto.Clone(in).(*dto.MetricFamily)
+	out.Name = proto.String(model.EscapeMetricName(in.GetName(), scheme))
+	for _, m := range out.Metric {
+		escapeLabelPairs(m.Label, scheme)
+		if m.Counter != nil && m.Counter.Exemplar != nil {
+			escapeLabelPairs(m.Counter.Exemplar.Label, scheme)
+		}
+		if m.Histogram != nil {
+			for _, b := range m.Histogram.Bucket {
+				if b.Exemplar != nil {
+					escapeLabelPairs(b.Exemplar.Label, scheme)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func needsEscaping(mf *dto.MetricFamily) bool {
+	if !model.IsValidLegacyMetricName(mf.GetName()) {
+		return true
+	}
+	for _, m := range mf.Metric {
+		if labelPairsNeedEscaping(m.Label) {
+			return true
+		}
+		if m.Counter != nil && m.Counter.Exemplar != nil &&
+			labelPairsNeedEscaping(m.Counter.Exemplar.Label) {
+			return true
+		}
+		if m.Histogram != nil {
+			for _, b := range m.Histogram.Bucket {
+				if b.Exemplar != nil && labelPairsNeedEscaping(b.Exemplar.Label) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func labelPairsNeedEscaping(lps []*dto.LabelPair) bool {
+	for _, lp := range lps {
+		if !model.IsValidLegacyLabelName(lp.GetName()) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeLabelPairs escapes the names of the provided LabelPairs in place.
+func escapeLabelPairs(lps []*dto.LabelPair, scheme model.EscapingScheme) {
+	for _, lp := range lps {
+		lp.Name = proto.String(model.EscapeLabelName(lp.GetName(), scheme))
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/model"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestEscapeMetricFamily(t *testing.T) {
+	legacy := &dto.MetricFamily{
+		Name: proto.String("legacy_name"),
+		Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{
+			&dto.Metric{
+				Label: []*dto.LabelPair{
+					&dto.LabelPair{
+						Name:  proto.String("label"),
+						Value: proto.String("val.ue"),
+					},
+				},
+				Gauge: &dto.Gauge{Value: proto.Float64(1)},
+			},
+		},
+	}
+	if got := EscapeMetricFamily(legacy, model.UnderscoreEscaping); got != legacy {
+		t.Errorf("got escaped copy %s of MetricFamily that needs no escaping", got)
+	}
+
+	in := &dto.MetricFamily{
+		Name: proto.String("my.counter"),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{
+			&dto.Metric{
+				Label: []*dto.LabelPair{
+					&dto.LabelPair{
+						Name:  proto.String("label.name"),
+						Value: proto.String("val.ue"),
+					},
+				},
+				Counter: &dto.Counter{
+					Value: proto.Float64(1),
+					Exemplar: &dto.Exemplar{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("trace.id"),
+								Value: proto.String("abc"),
+							},
+						},
+						Value: proto.Float64(1),
+					},
+				},
+			},
+		},
+	}
+	original := proto.Clone(in)
+	if got := EscapeMetricFamily(in, model.NoEscaping); got != in {
+		t.Errorf("got escaped copy %s with NoEscaping", got)
+	}
+
+	want := &dto.MetricFamily{
+		Name: proto.String("my_dot_counter"),
+		Type: dto.MetricType_COUNTER.Enum(),
+		Metric: []*dto.Metric{
+			&dto.Metric{
+				Label: []*dto.LabelPair{
+					&dto.LabelPair{
+						Name:  proto.String("label_dot_name"),
+						Value: proto.String("val.ue"),
+					},
+				},
+				Counter: &dto.Counter{
+					Value: proto.Float64(1),
+					Exemplar: &dto.Exemplar{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("trace_dot_id"),
+								Value: proto.String("abc"),
+							},
+						},
+						Value: proto.Float64(1),
+					},
+				},
+			},
+		},
+	}
+	if got := EscapeMetricFamily(in, model.DotsEscaping); !proto.Equal(got, want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if !proto.Equal(in, original) {
+		t.Errorf("input was modified to %s", in)
+	}
+}
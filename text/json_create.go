@@ -0,0 +1,143 @@
+// Copyright 2014 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// The JSON representation of a MetricFamily as written by MetricFamilyToJSON.
+// Floating point values are represented as strings so that NaN and the
+// infinities, which have no JSON number representation, can be expressed.
+type (
+	jsonMetricFamily struct {
+		Name    string       `json:"name"`
+		Help    string       `json:"help,omitempty"`
+		Type    string       `json:"type"`
+		Metrics []jsonMetric `json:"metrics"`
+	}
+	jsonMetric struct {
+		Labels      map[string]string `json:"labels,omitempty"`
+		Value       string            `json:"value,omitempty"`
+		Quantiles   []jsonQuantile    `json:"quantiles,omitempty"`
+		Buckets     []jsonBucket      `json:"buckets,omitempty"`
+		Count       *uint64           `json:"count,omitempty"`
+		Sum         string            `json:"sum,omitempty"`
+		TimestampMs *int64            `json:"timestamp_ms,omitempty"`
+	}
+	jsonQuantile struct {
+		Quantile string `json:"quantile"`
+		Value    string `json:"value"`
+	}
+	jsonBucket struct {
+		UpperBound string `json:"le"`
+		Count      uint64 `json:"count"`
+	}
+)
+
+// MetricFamilyToJSON converts a MetricFamily proto message into a JSON object
+// and writes it as a single line to 'out'. It returns the number of bytes
+// written and any error encountered. The JSON representation is meant for
+// debugging and for consumers that cannot parse any of the other formats. It
+// is not a canonical exchange format, and no Prometheus server will ingest it.
+// The field names of the JSON object might change in future versions.
+// This method fulfills the type 'prometheus.encoder'.
+func MetricFamilyToJSON(out io.Writer, in *dto.MetricFamily) (int, error) {
+	if len(in.Metric) == 0 {
+		return 0, fmt.Errorf("MetricFamily has no metrics: %s", in)
+	}
+	name := in.GetName()
+	if name == "" {
+		return 0, fmt.Errorf("MetricFamily has no name: %s", in)
+	}
+	jmf := jsonMetricFamily{
+		Name:    name,
+		Help:    in.GetHelp(),
+		Type:    strings.ToLower(in.GetType().String()),
+		Metrics: make([]jsonMetric, 0, len(in.Metric)),
+	}
+	for _, metric := range in.Metric {
+		jm := jsonMetric{TimestampMs: metric.TimestampMs}
+		if len(metric.Label) > 0 {
+			jm.Labels = make(map[string]string, len(metric.Label))
+			for _, lp := range metric.Label {
+				jm.Labels[lp.GetName()] = lp.GetValue()
+			}
+		}
+		switch in.GetType() {
+		case dto.MetricType_COUNTER:
+			if metric.Counter == nil {
+				return 0, fmt.Errorf("expected counter in metric %s", metric)
+			}
+			jm.Value = formatJSONFloat(metric.Counter.GetValue())
+		case dto.MetricType_GAUGE:
+			if metric.Gauge == nil {
+				return 0, fmt.Errorf("expected gauge in metric %s", metric)
+			}
+			jm.Value = formatJSONFloat(metric.Gauge.GetValue())
+		case dto.MetricType_UNTYPED:
+			if metric.Untyped == nil {
+				return 0, fmt.Errorf("expected untyped in metric %s", metric)
+			}
+			jm.Value = formatJSONFloat(metric.Untyped.GetValue())
+		case dto.MetricType_SUMMARY:
+			if metric.Summary == nil {
+				return 0, fmt.Errorf("expected summary in metric %s", metric)
+			}
+			for _, q := range metric.Summary.Quantile {
+				jm.Quantiles = append(jm.Quantiles, jsonQuantile{
+					Quantile: formatJSONFloat(q.GetQuantile()),
+					Value:    formatJSONFloat(q.GetValue()),
+				})
+			}
+			count := metric.Summary.GetSampleCount()
+			jm.Count = &count
+			jm.Sum = formatJSONFloat(metric.Summary.GetSampleSum())
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			if metric.Histogram == nil {
+				return 0, fmt.Errorf("expected histogram in metric %s", metric)
+			}
+			for _, b := range metric.Histogram.Bucket {
+				jm.Buckets = append(jm.Buckets, jsonBucket{
+					UpperBound: formatJSONFloat(b.GetUpperBound()),
+					Count:      b.GetCumulativeCount(),
+				})
+			}
+			count := metric.Histogram.GetSampleCount()
+			jm.Count = &count
+			jm.Sum = formatJSONFloat(metric.Histogram.GetSampleSum())
+		default:
+			return 0, fmt.Errorf("unexpected type in metric %s", metric)
+		}
+		jmf.Metrics = append(jmf.Metrics, jm)
+	}
+	b, err := json.Marshal(jmf)
+	if err != nil {
+		return 0, err
+	}
+	return out.Write(append(b, '\n'))
+}
+
+// formatJSONFloat formats f as it is represented in the JSON format, which is
+// the shortest representation that parses back into f, or "NaN", "+Inf", and
+// "-Inf".
+func formatJSONFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
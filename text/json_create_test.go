@@ -0,0 +1,186 @@
+// Copyright 2014 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCreateJSON(t *testing.T) {
+	var scenarios = []struct {
+		in  *dto.MetricFamily
+		out string
+	}{
+		// 0: Counter with labels, NaN as value, timestamp given.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("name"),
+				Help: proto.String("doc \"string\""),
+				Type: dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("labelname"),
+								Value: proto.String("val1"),
+							},
+							&dto.LabelPair{
+								Name:  proto.String("basename"),
+								Value: proto.String("basevalue"),
+							},
+						},
+						Counter: &dto.Counter{
+							Value: proto.Float64(math.NaN()),
+						},
+						TimestampMs: proto.Int64(1234567890),
+					},
+					&dto.Metric{
+						Counter: &dto.Counter{
+							Value: proto.Float64(.23),
+						},
+					},
+				},
+			},
+			out: `{"name":"name","help":"doc \"string\"","type":"counter","metrics":[{"labels":{"basename":"basevalue","labelname":"val1"},"value":"NaN","timestamp_ms":1234567890},{"value":"0.23"}]}
+`,
+		},
+		// 1: Gauge, no help.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("gauge_name"),
+				Type: dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Gauge: &dto.Gauge{
+							Value: proto.Float64(math.Inf(-1)),
+						},
+					},
+				},
+			},
+			out: `{"name":"gauge_name","type":"gauge","metrics":[{"value":"-Inf"}]}
+`,
+		},
+		// 2: Summary.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("summary_name"),
+				Help: proto.String("summary docstring"),
+				Type: dto.MetricType_SUMMARY.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Summary: &dto.Summary{
+							SampleCount: proto.Uint64(42),
+							SampleSum:   proto.Float64(-3.4567),
+							Quantile: []*dto.Quantile{
+								&dto.Quantile{
+									Quantile: proto.Float64(0.5),
+									Value:    proto.Float64(-1.23),
+								},
+								&dto.Quantile{
+									Quantile: proto.Float64(0.99),
+									Value:    proto.Float64(math.NaN()),
+								},
+							},
+						},
+					},
+				},
+			},
+			out: `{"name":"summary_name","help":"summary docstring","type":"summary","metrics":[{"quantiles":[{"quantile":"0.5","value":"-1.23"},{"quantile":"0.99","value":"NaN"}],"count":42,"sum":"-3.4567"}]}
+`,
+		},
+		// 3: Histogram without observations.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("request_duration_microseconds"),
+				Help: proto.String("The response latency."),
+				Type: dto.MetricType_HISTOGRAM.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Histogram: &dto.Histogram{
+							SampleCount: proto.Uint64(0),
+							SampleSum:   proto.Float64(0),
+							Bucket: []*dto.Bucket{
+								&dto.Bucket{
+									UpperBound:      proto.Float64(100),
+									CumulativeCount: proto.Uint64(0),
+								},
+								&dto.Bucket{
+									UpperBound:      proto.Float64(math.Inf(+1)),
+									CumulativeCount: proto.Uint64(0),
+								},
+							},
+						},
+					},
+				},
+			},
+			out: `{"name":"request_duration_microseconds","help":"The response latency.","type":"histogram","metrics":[{"buckets":[{"le":"100","count":0},{"le":"+Inf","count":0}],"count":0,"sum":"0"}]}
+`,
+		},
+	}
+
+	for i, scenario := range scenarios {
+		out := bytes.NewBuffer(make([]byte, 0, len(scenario.out)))
+		n, err := MetricFamilyToJSON(out, scenario.in)
+		if err != nil {
+			t.Errorf("%d. error: %s", i, err)
+			continue
+		}
+		if expected, got := len(scenario.out), n; expected != got {
+			t.Errorf(
+				"%d. expected %d bytes written, got %d",
+				i, expected, got,
+			)
+		}
+		if expected, got := scenario.out, out.String(); expected != got {
+			t.Errorf(
+				"%d. expected out=%q, got %q",
+				i, expected, got,
+			)
+		}
+	}
+}
+
+func TestCreateJSONError(t *testing.T) {
+	var scenarios = []*dto.MetricFamily{
+		// 0: No metric.
+		&dto.MetricFamily{
+			Name:   proto.String("name"),
+			Type:   dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{},
+		},
+		// 1: Value type mismatch.
+		&dto.MetricFamily{
+			Name: proto.String("name"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{
+				&dto.Metric{
+					Gauge: &dto.Gauge{
+						Value: proto.Float64(1),
+					},
+				},
+			},
+		},
+	}
+
+	for i, in := range scenarios {
+		if _, err := MetricFamilyToJSON(&bytes.Buffer{}, in); err == nil {
+			t.Errorf("%d. expected error, got nil", i)
+		}
+	}
+}
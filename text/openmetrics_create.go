@@ -0,0 +1,397 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// MetricFamilyToOpenMetrics converts a MetricFamily proto message into the
+// OpenMetrics text format (version 1.0.0) and writes the resulting lines to
+// 'out'. It returns the number of bytes written and any error encountered. As
+// MetricFamilyToText, it does not check the metric and label names.
+//
+// In contrast to the Prometheus text format, the OpenMetrics format exposes
+// the unit of a MetricFamily (if set) in a UNIT line and as a suffix of the
+// name, the created timestamps of counters, summaries, and histograms as
+// additional "_created" samples, and the exemplars of counters and histogram
+// buckets. The samples of a counter always have the "_total" suffix, while the
+// HELP, TYPE, and UNIT lines refer to the name without it. Timestamps are
+// expressed in seconds.
+//
+// A complete exposition in the OpenMetrics format has to be terminated by an
+// "# EOF" line. Call FinalizeOpenMetrics after the last MetricFamily to write
+// it.
+func MetricFamilyToOpenMetrics(out io.Writer, in *dto.MetricFamily) (int, error) {
+	var written int
+
+	// Fail-fast checks.
+	if len(in.Metric) == 0 {
+		return written, fmt.Errorf("MetricFamily has no metrics: %s", in)
+	}
+	name := in.GetName()
+	if name == "" {
+		return written, fmt.Errorf("MetricFamily has no name: %s", in)
+	}
+	if in.Type == nil {
+		return written, fmt.Errorf("MetricFamily has no type: %s", in)
+	}
+	metricType := in.GetType()
+	if metricType == dto.MetricType_COUNTER && strings.HasSuffix(name, "_total") {
+		name = name[:len(name)-len("_total")]
+	}
+	unit := in.GetUnit()
+	if unit != "" && !strings.HasSuffix(name, "_"+unit) {
+		name += "_" + unit
+	}
+
+	// Comments, first HELP, then TYPE, then UNIT.
+	if in.Help != nil {
+		n, err := fmt.Fprintf(
+			out, "# HELP %s %s\n",
+			formatMetricName(name), escapeString(*in.Help, true),
+		)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	var typeName string
+	switch metricType {
+	case dto.MetricType_UNTYPED:
+		typeName = "unknown"
+	case dto.MetricType_GAUGE_HISTOGRAM:
+		typeName = "gaugehistogram"
+	default:
+		typeName = strings.ToLower(metricType.String())
+	}
+	n, err := fmt.Fprintf(out, "# TYPE %s %s\n", formatMetricName(name), typeName)
+	written += n
+	if err != nil {
+		return written, err
+	}
+	if unit != "" {
+		n, err = fmt.Fprintf(out, "# UNIT %s %s\n", formatMetricName(name), unit)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	// Finally the samples, one line for each.
+	for _, metric := range in.Metric {
+		switch metricType {
+		case dto.MetricType_COUNTER:
+			if metric.Counter == nil {
+				return written, fmt.Errorf(
+					"expected counter in metric %s", metric,
+				)
+			}
+			n, err = writeOpenMetricsSample(
+				name+"_total", metric, "", "",
+				formatOpenMetricsFloat(metric.Counter.GetValue()),
+				metric.Counter.Exemplar,
+				out,
+			)
+			if err != nil {
+				return written + n, err
+			}
+			written += n
+			n, err = writeOpenMetricsCreated(
+				name, metric, metric.Counter.CreatedTimestamp, out,
+			)
+		case dto.MetricType_GAUGE:
+			if metric.Gauge == nil {
+				return written, fmt.Errorf(
+					"expected gauge in metric %s", metric,
+				)
+			}
+			n, err = writeOpenMetricsSample(
+				name, metric, "", "",
+				formatOpenMetricsFloat(metric.Gauge.GetValue()),
+				nil,
+				out,
+			)
+		case dto.MetricType_UNTYPED:
+			if metric.Untyped == nil {
+				return written, fmt.Errorf(
+					"expected untyped in metric %s", metric,
+				)
+			}
+			n, err = writeOpenMetricsSample(
+				name, metric, "", "",
+				formatOpenMetricsFloat(metric.Untyped.GetValue()),
+				nil,
+				out,
+			)
+		case dto.MetricType_SUMMARY:
+			if metric.Summary == nil {
+				return written, fmt.Errorf(
+					"expected summary in metric %s", metric,
+				)
+			}
+			for _, q := range metric.Summary.Quantile {
+				n, err = writeOpenMetricsSample(
+					name, metric,
+					"quantile", formatOpenMetricsFloat(q.GetQuantile()),
+					formatOpenMetricsFloat(q.GetValue()),
+					nil,
+					out,
+				)
+				written += n
+				if err != nil {
+					return written, err
+				}
+			}
+			n, err = writeOpenMetricsSample(
+				name+"_sum", metric, "", "",
+				formatOpenMetricsFloat(metric.Summary.GetSampleSum()),
+				nil,
+				out,
+			)
+			if err != nil {
+				return written + n, err
+			}
+			written += n
+			n, err = writeOpenMetricsSample(
+				name+"_count", metric, "", "",
+				strconv.FormatUint(metric.Summary.GetSampleCount(), 10),
+				nil,
+				out,
+			)
+			if err != nil {
+				return written + n, err
+			}
+			written += n
+			n, err = writeOpenMetricsCreated(
+				name, metric, metric.Summary.CreatedTimestamp, out,
+			)
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			if metric.Histogram == nil {
+				return written, fmt.Errorf(
+					"expected histogram in metric %s", metric,
+				)
+			}
+			infSeen := false
+			for _, b := range metric.Histogram.Bucket {
+				n, err = writeOpenMetricsSample(
+					name+"_bucket", metric,
+					"le", formatOpenMetricsFloat(b.GetUpperBound()),
+					strconv.FormatUint(b.GetCumulativeCount(), 10),
+					b.Exemplar,
+					out,
+				)
+				written += n
+				if err != nil {
+					return written, err
+				}
+				if math.IsInf(b.GetUpperBound(), +1) {
+					infSeen = true
+				}
+			}
+			if !infSeen {
+				n, err = writeOpenMetricsSample(
+					name+"_bucket", metric,
+					"le", "+Inf",
+					strconv.FormatUint(metric.Histogram.GetSampleCount(), 10),
+					nil,
+					out,
+				)
+				if err != nil {
+					return written + n, err
+				}
+				written += n
+			}
+			// Gauge histograms use different suffixes and have no
+			// created timestamp.
+			sumSuffix, countSuffix := "_sum", "_count"
+			if metricType == dto.MetricType_GAUGE_HISTOGRAM {
+				sumSuffix, countSuffix = "_gsum", "_gcount"
+			}
+			n, err = writeOpenMetricsSample(
+				name+sumSuffix, metric, "", "",
+				formatOpenMetricsFloat(metric.Histogram.GetSampleSum()),
+				nil,
+				out,
+			)
+			if err != nil {
+				return written + n, err
+			}
+			written += n
+			n, err = writeOpenMetricsSample(
+				name+countSuffix, metric, "", "",
+				strconv.FormatUint(metric.Histogram.GetSampleCount(), 10),
+				nil,
+				out,
+			)
+			if metricType == dto.MetricType_HISTOGRAM {
+				if err != nil {
+					return written + n, err
+				}
+				written += n
+				n, err = writeOpenMetricsCreated(
+					name, metric, metric.Histogram.CreatedTimestamp, out,
+				)
+			}
+		default:
+			return written, fmt.Errorf(
+				"unexpected type in metric %s", metric,
+			)
+		}
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// FinalizeOpenMetrics writes the final "# EOF" line required by the OpenMetrics
+// format. It returns the number of bytes written and any error encountered.
+func FinalizeOpenMetrics(out io.Writer) (int, error) {
+	return fmt.Fprint(out, "# EOF\n")
+}
+
+// writeOpenMetricsSample writes a single sample in the OpenMetrics format to
+// out. It works like writeSample, but takes the value already formatted and
+// writes the provided exemplar (if not nil) after the value.
+func writeOpenMetricsSample(
+	name string,
+	metric *dto.Metric,
+	additionalLabelName, additionalLabelValue string,
+	value string,
+	exemplar *dto.Exemplar,
+	out io.Writer,
+) (int, error) {
+	var written int
+	n, err := writeNameAndLabelPairs(
+		name, metric.Label,
+		additionalLabelName, additionalLabelValue,
+		out,
+	)
+	written += n
+	if err != nil {
+		return written, err
+	}
+	n, err = fmt.Fprint(out, " ", value)
+	written += n
+	if err != nil {
+		return written, err
+	}
+	if metric.TimestampMs != nil {
+		n, err = fmt.Fprint(out, " ", strconv.FormatFloat(float64(*metric.TimestampMs)/1000, 'f', -1, 64))
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	if exemplar != nil {
+		n, err = writeExemplar(exemplar, out)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	n, err = out.Write([]byte{'\n'})
+	written += n
+	if err != nil {
+		return written, err
+	}
+	return written, nil
+}
+
+// writeOpenMetricsCreated writes the "_created" sample for the provided
+// created timestamp to out. If the timestamp is nil, nothing is written.
+func writeOpenMetricsCreated(
+	name string,
+	metric *dto.Metric,
+	createdTs *timestamp.Timestamp,
+	out io.Writer,
+) (int, error) {
+	if createdTs == nil {
+		return 0, nil
+	}
+	return writeOpenMetricsSample(
+		name+"_created", metric, "", "",
+		formatOpenMetricsTimestamp(createdTs.GetSeconds(), createdTs.GetNanos()),
+		nil,
+		out,
+	)
+}
+
+// writeExemplar writes the provided exemplar in the OpenMetrics format to out,
+// including the leading " # ".
+func writeExemplar(e *dto.Exemplar, out io.Writer) (int, error) {
+	var written int
+	n, err := fmt.Fprint(out, " # ")
+	written += n
+	if err != nil {
+		return written, err
+	}
+	if len(e.Label) == 0 {
+		n, err = fmt.Fprint(out, "{}")
+	} else {
+		n, err = labelPairsToText(e.Label, "", "", out)
+	}
+	written += n
+	if err != nil {
+		return written, err
+	}
+	n, err = fmt.Fprint(out, " ", formatOpenMetricsFloat(e.GetValue()))
+	written += n
+	if err != nil {
+		return written, err
+	}
+	if ts := e.Timestamp; ts != nil {
+		n, err = fmt.Fprint(out, " ", formatOpenMetricsTimestamp(ts.GetSeconds(), ts.GetNanos()))
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// formatOpenMetricsFloat formats a float as required by the OpenMetrics
+// format, i.e. integral values get a ".0" appended to mark them as floats, and
+// the special values are rendered as "+Inf", "-Inf", and "NaN".
+func formatOpenMetricsFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, "e.") {
+		s += ".0"
+	}
+	return s
+}
+
+// formatOpenMetricsTimestamp formats a timestamp given as seconds and
+// nanoseconds as seconds with a fractional part.
+func formatOpenMetricsTimestamp(seconds int64, nanos int32) string {
+	return strconv.FormatFloat(float64(seconds)+float64(nanos)/1e9, 'f', -1, 64)
+}
@@ -0,0 +1,251 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package text
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCreateOpenMetrics(t *testing.T) {
+	var scenarios = []struct {
+		in  *dto.MetricFamily
+		out string
+	}{
+		// 0: Counter with _total suffix, exemplar, created timestamp, and
+		// label escaping.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("requests_total"),
+				Help: proto.String("Number of \"requests\".\nSecond line."),
+				Type: dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("path"),
+								Value: proto.String("with \"quotes\" and \\"),
+							},
+						},
+						Counter: &dto.Counter{
+							Value: proto.Float64(42),
+							Exemplar: &dto.Exemplar{
+								Label: []*dto.LabelPair{
+									&dto.LabelPair{
+										Name:  proto.String("trace_id"),
+										Value: proto.String("abc"),
+									},
+								},
+								Value:     proto.Float64(1.5),
+								Timestamp: &timestamp.Timestamp{Seconds: 1520879607, Nanos: 789000000},
+							},
+							CreatedTimestamp: &timestamp.Timestamp{Seconds: 1520870000},
+						},
+					},
+				},
+			},
+			out: `# HELP requests Number of \"requests\".\nSecond line.
+# TYPE requests counter
+requests_total{path="with \"quotes\" and \\"} 42.0 # {trace_id="abc"} 1.5 1520879607.789
+requests_created{path="with \"quotes\" and \\"} 1520870000
+`,
+		},
+		// 1: Gauge with unit, timestamp, and special values.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("temperature"),
+				Help: proto.String("Current temperature."),
+				Type: dto.MetricType_GAUGE.Enum(),
+				Unit: proto.String("celsius"),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Gauge:       &dto.Gauge{Value: proto.Float64(math.Inf(-1))},
+						TimestampMs: proto.Int64(1234567),
+					},
+					&dto.Metric{
+						Label: []*dto.LabelPair{
+							&dto.LabelPair{
+								Name:  proto.String("sensor"),
+								Value: proto.String("2"),
+							},
+						},
+						Gauge: &dto.Gauge{Value: proto.Float64(21.25)},
+					},
+				},
+			},
+			out: `# HELP temperature_celsius Current temperature.
+# TYPE temperature_celsius gauge
+# UNIT temperature_celsius celsius
+temperature_celsius -Inf 1234.567
+temperature_celsius{sensor="2"} 21.25
+`,
+		},
+		// 2: Untyped without help.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("untyped_name"),
+				Type: dto.MetricType_UNTYPED.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Untyped: &dto.Untyped{Value: proto.Float64(math.NaN())},
+					},
+				},
+			},
+			out: `# TYPE untyped_name unknown
+untyped_name NaN
+`,
+		},
+		// 3: Summary.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("rpc_duration_seconds"),
+				Help: proto.String("RPC latency."),
+				Type: dto.MetricType_SUMMARY.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Summary: &dto.Summary{
+							SampleCount: proto.Uint64(10),
+							SampleSum:   proto.Float64(3.5),
+							Quantile: []*dto.Quantile{
+								&dto.Quantile{
+									Quantile: proto.Float64(0.5),
+									Value:    proto.Float64(0.25),
+								},
+								&dto.Quantile{
+									Quantile: proto.Float64(1),
+									Value:    proto.Float64(1),
+								},
+							},
+						},
+					},
+				},
+			},
+			out: `# HELP rpc_duration_seconds RPC latency.
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 0.25
+rpc_duration_seconds{quantile="1.0"} 1.0
+rpc_duration_seconds_sum 3.5
+rpc_duration_seconds_count 10
+`,
+		},
+		// 4: Histogram with exemplar, created timestamp, and missing
+		// +Inf bucket.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("request_size_bytes"),
+				Help: proto.String("Request sizes."),
+				Type: dto.MetricType_HISTOGRAM.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Histogram: &dto.Histogram{
+							SampleCount: proto.Uint64(5),
+							SampleSum:   proto.Float64(2048),
+							Bucket: []*dto.Bucket{
+								&dto.Bucket{
+									UpperBound:      proto.Float64(100),
+									CumulativeCount: proto.Uint64(2),
+									Exemplar: &dto.Exemplar{
+										Value: proto.Float64(42),
+									},
+								},
+								&dto.Bucket{
+									UpperBound:      proto.Float64(1000),
+									CumulativeCount: proto.Uint64(4),
+								},
+							},
+							CreatedTimestamp: &timestamp.Timestamp{Seconds: 1520870000, Nanos: 500000000},
+						},
+					},
+				},
+			},
+			out: `# HELP request_size_bytes Request sizes.
+# TYPE request_size_bytes histogram
+request_size_bytes_bucket{le="100.0"} 2 # {} 42.0
+request_size_bytes_bucket{le="1000.0"} 4
+request_size_bytes_bucket{le="+Inf"} 5
+request_size_bytes_sum 2048.0
+request_size_bytes_count 5
+request_size_bytes_created 1520870000.5
+`,
+		},
+		// 5: Gauge histogram.
+		{
+			in: &dto.MetricFamily{
+				Name: proto.String("queued_job_size_bytes"),
+				Help: proto.String("Sizes of the queued jobs."),
+				Type: dto.MetricType_GAUGE_HISTOGRAM.Enum(),
+				Metric: []*dto.Metric{
+					&dto.Metric{
+						Histogram: &dto.Histogram{
+							SampleCount: proto.Uint64(3),
+							SampleSum:   proto.Float64(1e9),
+							Bucket: []*dto.Bucket{
+								&dto.Bucket{
+									UpperBound:      proto.Float64(1e6),
+									CumulativeCount: proto.Uint64(1),
+								},
+							},
+							CreatedTimestamp: &timestamp.Timestamp{Seconds: 1520870000},
+						},
+					},
+				},
+			},
+			out: `# HELP queued_job_size_bytes Sizes of the queued jobs.
+# TYPE queued_job_size_bytes gaugehistogram
+queued_job_size_bytes_bucket{le="1e+06"} 1
+queued_job_size_bytes_bucket{le="+Inf"} 3
+queued_job_size_bytes_gsum 1e+09
+queued_job_size_bytes_gcount 3
+`,
+		},
+	}
+
+	for i, scenario := range scenarios {
+		out := bytes.NewBuffer(make([]byte, 0, len(scenario.out)))
+		n, err := MetricFamilyToOpenMetrics(out, scenario.in)
+		if err != nil {
+			t.Errorf("%d. error: %s", i, err)
+			continue
+		}
+		if expected, got := len(scenario.out), n; expected != got {
+			t.Errorf(
+				"%d. expected %d bytes written, got %d",
+				i, expected, got,
+			)
+		}
+		if expected, got := scenario.out, out.String(); expected != got {
+			t.Errorf(
+				"%d. expected out=%q, got %q",
+				i, expected, got,
+			)
+		}
+	}
+}
+
+func TestFinalizeOpenMetrics(t *testing.T) {
+	var out bytes.Buffer
+	n, err := FinalizeOpenMetrics(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, got := "# EOF\n", out.String(); expected != got || n != len(expected) {
+		t.Errorf("expected out=%q, got %q (%d bytes)", expected, got, n)
+	}
+}
@@ -17,7 +17,7 @@ import (
 	"fmt"
 	"io"
 
-	"code.google.com/p/goprotobuf/proto"
+	"github.com/golang/protobuf/proto"
 	"github.com/matttproud/golang_protobuf_extensions/ext"
 
 	dto "github.com/prometheus/client_model/go"
@@ -39,5 +39,5 @@ func WriteProtoText(w io.Writer, p *dto.MetricFamily) (int, error) {
 // WriteProtoCompactText writes the MetricFamily to the writer in compact text
 // format and returns the number of bytes written and any error encountered.
 func WriteProtoCompactText(w io.Writer, p *dto.MetricFamily) (int, error) {
-	return fmt.Fprintf(w, "%s\n", p)
+	return fmt.Fprintf(w, "%s\n", proto.CompactTextString(p))
 }